@@ -0,0 +1,63 @@
+// Package adapter describes a chat platform in platform-neutral terms, so
+// that routes written against it (router.MessageRoute) run on any platform
+// Gadget has an adapter for. slackadapter adapts Slack, and mattermost
+// adapts Mattermost.
+package adapter
+
+import "errors"
+
+// ErrNotFound is returned when a user doesn't exist on the platform
+var ErrNotFound = errors.New("not found")
+
+// Message is a message addressed to the bot: one that mentions it, or a
+// direct message
+type Message struct {
+	Platform string // the adapter's Platform()
+	ID       string // the platform's ID for the message, e.g. its Slack timestamp
+	ThreadID string // the thread the message was posted in; empty outside of threads
+	Channel  string // the channel, or direct message channel, it was posted in
+	User     string // the platform's ID for the sender
+	Text     string // the message, without the mention of the bot
+	Direct   bool   // true for direct messages
+}
+
+// UserKey identifies the sender across platforms, as Gadget stores them in
+// the users table: their bare ID on Slack, where Gadget started, and
+// "<platform>:<ID>", e.g. "mattermost:abc123", elsewhere
+func (msg Message) UserKey() string {
+	if msg.Platform == "" || msg.Platform == "slack" {
+		return msg.User
+	}
+	return msg.Platform + ":" + msg.User
+}
+
+// User is a person on a chat platform
+type User struct {
+	ID          string
+	Name        string // username or handle
+	DisplayName string // the name to address them by; may be empty
+	Email       string // may be empty if the bot can't see it
+}
+
+// Adapter sends messages to, and looks people up on, a chat platform.
+// Implementations must be safe for concurrent use.
+type Adapter interface {
+	// Platform names the platform, e.g. "slack"
+	Platform() string
+	// BotUserID is the bot's own user ID on the platform
+	BotUserID() string
+	// Post posts text to channel, in the thread threadID unless it's empty,
+	// and returns the new message's ID
+	Post(channel, threadID, text string) (string, error)
+	// React adds the emoji reaction, e.g. "tada", to the message messageID
+	React(channel, messageID, emoji string) error
+	// User returns the user with id, or ErrNotFound
+	User(id string) (User, error)
+}
+
+// Reply posts text to the conversation msg came from: in its thread if it
+// was posted in one, and in the channel otherwise
+func Reply(a Adapter, msg Message, text string) error {
+	_, err := a.Post(msg.Channel, msg.ThreadID, text)
+	return err
+}
@@ -0,0 +1,47 @@
+package adapter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingAdapter records the messages posted through it
+type recordingAdapter struct {
+	posts []Message
+}
+
+func (a *recordingAdapter) Platform() string  { return "test" }
+func (a *recordingAdapter) BotUserID() string { return "bot" }
+
+func (a *recordingAdapter) Post(channel, threadID, text string) (string, error) {
+	a.posts = append(a.posts, Message{Channel: channel, ThreadID: threadID, Text: text})
+	return "posted", nil
+}
+
+func (a *recordingAdapter) React(channel, messageID, emoji string) error { return nil }
+
+func (a *recordingAdapter) User(id string) (User, error) { return User{}, ErrNotFound }
+
+func TestReply_InThread(t *testing.T) {
+	a := &recordingAdapter{}
+
+	require.NoError(t, Reply(a, Message{ID: "m2", ThreadID: "m1", Channel: "ch1"}, "hi"))
+
+	assert.Equal(t, []Message{{Channel: "ch1", ThreadID: "m1", Text: "hi"}}, a.posts)
+}
+
+func TestReply_OutsideThread(t *testing.T) {
+	a := &recordingAdapter{}
+
+	require.NoError(t, Reply(a, Message{ID: "m1", Channel: "ch1"}, "hi"))
+
+	assert.Equal(t, []Message{{Channel: "ch1", Text: "hi"}}, a.posts)
+}
+
+func TestMessage_UserKey(t *testing.T) {
+	assert.Equal(t, "U1", Message{Platform: "slack", User: "U1"}.UserKey())
+	assert.Equal(t, "U1", Message{User: "U1"}.UserKey())
+	assert.Equal(t, "mattermost:abc", Message{Platform: "mattermost", User: "abc"}.UserKey())
+}
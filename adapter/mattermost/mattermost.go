@@ -0,0 +1,239 @@
+// Package mattermost is the Mattermost implementation of adapter.Adapter.
+// It posts as a bot account through the Mattermost REST API (v4) and
+// receives messages from an outgoing webhook, which Mattermost sends when a
+// post starts with one of the webhook's trigger words, e.g. "@gadget".
+package mattermost
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gadget-bot/gadget/adapter"
+)
+
+// Platform is the name Mattermost messages carry in adapter.Message.Platform
+const Platform = "mattermost"
+
+// maxWebhookBody caps the size of an outgoing webhook request
+const maxWebhookBody = 1 << 20
+
+// Options configures an Adapter
+type Options struct {
+	URL          string       // the server's base URL, e.g. "https://chat.example.com"
+	Token        string       // the bot account's access token
+	WebhookToken string       // the outgoing webhook's token; Handler rejects requests without it
+	HTTPClient   *http.Client // optional; nil uses a client with a 10 second timeout
+}
+
+// Adapter talks to a Mattermost server as a bot account
+type Adapter struct {
+	baseURL      string
+	token        string
+	webhookToken string
+	httpClient   *http.Client
+	botUserID    string
+}
+
+// apiError is the body of a failed API call
+type apiError struct {
+	ID         string `json:"id"`
+	Message    string `json:"message"`
+	StatusCode int    `json:"status_code"`
+}
+
+// apiUser is a user as the API returns it
+type apiUser struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Nickname  string `json:"nickname"`
+	Email     string `json:"email"`
+}
+
+// New returns an Adapter for the server at opts.URL, looking up the bot's
+// own user ID with opts.Token
+func New(opts Options) (*Adapter, error) {
+	if opts.URL == "" || opts.Token == "" {
+		return nil, errors.New("mattermost: URL and Token are required")
+	}
+	a := &Adapter{
+		baseURL:      strings.TrimSuffix(opts.URL, "/"),
+		token:        opts.Token,
+		webhookToken: opts.WebhookToken,
+		httpClient:   opts.HTTPClient,
+	}
+	if a.httpClient == nil {
+		a.httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	var me apiUser
+	if err := a.call(http.MethodGet, "/users/me", nil, &me); err != nil {
+		return nil, fmt.Errorf("mattermost: look up bot user: %w", err)
+	}
+	a.botUserID = me.ID
+	return a, nil
+}
+
+// Platform returns "mattermost"
+func (a *Adapter) Platform() string {
+	return Platform
+}
+
+// BotUserID returns the bot account's user ID
+func (a *Adapter) BotUserID() string {
+	return a.botUserID
+}
+
+// Post posts text to channel, as a reply to the thread rooted at threadID
+// unless it's empty, and returns the new post's ID
+func (a *Adapter) Post(channel, threadID, text string) (string, error) {
+	var post struct {
+		ID string `json:"id"`
+	}
+	err := a.call(http.MethodPost, "/posts", map[string]string{
+		"channel_id": channel,
+		"root_id":    threadID,
+		"message":    text,
+	}, &post)
+	return post.ID, err
+}
+
+// React adds the emoji reaction to the post messageID. Mattermost doesn't
+// need the channel.
+func (a *Adapter) React(channel, messageID, emoji string) error {
+	return a.call(http.MethodPost, "/reactions", map[string]string{
+		"user_id":    a.botUserID,
+		"post_id":    messageID,
+		"emoji_name": strings.Trim(emoji, ":"),
+	}, nil)
+}
+
+// User looks up the Mattermost user with id
+func (a *Adapter) User(id string) (adapter.User, error) {
+	var u apiUser
+	if err := a.call(http.MethodGet, "/users/"+url.PathEscape(id), nil, &u); err != nil {
+		return adapter.User{}, err
+	}
+	displayName := u.Nickname
+	if displayName == "" {
+		displayName = strings.TrimSpace(u.FirstName + " " + u.LastName)
+	}
+	return adapter.User{ID: u.ID, Name: u.Username, DisplayName: displayName, Email: u.Email}, nil
+}
+
+// call makes an API request with body encoded as JSON, and decodes the
+// response into out unless it's nil. A 404 is returned as adapter.ErrNotFound.
+func (a *Adapter) call(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, a.baseURL+"/api/v4"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return adapter.ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr apiError
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("mattermost: %s %s: %s (%s)", method, path, apiErr.Message, apiErr.ID)
+		}
+		return fmt.Errorf("mattermost: %s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// webhookPayload is what an outgoing webhook sends
+type webhookPayload struct {
+	Token       string `json:"token"`
+	ChannelID   string `json:"channel_id"`
+	UserID      string `json:"user_id"`
+	PostID      string `json:"post_id"`
+	Text        string `json:"text"`
+	TriggerWord string `json:"trigger_word"`
+}
+
+// Handler receives an outgoing webhook's requests and calls dispatch with
+// each message, without the trigger word. Requests whose token doesn't
+// match Options.WebhookToken are rejected, and the bot's own posts are
+// ignored. dispatch should return quickly; Mattermost waits for the
+// response.
+func (a *Adapter) Handler(dispatch func(adapter.Message)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxWebhookBody)
+		payload, err := parseWebhook(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if a.webhookToken == "" || subtle.ConstantTimeCompare([]byte(payload.Token), []byte(a.webhookToken)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if payload.UserID != a.botUserID {
+			dispatch(adapter.Message{
+				Platform: Platform,
+				ID:       payload.PostID,
+				Channel:  payload.ChannelID,
+				User:     payload.UserID,
+				Text:     strings.TrimSpace(strings.TrimPrefix(payload.Text, payload.TriggerWord)),
+			})
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// parseWebhook reads an outgoing webhook request, which Mattermost sends as
+// JSON or as a form depending on the webhook's content type
+func parseWebhook(r *http.Request) (webhookPayload, error) {
+	var payload webhookPayload
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		return payload, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return payload, err
+	}
+	return webhookPayload{
+		Token:       r.PostForm.Get("token"),
+		ChannelID:   r.PostForm.Get("channel_id"),
+		UserID:      r.PostForm.Get("user_id"),
+		PostID:      r.PostForm.Get("post_id"),
+		Text:        r.PostForm.Get("text"),
+		TriggerWord: r.PostForm.Get("trigger_word"),
+	}, nil
+}
@@ -0,0 +1,193 @@
+package mattermost
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/gadget-bot/gadget/gadgettest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAdapter(t *testing.T) (*Adapter, *gadgettest.FakeMattermost) {
+	t.Helper()
+	fake := gadgettest.NewFakeMattermost(t)
+	a, err := New(Options{URL: fake.URL(), Token: gadgettest.MattermostToken, WebhookToken: "hook-token"})
+	require.NoError(t, err)
+	return a, fake
+}
+
+func TestNew_LooksUpBotUser(t *testing.T) {
+	a, _ := newTestAdapter(t)
+
+	var _ adapter.Adapter = a
+	assert.Equal(t, "mattermost", a.Platform())
+	assert.Equal(t, gadgettest.MattermostBotUserID, a.BotUserID())
+}
+
+func TestNew_BadToken(t *testing.T) {
+	fake := gadgettest.NewFakeMattermost(t)
+
+	_, err := New(Options{URL: fake.URL(), Token: "wrong"})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid or expired session")
+}
+
+func TestNew_RequiresURLAndToken(t *testing.T) {
+	_, err := New(Options{URL: "https://chat.example.com"})
+	assert.Error(t, err)
+}
+
+func TestAdapter_Post(t *testing.T) {
+	a, fake := newTestAdapter(t)
+
+	id, err := a.Post("ch1", "", "hello")
+	require.NoError(t, err)
+
+	posts := fake.Posts("ch1")
+	require.Len(t, posts, 1)
+	assert.Equal(t, id, posts[0].ID)
+	assert.Empty(t, posts[0].RootID)
+	fake.AssertPosted(t, "ch1", "hello")
+}
+
+func TestAdapter_PostInThread(t *testing.T) {
+	a, fake := newTestAdapter(t)
+	root := fake.AddPost("ch1", "u1", "question")
+
+	_, err := a.Post("ch1", root, "answer")
+	require.NoError(t, err)
+
+	posts := fake.Posts("ch1")
+	require.Len(t, posts, 2)
+	assert.Equal(t, root, posts[1].RootID)
+}
+
+func TestAdapter_React(t *testing.T) {
+	a, fake := newTestAdapter(t)
+	id := fake.AddPost("ch1", "u1", "ship it")
+
+	require.NoError(t, a.React("ch1", id, ":tada:"))
+
+	fake.AssertReacted(t, id, "tada")
+}
+
+func TestAdapter_ReactToMissingPost(t *testing.T) {
+	a, _ := newTestAdapter(t)
+
+	assert.ErrorIs(t, a.React("ch1", "nope", "tada"), adapter.ErrNotFound)
+}
+
+func TestAdapter_User(t *testing.T) {
+	a, fake := newTestAdapter(t)
+	fake.AddUser(gadgettest.MattermostUser{ID: "u1", Username: "alice", FirstName: "Alice", LastName: "Smith", Email: "alice@example.com"})
+
+	u, err := a.User("u1")
+	require.NoError(t, err)
+
+	assert.Equal(t, adapter.User{ID: "u1", Name: "alice", DisplayName: "Alice Smith", Email: "alice@example.com"}, u)
+}
+
+func TestAdapter_UserPrefersNickname(t *testing.T) {
+	a, fake := newTestAdapter(t)
+	fake.AddUser(gadgettest.MattermostUser{ID: "u1", Username: "alice", FirstName: "Alice", Nickname: "Al"})
+
+	u, err := a.User("u1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Al", u.DisplayName)
+}
+
+func TestAdapter_UserNotFound(t *testing.T) {
+	a, _ := newTestAdapter(t)
+
+	_, err := a.User("nobody")
+
+	assert.ErrorIs(t, err, adapter.ErrNotFound)
+}
+
+// serveWebhook sends an outgoing webhook request to a's Handler and returns
+// the response and the messages it dispatched
+func serveWebhook(a *Adapter, req *http.Request) (*httptest.ResponseRecorder, []adapter.Message) {
+	var messages []adapter.Message
+	rec := httptest.NewRecorder()
+	a.Handler(func(msg adapter.Message) {
+		messages = append(messages, msg)
+	}).ServeHTTP(rec, req)
+	return rec, messages
+}
+
+func TestHandler_JSON(t *testing.T) {
+	a, _ := newTestAdapter(t)
+	req := httptest.NewRequest(http.MethodPost, "/gadget/mattermost", strings.NewReader(
+		`{"token":"hook-token","channel_id":"ch1","user_id":"u1","post_id":"p1","text":"@gadget  ping","trigger_word":"@gadget"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec, messages := serveWebhook(a, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []adapter.Message{{Platform: "mattermost", ID: "p1", Channel: "ch1", User: "u1", Text: "ping"}}, messages)
+}
+
+func TestHandler_Form(t *testing.T) {
+	a, _ := newTestAdapter(t)
+	form := url.Values{"token": {"hook-token"}, "channel_id": {"ch1"}, "user_id": {"u1"}, "post_id": {"p1"}, "text": {"@gadget ping"}, "trigger_word": {"@gadget"}}
+	req := httptest.NewRequest(http.MethodPost, "/gadget/mattermost", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec, messages := serveWebhook(a, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "ping", messages[0].Text)
+}
+
+func TestHandler_RejectsWrongToken(t *testing.T) {
+	a, _ := newTestAdapter(t)
+	req := httptest.NewRequest(http.MethodPost, "/gadget/mattermost", strings.NewReader(`{"token":"wrong","user_id":"u1","text":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec, messages := serveWebhook(a, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, messages)
+}
+
+func TestHandler_RejectsAllWithoutWebhookToken(t *testing.T) {
+	fake := gadgettest.NewFakeMattermost(t)
+	a, err := New(Options{URL: fake.URL(), Token: gadgettest.MattermostToken})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/gadget/mattermost", strings.NewReader(`{"token":"","user_id":"u1","text":"ping"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec, messages := serveWebhook(a, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, messages)
+}
+
+func TestHandler_IgnoresBotPosts(t *testing.T) {
+	a, _ := newTestAdapter(t)
+	req := httptest.NewRequest(http.MethodPost, "/gadget/mattermost", strings.NewReader(
+		`{"token":"hook-token","user_id":"`+gadgettest.MattermostBotUserID+`","text":"@gadget ping","trigger_word":"@gadget"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec, messages := serveWebhook(a, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, messages)
+}
+
+func TestHandler_RejectsGet(t *testing.T) {
+	a, _ := newTestAdapter(t)
+
+	rec, messages := serveWebhook(a, httptest.NewRequest(http.MethodGet, "/gadget/mattermost", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Empty(t, messages)
+}
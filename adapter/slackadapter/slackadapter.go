@@ -0,0 +1,92 @@
+// Package slackadapter is the Slack implementation of adapter.Adapter
+package slackadapter
+
+import (
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// Platform is the name Slack messages carry in adapter.Message.Platform
+const Platform = "slack"
+
+// Adapter talks to Slack with a bot client
+type Adapter struct {
+	client    *slack.Client
+	botUserID string
+}
+
+// New returns an Adapter that calls Slack with client, a bot client whose
+// user ID is botUserID
+func New(client *slack.Client, botUserID string) *Adapter {
+	return &Adapter{client: client, botUserID: botUserID}
+}
+
+// Platform returns "slack"
+func (a *Adapter) Platform() string {
+	return Platform
+}
+
+// BotUserID returns the bot's Slack user ID
+func (a *Adapter) BotUserID() string {
+	return a.botUserID
+}
+
+// Post posts text to channel, in the thread threadID unless it's empty, and
+// returns the new message's timestamp
+func (a *Adapter) Post(channel, threadID, text string) (string, error) {
+	opts := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if threadID != "" {
+		opts = append(opts, slack.MsgOptionTS(threadID))
+	}
+	_, ts, err := a.client.PostMessage(channel, opts...)
+	return ts, err
+}
+
+// React adds the emoji reaction to the message with timestamp messageID
+func (a *Adapter) React(channel, messageID, emoji string) error {
+	return a.client.AddReaction(emoji, slack.NewRefToMessage(channel, messageID))
+}
+
+// User looks up the Slack user with id
+func (a *Adapter) User(id string) (adapter.User, error) {
+	u, err := a.client.GetUserInfo(id)
+	if err != nil {
+		if err.Error() == "user_not_found" {
+			return adapter.User{}, adapter.ErrNotFound
+		}
+		return adapter.User{}, err
+	}
+	displayName := u.Profile.DisplayName
+	if displayName == "" {
+		displayName = u.Profile.RealName
+	}
+	return adapter.User{ID: u.ID, Name: u.Name, DisplayName: displayName, Email: u.Profile.Email}, nil
+}
+
+// FromMention converts an app mention to a Message. text is the mention's
+// text without the mention of the bot.
+func FromMention(ev slackevents.AppMentionEvent, text string) adapter.Message {
+	return adapter.Message{
+		Platform: Platform,
+		ID:       ev.TimeStamp,
+		ThreadID: ev.ThreadTimeStamp,
+		Channel:  ev.Channel,
+		User:     ev.User,
+		Text:     text,
+	}
+}
+
+// FromMessage converts a message event to a Message. text is the message's
+// text without any mention of the bot.
+func FromMessage(ev slackevents.MessageEvent, text string) adapter.Message {
+	return adapter.Message{
+		Platform: Platform,
+		ID:       ev.TimeStamp,
+		ThreadID: ev.ThreadTimeStamp,
+		Channel:  ev.Channel,
+		User:     ev.User,
+		Text:     text,
+		Direct:   ev.ChannelType == "im",
+	}
+}
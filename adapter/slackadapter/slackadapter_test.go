@@ -0,0 +1,147 @@
+package slackadapter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// apiCall is a Slack API call the test server received
+type apiCall struct {
+	method string
+	params url.Values
+}
+
+// newTestAdapter returns an Adapter whose Slack calls are answered by
+// respond, and the calls it makes
+func newTestAdapter(t *testing.T, respond func(method string, params url.Values) map[string]interface{}) (*Adapter, func() []apiCall) {
+	t.Helper()
+	var mu sync.Mutex
+	var calls []apiCall
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		method := strings.TrimPrefix(r.URL.Path, "/")
+		mu.Lock()
+		calls = append(calls, apiCall{method: method, params: r.Form})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(respond(method, r.Form))
+	}))
+	t.Cleanup(server.Close)
+
+	client := slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/"))
+	return New(client, "U_BOT"), func() []apiCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]apiCall(nil), calls...)
+	}
+}
+
+func okResponse(method string, params url.Values) map[string]interface{} {
+	return map[string]interface{}{"ok": true, "channel": params.Get("channel"), "ts": "1600000000.000002"}
+}
+
+func TestAdapter_Identity(t *testing.T) {
+	a, _ := newTestAdapter(t, okResponse)
+
+	var _ adapter.Adapter = a
+	assert.Equal(t, "slack", a.Platform())
+	assert.Equal(t, "U_BOT", a.BotUserID())
+}
+
+func TestAdapter_Post(t *testing.T) {
+	a, calls := newTestAdapter(t, okResponse)
+
+	id, err := a.Post("C1", "", "hello")
+	require.NoError(t, err)
+
+	assert.Equal(t, "1600000000.000002", id)
+	require.Len(t, calls(), 1)
+	assert.Equal(t, "chat.postMessage", calls()[0].method)
+	assert.Equal(t, "C1", calls()[0].params.Get("channel"))
+	assert.Equal(t, "hello", calls()[0].params.Get("text"))
+	assert.Empty(t, calls()[0].params.Get("thread_ts"))
+}
+
+func TestAdapter_PostInThread(t *testing.T) {
+	a, calls := newTestAdapter(t, okResponse)
+
+	_, err := a.Post("C1", "1600000000.000001", "hello")
+	require.NoError(t, err)
+
+	assert.Equal(t, "1600000000.000001", calls()[0].params.Get("thread_ts"))
+}
+
+func TestAdapter_React(t *testing.T) {
+	a, calls := newTestAdapter(t, okResponse)
+
+	require.NoError(t, a.React("C1", "1600000000.000001", "tada"))
+
+	require.Len(t, calls(), 1)
+	assert.Equal(t, "reactions.add", calls()[0].method)
+	assert.Equal(t, "tada", calls()[0].params.Get("name"))
+	assert.Equal(t, "C1", calls()[0].params.Get("channel"))
+	assert.Equal(t, "1600000000.000001", calls()[0].params.Get("timestamp"))
+}
+
+func TestAdapter_User(t *testing.T) {
+	a, _ := newTestAdapter(t, func(method string, params url.Values) map[string]interface{} {
+		return map[string]interface{}{"ok": true, "user": map[string]interface{}{
+			"id":      params.Get("user"),
+			"name":    "alice",
+			"profile": map[string]string{"real_name": "Alice Smith", "email": "alice@example.com"},
+		}}
+	})
+
+	u, err := a.User("U1")
+	require.NoError(t, err)
+
+	assert.Equal(t, adapter.User{ID: "U1", Name: "alice", DisplayName: "Alice Smith", Email: "alice@example.com"}, u)
+}
+
+func TestAdapter_UserNotFound(t *testing.T) {
+	a, _ := newTestAdapter(t, func(method string, params url.Values) map[string]interface{} {
+		return map[string]interface{}{"ok": false, "error": "user_not_found"}
+	})
+
+	_, err := a.User("U404")
+
+	assert.ErrorIs(t, err, adapter.ErrNotFound)
+}
+
+func TestFromMention(t *testing.T) {
+	msg := FromMention(slackevents.AppMentionEvent{
+		User:            "U1",
+		Channel:         "C1",
+		TimeStamp:       "1600000000.000002",
+		ThreadTimeStamp: "1600000000.000001",
+		Text:            "<@U_BOT> ping",
+	}, "ping")
+
+	assert.Equal(t, adapter.Message{
+		Platform: "slack",
+		ID:       "1600000000.000002",
+		ThreadID: "1600000000.000001",
+		Channel:  "C1",
+		User:     "U1",
+		Text:     "ping",
+	}, msg)
+}
+
+func TestFromMessage_Direct(t *testing.T) {
+	msg := FromMessage(slackevents.MessageEvent{User: "U1", Channel: "D1", ChannelType: "im", Text: "ping"}, "ping")
+	assert.True(t, msg.Direct)
+
+	msg = FromMessage(slackevents.MessageEvent{User: "U1", Channel: "C1", ChannelType: "channel", Text: "ping"}, "ping")
+	assert.False(t, msg.Direct)
+}
@@ -0,0 +1,242 @@
+// Package console lets you talk to a Gadget bot from a terminal, without a
+// Slack workspace, a public URL or a MySQL database. Lines you type become
+// mentions, channel messages, direct messages and slash commands, which go
+// through the same dispatch path as events from Slack, and the Slack API
+// calls plugins make in reply are printed instead of sent.
+//
+// Type "@gadget ..." to mention the bot, "/command ..." to run a slash
+// command and anything else to post it to the current channel. Lines
+// starting with ":" control the console; ":help" lists them.
+package console
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gadget-bot/gadget/core"
+	"github.com/gadget-bot/gadget/directory"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	// BotUserID is the bot's user ID in the console
+	BotUserID = "U_BOT"
+	// BotID is the bot's bot ID in the console
+	BotID = "B_CONSOLE"
+	// TeamID is the console's workspace
+	TeamID = "T_CONSOLE"
+	// DefaultUser is who you are when the console starts. Setup makes them a
+	// global admin.
+	DefaultUser = "U_DEV"
+	// DefaultChannel is where you are when the console starts
+	DefaultChannel = "C_DEV"
+)
+
+// mention starts a line that mentions the bot
+const mention = "@gadget"
+
+const help = `Type "@gadget ..." to mention the bot, "/command ..." to run a slash
+command, or anything else to post it to the current channel.
+
+  :user <id>               act as another user
+  :channel <id>            move to another channel
+  :dm                      talk to the bot in a direct message
+  :click <action_id>       click the latest button with action_id here
+  :help                    show this help
+  :quit                    leave the console`
+
+// Console feeds what you type to a Gadget
+type Console struct {
+	gadget *core.Gadget
+	api    *slackAPI
+	out    io.Writer
+
+	user    string
+	channel string
+}
+
+// consoleDBs numbers in-memory databases so each console gets its own
+var consoleDBs atomic.Int64
+
+// Setup creates a Gadget for the console, like core.SetupWithConfig but
+// with an in-memory SQLite database instead of MySQL. DefaultUser is added
+// to cfg.GlobalAdmins. SQLite needs cgo, so a binary built with
+// CGO_ENABLED=0 can't run the console.
+func Setup(cfg core.Config) (*core.Gadget, error) {
+	dsn := fmt.Sprintf("file:gadget-console%d?mode=memory&cache=shared", consoleDBs.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("open console database: %w", err)
+	}
+	cfg.GlobalAdmins = append(cfg.GlobalAdmins, DefaultUser)
+	return core.NewWithDB(cfg, db)
+}
+
+// New attaches a console to gadget, replacing its Slack clients with ones
+// that print to out. Routes can still be added to gadget afterwards.
+func New(gadget *core.Gadget, out io.Writer) (*Console, error) {
+	api, err := newSlackAPI(out)
+	if err != nil {
+		return nil, err
+	}
+	gadget.Client = slack.New("xoxb-console", slack.OptionAPIURL(api.URL()))
+	gadget.UserClient = slack.New("xoxp-console", slack.OptionAPIURL(api.URL()))
+	gadget.Directory = directory.New(gadget.Client, directory.Options{})
+	gadget.Identity = router.NewIdentity(router.BotIdentity{UserID: BotUserID, BotID: BotID, TeamID: TeamID, Team: "console"})
+	gadget.Router.Identity = gadget.Identity
+	gadget.Router.BotUID = BotUserID
+	return &Console{gadget: gadget, api: api, out: out, user: DefaultUser, channel: DefaultChannel}, nil
+}
+
+// Close stops the console's fake Slack API
+func (c *Console) Close() error {
+	return c.api.Close()
+}
+
+// Run reads lines from in until it ends or you type ":quit", running the
+// bot's scheduled jobs in the meantime
+func (c *Console) Run(in io.Reader) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.gadget.RunScheduler(ctx)
+
+	c.api.printf("Talking to the bot as %s in %s. Type :help for help.", c.user, c.channel)
+	scanner := bufio.NewScanner(in)
+	for {
+		c.prompt()
+		if !scanner.Scan() || !c.Handle(scanner.Text()) {
+			c.api.printf("")
+			return scanner.Err()
+		}
+	}
+}
+
+func (c *Console) prompt() {
+	c.api.mu.Lock()
+	defer c.api.mu.Unlock()
+	_, _ = fmt.Fprintf(c.out, "%s in %s> ", c.user, c.channel)
+}
+
+// Handle acts on a line you typed and waits for the plugins it ran to
+// finish. It returns false if the line was ":quit".
+func (c *Console) Handle(line string) bool {
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "":
+	case strings.HasPrefix(line, ":"):
+		return c.control(strings.Fields(strings.TrimPrefix(line, ":")))
+	case strings.HasPrefix(line, "/"):
+		command, text, _ := strings.Cut(line, " ")
+		response := c.gadget.DispatchCommand(slack.SlashCommand{
+			Command:   command,
+			Text:      strings.TrimSpace(text),
+			UserID:    c.user,
+			UserName:  strings.ToLower(c.user),
+			ChannelID: c.channel,
+			TeamID:    TeamID,
+			TriggerID: c.nextTS(),
+		})
+		if response != "" {
+			c.api.printf("%s", render("["+c.channel+"] gadget (only "+c.user+"): ", response))
+		}
+	case strings.HasPrefix(c.channel, "D"):
+		c.gadget.DispatchEvent(c.message(line, "im"))
+	case strings.HasPrefix(line, mention):
+		text := "<@" + BotUserID + "> " + strings.TrimSpace(strings.TrimPrefix(line, mention))
+		ts := c.nextTS()
+		c.gadget.DispatchEvent(slackevents.EventsAPIInnerEvent{
+			Type: string(slackevents.AppMention),
+			Data: &slackevents.AppMentionEvent{
+				Type:      string(slackevents.AppMention),
+				User:      c.user,
+				Text:      text,
+				TimeStamp: ts,
+				Channel:   c.channel,
+			},
+		})
+	default:
+		c.gadget.DispatchEvent(c.message(line, "channel"))
+	}
+	c.gadget.Wait()
+	return true
+}
+
+// message is you posting text in the current channel
+func (c *Console) message(text, channelType string) slackevents.EventsAPIInnerEvent {
+	return slackevents.EventsAPIInnerEvent{
+		Type: string(slackevents.Message),
+		Data: &slackevents.MessageEvent{
+			Type:        string(slackevents.Message),
+			User:        c.user,
+			Text:        text,
+			TimeStamp:   c.nextTS(),
+			Channel:     c.channel,
+			ChannelType: channelType,
+		},
+	}
+}
+
+// control runs a console command and returns false for ":quit"
+func (c *Console) control(args []string) bool {
+	if len(args) == 0 {
+		args = []string{"help"}
+	}
+	switch {
+	case args[0] == "quit" || args[0] == "exit":
+		return false
+	case args[0] == "user" && len(args) == 2:
+		c.user = args[1]
+	case args[0] == "channel" && len(args) == 2:
+		c.channel = strings.TrimPrefix(args[1], "#")
+	case args[0] == "dm":
+		c.channel = dmChannel(c.user)
+	case args[0] == "click" && len(args) == 2:
+		c.click(args[1])
+	default:
+		c.api.printf("%s", help)
+	}
+	return true
+}
+
+// click clicks the latest button with actionID in the current channel
+func (c *Console) click(actionID string) {
+	b, found := c.api.button(c.channel, actionID)
+	if !found {
+		c.api.printf("There's no %s button in %s.", actionID, c.channel)
+		return
+	}
+	var callback slack.InteractionCallback
+	callback.Type = slack.InteractionTypeBlockActions
+	callback.Team.ID = TeamID
+	callback.User.ID = c.user
+	callback.Channel.ID = c.channel
+	callback.Container.Type = "message"
+	callback.Container.ChannelID = c.channel
+	callback.Container.MessageTs = b.MessageTS
+	callback.Message.Timestamp = b.MessageTS
+	callback.TriggerID = c.nextTS()
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{
+		ActionID: actionID,
+		Type:     slack.ActionType("button"),
+		Value:    b.Value,
+		ActionTs: c.nextTS(),
+	}}
+	c.gadget.DispatchInteraction(callback)
+	c.gadget.Wait()
+}
+
+// nextTS returns a new timestamp for something you did
+func (c *Console) nextTS() string {
+	return c.api.nextTS()
+}
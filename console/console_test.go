@@ -0,0 +1,135 @@
+package console
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gadget-bot/gadget/core"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newConsole(t *testing.T) (*Console, *core.Gadget, *bytes.Buffer) {
+	t.Helper()
+	g, err := Setup(core.Config{})
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	c, err := New(g, out)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c, g, out
+}
+
+func TestConsole_MentionUsesFallback(t *testing.T) {
+	c, _, out := newConsole(t)
+
+	c.Handle("@gadget make me a sandwich")
+
+	assert.Contains(t, out.String(), "[C_DEV] gadget: Hi there! I see you sent me a message, <@U_DEV>")
+}
+
+func TestConsole_DefaultUserIsGlobalAdmin(t *testing.T) {
+	c, _, out := newConsole(t)
+
+	c.Handle("@gadget add <@U2> to deployers")
+
+	assert.Contains(t, out.String(), "[C_DEV] gadget reacted :tada:")
+	assert.Contains(t, out.String(), "[C_DEV] gadget: I successfully added <@U2> to deployers!")
+}
+
+func TestConsole_SwitchUser(t *testing.T) {
+	c, _, out := newConsole(t)
+
+	c.Handle(":user U2")
+	c.Handle("@gadget add <@U2> to admins")
+
+	assert.Contains(t, out.String(), "I'm sorry, <@U2>, but you're not allowed to do that.")
+}
+
+func TestConsole_ChannelAndDirectMessages(t *testing.T) {
+	c, g, _ := newConsole(t)
+	got := make(chan slackevents.MessageEvent, 2)
+	var route router.ChannelMessageRoute
+	route.Name = "echo"
+	route.Pattern = `(?i)^ping$`
+	route.Plugin = func(ctx router.HandlerContext, ev slackevents.MessageEvent, message string) {
+		got <- ev
+	}
+	g.Router.AddChannelMessageRoute(route)
+
+	c.Handle(":channel #ops")
+	c.Handle("ping")
+	c.Handle(":dm")
+	c.Handle("ping")
+
+	require.Len(t, got, 2)
+	ev := <-got
+	assert.Equal(t, "ops", ev.Channel)
+	assert.Equal(t, "channel", ev.ChannelType)
+	ev = <-got
+	assert.Equal(t, "D_U_DEV", ev.Channel)
+	assert.Equal(t, "im", ev.ChannelType)
+}
+
+func TestConsole_SlashCommand(t *testing.T) {
+	c, g, out := newConsole(t)
+	var route router.SlashCommandRoute
+	route.Name = "deploy"
+	route.Command = "/deploy"
+	route.ImmediateResponse = func() string { return "On it." }
+	route.Plugin = func(ctx router.HandlerContext, cmd slack.SlashCommand) {
+		_ = ctx.Reply("Deploying " + cmd.Text)
+	}
+	g.Router.AddSlashCommandRoute(route)
+
+	c.Handle("/deploy api")
+	c.Handle("/nope")
+
+	assert.Contains(t, out.String(), "[C_DEV] gadget (only U_DEV): On it.")
+	assert.Contains(t, out.String(), "[C_DEV] gadget: Deploying api")
+	assert.Contains(t, out.String(), "[C_DEV] gadget (only U_DEV): Unknown command.")
+}
+
+func TestConsole_ClickButton(t *testing.T) {
+	c, g, out := newConsole(t)
+	var ask router.MentionRoute
+	ask.Name = "ask"
+	ask.Pattern = `(?i)^ask$`
+	ask.Plugin = func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+		_ = ctx.Reply("", slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "Ship it?", false, false), nil, nil),
+			slack.NewActionBlock("", slack.NewButtonBlockElement("approve", "release-42", slack.NewTextBlockObject(slack.PlainTextType, "Approve", false, false))),
+		))
+	}
+	var approve router.BlockActionRoute
+	approve.Name = "approve"
+	approve.ActionID = "approve"
+	approve.Plugin = func(ctx router.HandlerContext, callback slack.InteractionCallback, action slack.BlockAction) {
+		_ = ctx.Reply("Approved " + action.Value + " by <@" + callback.User.ID + ">")
+	}
+	g.Router.AddMentionRoute(ask)
+	g.Router.AddBlockActionRoute(approve)
+
+	c.Handle(":click approve")
+	c.Handle("@gadget ask")
+	c.Handle(":click approve")
+
+	assert.Contains(t, out.String(), "There's no approve button in C_DEV.")
+	assert.Contains(t, out.String(), "[Approve] (approve)")
+	assert.Contains(t, out.String(), "gadget: Approved release-42 by <@U_DEV>")
+}
+
+func TestConsole_Run(t *testing.T) {
+	c, _, out := newConsole(t)
+
+	err := c.Run(strings.NewReader(":help\n:quit\n@gadget never read\n"))
+
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "U_DEV in C_DEV> ")
+	assert.Contains(t, out.String(), ":click <action_id>")
+	assert.NotContains(t, out.String(), "Hi there!")
+}
@@ -0,0 +1,280 @@
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// slackAPI stands in for the Slack Web API. Instead of calling Slack, the
+// bot's API calls print what they would have done.
+type slackAPI struct {
+	server   *http.Server
+	listener net.Listener
+
+	mu      sync.Mutex
+	out     io.Writer
+	lastTS  int
+	buttons map[string]map[string]button // channel -> action ID -> the latest button with it
+}
+
+// button is a button the bot posted, for the console's user to click
+type button struct {
+	MessageTS string
+	Value     string
+}
+
+// newSlackAPI starts serving the API on a local port
+func newSlackAPI(out io.Writer) (*slackAPI, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	api := &slackAPI{listener: listener, out: out, buttons: map[string]map[string]button{}}
+	api.server = &http.Server{Handler: http.HandlerFunc(api.serveHTTP), ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = api.server.Serve(listener) }()
+	return api, nil
+}
+
+// URL returns the API's base URL, ending in "/"
+func (api *slackAPI) URL() string {
+	return "http://" + api.listener.Addr().String() + "/"
+}
+
+func (api *slackAPI) Close() error {
+	return api.server.Close()
+}
+
+// printf writes a line of output for the console's user
+func (api *slackAPI) printf(format string, args ...interface{}) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	_, _ = fmt.Fprintf(api.out, format+"\n", args...)
+}
+
+// remember records the buttons in blocks, posted in channel at ts
+func (api *slackAPI) remember(channel, ts, blocks string) {
+	var decoded interface{}
+	if blocks == "" || json.Unmarshal([]byte(blocks), &decoded) != nil {
+		return
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.buttons[channel] == nil {
+		api.buttons[channel] = map[string]button{}
+	}
+	for actionID, value := range blockButtons(decoded) {
+		api.buttons[channel][actionID] = button{MessageTS: ts, Value: value}
+	}
+}
+
+// button returns the latest button with actionID posted in channel
+func (api *slackAPI) button(channel, actionID string) (button, bool) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	b, ok := api.buttons[channel][actionID]
+	return b, ok
+}
+
+// nextTS returns a new message timestamp
+func (api *slackAPI) nextTS() string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.lastTS++
+	return fmt.Sprintf("%d.%06d", time.Now().Unix(), api.lastTS)
+}
+
+func (api *slackAPI) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/")
+	params, err := requestParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(api.handle(method, params))
+}
+
+// requestParams returns the parameters of an API call, sent either as a form
+// or as a JSON body
+func requestParams(r *http.Request) (url.Values, error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		return r.Form, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	for key, raw := range fields {
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil {
+			params.Set(key, text)
+			continue
+		}
+		params.Set(key, string(raw))
+	}
+	return params, nil
+}
+
+func ok(fields map[string]interface{}) map[string]interface{} {
+	fields["ok"] = true
+	return fields
+}
+
+func (api *slackAPI) handle(method string, p url.Values) map[string]interface{} {
+	channel := p.Get("channel")
+	switch method {
+	case "auth.test":
+		return ok(map[string]interface{}{"user_id": BotUserID, "bot_id": BotID, "team_id": TeamID, "user": "gadget"})
+	case "chat.postMessage":
+		ts := api.nextTS()
+		where := channel
+		if p.Get("thread_ts") != "" {
+			where += " thread " + p.Get("thread_ts")
+		}
+		api.printf("%s", render("["+where+"] gadget: ", messageText(p.Get("text"), p.Get("blocks"))))
+		api.remember(channel, ts, p.Get("blocks"))
+		return ok(map[string]interface{}{"channel": channel, "ts": ts, "message": map[string]string{"text": p.Get("text"), "ts": ts}})
+	case "chat.postEphemeral":
+		api.printf("%s", render("["+channel+"] gadget (only "+p.Get("user")+"): ", messageText(p.Get("text"), p.Get("blocks"))))
+		return ok(map[string]interface{}{"message_ts": api.nextTS()})
+	case "chat.update":
+		api.printf("%s", render("["+channel+"] gadget edited "+p.Get("ts")+": ", messageText(p.Get("text"), p.Get("blocks"))))
+		api.remember(channel, p.Get("ts"), p.Get("blocks"))
+		return ok(map[string]interface{}{"channel": channel, "ts": p.Get("ts"), "text": p.Get("text")})
+	case "chat.delete":
+		api.printf("[%s] gadget deleted %s", channel, p.Get("ts"))
+		return ok(map[string]interface{}{"channel": channel, "ts": p.Get("ts")})
+	case "reactions.add":
+		api.printf("[%s] gadget reacted :%s: to %s", channel, p.Get("name"), p.Get("timestamp"))
+		return ok(map[string]interface{}{})
+	case "reactions.remove":
+		api.printf("[%s] gadget removed :%s: from %s", channel, p.Get("name"), p.Get("timestamp"))
+		return ok(map[string]interface{}{})
+	case "users.info":
+		return ok(map[string]interface{}{"user": consoleUser(p.Get("user"))})
+	case "conversations.info":
+		return ok(map[string]interface{}{"channel": consoleChannel(channel)})
+	case "conversations.join":
+		return ok(map[string]interface{}{"channel": consoleChannel(channel)})
+	case "conversations.open":
+		return ok(map[string]interface{}{"channel": map[string]interface{}{"id": dmChannel(p.Get("users"))}})
+	case "views.open", "views.push", "views.update":
+		api.printf("%s", render("gadget opened a view: ", messageText("", p.Get("view"))))
+		return ok(map[string]interface{}{"view": map[string]string{"id": "V" + strings.ReplaceAll(api.nextTS(), ".", "")}})
+	}
+	api.printf("(gadget called %s, which the console doesn't simulate)", method)
+	return ok(map[string]interface{}{})
+}
+
+// consoleUser is the profile users.info returns for id
+func consoleUser(id string) map[string]interface{} {
+	name := strings.ToLower(id)
+	return map[string]interface{}{
+		"id":      id,
+		"name":    name,
+		"tz":      time.Local.String(),
+		"profile": map[string]string{"real_name": name, "display_name": name},
+	}
+}
+
+// consoleChannel is the channel conversations.info returns for id
+func consoleChannel(id string) map[string]interface{} {
+	return map[string]interface{}{"id": id, "name": strings.ToLower(id), "is_member": true}
+}
+
+// dmChannel is the ID of the direct message channel with users
+func dmChannel(users string) string {
+	return "D_" + strings.ReplaceAll(users, ",", "_")
+}
+
+// render is prefix followed by text, with its later lines indented
+func render(prefix, text string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n    ")
+}
+
+// messageText is the text of a message's blocks if it has any, and its text
+// otherwise
+func messageText(text, blocks string) string {
+	if blocks == "" {
+		return text
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(blocks), &decoded); err != nil {
+		return text
+	}
+	if texts := blockTexts(decoded); len(texts) > 0 {
+		return strings.Join(texts, "\n")
+	}
+	return text
+}
+
+// blockTexts collects every "text" string in decoded block JSON, with
+// buttons shown as [label] (action ID)
+func blockTexts(v interface{}) []string {
+	var texts []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if v["type"] == "button" {
+			if label, ok := v["text"].(map[string]interface{}); ok {
+				return []string{fmt.Sprintf("[%v] (%v)", label["text"], v["action_id"])}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if text, ok := v[key].(string); ok && key == "text" {
+				texts = append(texts, text)
+				continue
+			}
+			texts = append(texts, blockTexts(v[key])...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			texts = append(texts, blockTexts(item)...)
+		}
+	}
+	return texts
+}
+
+// blockButtons returns the value of each button in decoded block JSON, by
+// action ID
+func blockButtons(v interface{}) map[string]string {
+	buttons := map[string]string{}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if v["type"] == "button" {
+			actionID, _ := v["action_id"].(string)
+			value, _ := v["value"].(string)
+			buttons[actionID] = value
+			return buttons
+		}
+		for _, child := range v {
+			for actionID, value := range blockButtons(child) {
+				buttons[actionID] = value
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			for actionID, value := range blockButtons(child) {
+				buttons[actionID] = value
+			}
+		}
+	}
+	return buttons
+}
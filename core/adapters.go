@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/gadget-bot/gadget/adapter/mattermost"
+	"github.com/gadget-bot/gadget/adapter/slackadapter"
+	"github.com/gadget-bot/gadget/models"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// MattermostPath is where Gadget receives Mattermost's outgoing webhook
+const MattermostPath = "/gadget/mattermost"
+
+// connectAdapters connects to the chat platforms other than Slack that cfg
+// configures, and mounts their handlers
+func (gadget *Gadget) connectAdapters(cfg Config) error {
+	if cfg.MattermostURL == "" {
+		return nil
+	}
+	mm, err := mattermost.New(mattermost.Options{
+		URL:          cfg.MattermostURL,
+		Token:        cfg.MattermostToken,
+		WebhookToken: cfg.MattermostWebhookToken,
+	})
+	if err != nil {
+		return fmt.Errorf("connect to Mattermost: %w", err)
+	}
+	gadget.Handle(MattermostPath, mm.Handler(func(msg adapter.Message) {
+		gadget.DispatchMessage(mm, msg)
+	}))
+	log.Info().Str("url", cfg.MattermostURL).Str("path", MattermostPath).Msg("Mattermost adapter connected")
+	return nil
+}
+
+// Handle mounts h at pattern in Gadget's HTTP handler, e.g. to receive
+// messages from another chat platform's adapter. Call it before Handler or
+// Run.
+func (gadget *Gadget) Handle(pattern string, h http.Handler) {
+	if gadget.handlers == nil {
+		gadget.handlers = map[string]http.Handler{}
+	}
+	gadget.handlers[pattern] = h
+}
+
+// DispatchMessage routes msg, received through a, to the MessageRoutes and
+// runs the route it resolves to in the background: the matching route, or
+// the default, denied or rate limited message route. Messages from the bot
+// itself are ignored.
+//
+// Users are stored by adapter.Message.UserKey, so users from platforms other
+// than Slack are named "<platform>:<id>" in GlobalAdmins and groups.
+func (gadget Gadget) DispatchMessage(a adapter.Adapter, msg adapter.Message) {
+	if msg.User == "" || msg.User == a.BotUserID() {
+		return
+	}
+	gadget.Metrics.EventReceived(msg.Platform + "_message")
+	rs := gadget.newRequestState(context.Background())
+	logger := rs.logger.With().Str("platform", msg.Platform).Logger()
+
+	currentUser := gadget.Router.WithContext(rs.ctx).FindOrCreateUser(msg.UserKey())
+
+	route, outcome := gadget.Router.WithContext(rs.ctx).ResolveMessage(msg, currentUser)
+	rs.recordOutcome(router.RouteTypeMessage, route.Name, outcome, currentUser)
+	if route.Plugin == nil {
+		return
+	}
+	logger.Debug().Str("user", currentUser.Uuid).Str("route", route.Name).Msg(msg.Text)
+
+	ctx := gadget.buildHandlerContext(rs.ctx, logger)
+	ctx.Adapter = a
+	if msg.Platform == slackadapter.Platform {
+		ctx = ctx.WithOrigin(router.Origin{Channel: msg.Channel, ThreadTimeStamp: msg.ThreadID, TimeStamp: msg.ID, User: msg.User})
+	}
+	gadget.dispatchMessageRoute(logger, ctx, route, msg)
+}
+
+// dispatchSlackMessage runs the MessageRoute that msg, a Slack mention or
+// direct message from u, resolves to. It returns false without running
+// anything when no MessageRoute matches, so the caller can fall back to its
+// own route.
+func (gadget Gadget) dispatchSlackMessage(rs *requestState, ctx router.HandlerContext, msg adapter.Message, u models.User) bool {
+	route, outcome := gadget.Router.WithContext(rs.ctx).ResolveMessage(msg, u)
+	if outcome == router.Fallback {
+		return false
+	}
+	rs.recordOutcome(router.RouteTypeMessage, route.Name, outcome, u)
+	rs.logger.Debug().Str("user", u.Uuid).Str("route", route.Name).Msg(msg.Text)
+	gadget.dispatchMessageRoute(rs.logger, ctx, route, msg)
+	return true
+}
+
+// dispatchMessageRoute runs route for msg in the background
+func (gadget Gadget) dispatchMessageRoute(logger zerolog.Logger, ctx router.HandlerContext, route router.MessageRoute, msg adapter.Message) {
+	gadget.dispatchRoute(route.Name, logger, ctx, func(c router.HandlerContext) {
+		route.Execute(c, msg)
+	})
+}
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/gadget-bot/gadget/adapter/mattermost"
+	"github.com/gadget-bot/gadget/gadgettest"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pingRoute replies "pong" to "ping" on any platform
+func pingRoute(permissions ...string) router.MessageRoute {
+	return router.MessageRoute{
+		Route: router.Route{Name: "ping", Pattern: `^ping$`, Permissions: permissions},
+		Plugin: func(ctx router.HandlerContext, msg adapter.Message) {
+			_ = adapter.Reply(ctx.Adapter, msg, "pong")
+		},
+	}
+}
+
+func newMattermostGadget(t *testing.T, cfg Config) (*Gadget, *gadgettest.FakeMattermost) {
+	t.Helper()
+	fake := gadgettest.NewFakeMattermost(t)
+	cfg.MattermostURL = fake.URL()
+	cfg.MattermostToken = gadgettest.MattermostToken
+	cfg.MattermostWebhookToken = "hook-token"
+	gadget, err := NewWithDB(cfg, setupTestDB(t))
+	require.NoError(t, err)
+	gadget.Router.AddMessageRoute(pingRoute("*"))
+	return gadget, fake
+}
+
+func TestNewWithDB_MattermostConnectFails(t *testing.T) {
+	fake := gadgettest.NewFakeMattermost(t)
+
+	_, err := NewWithDB(Config{MattermostURL: fake.URL(), MattermostToken: "wrong"}, setupTestDB(t))
+
+	assert.ErrorContains(t, err, "connect to Mattermost")
+}
+
+func TestGadgetHandler_MattermostWebhook(t *testing.T) {
+	gadget, fake := newMattermostGadget(t, Config{})
+	server := httptest.NewServer(gadget.Handler())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+MattermostPath, "application/json", strings.NewReader(
+		`{"token":"hook-token","channel_id":"ch1","user_id":"u1","post_id":"p1","text":"@gadget ping","trigger_word":"@gadget"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	gadget.Wait()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	fake.AssertPosted(t, "ch1", "pong")
+}
+
+func TestDispatchMessage_PlatformUsersInGroups(t *testing.T) {
+	gadget, fake := newMattermostGadget(t, Config{GlobalAdmins: []string{"mattermost:u1"}})
+	gadget.Router.AddMessageRoute(pingRoute("nobody"))
+	mm, err := mattermost.New(mattermost.Options{URL: fake.URL(), Token: gadgettest.MattermostToken})
+	require.NoError(t, err)
+
+	gadget.DispatchMessage(mm, adapter.Message{Platform: "mattermost", Channel: "ch1", User: "u1", Text: "ping"})
+	gadget.Wait()
+	fake.AssertPosted(t, "ch1", "pong")
+
+	// Slack's U1 is someone else
+	id := fake.AddPost("ch2", "U1", "ping")
+	gadget.DispatchMessage(mm, adapter.Message{Platform: "mattermost", ID: id, Channel: "ch2", User: "U1", Text: "ping"})
+	gadget.Wait()
+	fake.AssertPosted(t, "ch2", "not allowed")
+}
+
+func TestDispatchMessage_IgnoresBot(t *testing.T) {
+	gadget, fake := newMattermostGadget(t, Config{})
+	mm, err := mattermost.New(mattermost.Options{URL: fake.URL(), Token: gadgettest.MattermostToken})
+	require.NoError(t, err)
+
+	gadget.DispatchMessage(mm, adapter.Message{Platform: "mattermost", Channel: "ch1", User: gadgettest.MattermostBotUserID, Text: "ping"})
+	gadget.Wait()
+
+	assert.Empty(t, fake.Posts("ch1"))
+}
+
+func newSlackMessageGadget(t *testing.T) (*Gadget, *gadgettest.FakeSlack) {
+	t.Helper()
+	fake := gadgettest.NewFakeSlack(t)
+	gadget, err := NewWithDB(Config{}, setupTestDB(t))
+	require.NoError(t, err)
+	gadget.Client = fake.Client()
+	gadget.Identity.Set(gadgettest.Identity)
+	gadget.Router.AddMessageRoute(pingRoute("*"))
+	return gadget, fake
+}
+
+func TestDispatchEvent_MentionRunsMessageRoute(t *testing.T) {
+	gadget, fake := newSlackMessageGadget(t)
+
+	gadget.DispatchEvent(slackevents.EventsAPIInnerEvent{
+		Type: string(slackevents.AppMention),
+		Data: &slackevents.AppMentionEvent{User: "U1", Channel: "C1", TimeStamp: "1.1", Text: "<@" + gadgettest.BotUserID + "> ping"},
+	})
+	gadget.Wait()
+
+	fake.AssertPosted(t, "C1", "pong")
+}
+
+func TestDispatchEvent_MentionRouteTakesPrecedence(t *testing.T) {
+	gadget, fake := newSlackMessageGadget(t)
+	gadget.Router.AddMentionRoute(router.MentionRoute{
+		Route: router.Route{Name: "slack_ping", Pattern: `^ping$`, Permissions: []string{"*"}},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+			_ = ctx.Reply("slack pong")
+		},
+	})
+
+	gadget.DispatchEvent(slackevents.EventsAPIInnerEvent{
+		Type: string(slackevents.AppMention),
+		Data: &slackevents.AppMentionEvent{User: "U1", Channel: "C1", TimeStamp: "1.1", Text: "<@" + gadgettest.BotUserID + "> ping"},
+	})
+	gadget.Wait()
+
+	fake.AssertPosted(t, "C1", "slack pong")
+	require.Len(t, fake.Messages("C1"), 1)
+}
+
+func TestDispatchEvent_DirectMessageRunsMessageRoute(t *testing.T) {
+	gadget, fake := newSlackMessageGadget(t)
+
+	gadget.DispatchEvent(slackevents.EventsAPIInnerEvent{
+		Type: string(slackevents.Message),
+		Data: &slackevents.MessageEvent{User: "U1", Channel: "D1", ChannelType: "im", TimeStamp: "1.1", Text: "ping"},
+	})
+	gadget.DispatchEvent(slackevents.EventsAPIInnerEvent{
+		Type: string(slackevents.Message),
+		Data: &slackevents.MessageEvent{User: "U1", Channel: "C1", ChannelType: "channel", TimeStamp: "1.2", Text: "ping"},
+	})
+	gadget.Wait()
+
+	fake.AssertPosted(t, "D1", "pong")
+	fake.AssertNothingPosted(t, "C1")
+}
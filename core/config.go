@@ -0,0 +1,294 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/gadget-bot/gadget/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the environment variable Setup reads the config
+// file's path from
+const ConfigFileEnv = "GADGET_CONFIG"
+
+// fileSuffix marks an environment variable naming a file to read another
+// variable's value from, e.g. SLACK_SIGNING_SECRET_FILE
+const fileSuffix = "_FILE"
+
+// ReadConfig returns the Config in the YAML file at path, overridden by the
+// environment variables that are set. A variable set to "" clears the
+// file's setting. Each variable can instead be read
+// from the file its _FILE variable names, for secrets that Docker or
+// Kubernetes mount as files. Without a path, the Config comes from the
+// environment alone. Keys the file shouldn't have and values that can't be
+// parsed are errors, reported together.
+func ReadConfig(path string) (Config, error) {
+	var cfg Config
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, cfg.applyEnv(os.LookupEnv)
+}
+
+// LoadConfig reads a Config like ReadConfig and validates it
+func LoadConfig(path string) (Config, error) {
+	cfg, err := ReadConfig(path)
+	return cfg, errors.Join(err, cfg.Validate())
+}
+
+// readFile decodes the YAML file at path into cfg
+func (cfg *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	if err := decodeStrict(data, cfg); err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+// decodeStrict decodes YAML data into v, rejecting keys v doesn't have
+func decodeStrict(data []byte, v interface{}) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// applyEnv sets each field of cfg whose env variable lookup finds, clearing
+// those whose variable is empty
+func (cfg *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		value, ok, err := lookupEnv(lookup, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if value == "" {
+			v.Field(i).SetZero()
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// lookupEnv returns the value of the variable name, or the contents of the
+// file its _FILE variable names, and whether either is set. A variable set
+// to "" counts as set, but an empty _FILE variable names no file.
+func lookupEnv(lookup func(string) (string, bool), name string) (string, bool, error) {
+	value, set := lookup(name)
+	file, _ := lookup(name + fileSuffix)
+	switch {
+	case set && file != "":
+		return "", false, fmt.Errorf("%s and %s%s are both set", name, name, fileSuffix)
+	case file != "":
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("%s%s: %w", name, fileSuffix, err)
+		}
+		return strings.TrimRight(string(contents), "\r\n"), true, nil
+	}
+	return value, set, nil
+}
+
+// setField parses value into field: lists are comma-separated, and
+// durations are written like "1h30m"
+func setField(field reflect.Value, value string) error {
+	switch p := field.Addr().Interface().(type) {
+	case *string:
+		*p = value
+	case *[]string:
+		*p = splitList(value)
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q isn't true or false", value)
+		}
+		*p = b
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*p = d
+	case *[]router.RateLimit:
+		var limits []router.RateLimit
+		for _, item := range splitList(value) {
+			limit, err := router.ParseRateLimit(item)
+			if err != nil {
+				return err
+			}
+			limits = append(limits, limit)
+		}
+		*p = limits
+	default:
+		return fmt.Errorf("can't set a %s from the environment", field.Type())
+	}
+	return nil
+}
+
+// Validate checks that cfg has everything Gadget needs to start, and
+// returns every problem it finds together
+func (cfg Config) Validate() error {
+	var errs []error
+	require := func(value, field string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", setting(field)))
+		}
+	}
+	check := func(err error, field string) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", setting(field), err))
+		}
+	}
+
+	if len(cfg.SigningSecrets) == 0 {
+		require(cfg.SigningSecret, "SigningSecret")
+	}
+	if cfg.SlackClientID == "" {
+		require(cfg.SlackOAuthToken, "SlackOAuthToken")
+	} else {
+		require(cfg.SlackClientSecret, "SlackClientSecret")
+		require(cfg.OAuthRedirectURL, "OAuthRedirectURL")
+	}
+	check(validURL(cfg.OAuthRedirectURL), "OAuthRedirectURL")
+	check(validURL(cfg.SlackAPIURL), "SlackAPIURL")
+	check(validKey(cfg.InstallationKey), "InstallationKey")
+
+	require(cfg.DBUser, "DBUser")
+	require(cfg.DBHost, "DBHost")
+	require(cfg.DBName, "DBName")
+	check(validPort(cfg.DBPort), "DBPort")
+	check(validPort(cfg.ListenPort), "ListenPort")
+	check(nonNegative(cfg.DBConnMaxLifetime), "DBConnMaxLifetime")
+	check(nonNegative(cfg.DBConnMaxIdleTime), "DBConnMaxIdleTime")
+	check(nonNegative(cfg.DirectoryTTL), "DirectoryTTL")
+	check(nonNegative(cfg.SigningMaxSkew), "SigningMaxSkew")
+
+	if (cfg.DeployChannel == "") != (cfg.DeployWebhookSecret == "") {
+		errs = append(errs, fmt.Errorf("%s and %s must be set together", setting("DeployChannel"), setting("DeployWebhookSecret")))
+	}
+	if cfg.MattermostURL != "" {
+		require(cfg.MattermostToken, "MattermostToken")
+		check(validURL(cfg.MattermostURL), "MattermostURL")
+	}
+	switch cfg.TracingExporter {
+	case "", tracing.ExporterOTLP, tracing.ExporterStdout:
+	default:
+		errs = append(errs, fmt.Errorf("%s must be %q or %q", setting("TracingExporter"), tracing.ExporterOTLP, tracing.ExporterStdout))
+	}
+	return errors.Join(errs...)
+}
+
+// setting describes Config's field for errors, by its key in the config file
+// and its environment variable, e.g. "signing_secret (SLACK_SIGNING_SECRET)"
+func setting(field string) string {
+	f, ok := reflect.TypeOf(Config{}).FieldByName(field)
+	if !ok {
+		return field
+	}
+	return fmt.Sprintf("%s (%s)", f.Tag.Get("yaml"), f.Tag.Get("env"))
+}
+
+// validKey checks that key, if set, is 32 base64 encoded bytes
+func validKey(key string) error {
+	if key == "" {
+		return nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(decoded) != 32 {
+		return errors.New("must be 32 base64 encoded bytes, e.g. from openssl rand -base64 32")
+	}
+	return nil
+}
+
+// validURL checks that rawURL, if set, is an absolute http(s) URL
+func validURL(rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q isn't an http(s) URL", rawURL)
+	}
+	return nil
+}
+
+// validPort checks that port, if set, is a TCP port number
+func validPort(port string) error {
+	if port == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%q isn't a port number", port)
+	}
+	return nil
+}
+
+// nonNegative checks that d isn't negative
+func nonNegative(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("%s is negative", d)
+	}
+	return nil
+}
+
+// PluginConfig decodes the plugin's section of the config file, under
+// plugins.<name>, into v, a pointer to the plugin's own config struct. Keys
+// v doesn't have are errors. v keeps its defaults if the file has no
+// section for the plugin, and is validated if it has a Validate() error
+// method.
+func (cfg Config) PluginConfig(name string, v interface{}) error {
+	if node, ok := cfg.Plugins[name]; ok {
+		data, err := yaml.Marshal(&node)
+		if err != nil {
+			return fmt.Errorf("plugins.%s: %w", name, err)
+		}
+		if err := decodeStrict(data, v); err != nil {
+			return fmt.Errorf("plugins.%s: %w", name, err)
+		}
+	}
+	if validator, ok := v.(interface{ Validate() error }); ok {
+		if err := validator.Validate(); err != nil {
+			return fmt.Errorf("plugins.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// PluginConfig decodes the plugin's section of the config Gadget was set up
+// with into v, like Config.PluginConfig
+func (gadget Gadget) PluginConfig(name string, v interface{}) error {
+	return gadget.config.PluginConfig(name, v)
+}
@@ -0,0 +1,218 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFile writes contents to name in a temporary directory and returns
+// its path
+func writeFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	return path
+}
+
+const validConfig = `
+slack_oauth_token: xoxb-file
+signing_secret: file-secret
+db_user: gadget
+db_host: db
+db_name: gadget
+listen_port: "3000"
+global_admins: [U0ADMIN]
+directory_ttl: 15m
+default_rate_limits: ["10/1m"]
+plugins:
+  lunch:
+    channel: C0LUNCH
+    every: 24h
+`
+
+func TestReadConfig_File(t *testing.T) {
+	cfg, err := ReadConfig(writeFile(t, "gadget.yaml", validConfig))
+
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-file", cfg.SlackOAuthToken)
+	assert.Equal(t, []string{"U0ADMIN"}, cfg.GlobalAdmins)
+	assert.Equal(t, 15*time.Minute, cfg.DirectoryTTL)
+	assert.Equal(t, []router.RateLimit{{Scope: router.RateLimitPerUser, Burst: 10, Every: 6 * time.Second}}, cfg.DefaultRateLimits)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestReadConfig_EnvOverridesFile(t *testing.T) {
+	t.Setenv("SLACK_OAUTH_TOKEN", "xoxb-env")
+	t.Setenv("GADGET_DIRECTORY_TTL", "1m")
+
+	cfg, err := ReadConfig(writeFile(t, "gadget.yaml", validConfig))
+
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-env", cfg.SlackOAuthToken)
+	assert.Equal(t, time.Minute, cfg.DirectoryTTL)
+	assert.Equal(t, "file-secret", cfg.SigningSecret, "settings the environment doesn't have come from the file")
+}
+
+func TestReadConfig_EmptyEnvClearsFile(t *testing.T) {
+	t.Setenv("GADGET_GLOBAL_ADMINS", "")
+	t.Setenv("GADGET_DIRECTORY_TTL", "")
+	t.Setenv("GADGET_DEFAULT_RATE_LIMIT", "")
+
+	cfg, err := ReadConfig(writeFile(t, "gadget.yaml", validConfig))
+
+	require.NoError(t, err)
+	assert.Empty(t, cfg.GlobalAdmins)
+	assert.Zero(t, cfg.DirectoryTTL)
+	assert.Empty(t, cfg.DefaultRateLimits)
+	assert.Equal(t, "xoxb-file", cfg.SlackOAuthToken, "unset variables leave the file's settings")
+}
+
+func TestReadConfig_GlobalAdminsFromEnv(t *testing.T) {
+	t.Setenv("GADGET_GLOBAL_ADMINS", " U123 , U456 ,,U789,")
+
+	cfg, err := ReadConfig("")
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"U123", "U456", "U789"}, cfg.GlobalAdmins)
+}
+
+func TestReadConfig_SecretFiles(t *testing.T) {
+	t.Setenv("SLACK_SIGNING_SECRET_FILE", writeFile(t, "signing_secret", "mounted-secret\n"))
+
+	cfg, err := ReadConfig("")
+
+	require.NoError(t, err)
+	assert.Equal(t, "mounted-secret", cfg.SigningSecret)
+}
+
+func TestReadConfig_Errors(t *testing.T) {
+	t.Setenv("GADGET_DB_PASS", "hunter2")
+	t.Setenv("GADGET_DB_PASS_FILE", writeFile(t, "db_pass", "hunter3"))
+	t.Setenv("SLACK_OAUTH_TOKEN_FILE", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("GADGET_PERSIST_PROFILES", "sometimes")
+	t.Setenv("GADGET_DEFAULT_RATE_LIMIT", "often")
+
+	_, err := ReadConfig("")
+
+	require.Error(t, err)
+	for _, want := range []string{
+		"GADGET_DB_PASS and GADGET_DB_PASS_FILE are both set",
+		"SLACK_OAUTH_TOKEN_FILE",
+		`GADGET_PERSIST_PROFILES: "sometimes" isn't true or false`,
+		"GADGET_DEFAULT_RATE_LIMIT",
+	} {
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestReadConfig_UnknownKey(t *testing.T) {
+	_, err := ReadConfig(writeFile(t, "gadget.yaml", "signing_secret: s\nsigning_secert: s\n"))
+
+	assert.ErrorContains(t, err, "signing_secert")
+}
+
+func TestReadConfig_MissingFile(t *testing.T) {
+	_, err := ReadConfig(filepath.Join(t.TempDir(), "gadget.yaml"))
+
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLoadConfig_ValidatesEverything(t *testing.T) {
+	_, err := LoadConfig(writeFile(t, "gadget.yaml", "listen_port: http\ntracing_exporter: zipkin\ndeploy_channel: C0DEPLOY\n"))
+
+	require.Error(t, err)
+	for _, want := range []string{
+		"signing_secret (SLACK_SIGNING_SECRET) is required",
+		"slack_oauth_token (SLACK_OAUTH_TOKEN) is required",
+		"db_host (GADGET_DB_HOST) is required",
+		`listen_port (GADGET_LISTEN_PORT): "http" isn't a port number`,
+		`tracing_exporter (GADGET_TRACING_EXPORTER) must be "otlp" or "stdout"`,
+		"deploy_channel (GADGET_DEPLOY_CHANNEL) and deploy_webhook_secret (GADGET_DEPLOY_WEBHOOK_SECRET) must be set together",
+	} {
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestConfig_ValidateInstalls(t *testing.T) {
+	cfg := Config{SigningSecret: "s", DBUser: "u", DBHost: "h", DBName: "n", SlackClientID: "client-id", OAuthRedirectURL: "/gadget/oauth/callback", InstallationKey: "c2hvcnQ="}
+
+	err := cfg.Validate()
+
+	assert.NotContains(t, err.Error(), "slack_oauth_token", "installs don't need a token of Gadget's own")
+	assert.ErrorContains(t, err, "slack_client_secret (SLACK_CLIENT_SECRET) is required")
+	assert.ErrorContains(t, err, `oauth_redirect_url (GADGET_OAUTH_REDIRECT_URL): "/gadget/oauth/callback" isn't an http(s) URL`)
+	assert.ErrorContains(t, err, "installation_key (GADGET_INSTALLATION_KEY): must be 32 base64 encoded bytes")
+}
+
+func TestConfig_ValidateSigningSecrets(t *testing.T) {
+	cfg := Config{SigningSecrets: []string{"old-secret"}, SigningMaxSkew: -time.Minute}
+
+	err := cfg.Validate()
+
+	assert.NotContains(t, err.Error(), "signing_secret (", "signing_secrets will do")
+	assert.ErrorContains(t, err, "signing_max_skew (GADGET_SIGNING_MAX_SKEW): -1m0s is negative")
+}
+
+type lunchConfig struct {
+	Channel string        `yaml:"channel"`
+	Every   time.Duration `yaml:"every"`
+	Menu    string        `yaml:"menu"`
+}
+
+func (c lunchConfig) Validate() error {
+	if c.Channel == "" {
+		return errors.New("channel is required")
+	}
+	return nil
+}
+
+func TestConfig_PluginConfig(t *testing.T) {
+	cfg, err := ReadConfig(writeFile(t, "gadget.yaml", validConfig))
+	require.NoError(t, err)
+
+	lunch := lunchConfig{Menu: "sandwiches"}
+	require.NoError(t, cfg.PluginConfig("lunch", &lunch))
+
+	assert.Equal(t, lunchConfig{Channel: "C0LUNCH", Every: 24 * time.Hour, Menu: "sandwiches"}, lunch, "settings the section doesn't have keep their defaults")
+}
+
+func TestConfig_PluginConfigErrors(t *testing.T) {
+	cfg, err := ReadConfig(writeFile(t, "gadget.yaml", "plugins:\n  lunch:\n    chanel: C0LUNCH\n"))
+	require.NoError(t, err)
+
+	err = cfg.PluginConfig("lunch", &lunchConfig{})
+	assert.ErrorContains(t, err, "plugins.lunch")
+	assert.ErrorContains(t, err, "chanel")
+
+	err = cfg.PluginConfig("dinner", &lunchConfig{})
+	assert.EqualError(t, err, "plugins.dinner: channel is required", "plugins without a section are still validated")
+}
+
+func TestGadget_PluginConfig(t *testing.T) {
+	cfg, err := ReadConfig(writeFile(t, "gadget.yaml", validConfig))
+	require.NoError(t, err)
+	gadget, err := NewWithDB(cfg, setupTestDB(t))
+	require.NoError(t, err)
+
+	var lunch lunchConfig
+	require.NoError(t, gadget.PluginConfig("lunch", &lunch))
+
+	assert.Equal(t, "C0LUNCH", lunch.Channel)
+}
+
+func TestConfigFromEnv_IgnoresInvalidValues(t *testing.T) {
+	t.Setenv("GADGET_DIRECTORY_TTL", "soon")
+	t.Setenv("GADGET_DB_HOST", "db")
+
+	cfg := ConfigFromEnv()
+
+	assert.Zero(t, cfg.DirectoryTTL)
+	assert.Equal(t, "db", cfg.DBHost)
+}
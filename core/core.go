@@ -2,25 +2,41 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/gadget-bot/gadget/adapter/slackadapter"
+	"github.com/gadget-bot/gadget/directory"
+	"github.com/gadget-bot/gadget/install"
 	"github.com/gadget-bot/gadget/manifest"
+	"github.com/gadget-bot/gadget/metrics"
 	"github.com/gadget-bot/gadget/models"
-	"github.com/gadget-bot/gadget/plugins/fallback"
+	"github.com/gadget-bot/gadget/plugins/defaults"
+	"github.com/gadget-bot/gadget/plugins/deploys"
 	"github.com/gadget-bot/gadget/plugins/groups"
-	"github.com/gadget-bot/gadget/plugins/permission_denied"
+	"github.com/gadget-bot/gadget/plugins/helpers"
+	"github.com/gadget-bot/gadget/plugins/reminders"
+	"github.com/gadget-bot/gadget/plugins/routes"
 	"github.com/gadget-bot/gadget/plugins/user_info"
 	"github.com/gadget-bot/gadget/router"
+	"github.com/gadget-bot/gadget/signing"
+	"github.com/gadget-bot/gadget/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
@@ -32,68 +48,86 @@ import (
 )
 
 // Config holds all configuration needed to initialize a Gadget instance.
+// ReadConfig loads it from a YAML file, by the yaml keys below, and from
+// environment variables, by the env names.
 type Config struct {
-	SlackOAuthToken   string
-	SlackUserToken    string // optional user-level OAuth token (xoxp-)
-	SigningSecret     string
-	DBUser            string
-	DBPass            string
-	DBHost            string
-	DBName            string
-	DBPort            string // optional; defaults to "3306" if empty
-	ListenPort        string
-	GlobalAdmins      []string
-	DBConnMaxLifetime time.Duration // max lifetime of a DB connection; 0 uses default (5m)
-	DBConnMaxIdleTime time.Duration // max idle time of a DB connection; 0 uses default (3m)
+	SlackOAuthToken     string             `yaml:"slack_oauth_token" env:"SLACK_OAUTH_TOKEN"`
+	SlackUserToken      string             `yaml:"slack_user_token" env:"SLACK_USER_OAUTH_TOKEN"` // optional user-level OAuth token (xoxp-)
+	SigningSecret       string             `yaml:"signing_secret" env:"SLACK_SIGNING_SECRET"`
+	SigningSecrets      []string           `yaml:"signing_secrets" env:"SLACK_SIGNING_SECRETS"`      // more secrets to accept, e.g. the old one while rotating
+	SigningMaxSkew      time.Duration      `yaml:"signing_max_skew" env:"GADGET_SIGNING_MAX_SKEW"`   // how old a signed request may be; 0 uses default (5m)
+	ReplayProtection    bool               `yaml:"replay_protection" env:"GADGET_REPLAY_PROTECTION"` // reject requests whose signature was already accepted
+	DBUser              string             `yaml:"db_user" env:"GADGET_DB_USER"`
+	DBPass              string             `yaml:"db_pass" env:"GADGET_DB_PASS"`
+	DBHost              string             `yaml:"db_host" env:"GADGET_DB_HOST"`
+	DBName              string             `yaml:"db_name" env:"GADGET_DB_NAME"`
+	DBPort              string             `yaml:"db_port" env:"GADGET_DB_PORT"` // optional; defaults to "3306" if empty
+	ListenPort          string             `yaml:"listen_port" env:"GADGET_LISTEN_PORT"`
+	GlobalAdmins        []string           `yaml:"global_admins" env:"GADGET_GLOBAL_ADMINS"`
+	DBConnMaxLifetime   time.Duration      `yaml:"db_conn_max_lifetime" env:"GADGET_DB_CONN_MAX_LIFETIME"`   // max lifetime of a DB connection; 0 uses default (5m)
+	DBConnMaxIdleTime   time.Duration      `yaml:"db_conn_max_idle_time" env:"GADGET_DB_CONN_MAX_IDLE_TIME"` // max idle time of a DB connection; 0 uses default (3m)
+	DefaultRateLimits   []router.RateLimit `yaml:"default_rate_limits" env:"GADGET_DEFAULT_RATE_LIMIT"`      // applied to routes that declare no RateLimits; empty disables
+	SharedRateLimits    bool               `yaml:"shared_rate_limits" env:"GADGET_SHARED_RATE_LIMITS"`       // store rate limit buckets in the DB so limits hold across replicas
+	DeployChannel       string             `yaml:"deploy_channel" env:"GADGET_DEPLOY_CHANNEL"`               // optional; channel the deploy webhook posts to
+	DeployWebhookSecret string             `yaml:"deploy_webhook_secret" env:"GADGET_DEPLOY_WEBHOOK_SECRET"` // optional; enables the /gadget/hooks/deploy webhook
+	DirectoryTTL        time.Duration      `yaml:"directory_ttl" env:"GADGET_DIRECTORY_TTL"`                 // how long cached users and channels are trusted; 0 uses default (1h)
+	PersistProfiles     bool               `yaml:"persist_profiles" env:"GADGET_PERSIST_PROFILES"`           // save snapshots of user profiles in the users table
+
+	MattermostURL          string `yaml:"mattermost_url" env:"GADGET_MATTERMOST_URL"`                     // optional; also serves MessageRoutes on this Mattermost server
+	MattermostToken        string `yaml:"mattermost_token" env:"GADGET_MATTERMOST_TOKEN"`                 // the Mattermost bot account's access token
+	MattermostWebhookToken string `yaml:"mattermost_webhook_token" env:"GADGET_MATTERMOST_WEBHOOK_TOKEN"` // the token of the outgoing webhook that posts to /gadget/mattermost
+
+	TracingExporter string `yaml:"tracing_exporter" env:"GADGET_TRACING_EXPORTER"` // optional; "otlp" or "stdout" turns on OpenTelemetry tracing
+	AdminToken      string `yaml:"admin_token" env:"GADGET_ADMIN_TOKEN"`           // optional; enables the /gadget/admin endpoint for bearers of this token
+
+	SlackClientID     string   `yaml:"slack_client_id" env:"SLACK_CLIENT_ID"`              // optional; lets workspaces install Gadget through /gadget/install
+	SlackClientSecret string   `yaml:"slack_client_secret" env:"SLACK_CLIENT_SECRET"`      // the Slack app's client secret
+	OAuthRedirectURL  string   `yaml:"oauth_redirect_url" env:"GADGET_OAUTH_REDIRECT_URL"` // Gadget's public /gadget/oauth/callback URL, as registered with the Slack app
+	OAuthScopes       []string `yaml:"oauth_scopes" env:"GADGET_OAUTH_SCOPES"`             // bot scopes installs request; empty requests those the routes need
+	OAuthUserScopes   []string `yaml:"oauth_user_scopes" env:"GADGET_OAUTH_USER_SCOPES"`   // optional; user scopes installs request
+	SlackAPIURL       string   `yaml:"slack_api_url" env:"SLACK_API_URL"`                  // optional; base URL of Slack's Web API, e.g. for a fake in tests
+	InstallationKey   string   `yaml:"installation_key" env:"GADGET_INSTALLATION_KEY"`     // optional; base64 encoded 32 byte key encrypting installations' tokens in the DB
+
+	// Plugins holds each plugin's section of the config file, by plugin
+	// name, for PluginConfig to decode. It's left out of the admin endpoint,
+	// since it may hold secrets.
+	Plugins map[string]yaml.Node `yaml:"plugins" json:"-"`
 }
 
 // ConfigFromEnv returns a Config populated from environment variables.
+// Variables that can't be parsed are logged and left unset; use ReadConfig
+// to have them reported as errors.
 func ConfigFromEnv() Config {
-	return Config{
-		SlackOAuthToken:   os.Getenv("SLACK_OAUTH_TOKEN"),
-		SlackUserToken:    os.Getenv("SLACK_USER_OAUTH_TOKEN"),
-		SigningSecret:     os.Getenv("SLACK_SIGNING_SECRET"),
-		DBUser:            os.Getenv("GADGET_DB_USER"),
-		DBPass:            os.Getenv("GADGET_DB_PASS"),
-		DBHost:            os.Getenv("GADGET_DB_HOST"),
-		DBName:            os.Getenv("GADGET_DB_NAME"),
-		DBPort:            os.Getenv("GADGET_DB_PORT"),
-		ListenPort:        os.Getenv("GADGET_LISTEN_PORT"),
-		GlobalAdmins:      globalAdminsFromString(os.Getenv("GADGET_GLOBAL_ADMINS")),
-		DBConnMaxLifetime: parseDurationEnv("GADGET_DB_CONN_MAX_LIFETIME"),
-		DBConnMaxIdleTime: parseDurationEnv("GADGET_DB_CONN_MAX_IDLE_TIME"),
-	}
-}
-
-// parseDurationEnv reads an environment variable as a time.Duration.
-// Returns 0 (meaning "use default") if the variable is empty or unparseable.
-func parseDurationEnv(key string) time.Duration {
-	val := os.Getenv(key)
-	if val == "" {
-		return 0
-	}
-	d, err := time.ParseDuration(val)
-	if err != nil {
-		log.Warn().Str("key", key).Str("value", val).Msg("Invalid duration, using default")
-		return 0
+	var cfg Config
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		log.Warn().Err(err).Msg("Ignoring invalid environment variables")
 	}
-	return d
+	return cfg
 }
 
 // Middleware wraps handler execution. Call next(ctx) to continue the chain,
 // or return without calling next to short-circuit.
-type Middleware func(ctx router.HandlerContext, next func(router.HandlerContext))
+type Middleware = router.Middleware
 
 type Gadget struct {
 	Router        router.Router
 	Client        *slack.Client
 	UserClient    *slack.Client // nil if no user token configured
-	signingSecret string
+	Directory     *directory.Directory
+	Metrics       *metrics.Metrics  // served on /metrics; plugins add their own through HandlerContext.Metrics
+	Identity      *router.Identity  // who the bot is in Slack, loaded by LoadIdentity
+	Installations install.Store     // workspaces Gadget was installed in; nil unless Config.SlackClientID is set
+	verifier      *signing.Verifier // checks the signatures of Slack's requests
 	listenPort    string
 	middleware    []Middleware
+	inflight      *sync.WaitGroup         // running handlers, for Wait
+	handlers      map[string]http.Handler // extra handlers mounted with Handle
+	stopTracing   func(context.Context) error
+	config        Config      // shown, redacted, on the admin endpoint
+	workspaces    *workspaces // clients for Installations, loaded as events arrive
 }
 
-func requestLog(code int, r http.Request, denied bool, start time.Time, logger zerolog.Logger) {
+func requestLog(code int, r http.Request, denied, rateLimited bool, start time.Time, logger zerolog.Logger) {
 	event := logger.Info().
 		Str("method", r.Method).
 		Str("code", strconv.Itoa(code)).
@@ -102,6 +136,9 @@ func requestLog(code int, r http.Request, denied bool, start time.Time, logger z
 	if denied {
 		event = event.Str("access", "denied")
 	}
+	if rateLimited {
+		event = event.Bool("rate_limited", true)
+	}
 	event.Msg("Request handled")
 }
 
@@ -114,10 +151,11 @@ func generateRequestID() string {
 	return hex.EncodeToString(b)
 }
 
-// verifySlackRequest reads the request body, verifies the Slack signing secret,
+// verifySlackRequest reads the request body, verifies its Slack signature,
 // and returns the body bytes. On failure it writes the appropriate HTTP status
-// and returns a non-nil error.
-func verifySlackRequest(w http.ResponseWriter, r *http.Request, secret string, logger zerolog.Logger) ([]byte, int, error) {
+// and returns a non-nil error. Rejected signatures are logged and counted
+// by endpoint.
+func (gadget Gadget) verifySlackRequest(w http.ResponseWriter, r *http.Request, endpoint string, logger zerolog.Logger) ([]byte, int, error) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to read request body")
@@ -125,19 +163,15 @@ func verifySlackRequest(w http.ResponseWriter, r *http.Request, secret string, l
 		return nil, http.StatusBadRequest, err
 	}
 
-	sv, err := slack.NewSecretsVerifier(r.Header, secret)
-	if err != nil {
-		logger.Error().Err(err).Msg("Failed to create secrets verifier")
-		w.WriteHeader(http.StatusUnauthorized)
-		return nil, http.StatusUnauthorized, err
-	}
-	if _, err := sv.Write(body); err != nil {
-		logger.Error().Err(err).Msg("Failed to write body to verifier")
-		w.WriteHeader(http.StatusInternalServerError)
-		return nil, http.StatusInternalServerError, err
-	}
-	if err := sv.Ensure(); err != nil {
-		logger.Warn().Err(err).Msg("Request signature verification failed")
+	if err := gadget.verifier.Verify(r.Header, body); err != nil {
+		reason := signing.Reason(err)
+		logger.Warn().
+			Err(err).
+			Str("reason", reason).
+			Str("remote_addr", r.RemoteAddr).
+			Str("timestamp", r.Header.Get(signing.TimestampHeader)).
+			Msg("Request signature verification failed")
+		gadget.Metrics.RequestRejected(endpoint, reason)
 		w.WriteHeader(http.StatusUnauthorized)
 		return nil, http.StatusUnauthorized, err
 	}
@@ -152,19 +186,18 @@ func (g Gadget) getListenPort() string {
 	return "3000"
 }
 
-func globalAdminsFromString(admins string) []string {
-	if admins == "" {
+// splitList splits a comma-separated list, dropping empty items
+func splitList(list string) []string {
+	if list == "" {
 		return []string{}
 	}
-	uuids := strings.Split(admins, ",")
-	trimmedUuids := []string{}
-	for _, uuid := range uuids {
-		trimmed := strings.TrimSpace(uuid)
-		if trimmed != "" {
-			trimmedUuids = append(trimmedUuids, trimmed)
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			items = append(items, trimmed)
 		}
 	}
-	return trimmedUuids
+	return items
 }
 
 func stripBotMention(body string, botUuid string) string {
@@ -187,22 +220,20 @@ func safeGo(routeName string, logger zerolog.Logger, fn func()) {
 }
 
 // Use appends a middleware to the chain. Middleware is executed in the order added,
-// wrapping every handler invocation (mentions, channel messages, and slash commands).
+// wrapping every handler invocation (mentions, channel messages, slash commands, block actions, webhooks, and scheduled jobs).
 func (g *Gadget) Use(mw Middleware) {
 	g.middleware = append(g.middleware, mw)
 }
 
+// Middleware returns the middleware added with Use, in order, e.g. for
+// gadgettest.WithMiddleware
+func (g Gadget) Middleware() []Middleware {
+	return append([]Middleware(nil), g.middleware...)
+}
+
 // buildChain builds a middleware chain ending with fn.
 func (g Gadget) buildChain(fn func(router.HandlerContext)) func(router.HandlerContext) {
-	handler := fn
-	for i := len(g.middleware) - 1; i >= 0; i-- {
-		mw := g.middleware[i]
-		next := handler
-		handler = func(ctx router.HandlerContext) {
-			mw(ctx, next)
-		}
-	}
-	return handler
+	return router.Chain(g.middleware, fn)
 }
 
 // Manifest generates a Slack app manifest from the currently registered routes.
@@ -215,15 +246,19 @@ func (g Gadget) Manifest(name, description, requestURL string, extraScopes ...st
 	return manifest.Generate(g.Router, name, description, requestURL, extraScopes...)
 }
 
-// Setup creates a new Gadget instance using configuration from environment variables.
+// Setup creates a new Gadget instance using the config file named by
+// GADGET_CONFIG, if any, and environment variables, failing if the config
+// isn't valid.
 func Setup() (*Gadget, error) {
-	return SetupWithConfig(ConfigFromEnv())
+	cfg, err := LoadConfig(os.Getenv(ConfigFileEnv))
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	return SetupWithConfig(cfg)
 }
 
 // SetupWithConfig creates a new Gadget instance using the provided Config.
 func SetupWithConfig(cfg Config) (*Gadget, error) {
-	var gadget Gadget
-
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	logLevel := os.Getenv("GADGET_LOG_LEVEL")
 	if logLevel == "" {
@@ -237,23 +272,16 @@ func SetupWithConfig(cfg Config) (*Gadget, error) {
 	zerolog.SetGlobalLevel(level)
 	log.Info().Str("level", level.String()).Msg("Log level configured")
 
-	gadget.Client = slack.New(cfg.SlackOAuthToken)
-	if cfg.SlackUserToken != "" {
-		gadget.UserClient = slack.New(cfg.SlackUserToken)
-	}
-	gadget.signingSecret = cfg.SigningSecret
-	gadget.listenPort = cfg.ListenPort
-
-	log.Debug().Str("globalAdmins", strings.Join(cfg.GlobalAdmins, ", ")).Msg("Pulled globalAdmins")
-
-	gadget.Router = *router.NewRouter()
+	gadget := newGadget(cfg)
 
-	gadget.Router.DefaultMentionRoute = *fallback.GetMentionRoute()
-	gadget.Router.DeniedMentionRoute = *permission_denied.GetMentionRoute()
-	gadget.Router.DeniedChannelMessageRoute = *permission_denied.GetChannelMessageRoute()
-	gadget.Router.DeniedSlashCommandRoute = *permission_denied.GetSlashCommandRoute()
-	gadget.Router.AddMentionRoutes(groups.GetMentionRoutes())
-	gadget.Router.AddMentionRoutes(user_info.GetMentionRoutes())
+	stopTracing, err := tracing.Setup(context.Background(), cfg.TracingExporter)
+	if err != nil {
+		return gadget, fmt.Errorf("set up tracing: %w", err)
+	}
+	gadget.stopTracing = stopTracing
+	if cfg.TracingExporter != "" {
+		log.Info().Str("exporter", cfg.TracingExporter).Msg("Tracing enabled")
+	}
 
 	log.Debug().Msg("Connecting to DB...")
 	var gormLogLevel gormlogger.LogLevel
@@ -274,12 +302,12 @@ func SetupWithConfig(cfg Config) (*Gadget, error) {
 		Logger: gormlogger.Default.LogMode(gormLogLevel),
 	})
 	if err != nil {
-		return &gadget, err
+		return gadget, err
 	}
 
 	sqlDB, err := db.DB()
 	if err != nil {
-		return &gadget, err
+		return gadget, err
 	}
 	sqlDB.SetMaxOpenConns(10)
 	sqlDB.SetMaxIdleConns(5)
@@ -302,26 +330,125 @@ func SetupWithConfig(cfg Config) (*Gadget, error) {
 		log.Debug().Str("version", version).Msg("Connected to DB")
 	}
 
+	if err := gadget.useDB(cfg, db); err != nil {
+		return gadget, err
+	}
+	if gadget.servesDefaultWorkspace() {
+		if err := gadget.LoadIdentity(context.Background()); err != nil {
+			return gadget, err
+		}
+	}
+	return gadget, gadget.connectAdapters(cfg)
+}
+
+// NewWithDB creates a Gadget like SetupWithConfig, but uses db instead of
+// connecting to the database cfg describes and leaves logging alone. Tests
+// use it with an in-memory database. It doesn't call LoadIdentity, which
+// Run does if nothing has yet.
+func NewWithDB(cfg Config, db *gorm.DB) (*Gadget, error) {
+	gadget := newGadget(cfg)
+	if err := gadget.useDB(cfg, db); err != nil {
+		return gadget, err
+	}
+	return gadget, gadget.connectAdapters(cfg)
+}
+
+// newGadget creates a Gadget with its Slack clients and built-in routes
+func newGadget(cfg Config) *Gadget {
+	gadget := &Gadget{
+		inflight:   &sync.WaitGroup{},
+		Metrics:    metrics.New(),
+		Identity:   &router.Identity{},
+		config:     cfg,
+		workspaces: &workspaces{},
+	}
+
+	gadget.Client = gadget.newSlackClient(cfg.SlackOAuthToken)
+	if cfg.SlackUserToken != "" {
+		gadget.UserClient = gadget.newSlackClient(cfg.SlackUserToken)
+	}
+	gadget.verifier = signing.NewVerifier(signing.Options{
+		Secrets:          append([]string{cfg.SigningSecret}, cfg.SigningSecrets...),
+		MaxSkew:          cfg.SigningMaxSkew,
+		ReplayProtection: cfg.ReplayProtection,
+	})
+	gadget.listenPort = cfg.ListenPort
+
+	log.Debug().Str("globalAdmins", strings.Join(cfg.GlobalAdmins, ", ")).Msg("Pulled globalAdmins")
+
+	gadget.Router = *router.NewRouter()
+	gadget.Router.Identity = gadget.Identity
+
+	defaults.SetRoutes(&gadget.Router)
+	gadget.Router.DefaultRateLimits = cfg.DefaultRateLimits
+	gadget.Router.AddMentionRoutes(groups.GetMentionRoutes())
+	gadget.Router.AddMentionRoutes(user_info.GetMentionRoutes())
+	gadget.Router.AddMentionRoutes(routes.GetMentionRoutes())
+	gadget.Router.AddMentionRoutes(reminders.GetMentionRoutes())
+	gadget.Router.AddScheduledJobs(reminders.GetScheduledJobs())
+	gadget.Router.AddBlockActionRoutes(helpers.GetBlockActionRoutes())
+	if cfg.DeployChannel != "" && cfg.DeployWebhookSecret != "" {
+		gadget.Router.AddWebhookRoute(*deploys.GetWebhookRoute(cfg.DeployChannel, cfg.DeployWebhookSecret))
+	}
+
+	return gadget
+}
+
+// useDB migrates db and sets up the parts of gadget that need it
+func (gadget *Gadget) useDB(cfg Config, db *gorm.DB) error {
 	gadget.Router.DbConnection = db
+	if err := gadget.Metrics.InstrumentDB(db); err != nil {
+		return fmt.Errorf("instrument database: %w", err)
+	}
+	if err := tracing.InstrumentDB(db); err != nil {
+		return fmt.Errorf("trace database: %w", err)
+	}
 	if err := gadget.Router.SetupDb(); err != nil {
-		return &gadget, fmt.Errorf("setup database: %w", err)
+		return fmt.Errorf("setup database: %w", err)
 	}
+	if cfg.SharedRateLimits {
+		gadget.Router.RateLimiter = router.NewDBRateLimiter(db)
+	}
+	if cfg.SlackClientID != "" {
+		store, err := installationStore(db, cfg.InstallationKey)
+		if err != nil {
+			return err
+		}
+		gadget.Installations = store
+	}
+
+	directoryOpts := directory.Options{TTL: cfg.DirectoryTTL}
+	if cfg.PersistProfiles {
+		directoryOpts.DB = db
+	}
+	gadget.Directory = directory.New(gadget.Client, directoryOpts)
 
+	// The config's global admins belong to Gadget's own workspace. Its team
+	// is "", which struct conditions would drop, matching other workspaces'
+	// users and groups, so the team is matched explicitly.
 	var globalAdmins models.Group
 	var globalAdminUsers []models.User
 
 	for _, userName := range cfg.GlobalAdmins {
 		var user models.User
-		db.FirstOrCreate(&user, models.User{Uuid: userName})
+		err := db.Where("team_id = ? AND uuid = ?", "", userName).
+			FirstOrCreate(&user, models.User{Uuid: userName}).Error
+		if err != nil {
+			return fmt.Errorf("load global admin %s: %w", userName, err)
+		}
 		globalAdminUsers = append(globalAdminUsers, user)
 	}
 
-	db.Where(models.Group{Name: "globalAdmins"}).FirstOrCreate(&globalAdmins)
+	err := db.Where("team_id = ? AND name = ?", "", "globalAdmins").
+		FirstOrCreate(&globalAdmins, models.Group{Name: "globalAdmins"}).Error
+	if err != nil {
+		return fmt.Errorf("load global admins group: %w", err)
+	}
 	if err := db.Model(&globalAdmins).Association("Members").Replace(globalAdminUsers); err != nil {
-		return &gadget, fmt.Errorf("replace global admin members: %w", err)
+		return fmt.Errorf("replace global admin members: %w", err)
 	}
 
-	return &gadget, nil
+	return nil
 }
 
 type requestState struct {
@@ -329,37 +456,172 @@ type requestState struct {
 	logger       zerolog.Logger
 	statusCode   int
 	accessDenied bool
+	rateLimited  bool
+	metrics      *metrics.Metrics
+	ctx          context.Context // carries the request's trace span
 }
 
-func newRequestState() requestState {
+// newRequestState starts the state of a request made in ctx. Its request ID
+// is added to ctx's span, and the span's trace ID to its logger.
+func (gadget Gadget) newRequestState(ctx context.Context) requestState {
+	requestID := generateRequestID()
+	logger := log.With().Str("request_id", requestID)
+	if traceID := tracing.TraceID(ctx); traceID != "" {
+		logger = logger.Str("trace_id", traceID)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("gadget.request_id", requestID))
+	}
 	return requestState{
 		start:      time.Now(),
-		logger:     log.With().Str("request_id", generateRequestID()).Logger(),
+		logger:     logger.Logger(),
 		statusCode: http.StatusOK,
+		metrics:    gadget.Metrics,
+		ctx:        ctx,
+	}
+}
+
+// recordOutcome counts the route of routeType that a request resolved to,
+// logs requests that were denied or rate limited and flags them for the
+// request log
+func (rs *requestState) recordOutcome(routeType, route string, outcome router.Outcome, u models.User) {
+	rs.metrics.RouteResolved(routeType, route, outcome.String())
+	switch outcome {
+	case router.Denied:
+		rs.logger.Warn().Str("user", u.Uuid).Msg("Permission failure")
+		rs.accessDenied = true
+	case router.RateLimited:
+		rs.logger.Warn().Str("user", u.Uuid).Msg("Rate limited")
+		rs.rateLimited = true
 	}
 }
 
-func (gadget Gadget) buildHandlerContext(logger zerolog.Logger) router.HandlerContext {
+// buildHandlerContext returns the context for handlers dispatched by work
+// done in ctx. Handlers outlive Slack's request, so they get ctx's values,
+// such as its trace span, but not its cancellation.
+func (gadget Gadget) buildHandlerContext(ctx context.Context, logger zerolog.Logger) router.HandlerContext {
+	ctx = context.WithoutCancel(ctx)
+	identity := gadget.Identity.Get()
+	r := gadget.Router.WithContext(ctx)
+	r.Identity = gadget.Identity
+	r.BotUID = identity.UserID
 	return router.HandlerContext{
-		Router:     gadget.Router,
+		Context:    ctx,
+		Router:     r,
 		BotClient:  gadget.Client,
 		UserClient: gadget.UserClient,
 		Logger:     logger,
+		Directory:  gadget.Directory,
+		Adapter:    slackadapter.New(gadget.Client, identity.UserID),
+		Metrics:    gadget.Metrics,
+		Identity:   identity,
+		Workspace: func(teamID string) (router.HandlerContext, error) {
+			ws, err := gadget.forTeam(ctx, teamID)
+			if err != nil {
+				return router.HandlerContext{}, err
+			}
+			return ws.buildHandlerContext(ctx, logger), nil
+		},
 	}
 }
 
 // logger is passed separately from ctx because safeGo uses it independently for panic-recovery logging.
 func (gadget Gadget) dispatchRoute(name string, logger zerolog.Logger, ctx router.HandlerContext, fn func(router.HandlerContext)) {
+	gadget.spawn(name, logger, func() {
+		gadget.runChain(name, ctx, fn)
+	})
+}
+
+// runChain runs fn for the route name behind the middleware, tracing the
+// whole chain and fn within it as spans of their own
+func (gadget Gadget) runChain(name string, ctx router.HandlerContext, fn func(router.HandlerContext)) {
+	if ctx.Context == nil {
+		ctx.Context = context.Background()
+	}
+	spanCtx, span := tracing.Tracer().Start(ctx.Context, "gadget.dispatch "+name, trace.WithAttributes(attribute.String("gadget.route", name)))
+	defer span.End()
+	ctx.Context = spanCtx
+
+	gadget.buildChain(func(c router.HandlerContext) {
+		pluginCtx, pluginSpan := tracing.Tracer().Start(c.Context, "gadget.plugin "+name, trace.WithAttributes(attribute.String("gadget.route", name)))
+		panicked := true
+		defer func() {
+			if panicked {
+				pluginSpan.SetStatus(codes.Error, "plugin panicked")
+			}
+			pluginSpan.End()
+		}()
+		c.Context = pluginCtx
+		c.Router = c.Router.WithContext(pluginCtx)
+		fn(c)
+		panicked = false
+	})(ctx)
+}
+
+// spawn runs fn with safeGo, counting it as in flight until it returns and
+// recording how long it took and whether it panicked
+func (gadget Gadget) spawn(name string, logger zerolog.Logger, fn func()) {
+	if gadget.inflight != nil {
+		gadget.inflight.Add(1)
+	}
+	gadget.Metrics.PluginDispatched()
 	safeGo(name, logger, func() {
-		gadget.buildChain(fn)(ctx)
+		start := time.Now()
+		panicked := true
+		defer func() {
+			gadget.Metrics.PluginFinished(name, time.Since(start), panicked)
+			if gadget.inflight != nil {
+				gadget.inflight.Done()
+			}
+		}()
+		fn()
+		panicked = false
 	})
 }
 
+// Wait blocks until every handler dispatched so far has returned, e.g. so a
+// test can assert on what a handler did, or so a bot can let running
+// handlers finish after its server stops.
+func (gadget Gadget) Wait() {
+	if gadget.inflight != nil {
+		gadget.inflight.Wait()
+	}
+}
+
+// dispatchConversation routes msg to the step waiting on its conversation, if
+// any, and reports whether the message was consumed. The conversation ends
+// before the step runs; steps that expect another reply call
+// ContinueConversation. Messages are dropped if the database fails, since
+// they might belong to a conversation.
+func (gadget Gadget) dispatchConversation(logger zerolog.Logger, ctx router.HandlerContext, msg router.ConversationMessage) bool {
+	conv, step, exists, err := gadget.Router.ClaimConversation(msg.ConversationKey)
+	if err != nil {
+		logger.Error().Err(err).Str("user", msg.User).Msg("Failed to claim conversation")
+		return true
+	}
+	if !exists {
+		return false
+	}
+
+	if gadget.Router.IsConversationCancel(msg.Text) {
+		logger.Debug().Str("user", msg.User).Str("step", step.Name).Msg("Conversation cancelled")
+		step = gadget.Router.CancelledConversationStep
+		if step.Plugin == nil {
+			return true
+		}
+	}
+
+	logger.Debug().Str("user", msg.User).Str("step", step.Name).Msg(msg.Text)
+	s := step // capture for closure
+	gadget.dispatchRoute(s.Name, logger, ctx, func(c router.HandlerContext) {
+		s.Execute(c, conv, msg)
+	})
+	return true
+}
+
 func (gadget Gadget) handleEvent(w http.ResponseWriter, r *http.Request) {
-	rs := newRequestState()
-	defer func() { requestLog(rs.statusCode, *r, rs.accessDenied, rs.start, rs.logger) }()
+	rs := gadget.newRequestState(r.Context())
+	defer func() { requestLog(rs.statusCode, *r, rs.accessDenied, rs.rateLimited, rs.start, rs.logger) }()
 
-	body, code, err := verifySlackRequest(w, r, gadget.signingSecret, rs.logger)
+	body, code, err := gadget.verifySlackRequest(w, r, "events", rs.logger)
 	if err != nil {
 		rs.statusCode = code
 		return
@@ -390,83 +652,150 @@ func (gadget Gadget) handleEvent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if eventsAPIEvent.Type == slackevents.CallbackEvent {
-		innerEvent := eventsAPIEvent.InnerEvent
-		err := gadget.Router.UpdateBotUID(body)
+		enterpriseID, teamID := eventsAPIEvent.EnterpriseID, eventsAPIEvent.TeamID
+		if gadget.Installations != nil && eventsAPIEvent.InnerEvent.Type == string(slackevents.AppUninstalled) {
+			gadget.uninstall(rs.ctx, enterpriseID, teamID)
+			return
+		}
+		workspace, err := gadget.forWorkspace(rs.ctx, enterpriseID, teamID)
+		if notInstalled(&rs, err, enterpriseID, teamID) {
+			return
+		}
 		if err != nil {
-			rs.logger.Error().Err(err).Msg("Failed to update bot UID")
-			rs.statusCode = http.StatusInternalServerError
-			w.WriteHeader(rs.statusCode)
+			failWorkspace(w, &rs, err)
 			return
 		}
+		workspace.dispatchEvent(&rs, eventsAPIEvent.InnerEvent)
+	}
+}
+
+// DispatchEvent routes event to plugins as if Slack had sent it to Gadget's
+// HTTP handler, without waiting for them to finish. Adapters and the
+// console use it to feed Gadget events from elsewhere; gadget.Identity must
+// already be loaded. Events are handled in the default workspace.
+func (gadget Gadget) DispatchEvent(event slackevents.EventsAPIInnerEvent) {
+	rs := gadget.newRequestState(context.Background())
+	gadget.dispatchEvent(&rs, event)
+}
+
+// dispatchEvent routes a callback event to plugins
+func (gadget Gadget) dispatchEvent(rs *requestState, innerEvent slackevents.EventsAPIInnerEvent) {
+	gadget.Metrics.EventReceived(innerEvent.Type)
+	// Directory updates aren't routed to plugins
+	if gadget.Directory != nil && gadget.Directory.HandleEvent(innerEvent.Data) {
+		return
+	}
+
+	identity := gadget.Identity.Get()
+	eventUser := userFromInnerEvent(&innerEvent)
+	// Ignore all events that Gadget, or any other bot, produces to avoid
+	// infinite loops
+	if eventUser == identity.UserID || botFromInnerEvent(&innerEvent) != "" {
+		return
+	}
+
+	currentUser := gadget.Router.WithContext(rs.ctx).FindOrCreateUser(eventUser)
 
-		eventUser := userFromInnerEvent(&innerEvent)
-		// Ignore all events that Gadget produces to avoid infinite loops
-		if gadget.Router.BotUID == eventUser {
-			w.WriteHeader(http.StatusOK)
+	ctx := gadget.buildHandlerContext(rs.ctx, rs.logger)
+
+	switch ev := innerEvent.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		ctx := ctx.WithOrigin(router.OriginFromMention(*ev))
+		trimmedMessage := stripBotMention(ev.Text, identity.UserID)
+		msg := router.ConversationMessage{
+			ConversationKey: router.ConversationKeyFromMention(*ev),
+			TimeStamp:       ev.TimeStamp,
+			Text:            trimmedMessage,
+		}
+		if gadget.dispatchConversation(rs.logger, ctx, msg) {
 			return
 		}
 
-		var currentUser models.User
-		gadget.Router.DbConnection.FirstOrCreate(&currentUser, models.User{Uuid: eventUser})
-
-		ctx := gadget.buildHandlerContext(rs.logger)
+		route, outcome := gadget.Router.WithContext(rs.ctx).ResolveMention(trimmedMessage, ev.Channel, currentUser)
+		// Platform-neutral routes handle mentions that no MentionRoute does
+		if outcome == router.Fallback && gadget.dispatchSlackMessage(rs, ctx, slackadapter.FromMention(*ev, trimmedMessage), currentUser) {
+			return
+		}
+		rs.recordOutcome(router.RouteTypeMention, route.Name, outcome, currentUser)
 
-		switch ev := innerEvent.Data.(type) {
-		case *slackevents.AppMentionEvent:
-			trimmedMessage := stripBotMention(ev.Text, gadget.Router.BotUID)
-			route, exists := gadget.Router.FindMentionRouteByMessage(trimmedMessage)
-			if !exists {
-				route = gadget.Router.DefaultMentionRoute
-			}
+		rs.logger.Debug().Str("user", currentUser.Uuid).Str("route", route.Name).Msg(trimmedMessage)
 
-			if !gadget.Router.Can(currentUser, route.Permissions) {
-				rs.logger.Warn().Str("user", currentUser.Uuid).Str("route", route.Name).Msg("Permission failure")
-				rs.accessDenied = true
-				route = gadget.Router.DeniedMentionRoute
+		r := route // capture for closure
+		e := *ev
+		gadget.dispatchRoute(r.Name, rs.logger, ctx, func(c router.HandlerContext) {
+			r.Execute(c, e, trimmedMessage)
+		})
+	case *slackevents.MessageEvent:
+		ctx := ctx.WithOrigin(router.OriginFromMessage(*ev))
+		trimmedMessage := stripBotMention(ev.Text, identity.UserID)
+		// Messages that mention the bot also arrive as app_mention events,
+		// which are responsible for resuming the conversation.
+		if !strings.Contains(ev.Text, "<@"+identity.UserID+">") {
+			msg := router.ConversationMessage{
+				ConversationKey: router.ConversationKeyFromMessage(*ev),
+				TimeStamp:       ev.TimeStamp,
+				Text:            trimmedMessage,
 			}
-
-			rs.logger.Debug().Str("user", currentUser.Uuid).Str("route", route.Name).Msg(trimmedMessage)
-
-			r := route // capture for closure
-			e := *ev
-			gadget.dispatchRoute(r.Name, rs.logger, ctx, func(c router.HandlerContext) {
-				r.Execute(c, e, trimmedMessage)
-			})
-		case *slackevents.MessageEvent:
-			trimmedMessage := stripBotMention(ev.Text, gadget.Router.BotUID)
-			route, exists := gadget.Router.FindChannelMessageRouteByMessage(trimmedMessage)
-			if !exists {
-				rs.statusCode = http.StatusOK
-				w.WriteHeader(rs.statusCode)
+			if gadget.dispatchConversation(rs.logger, ctx, msg) {
 				return
 			}
+		}
 
-			if !gadget.Router.Can(currentUser, route.Permissions) {
-				rs.logger.Warn().Str("user", currentUser.Uuid).Str("route", route.Name).Msg("Permission failure")
-				rs.accessDenied = true
-				route = gadget.Router.DeniedChannelMessageRoute
+		route, outcome := gadget.Router.WithContext(rs.ctx).ResolveChannelMessage(trimmedMessage, ev.Channel, currentUser)
+		if outcome == router.Fallback {
+			// Direct messages are addressed to the bot, like mentions
+			if ev.ChannelType == "im" {
+				gadget.dispatchSlackMessage(rs, ctx, slackadapter.FromMessage(*ev, trimmedMessage), currentUser)
 			}
-
-			rs.logger.Debug().Str("user", currentUser.Uuid).Str("route", route.Name).Msg(trimmedMessage)
-			r := route // capture for closure
-			e := *ev
-			gadget.dispatchRoute(r.Name, rs.logger, ctx, func(c router.HandlerContext) {
-				r.Execute(c, e, trimmedMessage)
-			})
+			return
 		}
+		rs.recordOutcome(router.RouteTypeChannelMessage, route.Name, outcome, currentUser)
+
+		rs.logger.Debug().Str("user", currentUser.Uuid).Str("route", route.Name).Msg(trimmedMessage)
+		r := route // capture for closure
+		e := *ev
+		gadget.dispatchRoute(r.Name, rs.logger, ctx, func(c router.HandlerContext) {
+			r.Execute(c, e, trimmedMessage)
+		})
+	}
+}
+
+// writeEphemeral responds to a slash command with an ephemeral message. It
+// returns false if the response could not be encoded.
+func (gadget Gadget) writeEphemeral(w http.ResponseWriter, rs *requestState, text string) bool {
+	resp, err := json.Marshal(map[string]string{
+		"response_type": "ephemeral",
+		"text":          text,
+	})
+	if err != nil {
+		rs.logger.Error().Err(err).Msg("Failed to marshal ephemeral response")
+		rs.statusCode = http.StatusInternalServerError
+		w.WriteHeader(rs.statusCode)
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(resp); err != nil {
+		rs.logger.Error().Err(err).Msg("Failed to write ephemeral response")
 	}
+	return true
 }
 
 func (gadget Gadget) handleCommand(w http.ResponseWriter, r *http.Request) {
-	rs := newRequestState()
-	defer func() { requestLog(rs.statusCode, *r, rs.accessDenied, rs.start, rs.logger) }()
+	rs := gadget.newRequestState(r.Context())
+	defer func() { requestLog(rs.statusCode, *r, rs.accessDenied, rs.rateLimited, rs.start, rs.logger) }()
 
-	body, code, err := verifySlackRequest(w, r, gadget.signingSecret, rs.logger)
+	body, code, err := gadget.verifySlackRequest(w, r, "commands", rs.logger)
 	if err != nil {
 		rs.statusCode = code
 		return
 	}
 
+	// Slack posts interactivity payloads to the same URL as slash commands
+	if form, err := url.ParseQuery(string(body)); err == nil && form.Get("payload") != "" {
+		gadget.handleInteraction(w, &rs, form.Get("payload"))
+		return
+	}
+
 	// Restore body so SlashCommandParse can read it via ParseForm
 	r.Body = io.NopCloser(bytes.NewBuffer(body))
 	cmd, err := slack.SlashCommandParse(r)
@@ -477,57 +806,67 @@ func (gadget Gadget) handleCommand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	route, exists := gadget.Router.FindSlashCommandRouteByCommand(cmd.Command)
-	if !exists {
-		w.Header().Set("Content-Type", "application/json")
-		if _, err := w.Write([]byte(`{"response_type":"ephemeral","text":"Unknown command."}`)); err != nil {
-			rs.logger.Error().Err(err).Msg("Failed to write unknown command response")
-		}
+	workspace, err := gadget.forWorkspace(rs.ctx, cmd.EnterpriseID, cmd.TeamID)
+	if notInstalled(&rs, err, cmd.EnterpriseID, cmd.TeamID) {
+		gadget.writeEphemeral(w, &rs, notInstalledResponse)
 		return
 	}
+	if err != nil {
+		failWorkspace(w, &rs, err)
+		return
+	}
+	if text := workspace.dispatchCommand(&rs, cmd); text != "" {
+		gadget.writeEphemeral(w, &rs, text)
+	}
+}
 
-	var currentUser models.User
-	gadget.Router.DbConnection.FirstOrCreate(&currentUser, models.User{Uuid: cmd.UserID})
+// DispatchCommand routes cmd to plugins as if Slack had sent it to Gadget's
+// HTTP handler, without waiting for them to finish. It returns the
+// ephemeral response Slack would show the user, if any.
+func (gadget Gadget) DispatchCommand(cmd slack.SlashCommand) string {
+	rs := gadget.newRequestState(context.Background())
+	return gadget.dispatchCommand(&rs, cmd)
+}
 
-	ctx := gadget.buildHandlerContext(rs.logger)
+// dispatchCommand routes a slash command to plugins and returns the
+// ephemeral response to it, if any
+func (gadget Gadget) dispatchCommand(rs *requestState, cmd slack.SlashCommand) string {
+	gadget.Metrics.EventReceived("slash_command")
+	if !gadget.Router.HasSlashCommand(cmd.Command) {
+		return router.UnknownSlashCommandResponse
+	}
 
-	if !gadget.Router.Can(currentUser, route.Permissions) {
-		rs.logger.Warn().Str("user", currentUser.Uuid).Str("route", route.Name).Msg("Permission failure")
-		rs.accessDenied = true
-		w.Header().Set("Content-Type", "application/json")
-		if _, err := w.Write([]byte(`{"response_type":"ephemeral","text":"Permission denied."}`)); err != nil {
-			rs.logger.Error().Err(err).Msg("Failed to write permission denied response")
-		}
-		denied := gadget.Router.DeniedSlashCommandRoute
-		gadget.dispatchRoute(denied.Name, rs.logger, ctx, func(c router.HandlerContext) {
-			denied.Execute(c, cmd)
-		})
-		return
+	currentUser := gadget.Router.WithContext(rs.ctx).FindOrCreateUser(cmd.UserID)
+
+	route, outcome := gadget.Router.WithContext(rs.ctx).ResolveSlashCommand(cmd, currentUser)
+	rs.recordOutcome(router.RouteTypeSlashCommand, route.Name, outcome, currentUser)
+	switch outcome {
+	case router.Help:
+		return gadget.Router.SlashCommandHelp(cmd.Command, currentUser)
+	case router.Fallback:
+		return router.SlashCommandFallbackResponse(cmd.Command)
 	}
 
-	rs.logger.Debug().Str("user", currentUser.Uuid).Str("route", route.Name).Str("command", cmd.Command).Msg("Slash command")
-	if route.ImmediateResponse != nil {
-		if text := route.ImmediateResponse(); text != "" {
-			resp, err := json.Marshal(map[string]string{
-				"response_type": "ephemeral",
-				"text":          text,
-			})
-			if err != nil {
-				rs.logger.Error().Err(err).Msg("Failed to marshal immediate response")
-				rs.statusCode = http.StatusInternalServerError
-				w.WriteHeader(rs.statusCode)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			if _, err := w.Write(resp); err != nil {
-				rs.logger.Error().Err(err).Msg("Failed to write immediate response")
-			}
+	ctx := gadget.buildHandlerContext(rs.ctx, rs.logger).WithOrigin(router.OriginFromSlashCommand(cmd))
+
+	var response string
+	switch outcome {
+	case router.Denied:
+		response = router.DeniedSlashCommandResponse
+	case router.RateLimited:
+		response = router.RateLimitedSlashCommandResponse
+	default:
+		rs.logger.Debug().Str("user", currentUser.Uuid).Str("route", route.Name).Str("command", cmd.Command).Msg("Slash command")
+		if route.ImmediateResponse != nil {
+			response = route.ImmediateResponse()
 		}
 	}
+
 	cmdRoute := route // capture for closure
 	gadget.dispatchRoute(cmdRoute.Name, rs.logger, ctx, func(c router.HandlerContext) {
 		cmdRoute.Execute(c, cmd)
 	})
+	return response
 }
 
 // Handler returns an http.Handler with all Gadget routes registered.
@@ -535,10 +874,36 @@ func (gadget Gadget) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/gadget", gadget.handleEvent)
 	mux.HandleFunc("/gadget/command", gadget.handleCommand)
-	return mux
+	mux.HandleFunc(router.WebhookPathPrefix, gadget.handleWebhook)
+	mux.HandleFunc(AdminPath, gadget.handleAdmin)
+	if gadget.Installations != nil {
+		installer := gadget.installHandler()
+		mux.HandleFunc(install.InstallPath, installer.ServeInstall)
+		mux.HandleFunc(install.CallbackPath, installer.ServeCallback)
+	}
+	for pattern, h := range gadget.handlers {
+		mux.Handle(pattern, h)
+	}
+
+	// Scrapes and probes aren't traced
+	root := http.NewServeMux()
+	root.Handle("/", tracing.Handler(mux))
+	root.Handle(metrics.Path, gadget.Metrics.Handler())
+	root.HandleFunc(HealthPath, gadget.handleHealth)
+	root.HandleFunc(ReadyPath, gadget.handleReady)
+	return root
 }
 
+// Run loads the bot's identity if nothing has yet, starts the scheduler and
+// serves Gadget's HTTP handler on the listen port
 func (gadget Gadget) Run() error {
+	if gadget.servesDefaultWorkspace() && !gadget.Identity.Get().Known() {
+		if err := gadget.LoadIdentity(context.Background()); err != nil {
+			return err
+		}
+	}
+	go gadget.RunScheduler(context.Background())
+
 	handler := gadget.Handler()
 	port := gadget.getListenPort()
 	srv := &http.Server{
@@ -548,6 +913,19 @@ func (gadget Gadget) Run() error {
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	for _, hook := range gadget.Router.WebhookURLs("") {
+		log.Info().Str("route", hook.Name).Str("path", hook.URL).Str("auth", hook.Auth).Msg("Webhook mounted")
+	}
 	log.Info().Str("port", port).Msg("Server listening")
-	return srv.ListenAndServe()
+	err := srv.ListenAndServe()
+
+	// Send the spans still waiting to be exported
+	if gadget.stopTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if stopErr := gadget.stopTracing(ctx); stopErr != nil {
+			log.Warn().Err(stopErr).Msg("Failed to flush traces")
+		}
+	}
+	return err
 }
@@ -1,10 +1,16 @@
 package core
 
 import (
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/gadget-bot/gadget/models"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/rs/zerolog"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSetupWithConfig_PopulatesClientField(t *testing.T) {
@@ -54,7 +60,67 @@ func TestConfigFromEnv_ReadsDBPort(t *testing.T) {
 	assert.Equal(t, "3307", cfg.DBPort)
 }
 
-func TestGlobalAdminsFromString(t *testing.T) {
+func TestConfigFromEnv_ReadsDefaultRateLimit(t *testing.T) {
+	t.Setenv("GADGET_DEFAULT_RATE_LIMIT", "5/1m")
+	t.Setenv("GADGET_SHARED_RATE_LIMITS", "true")
+
+	cfg := ConfigFromEnv()
+
+	assert.Equal(t, []router.RateLimit{{Scope: router.RateLimitPerUser, Burst: 5, Every: 12 * time.Second}}, cfg.DefaultRateLimits)
+	assert.True(t, cfg.SharedRateLimits)
+}
+
+func TestConfigFromEnv_ReadsDeployWebhook(t *testing.T) {
+	t.Setenv("GADGET_DEPLOY_CHANNEL", "C0DEPLOY")
+	t.Setenv("GADGET_DEPLOY_WEBHOOK_SECRET", "s3cret")
+
+	cfg := ConfigFromEnv()
+
+	assert.Equal(t, "C0DEPLOY", cfg.DeployChannel)
+	assert.Equal(t, "s3cret", cfg.DeployWebhookSecret)
+}
+
+func TestConfigFromEnv_ReadsDirectory(t *testing.T) {
+	t.Setenv("GADGET_DIRECTORY_TTL", "15m")
+	t.Setenv("GADGET_PERSIST_PROFILES", "true")
+
+	cfg := ConfigFromEnv()
+
+	assert.Equal(t, 15*time.Minute, cfg.DirectoryTTL)
+	assert.True(t, cfg.PersistProfiles)
+}
+
+func TestConfigFromEnv_ReadsMattermost(t *testing.T) {
+	t.Setenv("GADGET_MATTERMOST_URL", "https://chat.example.com")
+	t.Setenv("GADGET_MATTERMOST_TOKEN", "bot-token")
+	t.Setenv("GADGET_MATTERMOST_WEBHOOK_TOKEN", "hook-token")
+
+	cfg := ConfigFromEnv()
+
+	assert.Equal(t, "https://chat.example.com", cfg.MattermostURL)
+	assert.Equal(t, "bot-token", cfg.MattermostToken)
+	assert.Equal(t, "hook-token", cfg.MattermostWebhookToken)
+}
+
+func TestConfigFromEnv_ReadsTracingExporter(t *testing.T) {
+	t.Setenv("GADGET_TRACING_EXPORTER", "otlp")
+
+	assert.Equal(t, "otlp", ConfigFromEnv().TracingExporter)
+}
+
+func TestConfigFromEnv_ReadsAdminToken(t *testing.T) {
+	t.Setenv("GADGET_ADMIN_TOKEN", "admin-token")
+
+	assert.Equal(t, "admin-token", ConfigFromEnv().AdminToken)
+}
+
+func TestSetupWithConfig_UnknownTracingExporter(t *testing.T) {
+	_, err := SetupWithConfig(Config{TracingExporter: "zipkin"})
+
+	assert.ErrorContains(t, err, "set up tracing")
+}
+
+func TestSplitList(t *testing.T) {
 	tests := []struct {
 		name     string
 		input    string
@@ -70,7 +136,7 @@ func TestGlobalAdminsFromString(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := globalAdminsFromString(tt.input)
+			result := splitList(tt.input)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -136,3 +202,114 @@ func TestUserFromInnerEvent(t *testing.T) {
 		})
 	}
 }
+
+func TestBotFromInnerEvent(t *testing.T) {
+	assert.Equal(t, "B123", botFromInnerEvent(&slackevents.EventsAPIInnerEvent{Data: &slackevents.AppMentionEvent{BotID: "B123"}}))
+	assert.Equal(t, "B456", botFromInnerEvent(&slackevents.EventsAPIInnerEvent{Data: &slackevents.MessageEvent{User: "U456", BotID: "B456"}}))
+	assert.Empty(t, botFromInnerEvent(&slackevents.EventsAPIInnerEvent{Data: &slackevents.MessageEvent{User: "U456"}}))
+	assert.Empty(t, botFromInnerEvent(&slackevents.EventsAPIInnerEvent{Data: struct{}{}}))
+}
+
+func TestMiddleware_ReturnsChainInOrder(t *testing.T) {
+	var g Gadget
+	var calls []string
+	g.Use(func(ctx router.HandlerContext, next func(router.HandlerContext)) {
+		calls = append(calls, "first")
+		next(ctx)
+	})
+	g.Use(func(ctx router.HandlerContext, next func(router.HandlerContext)) {
+		calls = append(calls, "second")
+		next(ctx)
+	})
+
+	router.Chain(g.Middleware(), func(router.HandlerContext) {})(router.HandlerContext{})
+
+	assert.Equal(t, []string{"first", "second"}, calls)
+}
+
+func TestNewWithDB_UsesDB(t *testing.T) {
+	db := setupTestDB(t)
+
+	gadget, err := NewWithDB(Config{GlobalAdmins: []string{"U_ADMIN"}}, db)
+
+	require.NoError(t, err)
+	assert.Same(t, db, gadget.Router.DbConnection)
+	assert.NotNil(t, gadget.Directory)
+	var admins models.Group
+	require.NoError(t, db.Preload("Members").Where("name = ?", "globalAdmins").First(&admins).Error)
+	require.Len(t, admins.Members, 1)
+	assert.Equal(t, "U_ADMIN", admins.Members[0].Uuid)
+}
+
+func TestNewWithDB_SeedsOnlyItsOwnWorkspacesAdmins(t *testing.T) {
+	db := setupTestDB(t)
+	// the tenant was installed first, so its rows come first
+	tenantAdmin := models.User{TeamID: "T_TENANT", Uuid: "U_ADMIN"}
+	require.NoError(t, db.Create(&tenantAdmin).Error)
+	tenantAdmins := models.Group{TeamID: "T_TENANT", Name: "globalAdmins"}
+	require.NoError(t, db.Create(&tenantAdmins).Error)
+	require.NoError(t, db.Model(&tenantAdmins).Association("Members").Append(&tenantAdmin))
+
+	_, err := NewWithDB(Config{GlobalAdmins: []string{"U_ADMIN", "U_OTHER"}}, db)
+	require.NoError(t, err)
+
+	var groups []models.Group
+	require.NoError(t, db.Preload("Members").Where("name = ?", "globalAdmins").Order("team_id").Find(&groups).Error)
+	require.Len(t, groups, 2)
+	assert.Empty(t, groups[0].TeamID)
+	assert.Len(t, groups[0].Members, 2)
+	for _, member := range groups[0].Members {
+		assert.Empty(t, member.TeamID)
+	}
+	assert.Equal(t, "T_TENANT", groups[1].TeamID)
+	require.Len(t, groups[1].Members, 1, "the tenant's admins are left alone")
+	assert.Equal(t, tenantAdmin.ID, groups[1].Members[0].ID)
+}
+
+func TestGadget_WaitForDispatchedHandlers(t *testing.T) {
+	gadget, err := NewWithDB(Config{}, setupTestDB(t))
+	require.NoError(t, err)
+	var finished atomic.Bool
+
+	gadget.dispatchRoute("slow", zerolog.Nop(), router.HandlerContext{}, func(router.HandlerContext) {
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+	})
+	gadget.Wait()
+
+	assert.True(t, finished.Load())
+}
+
+func TestGadget_WaitWithoutConstructor(t *testing.T) {
+	var gadget Gadget
+
+	assert.NotPanics(t, gadget.Wait)
+}
+
+func TestConfigFromEnv_ReadsOAuth(t *testing.T) {
+	t.Setenv("SLACK_CLIENT_ID", "client-id")
+	t.Setenv("SLACK_CLIENT_SECRET", "client-secret")
+	t.Setenv("GADGET_OAUTH_REDIRECT_URL", "https://gadget.example.com/gadget/oauth/callback")
+	t.Setenv("GADGET_OAUTH_SCOPES", "chat:write, app_mentions:read")
+	t.Setenv("GADGET_OAUTH_USER_SCOPES", "")
+
+	cfg := ConfigFromEnv()
+
+	assert.Equal(t, "client-id", cfg.SlackClientID)
+	assert.Equal(t, "client-secret", cfg.SlackClientSecret)
+	assert.Equal(t, "https://gadget.example.com/gadget/oauth/callback", cfg.OAuthRedirectURL)
+	assert.Equal(t, []string{"chat:write", "app_mentions:read"}, cfg.OAuthScopes)
+	assert.Nil(t, cfg.OAuthUserScopes)
+}
+
+func TestConfigFromEnv_ReadsSigning(t *testing.T) {
+	t.Setenv("SLACK_SIGNING_SECRETS", "old-secret, older-secret")
+	t.Setenv("GADGET_SIGNING_MAX_SKEW", "2m")
+	t.Setenv("GADGET_REPLAY_PROTECTION", "true")
+
+	cfg := ConfigFromEnv()
+
+	assert.Equal(t, []string{"old-secret", "older-secret"}, cfg.SigningSecrets)
+	assert.Equal(t, 2*time.Minute, cfg.SigningMaxSkew)
+	assert.True(t, cfg.ReplayProtection)
+}
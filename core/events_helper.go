@@ -14,3 +14,16 @@ func userFromInnerEvent(event *slackevents.EventsAPIInnerEvent) string {
 		return ""
 	}
 }
+
+// botFromInnerEvent returns the bot_id of the bot that produced event, or ""
+// if a person did
+func botFromInnerEvent(event *slackevents.EventsAPIInnerEvent) string {
+	switch ev := event.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		return ev.BotID
+	case *slackevents.MessageEvent:
+		return ev.BotID
+	default:
+		return ""
+	}
+}
@@ -16,12 +16,18 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gadget-bot/gadget/directory"
+	"github.com/gadget-bot/gadget/gadgettest"
 	"github.com/gadget-bot/gadget/models"
 	"github.com/gadget-bot/gadget/router"
+	"github.com/gadget-bot/gadget/signing"
+	"github.com/gadget-bot/gadget/slackapi"
 	"github.com/rs/zerolog"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
@@ -44,9 +50,14 @@ const testSecret = "test-signing-secret"
 
 // signRequest sets the Slack signing headers on the given request.
 func signRequest(r *http.Request, body string) {
-	ts := fmt.Sprintf("%d", time.Now().Unix())
+	signRequestWith(r, testSecret, body, time.Now())
+}
+
+// signRequestWith signs the request like Slack would have with secret at t
+func signRequestWith(r *http.Request, secret, body string, t time.Time) {
+	ts := fmt.Sprintf("%d", t.Unix())
 	baseString := fmt.Sprintf("v0:%s:%s", ts, body)
-	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac := hmac.New(sha256.New, []byte(secret))
 	mac.Write([]byte(baseString))
 	sig := "v0=" + hex.EncodeToString(mac.Sum(nil))
 
@@ -63,7 +74,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	if err != nil {
 		t.Fatalf("Failed to open in-memory SQLite: %v", err)
 	}
-	if err := db.AutoMigrate(&models.Group{}, &models.User{}); err != nil {
+	if err := db.AutoMigrate(&models.Group{}, &models.User{}, &models.Conversation{}, &models.RouteToggle{}, &models.RateLimitBucket{}, &models.JobRun{}); err != nil {
 		t.Fatalf("Failed to auto-migrate: %v", err)
 	}
 	return db
@@ -72,9 +83,10 @@ func setupTestDB(t *testing.T) *gorm.DB {
 func newTestGadget(t *testing.T) Gadget {
 	t.Helper()
 	g := Gadget{
-		Router:        *router.NewRouter(),
-		Client:        slack.New("xoxb-fake"),
-		signingSecret: testSecret,
+		Router:   *router.NewRouter(),
+		Client:   slack.New("xoxb-fake"),
+		Identity: &router.Identity{},
+		verifier: signing.NewVerifier(signing.Options{Secrets: []string{testSecret}}),
 	}
 	g.Router.DbConnection = setupTestDB(t)
 	return g
@@ -115,6 +127,60 @@ func TestGadgetHandler_InvalidSignature(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, rr.Code)
 }
 
+func TestGadgetHandler_RotatedSigningSecrets(t *testing.T) {
+	gadget, err := NewWithDB(Config{SigningSecret: "new-secret", SigningSecrets: []string{testSecret}}, setupTestDB(t))
+	require.NoError(t, err)
+
+	body := `{"type":"url_verification","challenge":"abc"}`
+	for secret, want := range map[string]int{"new-secret": http.StatusOK, testSecret: http.StatusOK, "retired-secret": http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodPost, "/gadget", strings.NewReader(body))
+		signRequestWith(req, secret, body, time.Now())
+
+		assert.Equal(t, want, serve(gadget, req).Code, secret)
+	}
+}
+
+func TestGadgetHandler_RejectsReplaysAndStaleRequests(t *testing.T) {
+	gadget, err := NewWithDB(Config{SigningSecret: testSecret, SigningMaxSkew: time.Minute, ReplayProtection: true}, setupTestDB(t))
+	require.NoError(t, err)
+	body := `{"type":"url_verification","challenge":"abc"}`
+	post := func(ts time.Time, sign func(*http.Request)) int {
+		req := httptest.NewRequest(http.MethodPost, "/gadget", strings.NewReader(body))
+		signRequestWith(req, testSecret, body, ts)
+		if sign != nil {
+			sign(req)
+		}
+		return serve(gadget, req).Code
+	}
+	captured := time.Now()
+
+	assert.Equal(t, http.StatusOK, post(captured, nil))
+	assert.Equal(t, http.StatusUnauthorized, post(captured, nil), "replayed")
+	assert.Equal(t, http.StatusUnauthorized, post(time.Now().Add(-2*time.Minute), nil), "older than the skew")
+	assert.Equal(t, http.StatusUnauthorized, post(time.Now(), func(r *http.Request) { r.Header.Del("X-Slack-Signature") }))
+
+	metrics := serve(gadget, httptest.NewRequest(http.MethodGet, "/metrics", nil)).Body.String()
+	for _, line := range []string{
+		`gadget_requests_rejected_total{endpoint="events",reason="replayed"} 1`,
+		`gadget_requests_rejected_total{endpoint="events",reason="stale_timestamp"} 1`,
+		`gadget_requests_rejected_total{endpoint="events",reason="missing_headers"} 1`,
+	} {
+		assert.Contains(t, metrics, line)
+	}
+}
+
+func TestCommandHandler_CountsRejections(t *testing.T) {
+	gadget, err := NewWithDB(Config{SigningSecret: testSecret}, setupTestDB(t))
+	require.NoError(t, err)
+	body := "command=%2Fdeploy"
+	req := httptest.NewRequest(http.MethodPost, "/gadget/command", strings.NewReader(body))
+	signRequestWith(req, "wrong-secret", body, time.Now())
+
+	assert.Equal(t, http.StatusUnauthorized, serve(gadget, req).Code)
+	metrics := serve(gadget, httptest.NewRequest(http.MethodGet, "/metrics", nil)).Body.String()
+	assert.Contains(t, metrics, `gadget_requests_rejected_total{endpoint="commands",reason="bad_signature"} 1`)
+}
+
 func TestGadgetHandler_CallbackEventCallsPlugin(t *testing.T) {
 	g := newTestGadget(t)
 
@@ -128,7 +194,7 @@ func TestGadgetHandler_CallbackEventCallsPlugin(t *testing.T) {
 			close(pluginCalled)
 		},
 	})
-	g.Router.BotUID = "U_BOT"
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
 
 	handler := g.Handler()
 
@@ -168,6 +234,33 @@ func TestGadgetHandler_CallbackEventCallsPlugin(t *testing.T) {
 	}
 }
 
+func TestGadgetHandler_CallbackEventWithoutAuthorizations(t *testing.T) {
+	g := newTestGadget(t)
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
+	pluginCalled := make(chan string, 1)
+	g.Router.AddMentionRoute(router.MentionRoute{
+		Route: router.Route{Name: "test-route", Pattern: `(?i)^hello`},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+			pluginCalled <- message
+		},
+	})
+
+	// The bot's identity comes from startup, not the event's authorizations
+	body := `{"type":"event_callback","event":{"type":"app_mention","user":"U_USER","text":"<@U_BOT> hello","channel":"C123","ts":"1.1"}}`
+	req := httptest.NewRequest(http.MethodPost, "/gadget", strings.NewReader(body))
+	signRequest(req, body)
+	rr := httptest.NewRecorder()
+	g.Handler().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	select {
+	case message := <-pluginCalled:
+		assert.Equal(t, "hello", message)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for plugin to be called")
+	}
+}
+
 func TestGadgetHandler_CallbackEventPassesUserClientInContext(t *testing.T) {
 	g := newTestGadget(t)
 	g.UserClient = slack.New("xoxp-fake") //nolint:gosec // test credentials
@@ -182,7 +275,7 @@ func TestGadgetHandler_CallbackEventPassesUserClientInContext(t *testing.T) {
 			ctxUserClient <- ctx.UserClient
 		},
 	})
-	g.Router.BotUID = "U_BOT"
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
 
 	handler := g.Handler()
 
@@ -236,7 +329,7 @@ func TestGadgetHandler_ChannelMessageCallsPlugin(t *testing.T) {
 			close(pluginCalled)
 		},
 	})
-	g.Router.BotUID = "U_BOT"
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
 
 	handler := g.Handler()
 
@@ -302,7 +395,7 @@ func TestGadgetHandler_ChannelMessagePermissionDenied(t *testing.T) {
 			close(deniedCalled)
 		},
 	}
-	g.Router.BotUID = "U_BOT"
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
 
 	handler := g.Handler()
 
@@ -375,7 +468,7 @@ func TestGadgetHandler_MentionPermissionDenied(t *testing.T) {
 			close(deniedCalled)
 		},
 	}
-	g.Router.BotUID = "U_BOT"
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
 
 	handler := g.Handler()
 
@@ -549,7 +642,7 @@ func TestMiddleware_CalledAroundHandler(t *testing.T) {
 			close(done)
 		},
 	})
-	g.Router.BotUID = "U_BOT"
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
 
 	handler := g.Handler()
 
@@ -588,3 +681,550 @@ func TestMiddleware_CalledAroundHandler(t *testing.T) {
 
 	assert.Equal(t, []string{"before", "handler", "after"}, order)
 }
+
+func TestGadgetHandler_MentionResumesConversation(t *testing.T) {
+	g := newTestGadget(t)
+
+	routeCalled := make(chan struct{}, 1)
+	g.Router.AddMentionRoute(router.MentionRoute{
+		Route: router.Route{Name: "catch-all", Pattern: `.*`},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+			routeCalled <- struct{}{}
+		},
+	})
+
+	replies := make(chan string, 1)
+	g.Router.AddConversationStep(router.ConversationStep{
+		Name: "deploy.askEnvironment",
+		Plugin: func(ctx router.HandlerContext, conv router.Conversation, msg router.ConversationMessage) {
+			var state map[string]string
+			assert.NoError(t, conv.Decode(&state))
+			replies <- state["app"] + ":" + msg.Text
+		},
+	})
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
+	key := router.ConversationKey{User: "U_USER", Channel: "C123"}
+	assert.NoError(t, g.Router.SaveConversation(key, "deploy.askEnvironment", map[string]string{"app": "api"}))
+
+	handler := g.Handler()
+
+	eventPayload := map[string]interface{}{
+		"type":           "event_callback",
+		"authorizations": []map[string]string{{"user_id": "U_BOT", "team_id": "T123"}},
+		"event": map[string]interface{}{
+			"type":    "app_mention",
+			"user":    "U_USER",
+			"text":    "<@U_BOT> production",
+			"channel": "C123",
+			"ts":      "1234567890.123456",
+		},
+	}
+	body, _ := json.Marshal(eventPayload)
+	bodyStr := string(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/gadget", strings.NewReader(bodyStr))
+	signRequest(req, bodyStr)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	select {
+	case reply := <-replies:
+		assert.Equal(t, "api:production", reply)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for conversation step")
+	}
+
+	select {
+	case <-routeCalled:
+		t.Fatal("mention route should not be called while a conversation is waiting")
+	default:
+	}
+
+	_, _, found := g.Router.FindConversation(key)
+	assert.False(t, found, "conversation should end unless the step continues it")
+}
+
+func TestGadgetHandler_ConversationDatabaseErrorDropsMessage(t *testing.T) {
+	g := newTestGadget(t)
+	routeCalled := make(chan struct{}, 1)
+	g.Router.AddMentionRoute(router.MentionRoute{
+		Route: router.Route{Name: "catch-all", Pattern: `.*`},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+			routeCalled <- struct{}{}
+		},
+	})
+	g.Router.AddConversationStep(router.ConversationStep{
+		Name:   "deploy.askEnvironment",
+		Plugin: func(ctx router.HandlerContext, conv router.Conversation, msg router.ConversationMessage) {},
+	})
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
+	require.NoError(t, g.Router.DbConnection.Migrator().DropTable(&models.Conversation{}))
+
+	rr := postEvent(&g, "", mention("U_BOT", "production"))
+	g.Wait()
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	select {
+	case <-routeCalled:
+		t.Fatal("a message that might answer a conversation shouldn't fall through to routes")
+	default:
+	}
+}
+
+func TestGadgetHandler_ChannelMessageCancelsConversation(t *testing.T) {
+	g := newTestGadget(t)
+
+	g.Router.AddConversationStep(router.ConversationStep{
+		Name: "deploy.askEnvironment",
+		Plugin: func(ctx router.HandlerContext, conv router.Conversation, msg router.ConversationMessage) {
+			t.Error("waiting step should not be called on cancel")
+		},
+	})
+	cancelled := make(chan struct{})
+	g.Router.CancelledConversationStep = router.ConversationStep{
+		Name: "conversation_cancelled",
+		Plugin: func(ctx router.HandlerContext, conv router.Conversation, msg router.ConversationMessage) {
+			close(cancelled)
+		},
+	}
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
+	key := router.ConversationKey{User: "U_USER", Channel: "C123", ThreadTimeStamp: "1234567890.000001"}
+	assert.NoError(t, g.Router.SaveConversation(key, "deploy.askEnvironment", nil))
+
+	handler := g.Handler()
+
+	eventPayload := map[string]interface{}{
+		"type":           "event_callback",
+		"authorizations": []map[string]string{{"user_id": "U_BOT", "team_id": "T123"}},
+		"event": map[string]interface{}{
+			"type":         "message",
+			"user":         "U_USER",
+			"text":         "cancel",
+			"channel":      "C123",
+			"channel_type": "channel",
+			"thread_ts":    "1234567890.000001",
+			"ts":           "1234567890.123456",
+		},
+	}
+	body, _ := json.Marshal(eventPayload)
+	bodyStr := string(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/gadget", strings.NewReader(bodyStr))
+	signRequest(req, bodyStr)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for cancelled step")
+	}
+
+	_, _, found := g.Router.FindConversation(key)
+	assert.False(t, found)
+}
+
+func TestCommandHandler_RoutesSubcommand(t *testing.T) {
+	g := newTestGadget(t)
+
+	called := make(chan string, 1)
+	g.Router.AddSlashCommandRoutes([]router.SlashCommandRoute{
+		{
+			Route:   router.Route{Name: "deploy.rollback", Pattern: `(?i)^rollback (\w+)$`},
+			Command: "/deploy",
+			Plugin: func(ctx router.HandlerContext, cmd slack.SlashCommand) {
+				called <- ctx.Route.Name
+			},
+		},
+		{
+			Route:   router.Route{Name: "deploy"},
+			Command: "/deploy",
+			Plugin: func(ctx router.HandlerContext, cmd slack.SlashCommand) {
+				called <- ctx.Route.Name
+			},
+		},
+	})
+
+	handler := g.Handler()
+
+	for text, expected := range map[string]string{"rollback prod": "deploy.rollback", "api": "deploy"} {
+		body := url.Values{"command": {"/deploy"}, "user_id": {"U123"}, "text": {text}}.Encode()
+		req := httptest.NewRequest(http.MethodPost, "/gadget/command", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		signRequest(req, body)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		select {
+		case name := <-called:
+			assert.Equal(t, expected, name)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %s", expected)
+		}
+	}
+}
+
+func TestCommandHandler_SubcommandPermissionDenied(t *testing.T) {
+	g := newTestGadget(t)
+
+	g.Router.AddSlashCommandRoute(router.SlashCommandRoute{
+		Route:   router.Route{Name: "deploy.rollback", Pattern: `(?i)^rollback`, Permissions: []string{"deployers"}},
+		Command: "/deploy",
+		Plugin: func(ctx router.HandlerContext, cmd slack.SlashCommand) {
+			t.Error("restricted subcommand should not be called")
+		},
+	})
+	deniedCalled := make(chan struct{})
+	g.Router.DeniedSlashCommandRoute = router.SlashCommandRoute{
+		Route: router.Route{Name: "permission_denied"},
+		Plugin: func(ctx router.HandlerContext, cmd slack.SlashCommand) {
+			close(deniedCalled)
+		},
+	}
+
+	handler := g.Handler()
+
+	body := url.Values{"command": {"/deploy"}, "user_id": {"U123"}, "text": {"rollback prod"}}.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/gadget/command", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	signRequest(req, body)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	assert.JSONEq(t, `{"response_type":"ephemeral","text":"Permission denied."}`, rr.Body.String())
+	select {
+	case <-deniedCalled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for denied route")
+	}
+}
+
+func TestCommandHandler_GeneratedHelp(t *testing.T) {
+	g := newTestGadget(t)
+
+	g.Router.AddSlashCommandRoute(router.SlashCommandRoute{
+		Route:   router.Route{Name: "deploy.status", Pattern: `(?i)^status$`, Help: "status", Description: "Show deploy status"},
+		Command: "/deploy",
+		Plugin:  func(ctx router.HandlerContext, cmd slack.SlashCommand) {},
+	})
+
+	handler := g.Handler()
+
+	body := url.Values{"command": {"/deploy"}, "user_id": {"U123"}, "text": {"help"}}.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/gadget/command", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	signRequest(req, body)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	var resp map[string]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, "ephemeral", resp["response_type"])
+	assert.Contains(t, resp["text"], "`/deploy status` - Show deploy status")
+}
+
+func TestCommandHandler_NoMatchingSubcommand(t *testing.T) {
+	g := newTestGadget(t)
+
+	g.Router.AddSlashCommandRoute(router.SlashCommandRoute{
+		Route:   router.Route{Name: "deploy.status", Pattern: `(?i)^status$`},
+		Command: "/deploy",
+		Plugin:  func(ctx router.HandlerContext, cmd slack.SlashCommand) {},
+	})
+
+	handler := g.Handler()
+
+	body := url.Values{"command": {"/deploy"}, "user_id": {"U123"}, "text": {"launch"}}.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/gadget/command", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	signRequest(req, body)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	assert.Contains(t, rr.Body.String(), "/deploy help")
+}
+
+func TestGadgetHandler_DisabledMentionRouteUsesFallback(t *testing.T) {
+	g := newTestGadget(t)
+
+	g.Router.AddMentionRoute(router.MentionRoute{
+		Route: router.Route{Name: "deploy.run", Pattern: `(?i)^hello`},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+			t.Error("disabled route should not be called")
+		},
+	})
+	fallbackCalled := make(chan struct{})
+	g.Router.DefaultMentionRoute = router.MentionRoute{
+		Route: router.Route{Name: "fallback"},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+			close(fallbackCalled)
+		},
+	}
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
+	assert.NoError(t, g.Router.DisableRoute(router.NamespaceTarget("deploy"), "C123"))
+
+	handler := g.Handler()
+
+	eventPayload := map[string]interface{}{
+		"type":           "event_callback",
+		"authorizations": []map[string]string{{"user_id": "U_BOT", "team_id": "T123"}},
+		"event": map[string]interface{}{
+			"type":    "app_mention",
+			"user":    "U_USER",
+			"text":    "<@U_BOT> hello world",
+			"channel": "C123",
+			"ts":      "1234567890.123456",
+		},
+	}
+	body, _ := json.Marshal(eventPayload)
+	bodyStr := string(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/gadget", strings.NewReader(bodyStr))
+	signRequest(req, bodyStr)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	select {
+	case <-fallbackCalled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for fallback route")
+	}
+}
+
+func TestCommandHandler_RateLimited(t *testing.T) {
+	g := newTestGadget(t)
+	g.Router.RateLimiter = router.NewMemoryRateLimiter()
+
+	calls := make(chan struct{}, 2)
+	g.Router.AddSlashCommandRoute(router.SlashCommandRoute{
+		Route: router.Route{
+			Name:       "deploy",
+			RateLimits: []router.RateLimit{{Scope: router.RateLimitPerUser, Burst: 1, Every: time.Hour}},
+		},
+		Command: "/deploy",
+		Plugin: func(ctx router.HandlerContext, cmd slack.SlashCommand) {
+			calls <- struct{}{}
+		},
+	})
+	limitedCalled := make(chan struct{})
+	g.Router.RateLimitedSlashCommandRoute = router.SlashCommandRoute{
+		Route: router.Route{Name: "rate_limited"},
+		Plugin: func(ctx router.HandlerContext, cmd slack.SlashCommand) {
+			close(limitedCalled)
+		},
+	}
+
+	handler := g.Handler()
+	send := func() *httptest.ResponseRecorder {
+		body := url.Values{"command": {"/deploy"}, "user_id": {"U123"}, "channel_id": {"C123"}}.Encode()
+		req := httptest.NewRequest(http.MethodPost, "/gadget/command", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		signRequest(req, body)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	send()
+	select {
+	case <-calls:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for first command")
+	}
+
+	rr := send()
+	assert.Contains(t, rr.Body.String(), "Slow down")
+	select {
+	case <-limitedCalled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for rate limited route")
+	}
+	assert.Len(t, calls, 0, "rate limited command should not run the plugin")
+}
+
+func TestGadgetHandler_MentionSetsOrigin(t *testing.T) {
+	g := newTestGadget(t)
+
+	origins := make(chan router.Origin, 1)
+	g.Router.AddMentionRoute(router.MentionRoute{
+		Route: router.Route{Name: "test-route", Pattern: `(?i)^hello`},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+			origins <- ctx.Origin
+		},
+	})
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
+
+	eventPayload := map[string]interface{}{
+		"type":           "event_callback",
+		"authorizations": []map[string]string{{"user_id": "U_BOT", "team_id": "T123"}},
+		"event": map[string]interface{}{
+			"type":      "app_mention",
+			"user":      "U_USER",
+			"text":      "<@U_BOT> hello",
+			"channel":   "C123",
+			"ts":        "1234567890.000002",
+			"thread_ts": "1234567890.000001",
+		},
+	}
+	body, _ := json.Marshal(eventPayload)
+	req := httptest.NewRequest(http.MethodPost, "/gadget", strings.NewReader(string(body)))
+	signRequest(req, string(body))
+	g.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case origin := <-origins:
+		assert.Equal(t, router.Origin{Channel: "C123", ThreadTimeStamp: "1234567890.000001", TimeStamp: "1234567890.000002", User: "U_USER"}, origin)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for plugin to be called")
+	}
+}
+
+func TestCommandHandler_SetsOrigin(t *testing.T) {
+	g := newTestGadget(t)
+
+	origins := make(chan router.Origin, 1)
+	g.Router.AddSlashCommandRoute(router.SlashCommandRoute{
+		Route:   router.Route{Name: "deploy"},
+		Command: "/deploy",
+		Plugin: func(ctx router.HandlerContext, cmd slack.SlashCommand) {
+			origins <- ctx.Origin
+		},
+	})
+
+	body := url.Values{
+		"command":      {"/deploy"},
+		"user_id":      {"U123"},
+		"channel_id":   {"C123"},
+		"response_url": {"https://hooks.slack.com/commands/T123/456/abc"},
+	}.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/gadget/command", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	signRequest(req, body)
+	g.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case origin := <-origins:
+		assert.Equal(t, router.Origin{Channel: "C123", User: "U123", ResponseURL: "https://hooks.slack.com/commands/T123/456/abc"}, origin)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for command plugin to be called")
+	}
+}
+
+func TestGadgetHandler_DirectoryEventsUpdateDirectory(t *testing.T) {
+	g := newTestGadget(t)
+	// the directory must not need Slack for channels it was told about
+	g.Directory = directory.New(slack.New("xoxb-fake", slack.OptionAPIURL("http://127.0.0.1:0/")), directory.Options{})
+	g.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
+	handler := g.Handler()
+
+	for _, event := range []map[string]interface{}{
+		{"type": "channel_created", "channel": map[string]interface{}{"id": "C9", "name": "launch", "creator": "U_USER", "created": 1234567890}},
+		{"type": "channel_rename", "channel": map[string]interface{}{"id": "C9", "name": "launched", "created": 1234567890}},
+	} {
+		body, _ := json.Marshal(map[string]interface{}{
+			"type":           "event_callback",
+			"authorizations": []map[string]string{{"user_id": "U_BOT", "team_id": "T123"}},
+			"event":          event,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/gadget", strings.NewReader(string(body)))
+		signRequest(req, string(body))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	channel, err := g.Directory.ChannelByName("launched")
+	assert.NoError(t, err)
+	assert.Equal(t, "C9", channel.ID)
+}
+
+func TestGadgetHandler_Metrics(t *testing.T) {
+	gadget, err := NewWithDB(Config{SigningSecret: testSecret}, setupTestDB(t))
+	require.NoError(t, err)
+	gadget.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
+	gadget.Router.AddMentionRoute(router.MentionRoute{
+		Route: router.Route{Name: "explode", Pattern: `(?i)^explode`, Permissions: []string{"*"}},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+			ctx.Metrics.Counter("explosions_total", "Explosions attempted.").WithLabelValues().Inc()
+			panic("boom")
+		},
+	})
+	handler := gadget.Handler()
+
+	body := `{"type":"event_callback","event":{"type":"app_mention","user":"U_USER","text":"<@U_BOT> explode","channel":"C123","ts":"1234567890.123456"}}`
+	req := httptest.NewRequest(http.MethodPost, "/gadget", strings.NewReader(body))
+	signRequest(req, body)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	gadget.Wait()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	for _, line := range []string{
+		`gadget_events_received_total{type="app_mention"} 1`,
+		`gadget_route_matches_total{outcome="matched",route="explode",route_type="mention"} 1`,
+		`gadget_plugin_panics_total{route="explode"} 1`,
+		`gadget_plugin_duration_seconds_count{route="explode"} 1`,
+		`gadget_dispatch_queue_depth 0`,
+		`gadget_db_query_duration_seconds_count{operation="query"}`,
+		`explosions_total 1`,
+	} {
+		assert.Contains(t, rr.Body.String(), line)
+	}
+}
+
+func TestGadgetHandler_Tracing(t *testing.T) {
+	spans := gadgettest.RecordSpans(t)
+	fake := gadgettest.NewFakeSlack(t)
+	gadget, err := NewWithDB(Config{SigningSecret: testSecret}, setupTestDB(t))
+	require.NoError(t, err)
+	gadget.Client = slackapi.New("xoxb-fake", slackapi.Options{}, slack.OptionAPIURL(fake.URL()))
+	gadget.Identity.Set(router.BotIdentity{UserID: "U_BOT"})
+	gadget.Router.AddMentionRoute(router.MentionRoute{
+		Route: router.Route{Name: "greet", Pattern: `(?i)^hello`, Permissions: []string{"*"}},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+			_ = ctx.Reply("hi")
+		},
+	})
+
+	body := `{"type":"event_callback","event":{"type":"app_mention","user":"U_USER","text":"<@U_BOT> hello","channel":"C123","ts":"1234567890.123456"}}`
+	req := httptest.NewRequest(http.MethodPost, "/gadget", strings.NewReader(body))
+	signRequest(req, body)
+	gadget.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	gadget.Wait()
+	fake.AssertPosted(t, "C123", "hi")
+
+	ended := spans.Ended()
+	request := gadgettest.FindSpan(ended, "POST /gadget")
+	check := gadgettest.FindSpan(ended, "gadget.permission_check")
+	dispatch := gadgettest.FindSpan(ended, "gadget.dispatch greet")
+	plugin := gadgettest.FindSpan(ended, "gadget.plugin greet")
+	post := gadgettest.FindSpan(ended, "slack chat.postMessage")
+	for name, span := range map[string]sdktrace.ReadOnlySpan{"request": request, "check": check, "dispatch": dispatch, "plugin": plugin, "post": post} {
+		require.NotNil(t, span, name)
+		assert.Equal(t, request.SpanContext().TraceID(), span.SpanContext().TraceID(), name)
+	}
+	assert.Equal(t, request.SpanContext().SpanID(), check.Parent().SpanID())
+	assert.Equal(t, request.SpanContext().SpanID(), dispatch.Parent().SpanID())
+	assert.Equal(t, dispatch.SpanContext().SpanID(), plugin.Parent().SpanID())
+	assert.Equal(t, plugin.SpanContext().SpanID(), post.Parent().SpanID())
+
+	var checkQueries int
+	for _, span := range ended {
+		if strings.HasPrefix(span.Name(), "db.") && span.Parent().SpanID() == check.SpanContext().SpanID() {
+			checkQueries++
+		}
+	}
+	assert.Positive(t, checkQueries, "the permission check's queries are traced under it")
+}
@@ -0,0 +1,288 @@
+package core
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/rs/zerolog/log"
+)
+
+// Paths of Gadget's operational endpoints
+const (
+	HealthPath = "/healthz"      // answers 200 while the process is up
+	ReadyPath  = "/readyz"       // answers 200 once Gadget can handle events, and 503 until then
+	AdminPath  = "/gadget/admin" // describes the bot as JSON to callers with Config.AdminToken
+)
+
+// readyTimeout bounds how long the readiness checks may take together
+const readyTimeout = 5 * time.Second
+
+// redacted replaces secrets in the admin endpoint's config
+const redacted = "[redacted]"
+
+// CheckResult is the outcome of one readiness check
+type CheckResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"` // left out of /readyz responses, which anyone can read
+}
+
+// Readiness is the body of a /readyz response
+type Readiness struct {
+	Ready  bool                   `json:"ready"`
+	Checks map[string]CheckResult `json:"checks"` // keyed by "database", "migrations" and "bot_user"
+}
+
+// Ready checks whether Gadget can handle events: its database is
+// reachable and migrated, and its identity has been loaded
+func (gadget Gadget) Ready(ctx context.Context) Readiness {
+	result := func(err error) CheckResult {
+		if err != nil {
+			return CheckResult{Error: err.Error()}
+		}
+		return CheckResult{OK: true}
+	}
+
+	checks := map[string]CheckResult{
+		"database":   result(gadget.pingDB(ctx)),
+		"migrations": result(gadget.Router.CheckMigrations()),
+		"bot_user":   result(gadget.checkBotUser()),
+	}
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.OK
+	}
+	return Readiness{Ready: ready, Checks: checks}
+}
+
+// pingDB checks that the database answers
+func (gadget Gadget) pingDB(ctx context.Context) error {
+	if gadget.Router.DbConnection == nil {
+		return errors.New("no database connection")
+	}
+	sqlDB, err := gadget.Router.DbConnection.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// checkBotUser checks that Gadget knows who its bot user is. Gadgets that
+// only serve the workspaces they were installed in have no bot user of their
+// own to check.
+func (gadget Gadget) checkBotUser() error {
+	if gadget.servesDefaultWorkspace() && !gadget.Identity.Get().Known() {
+		return errors.New("bot identity not loaded")
+	}
+	return nil
+}
+
+func (gadget Gadget) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n")) //nolint:errcheck // nothing to do if the probe hung up
+}
+
+func (gadget Gadget) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	readiness := gadget.Ready(ctx)
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+		for name, check := range readiness.Checks {
+			if !check.OK {
+				log.Warn().Str("check", name).Str("error", check.Error).Msg("Readiness check failed")
+			}
+			// errors can name hosts, tables and the like, so only the log has them
+			check.Error = ""
+			readiness.Checks[name] = check
+		}
+	}
+	writeJSON(w, status, readiness)
+}
+
+// AdminInfo is the body of an AdminPath response
+type AdminInfo struct {
+	Routes        []AdminRoute `json:"routes"`
+	Middleware    []string     `json:"middleware"` // function names, in the order they run
+	ScheduledJobs []AdminJob   `json:"scheduled_jobs"`
+	Build         BuildInfo    `json:"build"`
+	Config        Config       `json:"config"` // with secrets redacted
+}
+
+// AdminRoute describes a registered route
+type AdminRoute struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+	Priority    int      `json:"priority"`
+	Disabled    bool     `json:"disabled"`
+}
+
+// AdminJob describes a scheduled job
+type AdminJob struct {
+	Name      string     `json:"name"`
+	Schedule  string     `json:"schedule"`
+	Disabled  bool       `json:"disabled"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+}
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	GoVersion string `json:"go_version"`
+	Module    string `json:"module,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Revision  string `json:"revision,omitempty"` // VCS commit the binary was built from
+	Time      string `json:"time,omitempty"`     // VCS commit time
+	Modified  bool   `json:"modified,omitempty"` // built with uncommitted changes
+}
+
+// Admin describes the bot: its routes, middleware, scheduled jobs, build
+// and config, with secrets redacted
+func (gadget Gadget) Admin() AdminInfo {
+	info := AdminInfo{
+		Routes:        []AdminRoute{},
+		Middleware:    []string{},
+		ScheduledJobs: []AdminJob{},
+		Build:         readBuildInfo(),
+		Config:        gadget.config.Redacted(),
+	}
+	for _, route := range gadget.Router.RegisteredRoutes() {
+		permissions := route.Permissions
+		if permissions == nil {
+			permissions = []string{}
+		}
+		info.Routes = append(info.Routes, AdminRoute{
+			Name:        route.Name,
+			Type:        route.Type,
+			Pattern:     route.Pattern,
+			Description: route.Description,
+			Permissions: permissions,
+			Priority:    route.Priority,
+			Disabled:    route.Disabled,
+		})
+	}
+	for _, mw := range gadget.middleware {
+		info.Middleware = append(info.Middleware, funcName(mw))
+	}
+	for _, job := range gadget.Router.RegisteredJobs() {
+		adminJob := AdminJob{Name: job.Name, Schedule: job.Schedule, Disabled: job.Disabled}
+		if !job.LastRunAt.IsZero() {
+			adminJob.LastRunAt = &job.LastRunAt
+		}
+		if !job.NextRunAt.IsZero() {
+			adminJob.NextRunAt = &job.NextRunAt
+		}
+		info.ScheduledJobs = append(info.ScheduledJobs, adminJob)
+	}
+	return info
+}
+
+// handleAdmin serves Admin to callers presenting Config.AdminToken as a
+// bearer token. Without an AdminToken the endpoint doesn't exist.
+func (gadget Gadget) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	token := gadget.config.AdminToken
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+		log.Warn().Str("remote_addr", r.RemoteAddr).Msg("Admin endpoint authentication failed")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gadget"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, gadget.Admin())
+}
+
+// Redacted returns a copy of cfg with its secrets replaced, for display
+func (cfg Config) Redacted() Config {
+	for _, secret := range []*string{
+		&cfg.SlackOAuthToken,
+		&cfg.SlackUserToken,
+		&cfg.SigningSecret,
+		&cfg.DBPass,
+		&cfg.DeployWebhookSecret,
+		&cfg.MattermostToken,
+		&cfg.MattermostWebhookToken,
+		&cfg.AdminToken,
+		&cfg.SlackClientSecret,
+		&cfg.InstallationKey,
+	} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	if cfg.SigningSecrets != nil {
+		secrets := make([]string, len(cfg.SigningSecrets))
+		for i := range secrets {
+			secrets[i] = redacted
+		}
+		cfg.SigningSecrets = secrets
+	}
+	return cfg
+}
+
+// readBuildInfo describes the running binary from the build info Go embeds
+// in it
+func readBuildInfo() BuildInfo {
+	info := BuildInfo{GoVersion: runtime.Version()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = build.Main.Path
+	info.Version = build.Main.Version
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.Time = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+// funcName returns the name of mw's function, e.g. "main.main.func1" for a
+// closure
+func funcName(mw router.Middleware) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(mw).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	return fn.Name()
+}
+
+// writeJSON writes v as the JSON body of a status response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal JSON response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body) //nolint:errcheck // nothing to do if the caller hung up
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gadget-bot/gadget/gadgettest"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(gadget *Gadget, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	gadget.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestGadgetHandler_Health(t *testing.T) {
+	w := serve(&Gadget{}, httptest.NewRequest(http.MethodGet, HealthPath, nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok\n", w.Body.String())
+}
+
+func TestGadgetHandler_Ready(t *testing.T) {
+	gadget, err := NewWithDB(Config{}, setupTestDB(t))
+	require.NoError(t, err)
+	gadget.Identity.Set(gadgettest.Identity)
+
+	w := serve(gadget, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var readiness Readiness
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &readiness))
+	assert.True(t, readiness.Ready)
+	assert.Len(t, readiness.Checks, 3)
+}
+
+func TestGadgetHandler_NotReady(t *testing.T) {
+	gadget := &Gadget{Router: *router.NewRouter()}
+	gadget.Router.DbConnection = setupTestDB(t)
+
+	w := serve(gadget, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var readiness Readiness
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &readiness))
+	assert.False(t, readiness.Ready)
+	assert.True(t, readiness.Checks["database"].OK)
+	assert.Equal(t, CheckResult{OK: false}, readiness.Checks["migrations"], "errors aren't exposed")
+	assert.Equal(t, CheckResult{OK: false}, readiness.Checks["bot_user"])
+	assert.NotContains(t, w.Body.String(), "error")
+
+	checks := gadget.Ready(context.Background()).Checks
+	assert.Equal(t, "tables not migrated: Reminder, PagedList, Installation", checks["migrations"].Error)
+	assert.Equal(t, "bot identity not loaded", checks["bot_user"].Error)
+}
+
+func TestGadgetHandler_NotReadyWithoutDatabase(t *testing.T) {
+	gadget := &Gadget{Router: *router.NewRouter()}
+
+	w := serve(gadget, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var readiness Readiness
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &readiness))
+	assert.False(t, readiness.Checks["database"].OK)
+	assert.Equal(t, "no database connection", gadget.Ready(context.Background()).Checks["database"].Error)
+}
+
+func newAdminGadget(t *testing.T, cfg Config) *Gadget {
+	t.Helper()
+	gadget, err := NewWithDB(cfg, setupTestDB(t))
+	require.NoError(t, err)
+	gadget.Use(func(ctx router.HandlerContext, next func(router.HandlerContext)) { next(ctx) })
+	return gadget
+}
+
+func adminRequest(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, AdminPath, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestGadgetHandler_Admin(t *testing.T) {
+	gadget := newAdminGadget(t, Config{AdminToken: "admin-token", SigningSecret: "signing-secret", DBUser: "gadget"})
+
+	w := serve(gadget, adminRequest("admin-token"))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var info AdminInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Len(t, info.Routes, len(gadget.Router.RegisteredRoutes()))
+	require.Len(t, info.Middleware, 1)
+	assert.Contains(t, info.Middleware[0], "core.newAdminGadget")
+	require.NotEmpty(t, info.ScheduledJobs)
+	assert.Equal(t, gadget.Router.RegisteredJobs()[0].Name, info.ScheduledJobs[0].Name)
+	assert.NotEmpty(t, info.Build.GoVersion)
+	assert.Equal(t, "gadget", info.Config.DBUser)
+	assert.Equal(t, "[redacted]", info.Config.SigningSecret)
+	assert.Equal(t, "[redacted]", info.Config.AdminToken)
+	assert.NotContains(t, w.Body.String(), "signing-secret")
+	assert.NotContains(t, w.Body.String(), "admin-token")
+}
+
+func TestGadgetHandler_AdminRequiresToken(t *testing.T) {
+	gadget := newAdminGadget(t, Config{AdminToken: "admin-token"})
+
+	for name, token := range map[string]string{"missing": "", "wrong": "guess"} {
+		t.Run(name, func(t *testing.T) {
+			w := serve(gadget, adminRequest(token))
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+			assert.Empty(t, w.Body.String())
+		})
+	}
+}
+
+func TestGadgetHandler_AdminOnlyAllowsGet(t *testing.T) {
+	gadget := newAdminGadget(t, Config{AdminToken: "admin-token"})
+	r := adminRequest("admin-token")
+	r.Method = http.MethodPost
+
+	w := serve(gadget, r)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestGadgetHandler_AdminDisabledWithoutToken(t *testing.T) {
+	gadget := newAdminGadget(t, Config{})
+
+	w := serve(gadget, adminRequest(""))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestConfig_Redacted(t *testing.T) {
+	cfg := Config{SlackOAuthToken: "xoxb-1", DBPass: "hunter2", DBHost: "db", MattermostToken: "", SigningSecrets: []string{"old-secret"}}
+
+	redactedCfg := cfg.Redacted()
+
+	assert.Equal(t, "[redacted]", redactedCfg.SlackOAuthToken)
+	assert.Equal(t, "[redacted]", redactedCfg.DBPass)
+	assert.Equal(t, "db", redactedCfg.DBHost)
+	assert.Empty(t, redactedCfg.MattermostToken, "unset secrets stay empty")
+	assert.Equal(t, []string{"[redacted]"}, redactedCfg.SigningSecrets)
+	assert.Equal(t, "xoxb-1", cfg.SlackOAuthToken, "the original is untouched")
+	assert.Equal(t, []string{"old-secret"}, cfg.SigningSecrets)
+}
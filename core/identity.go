@@ -0,0 +1,48 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/rs/zerolog/log"
+	"github.com/slack-go/slack"
+)
+
+// LoadIdentity asks Slack who the bot token belongs to, with auth.test, and
+// stores the answer in gadget.Identity. The app ID comes from bots.info; if
+// that fails, the identity is stored without it.
+func (gadget *Gadget) LoadIdentity(ctx context.Context) error {
+	auth, err := gadget.Client.AuthTestContext(ctx)
+	if err != nil {
+		return fmt.Errorf("load bot identity: %w", err)
+	}
+	identity := router.BotIdentity{
+		UserID: auth.UserID,
+		BotID:  auth.BotID,
+		TeamID: auth.TeamID,
+		Team:   auth.Team,
+	}
+	if auth.BotID != "" {
+		bot, err := gadget.Client.GetBotInfoContext(ctx, slack.GetBotInfoParameters{Bot: auth.BotID, TeamID: auth.TeamID})
+		if err != nil {
+			log.Warn().Err(err).Str("bot_id", auth.BotID).Msg("Failed to look up the bot's app ID")
+		} else {
+			identity.AppID = bot.AppID
+		}
+	}
+
+	if gadget.Identity == nil {
+		gadget.Identity = &router.Identity{}
+		gadget.Router.Identity = gadget.Identity
+	}
+	gadget.Identity.Set(identity)
+	gadget.Router.BotUID = identity.UserID
+	log.Info().
+		Str("user_id", identity.UserID).
+		Str("bot_id", identity.BotID).
+		Str("team_id", identity.TeamID).
+		Str("app_id", identity.AppID).
+		Msg("Loaded bot identity")
+	return nil
+}
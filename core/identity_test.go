@@ -0,0 +1,48 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gadget-bot/gadget/gadgettest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadIdentity(t *testing.T) {
+	fake := gadgettest.NewFakeSlack(t)
+	gadget := &Gadget{Client: fake.Client()}
+
+	require.NoError(t, gadget.LoadIdentity(context.Background()))
+
+	assert.Equal(t, gadgettest.Identity, gadget.Identity.Get())
+	assert.Equal(t, gadgettest.BotUserID, gadget.Router.BotUID, "the deprecated accessor reads the same identity")
+}
+
+func TestLoadIdentity_WithoutAppID(t *testing.T) {
+	fake := gadgettest.NewFakeSlack(t)
+	fake.Fail("bots.info", "missing_scope")
+	gadget, err := NewWithDB(Config{}, setupTestDB(t))
+	require.NoError(t, err)
+	gadget.Client = fake.Client()
+
+	require.NoError(t, gadget.LoadIdentity(context.Background()))
+
+	identity := gadget.Identity.Get()
+	assert.Equal(t, gadgettest.BotUserID, identity.UserID)
+	assert.Empty(t, identity.AppID)
+	assert.Equal(t, gadgettest.BotUserID, gadget.Router.BotUID)
+}
+
+func TestLoadIdentity_AuthTestFails(t *testing.T) {
+	fake := gadgettest.NewFakeSlack(t)
+	fake.Fail("auth.test", "invalid_auth")
+	gadget, err := NewWithDB(Config{}, setupTestDB(t))
+	require.NoError(t, err)
+	gadget.Client = fake.Client()
+
+	err = gadget.LoadIdentity(context.Background())
+
+	assert.ErrorContains(t, err, "invalid_auth")
+	assert.False(t, gadget.Identity.Get().Known())
+}
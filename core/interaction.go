@@ -0,0 +1,75 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+)
+
+// handleInteraction dispatches an interactivity payload, which Slack posts to
+// the same URL as slash commands, to the BlockActionRoute for each action in
+// it. The payload is acknowledged with an empty 200 before the plugins run.
+// Only block_actions payloads are handled; others are acknowledged and
+// ignored.
+func (gadget Gadget) handleInteraction(w http.ResponseWriter, rs *requestState, payload string) {
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(payload), &callback); err != nil {
+		rs.logger.Warn().Err(err).Msg("Failed to parse interaction payload")
+		rs.statusCode = http.StatusBadRequest
+		w.WriteHeader(rs.statusCode)
+		return
+	}
+	workspace, err := gadget.forWorkspace(rs.ctx, callback.Enterprise.ID, callback.Team.ID)
+	if notInstalled(rs, err, callback.Enterprise.ID, callback.Team.ID) {
+		w.WriteHeader(rs.statusCode)
+		return
+	}
+	if err != nil {
+		failWorkspace(w, rs, err)
+		return
+	}
+	w.WriteHeader(rs.statusCode)
+	workspace.dispatchInteraction(rs, callback)
+}
+
+// DispatchInteraction routes callback to plugins as if Slack had sent it to
+// Gadget's HTTP handler, without waiting for them to finish
+func (gadget Gadget) DispatchInteraction(callback slack.InteractionCallback) {
+	rs := gadget.newRequestState(context.Background())
+	gadget.dispatchInteraction(&rs, callback)
+}
+
+// dispatchInteraction routes each action in a block_actions callback to its
+// BlockActionRoute
+func (gadget Gadget) dispatchInteraction(rs *requestState, callback slack.InteractionCallback) {
+	gadget.Metrics.EventReceived(string(callback.Type))
+	if callback.Type != slack.InteractionTypeBlockActions {
+		rs.logger.Debug().Str("type", string(callback.Type)).Msg("Ignoring interaction")
+		return
+	}
+
+	currentUser := gadget.Router.WithContext(rs.ctx).FindOrCreateUser(callback.User.ID)
+
+	origin := router.OriginFromBlockAction(callback)
+	ctx := gadget.buildHandlerContext(rs.ctx, rs.logger).WithOrigin(origin)
+	for _, action := range callback.ActionCallback.BlockActions {
+		route, outcome := gadget.Router.WithContext(rs.ctx).ResolveBlockAction(action.ActionID, origin.Channel, currentUser)
+		if outcome == router.Fallback {
+			rs.logger.Debug().Str("action", action.ActionID).Msg("No route for block action")
+			continue
+		}
+		rs.recordOutcome(router.RouteTypeBlockAction, route.Name, outcome, currentUser)
+		if outcome != router.Matched {
+			continue
+		}
+
+		rs.logger.Debug().Str("user", currentUser.Uuid).Str("route", route.Name).Str("action", action.ActionID).Msg("Block action")
+		r, a := route, *action // capture for closure
+		gadget.dispatchRoute(r.Name, rs.logger, ctx, func(c router.HandlerContext) {
+			r.Execute(c, callback, a)
+		})
+	}
+}
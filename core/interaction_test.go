@@ -0,0 +1,115 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const blockActionPayload = `{
+	"type": "block_actions",
+	"user": {"id": "U123"},
+	"container": {"type": "message", "message_ts": "1000.0001", "channel_id": "C123"},
+	"channel": {"id": "C123"},
+	"actions": [{"action_id": "approve", "block_id": "b1", "type": "button", "value": "42"}]
+}`
+
+func postInteraction(g Gadget, payload string) *httptest.ResponseRecorder {
+	body := url.Values{"payload": {payload}}.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/gadget/command", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	signRequest(req, body)
+	rr := httptest.NewRecorder()
+	g.Handler().ServeHTTP(rr, req)
+	return rr
+}
+
+type blockActionCall struct {
+	ctx    router.HandlerContext
+	action slack.BlockAction
+}
+
+func newInteractionTestGadget(t *testing.T, calls chan blockActionCall, permissions ...string) Gadget {
+	t.Helper()
+	g := newTestGadget(t)
+	g.Router.AddBlockActionRoute(router.BlockActionRoute{
+		Route:    router.Route{Name: "approvals.approve", Permissions: permissions},
+		ActionID: "approve",
+		Plugin: func(ctx router.HandlerContext, callback slack.InteractionCallback, action slack.BlockAction) {
+			calls <- blockActionCall{ctx: ctx, action: action}
+		},
+	})
+	return g
+}
+
+func TestInteractionHandler_DispatchesBlockAction(t *testing.T) {
+	calls := make(chan blockActionCall, 1)
+	g := newInteractionTestGadget(t, calls)
+
+	rr := postInteraction(g, blockActionPayload)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Body.String())
+
+	select {
+	case call := <-calls:
+		assert.Equal(t, "42", call.action.Value)
+		assert.Equal(t, "approvals.approve", call.ctx.Route.Name)
+		assert.Equal(t, router.Origin{Channel: "C123", TimeStamp: "1000.0001", User: "U123"}, call.ctx.Origin)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for block action plugin to be called")
+	}
+}
+
+func TestInteractionHandler_PermissionDenied(t *testing.T) {
+	calls := make(chan blockActionCall, 1)
+	g := newInteractionTestGadget(t, calls, "approvers")
+
+	assert.Equal(t, http.StatusOK, postInteraction(g, blockActionPayload).Code)
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, calls)
+}
+
+func TestInteractionHandler_DisabledRoute(t *testing.T) {
+	calls := make(chan blockActionCall, 1)
+	g := newInteractionTestGadget(t, calls)
+	require.NoError(t, g.Router.DisableRoute("approvals.*", ""))
+
+	assert.Equal(t, http.StatusOK, postInteraction(g, blockActionPayload).Code)
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, calls)
+}
+
+func TestInteractionHandler_IgnoresOtherTypes(t *testing.T) {
+	calls := make(chan blockActionCall, 1)
+	g := newInteractionTestGadget(t, calls)
+
+	assert.Equal(t, http.StatusOK, postInteraction(g, `{"type": "view_closed", "user": {"id": "U123"}}`).Code)
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, calls)
+}
+
+func TestInteractionHandler_InvalidPayload(t *testing.T) {
+	g := newInteractionTestGadget(t, make(chan blockActionCall, 1))
+	assert.Equal(t, http.StatusBadRequest, postInteraction(g, `{not json`).Code)
+}
+
+func TestInteractionHandler_InvalidSignature(t *testing.T) {
+	g := newInteractionTestGadget(t, make(chan blockActionCall, 1))
+
+	body := url.Values{"payload": {blockActionPayload}}.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/gadget/command", strings.NewReader(body))
+	req.Header.Set("X-Slack-Request-Timestamp", "0")
+	req.Header.Set("X-Slack-Signature", "v0=bad")
+	rr := httptest.NewRecorder()
+	g.Handler().ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/rs/zerolog/log"
+)
+
+// schedulerTick is how often the scheduler checks for due jobs. Jobs may run
+// up to one tick after their scheduled time.
+const schedulerTick = 15 * time.Second
+
+// schedulerOwner identifies this process when it holds a job lease
+func schedulerOwner() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "gadget"
+	}
+	return host + "-" + generateRequestID()
+}
+
+// RunScheduler runs the Router's ScheduledJobs until ctx is cancelled. Each
+// tick, every enabled job that is due is claimed through the database so that
+// only one replica runs it. Jobs run in their own goroutine through the
+// middleware chain, like routes. Run starts the scheduler automatically.
+func (gadget Gadget) RunScheduler(ctx context.Context) {
+	if len(gadget.Router.ScheduledJobs) == 0 || gadget.Router.DbConnection == nil {
+		return
+	}
+
+	owner := schedulerOwner()
+	log.Info().Int("jobs", len(gadget.Router.ScheduledJobs)).Str("owner", owner).Msg("Scheduler started")
+
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+	gadget.runDueJobs(owner, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			gadget.runDueJobs(owner, now)
+		}
+	}
+}
+
+// runDueJobs claims and dispatches every job that is due as of now
+func (gadget Gadget) runDueJobs(owner string, now time.Time) {
+	for _, job := range gadget.Router.ScheduledJobs {
+		if !gadget.Router.IsRouteEnabled(job.Name, "") {
+			continue
+		}
+		claimed, err := gadget.Router.ClaimScheduledJob(job, owner, now)
+		if err != nil {
+			log.Error().Err(err).Str("job", job.Name).Msg("Failed to claim scheduled job")
+			continue
+		}
+		if claimed {
+			gadget.dispatchJob(owner, job)
+		}
+	}
+}
+
+// dispatchJob runs job in its own goroutine and releases its lease when it
+// finishes, even if the job panics or middleware short-circuits it.
+func (gadget Gadget) dispatchJob(owner string, job router.ScheduledJob) {
+	logger := log.With().Str("request_id", generateRequestID()).Str("job", job.Name).Logger()
+	ctx := gadget.buildHandlerContext(context.Background(), logger)
+	start := time.Now()
+
+	gadget.spawn(job.Name, logger, func() {
+		defer func() {
+			if err := gadget.Router.ReleaseScheduledJob(job.Name, owner); err != nil {
+				logger.Error().Err(err).Msg("Failed to release scheduled job")
+			}
+			logger.Info().Dur("duration", time.Since(start)).Msg("Scheduled job finished")
+		}()
+		gadget.runChain(job.Name, ctx, job.Execute)
+	})
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunDueJobs_RunsClaimedJobOnce(t *testing.T) {
+	g := newTestGadget(t)
+	ran := make(chan string, 2)
+	g.Router.AddScheduledJob(router.ScheduledJob{
+		Route:    router.Route{Name: "cleanup"},
+		Interval: time.Hour,
+		Plugin: func(ctx router.HandlerContext) {
+			ran <- ctx.Route.Name
+		},
+	})
+
+	now := time.Now()
+	g.runDueJobs("a", now)
+	g.runDueJobs("a", now.Add(time.Hour))
+	g.runDueJobs("b", now.Add(time.Hour))
+
+	select {
+	case name := <-ran:
+		assert.Equal(t, "cleanup", name)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for scheduled job to run")
+	}
+	select {
+	case <-ran:
+		t.Fatal("scheduled job ran more than once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRunDueJobs_ReleasesLeaseAfterPanic(t *testing.T) {
+	g := newTestGadget(t)
+	g.Router.AddScheduledJob(router.ScheduledJob{
+		Route:    router.Route{Name: "explode"},
+		Interval: time.Minute,
+		Plugin:   func(ctx router.HandlerContext) { panic("boom") },
+	})
+
+	now := time.Now()
+	g.runDueJobs("a", now)
+	g.runDueJobs("a", now.Add(time.Minute))
+
+	assert.Eventually(t, func() bool {
+		var run models.JobRun
+		g.Router.DbConnection.Where("name = ?", "explode").First(&run)
+		return run.LeaseOwner == ""
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestRunDueJobs_SkipsDisabledJobs(t *testing.T) {
+	g := newTestGadget(t)
+	ran := make(chan struct{}, 1)
+	g.Router.AddScheduledJob(router.ScheduledJob{
+		Route:    router.Route{Name: "reports.nightly"},
+		Interval: time.Hour,
+		Plugin:   func(ctx router.HandlerContext) { ran <- struct{}{} },
+	})
+	assert.NoError(t, g.Router.DisableRoute("reports.*", ""))
+
+	now := time.Now()
+	g.runDueJobs("a", now)
+	g.runDueJobs("a", now.Add(time.Hour))
+
+	select {
+	case <-ran:
+		t.Fatal("disabled job ran")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRunDueJobs_UsesMiddleware(t *testing.T) {
+	g := newTestGadget(t)
+	wrapped := make(chan string, 1)
+	g.Use(func(ctx router.HandlerContext, next func(router.HandlerContext)) {
+		wrapped <- "before"
+		next(ctx)
+	})
+	g.Router.AddScheduledJob(router.ScheduledJob{
+		Route:    router.Route{Name: "cleanup"},
+		Interval: time.Hour,
+		Plugin:   func(ctx router.HandlerContext) {},
+	})
+
+	now := time.Now()
+	g.runDueJobs("a", now)
+	g.runDueJobs("a", now.Add(time.Hour))
+
+	select {
+	case got := <-wrapped:
+		assert.Equal(t, "before", got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for middleware")
+	}
+}
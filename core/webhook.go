@@ -0,0 +1,89 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gadget-bot/gadget/router"
+)
+
+// maxWebhookBodyBytes caps the size of webhook request bodies
+const maxWebhookBodyBytes = 1 << 20
+
+// handleWebhook authenticates requests under router.WebhookPathPrefix and
+// dispatches them to the matching WebhookRoute. The request is acknowledged
+// with 202 Accepted before the plugin runs. Paths without a route are
+// answered like failed authentication, so they can't be told apart from
+// routes without knowing their secrets.
+func (gadget Gadget) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	rs := gadget.newRequestState(r.Context())
+	defer func() { requestLog(rs.statusCode, *r, rs.accessDenied, rs.rateLimited, rs.start, rs.logger) }()
+
+	fail := func(code int) {
+		rs.statusCode = code
+		w.WriteHeader(code)
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		fail(http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, router.WebhookPathPrefix)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		rs.logger.Warn().Err(err).Str("path", path).Msg("Failed to read webhook body")
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			fail(http.StatusRequestEntityTooLarge)
+			return
+		}
+		fail(http.StatusBadRequest)
+		return
+	}
+
+	route, exists := gadget.Router.FindWebhookRouteByPath(path)
+	if !exists {
+		rs.logger.Warn().Str("path", path).Msg("Webhook has no route")
+		fail(http.StatusUnauthorized)
+		return
+	}
+	if !route.Authenticate(r.Header, body) {
+		rs.logger.Warn().Str("route", route.Name).Msg("Webhook authentication failed")
+		rs.accessDenied = true
+		gadget.Metrics.RouteResolved(router.RouteTypeWebhook, route.Name, router.Denied.String())
+		fail(http.StatusUnauthorized)
+		return
+	}
+	if !gadget.Router.IsRouteEnabled(route.Name, "") {
+		fail(http.StatusNotFound)
+		return
+	}
+	if len(body) > 0 && !json.Valid(body) {
+		rs.logger.Warn().Str("route", route.Name).Msg("Webhook body is not valid JSON")
+		fail(http.StatusBadRequest)
+		return
+	}
+
+	req := router.WebhookRequest{
+		Path:   route.Path,
+		Header: r.Header.Clone(),
+		Query:  r.URL.Query(),
+		Body:   json.RawMessage(body),
+	}
+
+	rs.logger.Debug().Str("route", route.Name).Msg("Webhook")
+	gadget.Metrics.EventReceived("webhook")
+	gadget.Metrics.RouteResolved(router.RouteTypeWebhook, route.Name, router.Matched.String())
+	rs.statusCode = http.StatusAccepted
+	w.WriteHeader(rs.statusCode)
+
+	ctx := gadget.buildHandlerContext(rs.ctx, rs.logger)
+	gadget.dispatchRoute(route.Name, rs.logger, ctx, func(c router.HandlerContext) {
+		route.Execute(c, req)
+	})
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWebhookTestGadget(t *testing.T, received chan router.WebhookRequest) Gadget {
+	t.Helper()
+	g := newTestGadget(t)
+	g.Router.AddWebhookRoute(router.WebhookRoute{
+		Route:  router.Route{Name: "deploys.deployNotice"},
+		Path:   "deploy",
+		Secret: "s3cret",
+		Plugin: func(ctx router.HandlerContext, req router.WebhookRequest) {
+			received <- req
+		},
+	})
+	return g
+}
+
+func postWebhook(g Gadget, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path+"?source=ci", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	g.Handler().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestWebhookHandler_DispatchesToPlugin(t *testing.T) {
+	received := make(chan router.WebhookRequest, 1)
+	g := newWebhookTestGadget(t, received)
+
+	rr := postWebhook(g, "/gadget/hooks/deploy", "s3cret", `{"service":"api"}`)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	select {
+	case req := <-received:
+		assert.Equal(t, "deploy", req.Path)
+		assert.Equal(t, "ci", req.Query.Get("source"))
+		assert.JSONEq(t, `{"service":"api"}`, string(req.Body))
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for webhook plugin to be called")
+	}
+}
+
+func TestWebhookHandler_Unauthorized(t *testing.T) {
+	received := make(chan router.WebhookRequest, 1)
+	g := newWebhookTestGadget(t, received)
+
+	assert.Equal(t, http.StatusUnauthorized, postWebhook(g, "/gadget/hooks/deploy", "", `{}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, postWebhook(g, "/gadget/hooks/deploy", "wrong", `{}`).Code)
+	assert.Empty(t, received)
+}
+
+func TestWebhookHandler_UnknownPath(t *testing.T) {
+	g := newWebhookTestGadget(t, make(chan router.WebhookRequest, 1))
+	assert.Equal(t, http.StatusUnauthorized, postWebhook(g, "/gadget/hooks/nope", "s3cret", `{}`).Code, "unknown paths look like a wrong secret")
+}
+
+func TestWebhookHandler_DisabledRoute(t *testing.T) {
+	g := newWebhookTestGadget(t, make(chan router.WebhookRequest, 1))
+	assert.NoError(t, g.Router.DisableRoute("deploys.*", ""))
+	assert.Equal(t, http.StatusNotFound, postWebhook(g, "/gadget/hooks/deploy", "s3cret", `{}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, postWebhook(g, "/gadget/hooks/deploy", "wrong", `{}`).Code, "only callers with the secret learn it's disabled")
+}
+
+func TestWebhookHandler_InvalidJSON(t *testing.T) {
+	g := newWebhookTestGadget(t, make(chan router.WebhookRequest, 1))
+	assert.Equal(t, http.StatusBadRequest, postWebhook(g, "/gadget/hooks/deploy", "s3cret", `{not json`).Code)
+}
+
+func TestWebhookHandler_RequiresPost(t *testing.T) {
+	g := newWebhookTestGadget(t, make(chan router.WebhookRequest, 1))
+	req := httptest.NewRequest(http.MethodGet, "/gadget/hooks/deploy", nil)
+	rr := httptest.NewRecorder()
+	g.Handler().ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, http.MethodPost, rr.Header().Get("Allow"))
+}
+
+func TestWebhookHandler_BodyTooLarge(t *testing.T) {
+	g := newWebhookTestGadget(t, make(chan router.WebhookRequest, 1))
+	body := `"` + strings.Repeat("a", maxWebhookBodyBytes) + `"`
+	assert.Equal(t, http.StatusRequestEntityTooLarge, postWebhook(g, "/gadget/hooks/deploy", "s3cret", body).Code)
+}
@@ -0,0 +1,245 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gadget-bot/gadget/directory"
+	"github.com/gadget-bot/gadget/install"
+	"github.com/gadget-bot/gadget/models"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/gadget-bot/gadget/slackapi"
+	"github.com/rs/zerolog/log"
+	"github.com/slack-go/slack"
+	"gorm.io/gorm"
+)
+
+// notInstalledResponse answers slash commands from workspaces Gadget isn't
+// installed in
+const notInstalledResponse = "Gadget isn't installed in this workspace."
+
+// workspace is what Gadget needs to act in a workspace it was installed in
+type workspace struct {
+	client     *slack.Client
+	userClient *slack.Client // nil if the installer granted no user scopes
+	directory  *directory.Directory
+	identity   *router.Identity
+	teamID     string // scopes the workspace's users and groups
+}
+
+// workspaces caches the workspaces Gadget was installed in, keyed by their
+// installation's Workspace, so an event and a scheduled job in the same
+// workspace share its clients and directory
+type workspaces struct {
+	mu    sync.Mutex
+	byKey map[string]*workspace
+	// keys maps what a workspace was looked up by, the enterprise and team
+	// IDs Slack sends with events or a workspace ID, to its key in byKey
+	keys map[string]string
+}
+
+// reset forgets every cached workspace, e.g. after a reinstall changes its
+// tokens
+func (ws *workspaces) reset() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.byKey = nil
+	ws.keys = nil
+}
+
+// servesDefaultWorkspace returns true if Gadget has a workspace of its own,
+// configured with Config.SlackOAuthToken, besides any it was installed in
+func (gadget Gadget) servesDefaultWorkspace() bool {
+	return gadget.Installations == nil || gadget.config.SlackOAuthToken != ""
+}
+
+// installationStore returns the store installations are kept in, which
+// encrypts their tokens if key, as Config.InstallationKey, is set
+func installationStore(db *gorm.DB, key string) (*install.DBStore, error) {
+	if key == "" {
+		log.Warn().Msg("Installation tokens are stored unencrypted; set GADGET_INSTALLATION_KEY to encrypt them")
+		return install.NewDBStore(db), nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("decode installation key: %w", err)
+	}
+	store, err := install.NewEncryptedDBStore(db, decoded)
+	if err != nil {
+		return nil, fmt.Errorf("open installation store: %w", err)
+	}
+	return store, nil
+}
+
+// newSlackClient returns a client for token that waits out Slack's rate
+// limits and retries transient failures
+func (gadget Gadget) newSlackClient(token string) *slack.Client {
+	var options []slack.Option
+	if gadget.config.SlackAPIURL != "" {
+		options = append(options, slack.OptionAPIURL(gadget.config.SlackAPIURL))
+	}
+	return slackapi.New(token, slackapi.Options{Observer: gadget.Metrics.SlackCall}, options...)
+}
+
+// forWorkspace returns a copy of gadget acting in the workspace an event
+// came from: its clients, directory and identity are the installation's,
+// and its router finds users and groups in that workspace. Events from the
+// default workspace, or without a team, get gadget unchanged.
+func (gadget Gadget) forWorkspace(ctx context.Context, enterpriseID, teamID string) (Gadget, error) {
+	if gadget.Installations == nil || (enterpriseID == "" && teamID == "") {
+		return gadget, nil
+	}
+	if gadget.config.SlackOAuthToken != "" && teamID == gadget.Identity.Get().TeamID {
+		return gadget, nil
+	}
+
+	return gadget.withWorkspace("event:"+enterpriseID+"/"+teamID, func() (models.Installation, error) {
+		return gadget.Installations.Find(ctx, enterpriseID, teamID)
+	})
+}
+
+// forTeam returns a copy of gadget acting in workspace, the ID Router.TeamID
+// scopes users and groups by, for work that doesn't start with an event
+// from Slack, like scheduled jobs. An empty workspace gets gadget unchanged.
+func (gadget Gadget) forTeam(ctx context.Context, workspace string) (Gadget, error) {
+	if gadget.Installations == nil || workspace == "" {
+		return gadget, nil
+	}
+	if gadget.config.SlackOAuthToken != "" && workspace == gadget.Identity.Get().TeamID {
+		return gadget, nil
+	}
+	return gadget.withWorkspace("workspace:"+workspace, func() (models.Installation, error) {
+		return gadget.Installations.FindWorkspace(ctx, workspace)
+	})
+}
+
+// withWorkspace returns a copy of gadget acting in the workspace looked up
+// by lookup, finding its installation if it isn't cached yet
+func (gadget Gadget) withWorkspace(lookup string, find func() (models.Installation, error)) (Gadget, error) {
+	cache := gadget.workspaces
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	ws, ok := cache.byKey[cache.keys[lookup]]
+	if !ok {
+		installation, err := find()
+		if err != nil {
+			return gadget, err
+		}
+		key := installation.Workspace()
+		if ws, ok = cache.byKey[key]; !ok {
+			ws = gadget.newWorkspace(installation)
+			if cache.byKey == nil {
+				cache.byKey = map[string]*workspace{}
+			}
+			cache.byKey[key] = ws
+		}
+		if cache.keys == nil {
+			cache.keys = map[string]string{}
+		}
+		cache.keys[lookup] = key
+	}
+
+	gadget.Client = ws.client
+	gadget.UserClient = ws.userClient
+	gadget.Directory = ws.directory
+	gadget.Identity = ws.identity
+	gadget.Router.Identity = ws.identity
+	gadget.Router.BotUID = ws.identity.Get().UserID
+	gadget.Router.TeamID = ws.teamID
+	return gadget, nil
+}
+
+// newWorkspace sets up what Gadget needs to act in installation's workspace
+func (gadget Gadget) newWorkspace(installation models.Installation) *workspace {
+	ws := &workspace{
+		client: gadget.newSlackClient(installation.BotToken),
+		identity: router.NewIdentity(router.BotIdentity{
+			UserID: installation.BotUserID,
+			BotID:  installation.BotID,
+			TeamID: installation.Workspace(),
+			Team:   installation.TeamName,
+			AppID:  installation.AppID,
+		}),
+		teamID: installation.Workspace(),
+	}
+	if installation.UserToken != "" {
+		ws.userClient = gadget.newSlackClient(installation.UserToken)
+	}
+	directoryOpts := directory.Options{TTL: gadget.config.DirectoryTTL, TeamID: ws.teamID}
+	if gadget.config.PersistProfiles {
+		directoryOpts.DB = gadget.Router.DbConnection
+	}
+	ws.directory = directory.New(ws.client, directoryOpts)
+	return ws
+}
+
+// installHandler returns the handler of the OAuth install flow, requesting
+// Config.OAuthScopes or, without them, the scopes the manifest infers from
+// the registered routes
+func (gadget Gadget) installHandler() *install.Handler {
+	scopes := gadget.config.OAuthScopes
+	if len(scopes) == 0 {
+		scopes = gadget.Manifest("", "", "").OAuthConfig.Scopes.Bot
+	}
+	return install.NewHandler(gadget.Installations, install.Options{
+		ClientID:     gadget.config.SlackClientID,
+		ClientSecret: gadget.config.SlackClientSecret,
+		RedirectURL:  gadget.config.OAuthRedirectURL,
+		Scopes:       scopes,
+		UserScopes:   gadget.config.OAuthUserScopes,
+		APIURL:       gadget.config.SlackAPIURL,
+		OnInstall:    gadget.onInstall,
+	})
+}
+
+// onInstall makes the installer and Config.GlobalAdmins the global admins
+// of the workspace Gadget was installed in
+func (gadget Gadget) onInstall(ctx context.Context, installation models.Installation) {
+	gadget.workspaces.reset()
+
+	r := gadget.Router.WithContext(ctx)
+	r.TeamID = installation.Workspace()
+	admins := gadget.config.GlobalAdmins
+	if installation.InstallerUserID != "" {
+		admins = append([]string{installation.InstallerUserID}, admins...)
+	}
+	var users []models.User
+	for _, uuid := range admins {
+		users = append(users, r.FindOrCreateUser(uuid))
+	}
+	globalAdmins := r.FindOrCreateGroup("globalAdmins")
+	if err := r.DbConnection.Model(&globalAdmins).Association("Members").Append(users); err != nil {
+		log.Error().Err(err).Str("team", r.TeamID).Msg("Failed to add global admins")
+	}
+}
+
+// uninstall forgets the workspace an app_uninstalled event came from
+func (gadget Gadget) uninstall(ctx context.Context, enterpriseID, teamID string) {
+	if err := gadget.Installations.Delete(ctx, enterpriseID, teamID); err != nil {
+		log.Error().Err(err).Str("enterprise_id", enterpriseID).Str("team_id", teamID).Msg("Failed to delete installation")
+		return
+	}
+	gadget.workspaces.reset()
+	log.Info().Str("enterprise_id", enterpriseID).Str("team_id", teamID).Msg("Uninstalled")
+}
+
+// notInstalled returns true if err is because Gadget isn't installed in the
+// workspace a request came from, and logs it
+func notInstalled(rs *requestState, err error, enterpriseID, teamID string) bool {
+	if !errors.Is(err, install.ErrNotInstalled) {
+		return false
+	}
+	rs.logger.Warn().Str("enterprise_id", enterpriseID).Str("team_id", teamID).Msg("Request from a workspace Gadget isn't installed in")
+	return true
+}
+
+// failWorkspace answers a request whose workspace couldn't be loaded
+func failWorkspace(w http.ResponseWriter, rs *requestState, err error) {
+	rs.logger.Error().Err(err).Msg("Failed to load workspace")
+	rs.statusCode = http.StatusInternalServerError
+	w.WriteHeader(rs.statusCode)
+}
@@ -0,0 +1,271 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/gadgettest"
+	"github.com/gadget-bot/gadget/install"
+	"github.com/gadget-bot/gadget/models"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/rs/zerolog"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var otherWorkspace = models.Installation{
+	TeamID:    "T_OTHER",
+	TeamName:  "Other",
+	AppID:     gadgettest.AppID,
+	BotToken:  "xoxb-other",
+	BotUserID: "U_OTHERBOT",
+	BotID:     "B_OTHERBOT",
+}
+
+// newInstallableGadget returns a Gadget serving gadgettest's workspace and
+// any workspace it's installed in
+func newInstallableGadget(t *testing.T, fake *gadgettest.FakeSlack) *Gadget {
+	t.Helper()
+	gadget, err := NewWithDB(Config{
+		SlackOAuthToken:   "xoxb-default",
+		SigningSecret:     testSecret,
+		SlackClientID:     "client-id",
+		SlackClientSecret: "client-secret",
+		OAuthRedirectURL:  "https://gadget.example.com" + install.CallbackPath,
+		SlackAPIURL:       fake.URL(),
+		GlobalAdmins:      []string{"U_OWNER"},
+	}, setupTestDB(t))
+	require.NoError(t, err)
+	gadget.Identity.Set(gadgettest.Identity)
+	return gadget
+}
+
+func postEvent(gadget *Gadget, teamID string, event map[string]interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]interface{}{"type": "event_callback", "team_id": teamID, "event": event})
+	req := httptest.NewRequest(http.MethodPost, "/gadget", strings.NewReader(string(body)))
+	signRequest(req, string(body))
+	return serve(gadget, req)
+}
+
+func mention(bot, text string) map[string]interface{} {
+	return map[string]interface{}{"type": "app_mention", "user": "U_USER", "text": "<@" + bot + "> " + text, "channel": "C123", "ts": "1.1"}
+}
+
+func TestGadgetHandler_EventInInstalledWorkspace(t *testing.T) {
+	gadget := newInstallableGadget(t, gadgettest.NewFakeSlack(t))
+	require.NoError(t, gadget.Installations.Save(context.Background(), otherWorkspace))
+	contexts := make(chan router.HandlerContext, 2)
+	gadget.Router.AddMentionRoute(router.MentionRoute{
+		Route:  router.Route{Name: "hello", Pattern: `(?i)^hello`},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) { contexts <- ctx },
+	})
+
+	require.Equal(t, http.StatusOK, postEvent(gadget, "T_OTHER", mention("U_OTHERBOT", "hello")).Code)
+	require.Equal(t, http.StatusOK, postEvent(gadget, gadgettest.TeamID, mention(gadgettest.BotUserID, "hello")).Code)
+	gadget.Wait()
+
+	other, home := <-contexts, <-contexts
+	if other.Identity.TeamID != "T_OTHER" {
+		other, home = home, other
+	}
+	assert.Equal(t, "U_OTHERBOT", other.Identity.UserID)
+	assert.NotSame(t, gadget.Client, other.BotClient)
+	assert.NotSame(t, gadget.Directory, other.Directory)
+	assert.Equal(t, "T_OTHER", other.Router.TeamID)
+	assert.Equal(t, gadgettest.Identity, home.Identity)
+	assert.Same(t, gadget.Client, home.BotClient)
+	assert.Empty(t, home.Router.TeamID)
+
+	var users []models.User
+	gadget.Router.DbConnection.Where("uuid = ?", "U_USER").Order("team_id").Find(&users)
+	require.Len(t, users, 2, "the same ID in two workspaces is two users")
+	assert.Equal(t, []string{"", "T_OTHER"}, []string{users[0].TeamID, users[1].TeamID})
+}
+
+func TestForWorkspace_SharesTheWorkspaceWithForTeam(t *testing.T) {
+	gadget := newInstallableGadget(t, gadgettest.NewFakeSlack(t))
+	org := models.Installation{EnterpriseID: "E_ORG", IsEnterpriseInstall: true, BotToken: "xoxb-org", BotUserID: "U_ORGBOT"}
+	require.NoError(t, gadget.Installations.Save(context.Background(), otherWorkspace))
+	require.NoError(t, gadget.Installations.Save(context.Background(), org))
+
+	fromEvent, err := gadget.forWorkspace(context.Background(), "", "T_OTHER")
+	require.NoError(t, err)
+	fromJob, err := gadget.forTeam(context.Background(), "T_OTHER")
+	require.NoError(t, err)
+	assert.Same(t, fromEvent.Client, fromJob.Client)
+	assert.Same(t, fromEvent.Directory, fromJob.Directory)
+
+	// two teams in an organization-wide install share its workspace
+	first, err := gadget.forWorkspace(context.Background(), "E_ORG", "T_ONE")
+	require.NoError(t, err)
+	second, err := gadget.forWorkspace(context.Background(), "E_ORG", "T_TWO")
+	require.NoError(t, err)
+	job, err := gadget.forTeam(context.Background(), "E_ORG")
+	require.NoError(t, err)
+	assert.Same(t, first.Client, second.Client)
+	assert.Same(t, first.Client, job.Client)
+	assert.Len(t, gadget.workspaces.byKey, 2)
+}
+
+func TestNewWithDB_EncryptsInstallationTokens(t *testing.T) {
+	db := setupTestDB(t)
+	gadget, err := NewWithDB(Config{SlackClientID: "client-id", InstallationKey: "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="}, db)
+	require.NoError(t, err)
+	require.NoError(t, gadget.Installations.Save(context.Background(), otherWorkspace))
+
+	var stored models.Installation
+	require.NoError(t, db.First(&stored).Error)
+	assert.NotEqual(t, otherWorkspace.BotToken, stored.BotToken)
+	other, err := gadget.forTeam(context.Background(), "T_OTHER")
+	require.NoError(t, err)
+	assert.Equal(t, "U_OTHERBOT", other.Identity.Get().UserID)
+}
+
+func TestHandlerContext_InWorkspace(t *testing.T) {
+	gadget := newInstallableGadget(t, gadgettest.NewFakeSlack(t))
+	require.NoError(t, gadget.Installations.Save(context.Background(), otherWorkspace))
+	ctx := gadget.buildHandlerContext(context.Background(), zerolog.Nop())
+
+	other, err := ctx.InWorkspace("T_OTHER")
+	require.NoError(t, err)
+	home, err := ctx.InWorkspace("")
+	require.NoError(t, err)
+	_, err = ctx.InWorkspace("T_GONE")
+
+	assert.Equal(t, "U_OTHERBOT", other.Identity.UserID)
+	assert.Equal(t, "U_OTHERBOT", other.Router.BotUID, "the deprecated field follows the workspace's identity")
+	assert.Equal(t, "T_OTHER", other.Router.TeamID)
+	assert.NotSame(t, gadget.Client, other.BotClient)
+	assert.Same(t, gadget.Client, home.BotClient)
+	assert.ErrorIs(t, err, install.ErrNotInstalled)
+}
+
+func TestGadgetHandler_EventInInstalledWorkspaceIgnoresItsBot(t *testing.T) {
+	gadget := newInstallableGadget(t, gadgettest.NewFakeSlack(t))
+	require.NoError(t, gadget.Installations.Save(context.Background(), otherWorkspace))
+	called := make(chan struct{}, 1)
+	gadget.Router.AddChannelMessageRoute(router.ChannelMessageRoute{
+		Route:  router.Route{Name: "echo", Pattern: `.*`},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.MessageEvent, message string) { called <- struct{}{} },
+	})
+
+	postEvent(gadget, "T_OTHER", map[string]interface{}{"type": "message", "user": "U_OTHERBOT", "text": "hi", "channel": "C123", "ts": "1.1"})
+	gadget.Wait()
+
+	assert.Empty(t, called)
+}
+
+func TestGadgetHandler_EventInUnknownWorkspace(t *testing.T) {
+	gadget := newInstallableGadget(t, gadgettest.NewFakeSlack(t))
+	called := make(chan struct{}, 1)
+	gadget.Router.AddMentionRoute(router.MentionRoute{
+		Route:  router.Route{Name: "hello", Pattern: `(?i)^hello`},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) { called <- struct{}{} },
+	})
+
+	w := postEvent(gadget, "T_UNKNOWN", mention("U_OTHERBOT", "hello"))
+	gadget.Wait()
+
+	assert.Equal(t, http.StatusOK, w.Code, "Slack doesn't retry events that were acknowledged")
+	assert.Empty(t, called)
+}
+
+func TestGadgetHandler_AppUninstalled(t *testing.T) {
+	gadget := newInstallableGadget(t, gadgettest.NewFakeSlack(t))
+	require.NoError(t, gadget.Installations.Save(context.Background(), otherWorkspace))
+	_, err := gadget.forWorkspace(context.Background(), "", "T_OTHER")
+	require.NoError(t, err)
+
+	w := postEvent(gadget, "T_OTHER", map[string]interface{}{"type": "app_uninstalled"})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err = gadget.Installations.Find(context.Background(), "", "T_OTHER")
+	assert.ErrorIs(t, err, install.ErrNotInstalled)
+	_, err = gadget.forWorkspace(context.Background(), "", "T_OTHER")
+	assert.ErrorIs(t, err, install.ErrNotInstalled, "the cached workspace is forgotten")
+}
+
+func TestCommandHandler_InstalledWorkspace(t *testing.T) {
+	gadget := newInstallableGadget(t, gadgettest.NewFakeSlack(t))
+	require.NoError(t, gadget.Installations.Save(context.Background(), otherWorkspace))
+	teams := make(chan string, 1)
+	gadget.Router.AddSlashCommandRoute(router.SlashCommandRoute{
+		Route:   router.Route{Name: "ping"},
+		Command: "/ping",
+		Plugin:  func(ctx router.HandlerContext, cmd slack.SlashCommand) { teams <- ctx.Identity.TeamID },
+	})
+	command := func(teamID string) *httptest.ResponseRecorder {
+		body := url.Values{"command": {"/ping"}, "team_id": {teamID}, "user_id": {"U_USER"}, "channel_id": {"C123"}}.Encode()
+		req := httptest.NewRequest(http.MethodPost, "/gadget/command", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		signRequest(req, body)
+		return serve(gadget, req)
+	}
+
+	assert.Equal(t, http.StatusOK, command("T_OTHER").Code)
+	gadget.Wait()
+	assert.Equal(t, "T_OTHER", <-teams)
+
+	w := command("T_UNKNOWN")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), notInstalledResponse)
+	assert.Empty(t, teams)
+}
+
+func TestGadgetHandler_Install(t *testing.T) {
+	fake := gadgettest.NewFakeSlack(t)
+	fake.GrantCode("code-1", "T_NEW", "U_INSTALLER")
+	gadget := newInstallableGadget(t, fake)
+	gadget.Router.AddMentionRoute(router.MentionRoute{Route: router.Route{Name: "hello", Pattern: `(?i)^hello`}})
+
+	start := serve(gadget, httptest.NewRequest(http.MethodGet, install.InstallPath, nil))
+	require.Equal(t, http.StatusFound, start.Code)
+	location, err := url.Parse(start.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Contains(t, location.Query().Get("scope"), "app_mentions:read", "scopes come from the routes")
+
+	req := httptest.NewRequest(http.MethodGet, install.CallbackPath+"?code=code-1&state="+url.QueryEscape(location.Query().Get("state")), nil)
+	req.AddCookie(start.Result().Cookies()[0])
+	w := serve(gadget, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	installation, err := gadget.Installations.Find(context.Background(), "", "T_NEW")
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-T_NEW", installation.BotToken)
+
+	r := gadget.Router
+	r.TeamID = "T_NEW"
+	assert.True(t, r.IsGlobalAdmin(r.FindOrCreateUser("U_INSTALLER")), "the installer administers their workspace")
+	assert.True(t, r.IsGlobalAdmin(r.FindOrCreateUser("U_OWNER")))
+	r.TeamID = ""
+	assert.False(t, r.IsGlobalAdmin(r.FindOrCreateUser("U_INSTALLER")), "but not the default workspace")
+}
+
+func TestGadgetHandler_InstallDisabled(t *testing.T) {
+	gadget, err := NewWithDB(Config{}, setupTestDB(t))
+	require.NoError(t, err)
+
+	w := serve(gadget, httptest.NewRequest(http.MethodGet, install.InstallPath, nil))
+
+	assert.Nil(t, gadget.Installations)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGadget_ReadyWithOnlyInstalledWorkspaces(t *testing.T) {
+	gadget, err := NewWithDB(Config{SlackClientID: "client-id"}, setupTestDB(t))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	readiness := gadget.Ready(ctx)
+
+	assert.True(t, readiness.Ready, "there's no default bot user to load")
+}
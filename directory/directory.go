@@ -0,0 +1,398 @@
+// Package directory caches the workspace's users and channels, so plugins
+// can look them up by ID, name, email or display name without calling Slack
+// every time. Cached entries are trusted for a TTL and kept current between
+// lookups by the user_change, channel_created, channel_rename,
+// channel_archive and channel_unarchive events passed to HandleEvent.
+//
+// Lookups by ID or email that miss the cache ask Slack for that one user or
+// channel. Lookups by name or display name that miss the cache reload the
+// full user or channel list, at most once per TTL.
+package directory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/rs/zerolog/log"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"gorm.io/gorm"
+)
+
+// DefaultTTL is how long cached entries are trusted when Options.TTL is 0
+const DefaultTTL = time.Hour
+
+// ErrNotFound is returned when no user or channel matches a lookup
+var ErrNotFound = errors.New("not found in directory")
+
+// channelTypes are the conversation types loaded by ChannelByName. DMs have
+// no names to look up.
+var channelTypes = []string{"public_channel", "private_channel"}
+
+// Options configure a Directory. The zero value caches for DefaultTTL and
+// persists nothing.
+type Options struct {
+	TTL time.Duration // how long cached entries are trusted
+	// DB, when set, receives a snapshot of every user profile the directory
+	// fetches or is told about, in the users table.
+	DB     *gorm.DB
+	TeamID string // the installed workspace the snapshots' users belong to, as in models.User
+}
+
+func (o Options) ttl() time.Duration {
+	if o.TTL <= 0 {
+		return DefaultTTL
+	}
+	return o.TTL
+}
+
+// Directory is a cache of the workspace's users and channels. It is safe for
+// concurrent use.
+type Directory struct {
+	client *slack.Client
+	opts   Options
+
+	mu             sync.RWMutex
+	users          map[string]entry[slack.User]    // keyed by ID
+	channels       map[string]entry[slack.Channel] // keyed by ID
+	usersLoaded    time.Time                       // when the full user list was last loaded
+	channelsLoaded time.Time                       // when the full channel list was last loaded
+
+	now func() time.Time // replaced in tests
+}
+
+type entry[T any] struct {
+	value   T
+	fetched time.Time
+}
+
+// New returns an empty Directory that looks up misses with client
+func New(client *slack.Client, opts Options) *Directory {
+	return &Directory{
+		client:   client,
+		opts:     opts,
+		users:    map[string]entry[slack.User]{},
+		channels: map[string]entry[slack.Channel]{},
+		now:      time.Now,
+	}
+}
+
+func (d *Directory) fresh(fetched time.Time) bool {
+	return d.now().Sub(fetched) < d.opts.ttl()
+}
+
+// User returns the user with id
+func (d *Directory) User(id string) (slack.User, error) {
+	d.mu.RLock()
+	cached, exists := d.users[id]
+	d.mu.RUnlock()
+	if exists && d.fresh(cached.fetched) {
+		return cached.value, nil
+	}
+
+	user, err := d.client.GetUserInfo(id)
+	if err != nil {
+		return slack.User{}, fmt.Errorf("looking up user %s: %w", id, err)
+	}
+	d.storeUser(*user)
+	return *user, nil
+}
+
+// UserByEmail returns the user whose profile has email, ignoring case. The
+// bot needs the users:read.email scope to find users Slack hasn't told it
+// about.
+func (d *Directory) UserByEmail(email string) (slack.User, error) {
+	if user, found := d.findUser(func(u slack.User) bool {
+		return strings.EqualFold(u.Profile.Email, email)
+	}); found {
+		return user, nil
+	}
+
+	user, err := d.client.GetUserByEmail(email)
+	if err != nil {
+		var slackErr slack.SlackErrorResponse
+		if errors.As(err, &slackErr) && slackErr.Err == "users_not_found" {
+			return slack.User{}, fmt.Errorf("user %s: %w", email, ErrNotFound)
+		}
+		return slack.User{}, fmt.Errorf("looking up user %s: %w", email, err)
+	}
+	d.storeUser(*user)
+	return *user, nil
+}
+
+// UserByName returns the user whose handle is name, ignoring case and any
+// leading "@"
+func (d *Directory) UserByName(name string) (slack.User, error) {
+	name = strings.TrimPrefix(name, "@")
+	return d.userMatching(name, func(u slack.User) bool {
+		return strings.EqualFold(u.Name, name)
+	})
+}
+
+// UserByDisplayName returns the user whose display name, or real name when
+// they have no display name, is name, ignoring case and any leading "@"
+func (d *Directory) UserByDisplayName(name string) (slack.User, error) {
+	name = strings.TrimPrefix(name, "@")
+	return d.userMatching(name, func(u slack.User) bool {
+		displayName := u.Profile.DisplayName
+		if displayName == "" {
+			displayName = u.RealName
+		}
+		return strings.EqualFold(displayName, name)
+	})
+}
+
+// userMatching returns the cached user matching match, reloading the full
+// user list if none does and it hasn't been loaded within the TTL.
+func (d *Directory) userMatching(name string, match func(slack.User) bool) (slack.User, error) {
+	if user, found := d.findUser(match); found {
+		return user, nil
+	}
+
+	d.mu.RLock()
+	loaded := d.usersLoaded
+	d.mu.RUnlock()
+	if !d.fresh(loaded) {
+		if err := d.loadUsers(); err != nil {
+			return slack.User{}, err
+		}
+		if user, found := d.findUser(match); found {
+			return user, nil
+		}
+	}
+	return slack.User{}, fmt.Errorf("user %s: %w", name, ErrNotFound)
+}
+
+func (d *Directory) findUser(match func(slack.User) bool) (slack.User, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, cached := range d.users {
+		if !cached.value.Deleted && d.fresh(cached.fetched) && match(cached.value) {
+			return cached.value, true
+		}
+	}
+	return slack.User{}, false
+}
+
+func (d *Directory) loadUsers() error {
+	users, err := d.client.GetUsers()
+	if err != nil {
+		return fmt.Errorf("listing users: %w", err)
+	}
+	now := d.now()
+	d.mu.Lock()
+	for _, user := range users {
+		d.users[user.ID] = entry[slack.User]{value: user, fetched: now}
+	}
+	d.usersLoaded = now
+	d.mu.Unlock()
+
+	for _, user := range users {
+		d.persist(user)
+	}
+	return nil
+}
+
+func (d *Directory) storeUser(user slack.User) {
+	d.mu.Lock()
+	d.users[user.ID] = entry[slack.User]{value: user, fetched: d.now()}
+	d.mu.Unlock()
+	d.persist(user)
+}
+
+// persist saves a snapshot of user's profile when Options.DB is set
+func (d *Directory) persist(user slack.User) {
+	if d.opts.DB == nil || user.IsBot || user.Deleted {
+		return
+	}
+	var stored models.User
+	err := d.opts.DB.Where("team_id = ? AND uuid = ?", d.opts.TeamID, user.ID).
+		Attrs(models.User{Uuid: user.ID, TeamID: d.opts.TeamID}).
+		Assign(models.ProfileColumns(user, d.now())).
+		FirstOrCreate(&stored).Error
+	if err != nil {
+		log.Warn().Err(err).Str("uuid", user.ID).Msg("Failed to save user profile")
+	}
+}
+
+// Channel returns the channel with id
+func (d *Directory) Channel(id string) (slack.Channel, error) {
+	d.mu.RLock()
+	cached, exists := d.channels[id]
+	d.mu.RUnlock()
+	if exists && d.fresh(cached.fetched) {
+		return cached.value, nil
+	}
+
+	channel, err := d.client.GetConversationInfo(&slack.GetConversationInfoInput{ChannelID: id})
+	if err != nil {
+		return slack.Channel{}, fmt.Errorf("looking up channel %s: %w", id, err)
+	}
+	d.storeChannel(*channel)
+	return *channel, nil
+}
+
+// ChannelByName returns the public or private channel named name, ignoring
+// case and any leading "#". Archived channels are not found.
+func (d *Directory) ChannelByName(name string) (slack.Channel, error) {
+	name = strings.ToLower(strings.TrimPrefix(name, "#"))
+	match := func(ch slack.Channel) bool {
+		return !ch.IsArchived && (ch.NameNormalized == name || strings.EqualFold(ch.Name, name))
+	}
+	if channel, found := d.findChannel(match); found {
+		return channel, nil
+	}
+
+	d.mu.RLock()
+	loaded := d.channelsLoaded
+	d.mu.RUnlock()
+	if !d.fresh(loaded) {
+		if err := d.loadChannels(); err != nil {
+			return slack.Channel{}, err
+		}
+		if channel, found := d.findChannel(match); found {
+			return channel, nil
+		}
+	}
+	return slack.Channel{}, fmt.Errorf("channel %s: %w", name, ErrNotFound)
+}
+
+func (d *Directory) findChannel(match func(slack.Channel) bool) (slack.Channel, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, cached := range d.channels {
+		if d.fresh(cached.fetched) && match(cached.value) {
+			return cached.value, true
+		}
+	}
+	return slack.Channel{}, false
+}
+
+func (d *Directory) loadChannels() error {
+	var channels []slack.Channel
+	params := &slack.GetConversationsParameters{Types: channelTypes, ExcludeArchived: true, Limit: 1000}
+	for {
+		page, cursor, err := d.client.GetConversations(params)
+		if err != nil {
+			return fmt.Errorf("listing conversations: %w", err)
+		}
+		channels = append(channels, page...)
+		if cursor == "" {
+			break
+		}
+		params.Cursor = cursor
+	}
+
+	now := d.now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, channel := range channels {
+		d.channels[channel.ID] = entry[slack.Channel]{value: channel, fetched: now}
+	}
+	d.channelsLoaded = now
+	return nil
+}
+
+func (d *Directory) storeChannel(channel slack.Channel) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.channels[channel.ID] = entry[slack.Channel]{value: channel, fetched: d.now()}
+}
+
+// updateChannel applies update to the cached channel with id, if there is one
+func (d *Directory) updateChannel(id string, update func(*slack.Channel)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cached, exists := d.channels[id]
+	if !exists {
+		return
+	}
+	update(&cached.value)
+	d.channels[id] = cached
+}
+
+// HandleEvent updates the directory from an Events API inner event's data,
+// and returns true if the event was one the directory tracks.
+func (d *Directory) HandleEvent(data interface{}) bool {
+	switch ev := data.(type) {
+	case *slackevents.UserChangeEvent:
+		user := userFromEvent(ev.User)
+		d.mu.RLock()
+		cached, exists := d.users[user.ID]
+		d.mu.RUnlock()
+		if exists && user.Profile.Email == "" {
+			// user_change events don't carry the profile's email
+			user.Profile.Email = cached.value.Profile.Email
+		}
+		d.storeUser(user)
+	case *slackevents.ChannelCreatedEvent:
+		channel := slack.Channel{}
+		channel.ID = ev.Channel.ID
+		channel.Name = ev.Channel.Name
+		channel.NameNormalized = strings.ToLower(ev.Channel.Name)
+		channel.Creator = ev.Channel.Creator
+		channel.Created = slack.JSONTime(ev.Channel.Created)
+		channel.IsChannel = true
+		d.storeChannel(channel)
+	case *slackevents.ChannelRenameEvent:
+		d.updateChannel(ev.Channel.ID, func(ch *slack.Channel) {
+			ch.Name = ev.Channel.Name
+			ch.NameNormalized = strings.ToLower(ev.Channel.Name)
+		})
+	case *slackevents.ChannelArchiveEvent:
+		d.updateChannel(ev.Channel, func(ch *slack.Channel) { ch.IsArchived = true })
+	case *slackevents.ChannelUnarchiveEvent:
+		d.updateChannel(ev.Channel, func(ch *slack.Channel) { ch.IsArchived = false })
+	default:
+		return false
+	}
+	return true
+}
+
+// userFromEvent converts the user in a user_change event to a slack.User
+func userFromEvent(u slackevents.User) slack.User {
+	return slack.User{
+		ID:                u.ID,
+		TeamID:            u.TeamID,
+		Name:              u.Name,
+		Deleted:           u.Deleted,
+		Color:             u.Color,
+		RealName:          u.RealName,
+		TZ:                u.TZ,
+		TZLabel:           u.TZLabel,
+		TZOffset:          u.TZOffset,
+		IsAdmin:           u.IsAdmin,
+		IsOwner:           u.IsOwner,
+		IsPrimaryOwner:    u.IsPrimaryOwner,
+		IsRestricted:      u.IsRestricted,
+		IsUltraRestricted: u.IsUltraRestricted,
+		IsBot:             u.IsBot,
+		IsAppUser:         u.IsAppUser,
+		Updated:           slack.JSONTime(u.Updated),
+		Locale:            u.Locale,
+		Profile: slack.UserProfile{
+			FirstName:             u.Profile.FirstName,
+			LastName:              u.Profile.LastName,
+			RealName:              u.Profile.RealName,
+			RealNameNormalized:    u.Profile.RealNameNormalized,
+			DisplayName:           u.Profile.DisplayName,
+			DisplayNameNormalized: u.Profile.DisplayNameNormalized,
+			Title:                 u.Profile.Title,
+			Phone:                 u.Profile.Phone,
+			Skype:                 u.Profile.Skype,
+			StatusText:            u.Profile.StatusText,
+			StatusEmoji:           u.Profile.StatusEmoji,
+			Image24:               u.Profile.Image24,
+			Image32:               u.Profile.Image32,
+			Image48:               u.Profile.Image48,
+			Image72:               u.Profile.Image72,
+			Image192:              u.Profile.Image192,
+			Image512:              u.Profile.Image512,
+			Team:                  u.Profile.Team,
+		},
+	}
+}
@@ -0,0 +1,280 @@
+package directory
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const usersJSON = `{"ok":true,"members":[
+	{"id":"U1","name":"alice","real_name":"Alice Adams","tz":"Europe/London","profile":{"display_name":"ali","email":"alice@example.com"}},
+	{"id":"U2","name":"bob","real_name":"Bob Brown","profile":{"display_name":"","email":"bob@example.com"}}
+],"response_metadata":{"next_cursor":""}}`
+
+// fakeSlack answers the directory's Slack API calls and counts them by method
+type fakeSlack struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (f *fakeSlack) count(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+func newTestDirectory(t *testing.T, opts Options) (*Directory, *fakeSlack, *time.Time) {
+	t.Helper()
+	fake := &fakeSlack{calls: map[string]int{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		fake.mu.Lock()
+		fake.calls[r.URL.Path[1:]]++
+		fake.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		var body string
+		switch r.URL.Path {
+		case "/users.info":
+			body = `{"ok":true,"user":{"id":"` + r.FormValue("user") + `","name":"carol","real_name":"Carol Clark","tz":"America/Chicago","profile":{"email":"carol@example.com"}}}`
+		case "/users.lookupByEmail":
+			if r.FormValue("email") != "dave@example.com" {
+				body = `{"ok":false,"error":"users_not_found"}`
+				break
+			}
+			body = `{"ok":true,"user":{"id":"U4","name":"dave","profile":{"email":"dave@example.com"}}}`
+		case "/users.list":
+			body = usersJSON
+		case "/conversations.info":
+			body = `{"ok":true,"channel":{"id":"` + r.FormValue("channel") + `","name":"random","name_normalized":"random"}}`
+		case "/conversations.list":
+			if r.FormValue("cursor") == "" {
+				body = `{"ok":true,"channels":[{"id":"C1","name":"general","name_normalized":"general"}],"response_metadata":{"next_cursor":"page2"}}`
+				break
+			}
+			body = `{"ok":true,"channels":[{"id":"C2","name":"Ops-Alerts","name_normalized":"ops-alerts"}],"response_metadata":{"next_cursor":""}}`
+		default:
+			body = `{"ok":false,"error":"unknown_method"}`
+		}
+		_, _ = w.Write([]byte(body)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	t.Cleanup(server.Close)
+
+	api := slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+	dir := New(api, opts)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dir.now = func() time.Time { return now }
+	return dir, fake, &now
+}
+
+func TestDirectory_UserIsCached(t *testing.T) {
+	dir, fake, _ := newTestDirectory(t, Options{})
+
+	for i := 0; i < 2; i++ {
+		user, err := dir.User("U3")
+		require.NoError(t, err)
+		assert.Equal(t, "Carol Clark", user.RealName)
+	}
+	assert.Equal(t, 1, fake.count("users.info"))
+}
+
+func TestDirectory_UserRefetchedAfterTTL(t *testing.T) {
+	dir, fake, now := newTestDirectory(t, Options{TTL: time.Minute})
+
+	_, err := dir.User("U3")
+	require.NoError(t, err)
+	*now = now.Add(time.Minute)
+	_, err = dir.User("U3")
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, fake.count("users.info"))
+}
+
+func TestDirectory_UserByNameLoadsUserList(t *testing.T) {
+	dir, fake, _ := newTestDirectory(t, Options{})
+
+	user, err := dir.UserByName("@Alice")
+	require.NoError(t, err)
+	assert.Equal(t, "U1", user.ID)
+
+	user, err = dir.User("U2")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", user.Name, "the full list fills the cache")
+	assert.Equal(t, 0, fake.count("users.info"))
+}
+
+func TestDirectory_UserByNameNotFoundLoadsOncePerTTL(t *testing.T) {
+	dir, fake, _ := newTestDirectory(t, Options{})
+
+	for i := 0; i < 2; i++ {
+		_, err := dir.UserByName("nobody")
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, 1, fake.count("users.list"))
+}
+
+func TestDirectory_UserByDisplayName(t *testing.T) {
+	dir, _, _ := newTestDirectory(t, Options{})
+
+	user, err := dir.UserByDisplayName("ALI")
+	require.NoError(t, err)
+	assert.Equal(t, "U1", user.ID)
+
+	user, err = dir.UserByDisplayName("Bob Brown")
+	require.NoError(t, err)
+	assert.Equal(t, "U2", user.ID, "users without a display name match on real name")
+}
+
+func TestDirectory_UserByEmail(t *testing.T) {
+	dir, fake, _ := newTestDirectory(t, Options{})
+
+	user, err := dir.UserByEmail("dave@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "U4", user.ID)
+
+	user, err = dir.UserByEmail("DAVE@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "U4", user.ID)
+	assert.Equal(t, 1, fake.count("users.lookupByEmail"))
+
+	_, err = dir.UserByEmail("nobody@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestDirectory_ChannelByNamePaginates(t *testing.T) {
+	dir, fake, _ := newTestDirectory(t, Options{})
+
+	channel, err := dir.ChannelByName("#ops-alerts")
+	require.NoError(t, err)
+	assert.Equal(t, "C2", channel.ID)
+
+	channel, err = dir.Channel("C1")
+	require.NoError(t, err)
+	assert.Equal(t, "general", channel.Name)
+	assert.Equal(t, 2, fake.count("conversations.list"))
+	assert.Equal(t, 0, fake.count("conversations.info"))
+}
+
+func TestDirectory_Channel(t *testing.T) {
+	dir, fake, _ := newTestDirectory(t, Options{})
+
+	for i := 0; i < 2; i++ {
+		channel, err := dir.Channel("C9")
+		require.NoError(t, err)
+		assert.Equal(t, "random", channel.Name)
+	}
+	assert.Equal(t, 1, fake.count("conversations.info"))
+}
+
+func TestDirectory_HandleEventUserChange(t *testing.T) {
+	dir, fake, _ := newTestDirectory(t, Options{})
+	_, err := dir.User("U3")
+	require.NoError(t, err)
+
+	handled := dir.HandleEvent(&slackevents.UserChangeEvent{User: slackevents.User{
+		ID:       "U3",
+		Name:     "carol",
+		RealName: "Carol Cooper",
+		Profile:  slackevents.Profile{DisplayName: "cc"},
+	}})
+
+	assert.True(t, handled)
+	user, err := dir.User("U3")
+	require.NoError(t, err)
+	assert.Equal(t, "Carol Cooper", user.RealName)
+	assert.Equal(t, "carol@example.com", user.Profile.Email, "the cached email is kept")
+	found, err := dir.UserByDisplayName("cc")
+	require.NoError(t, err)
+	assert.Equal(t, "U3", found.ID)
+	assert.Equal(t, 1, fake.count("users.info"))
+	assert.Equal(t, 0, fake.count("users.list"))
+}
+
+func TestDirectory_HandleEventChannels(t *testing.T) {
+	dir, fake, _ := newTestDirectory(t, Options{})
+
+	assert.True(t, dir.HandleEvent(&slackevents.ChannelCreatedEvent{Channel: slackevents.ChannelCreatedInfo{ID: "C5", Name: "launch", Creator: "U1"}}))
+	channel, err := dir.ChannelByName("launch")
+	require.NoError(t, err)
+	assert.Equal(t, "C5", channel.ID)
+
+	assert.True(t, dir.HandleEvent(&slackevents.ChannelRenameEvent{Channel: slackevents.ChannelRenameInfo{ID: "C5", Name: "Launched"}}))
+	channel, err = dir.ChannelByName("launched")
+	require.NoError(t, err)
+	assert.Equal(t, "C5", channel.ID)
+	assert.Equal(t, 0, fake.count("conversations.list"))
+
+	assert.True(t, dir.HandleEvent(&slackevents.ChannelArchiveEvent{Channel: "C5"}))
+	channel, err = dir.Channel("C5")
+	require.NoError(t, err)
+	assert.True(t, channel.IsArchived)
+	_, err = dir.ChannelByName("launched")
+	assert.ErrorIs(t, err, ErrNotFound, "archived channels aren't found by name")
+
+	assert.True(t, dir.HandleEvent(&slackevents.ChannelUnarchiveEvent{Channel: "C5"}))
+	_, err = dir.ChannelByName("launched")
+	assert.NoError(t, err)
+}
+
+func TestDirectory_HandleEventIgnoresOtherEvents(t *testing.T) {
+	dir, _, _ := newTestDirectory(t, Options{})
+
+	assert.False(t, dir.HandleEvent(&slackevents.AppMentionEvent{}))
+}
+
+func TestDirectory_PersistsProfiles(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Group{}, &models.User{}))
+	require.NoError(t, db.Create(&models.User{Uuid: "U3"}).Error)
+
+	dir, _, _ := newTestDirectory(t, Options{DB: db})
+	_, err = dir.User("U3")
+	require.NoError(t, err)
+	dir.HandleEvent(&slackevents.UserChangeEvent{User: slackevents.User{ID: "U3", Name: "carol", RealName: "Carol Cooper", TZ: "America/Chicago"}})
+
+	var stored models.User
+	require.NoError(t, db.Where("uuid = ?", "U3").First(&stored).Error)
+	assert.Equal(t, "carol", stored.Name)
+	assert.Equal(t, "Carol Cooper", stored.RealName)
+	assert.Equal(t, "carol@example.com", stored.Email)
+	assert.Equal(t, "America/Chicago", stored.TimeZone)
+	require.NotNil(t, stored.ProfileUpdatedAt)
+
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestDirectory_PersistsProfilesInTeam(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Group{}, &models.User{}))
+	require.NoError(t, db.Create(&models.User{Uuid: "U3"}).Error)
+
+	dir, _, _ := newTestDirectory(t, Options{DB: db, TeamID: "T_OTHER"})
+	_, err = dir.User("U3")
+	require.NoError(t, err)
+
+	var stored []models.User
+	require.NoError(t, db.Where("uuid = ?", "U3").Order("id").Find(&stored).Error)
+	require.Len(t, stored, 2)
+	assert.Empty(t, stored[0].Name, "the user outside the team is untouched")
+	assert.Equal(t, "T_OTHER", stored[1].TeamID)
+	assert.NotEmpty(t, stored[1].Name)
+}
@@ -3,11 +3,17 @@ package gadgettest
 import (
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/gadget-bot/gadget/adapter/mattermost"
+	"github.com/gadget-bot/gadget/models"
 	"github.com/gadget-bot/gadget/router"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDispatchMention_MatchingRoute(t *testing.T) {
@@ -128,3 +134,334 @@ func TestWithUserClient_Available(t *testing.T) {
 	_ = d.DispatchMention(slackevents.AppMentionEvent{}, "test")
 	assert.Equal(t, userClient, receivedClient)
 }
+
+func TestDispatchSlashCommand_Subcommand(t *testing.T) {
+	var called string
+	d := NewDispatcher(
+		WithSlashCommandRoutes(
+			router.SlashCommandRoute{
+				Route:   router.Route{Name: "deploy.status", Pattern: `^status$`},
+				Command: "/deploy",
+				Plugin:  func(ctx router.HandlerContext, cmd slack.SlashCommand) { called = ctx.Route.Name },
+			},
+			router.SlashCommandRoute{
+				Route:   router.Route{Name: "deploy"},
+				Command: "/deploy",
+				Plugin:  func(ctx router.HandlerContext, cmd slack.SlashCommand) { called = ctx.Route.Name },
+			},
+		),
+	)
+
+	assert.NoError(t, d.DispatchSlashCommand(slack.SlashCommand{Command: "/deploy", Text: "status"}))
+	assert.Equal(t, "deploy.status", called)
+
+	assert.NoError(t, d.DispatchSlashCommand(slack.SlashCommand{Command: "/deploy", Text: "api"}))
+	assert.Equal(t, "deploy", called)
+}
+
+func TestDispatchScheduledJob(t *testing.T) {
+	var called string
+	d := NewDispatcher(
+		WithScheduledJobs(router.ScheduledJob{
+			Route:    router.Route{Name: "standup.reminder"},
+			Schedule: "0 9 * * MON-FRI",
+			Plugin:   func(ctx router.HandlerContext) { called = ctx.Route.Name },
+		}),
+	)
+
+	assert.NoError(t, d.DispatchScheduledJob("standup.reminder"))
+	assert.Equal(t, "standup.reminder", called)
+}
+
+func TestDispatchScheduledJob_NoMatch(t *testing.T) {
+	d := NewDispatcher()
+	err := d.DispatchScheduledJob("unknown")
+	assert.True(t, errors.Is(err, ErrNoRoute))
+}
+
+func TestDispatchBlockAction(t *testing.T) {
+	var value string
+	var origin router.Origin
+	d := NewDispatcher(
+		WithBlockActionRoutes(router.BlockActionRoute{
+			Route:    router.Route{Name: "approvals.approve"},
+			ActionID: "approve",
+			Plugin: func(ctx router.HandlerContext, callback slack.InteractionCallback, action slack.BlockAction) {
+				value, origin = action.Value, ctx.Origin
+			},
+		}),
+	)
+
+	callback := slack.InteractionCallback{
+		User:      slack.User{ID: "U_USER"},
+		Container: slack.Container{ChannelID: "C123", MessageTs: "1.2"},
+	}
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: "approve", Value: "42"}}
+
+	assert.NoError(t, d.DispatchBlockAction(callback))
+	assert.Equal(t, "42", value)
+	assert.Equal(t, router.Origin{Channel: "C123", TimeStamp: "1.2", User: "U_USER"}, origin)
+
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: "reject"}}
+	assert.True(t, errors.Is(d.DispatchBlockAction(callback), ErrNoRoute))
+}
+
+func TestDispatchMention_SetsOrigin(t *testing.T) {
+	var origin router.Origin
+	d := NewDispatcher(
+		WithMentionRoutes(router.MentionRoute{
+			Route:  router.Route{Name: "greet", Pattern: `(?i)^hello`},
+			Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) { origin = ctx.Origin },
+		}),
+	)
+
+	assert.NoError(t, d.DispatchMention(slackevents.AppMentionEvent{User: "U_USER", Channel: "C123", TimeStamp: "1.2"}, "hello"))
+	assert.Equal(t, router.Origin{Channel: "C123", TimeStamp: "1.2", User: "U_USER"}, origin)
+}
+
+func adminOnlyMention(called *bool) router.MentionRoute {
+	return router.MentionRoute{
+		Route: router.Route{Name: "deploy", Pattern: `(?i)^deploy`, Permissions: []string{"admins"}},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+			*called = true
+		},
+	}
+}
+
+func TestEnforcement_AllowsGroupMember(t *testing.T) {
+	var called bool
+	d := NewDispatcher(WithEnforcement(), WithGroup("admins", "U_ADMIN"), WithMentionRoutes(adminOnlyMention(&called)))
+
+	err := d.DispatchMention(slackevents.AppMentionEvent{User: "U_ADMIN", Channel: "C123"}, "deploy")
+
+	assert.NoError(t, err)
+	assert.True(t, called)
+}
+
+func TestEnforcement_RunsDeniedRoute(t *testing.T) {
+	fake := NewFakeSlack(t)
+	var called bool
+	d := NewDispatcher(WithEnforcement(), WithFakeSlack(fake), WithGroup("admins", "U_ADMIN"), WithMentionRoutes(adminOnlyMention(&called)))
+
+	err := d.DispatchMention(slackevents.AppMentionEvent{User: "U_OTHER", Channel: "C123"}, "deploy")
+
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.False(t, called)
+	fake.AssertPosted(t, "C123", "you're not allowed to do that")
+}
+
+func TestEnforcement_GlobalAdmins(t *testing.T) {
+	var called bool
+	d := NewDispatcher(WithEnforcement(), WithGlobalAdmins("U_BOSS"), WithMentionRoutes(adminOnlyMention(&called)))
+
+	assert.NoError(t, d.DispatchMention(slackevents.AppMentionEvent{User: "U_BOSS", Channel: "C123"}, "deploy"))
+	assert.True(t, called)
+}
+
+func TestEnforcement_RunsFallback(t *testing.T) {
+	fake := NewFakeSlack(t)
+	d := NewDispatcher(WithEnforcement(), WithFakeSlack(fake))
+
+	err := d.DispatchMention(slackevents.AppMentionEvent{User: "U_USER", Channel: "C123"}, "sing a song")
+
+	assert.ErrorIs(t, err, ErrNoRoute)
+	fake.AssertPosted(t, "C123", "I'm not sure what to do with that")
+}
+
+func TestEnforcement_RateLimits(t *testing.T) {
+	fake := NewFakeSlack(t)
+	calls := 0
+	d := NewDispatcher(WithEnforcement(), WithFakeSlack(fake), WithChannelMessageRoutes(router.ChannelMessageRoute{
+		Route: router.Route{Name: "ping", Pattern: `^ping`, RateLimits: []router.RateLimit{{Scope: router.RateLimitPerUser, Burst: 1, Every: time.Hour}}},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.MessageEvent, message string) {
+			calls++
+		},
+	}))
+	ev := slackevents.MessageEvent{User: "U_USER", Channel: "C123"}
+
+	assert.NoError(t, d.DispatchChannelMessage(ev, "ping"))
+	assert.ErrorIs(t, d.DispatchChannelMessage(ev, "ping"), ErrRateLimited)
+	assert.Equal(t, 1, calls)
+	reactions := fake.Calls("reactions.add")
+	require.Len(t, reactions, 1)
+	assert.Equal(t, "hourglass_flowing_sand", reactions[0].Params.Get("name"))
+}
+
+func TestEnforcement_DisabledRoute(t *testing.T) {
+	var called bool
+	d := NewDispatcher(WithEnforcement(), WithFakeSlack(NewFakeSlack(t)), WithGlobalAdmins("U_ADMIN"), WithMentionRoutes(adminOnlyMention(&called)))
+	require.NoError(t, d.DB().Create(&models.RouteToggle{Target: "deploy", Disabled: true}).Error)
+
+	err := d.DispatchMention(slackevents.AppMentionEvent{User: "U_ADMIN", Channel: "C123"}, "deploy")
+
+	assert.ErrorIs(t, err, ErrNoRoute)
+	assert.False(t, called)
+}
+
+func TestEnforcement_SlashCommandDenied(t *testing.T) {
+	var called bool
+	d := NewDispatcher(WithEnforcement(), WithFakeSlack(NewFakeSlack(t)), WithSlashCommandRoutes(router.SlashCommandRoute{
+		Route:   router.Route{Name: "deploy", Permissions: []string{"admins"}},
+		Command: "/deploy",
+		Plugin:  func(ctx router.HandlerContext, cmd slack.SlashCommand) { called = true },
+	}))
+
+	err := d.DispatchSlashCommand(slack.SlashCommand{Command: "/deploy", UserID: "U_OTHER", ChannelID: "C123"})
+
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.False(t, called)
+	assert.ErrorIs(t, d.DispatchSlashCommand(slack.SlashCommand{Command: "/deploy", Text: "help", UserID: "U_OTHER"}), ErrNoRoute)
+}
+
+func TestEnforcement_BlockActionDenied(t *testing.T) {
+	var called bool
+	d := NewDispatcher(WithEnforcement(), WithBlockActionRoutes(router.BlockActionRoute{
+		Route:    router.Route{Name: "approve", Permissions: []string{"admins"}},
+		ActionID: "approve",
+		Plugin: func(ctx router.HandlerContext, callback slack.InteractionCallback, action slack.BlockAction) {
+			called = true
+		},
+	}))
+	callback := slack.InteractionCallback{User: slack.User{ID: "U_OTHER"}}
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: "approve"}}
+
+	assert.ErrorIs(t, d.DispatchBlockAction(callback), ErrPermissionDenied)
+	assert.False(t, called)
+}
+
+func TestWithMiddleware(t *testing.T) {
+	var calls []string
+	d := NewDispatcher(
+		WithMiddleware(func(ctx router.HandlerContext, next func(router.HandlerContext)) {
+			calls = append(calls, "middleware")
+			next(ctx)
+		}),
+		WithMentionRoutes(router.MentionRoute{
+			Route: router.Route{Name: "greet", Pattern: `(?i)^hello`},
+			Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+				calls = append(calls, "handler")
+			},
+		}),
+		WithScheduledJobs(router.ScheduledJob{
+			Route:    router.Route{Name: "nightly"},
+			Schedule: "@daily",
+			Plugin:   func(ctx router.HandlerContext) { calls = append(calls, "job") },
+		}),
+	)
+
+	require.NoError(t, d.DispatchMention(slackevents.AppMentionEvent{}, "hello"))
+	require.NoError(t, d.DispatchScheduledJob("nightly"))
+
+	assert.Equal(t, []string{"middleware", "handler", "middleware", "job"}, calls)
+}
+
+// pingRoute is a platform-neutral route that replies "pong", for users in
+// permissions
+func pingRoute(permissions ...string) router.MessageRoute {
+	return router.MessageRoute{
+		Route: router.Route{Name: "ping", Pattern: `^ping$`, Permissions: permissions},
+		Plugin: func(ctx router.HandlerContext, msg adapter.Message) {
+			_ = adapter.Reply(ctx.Adapter, msg, "pong")
+		},
+	}
+}
+
+func TestDispatchMention_FallsThroughToMessageRoute(t *testing.T) {
+	fake := NewFakeSlack(t)
+	d := NewDispatcher(WithFakeSlack(fake), WithMessageRoutes(pingRoute()))
+
+	err := d.DispatchMention(slackevents.AppMentionEvent{User: "U_USER", Channel: "C123", TimeStamp: "1.1", ThreadTimeStamp: "1.0"}, "ping")
+
+	require.NoError(t, err)
+	fake.AssertPostedInThread(t, "C123", "1.0", "pong")
+}
+
+func TestDispatchMention_MentionRouteBeforeMessageRoute(t *testing.T) {
+	fake := NewFakeSlack(t)
+	var called bool
+	d := NewDispatcher(WithEnforcement(), WithFakeSlack(fake), WithMessageRoutes(pingRoute("*")), WithMentionRoutes(router.MentionRoute{
+		Route:  router.Route{Name: "slack_ping", Pattern: `^ping$`, Permissions: []string{"*"}},
+		Plugin: func(router.HandlerContext, slackevents.AppMentionEvent, string) { called = true },
+	}))
+
+	require.NoError(t, d.DispatchMention(slackevents.AppMentionEvent{User: "U_USER", Channel: "C123"}, "ping"))
+
+	assert.True(t, called)
+	fake.AssertNothingPosted(t, "C123")
+}
+
+func TestDispatchChannelMessage_DirectMessageToMessageRoute(t *testing.T) {
+	fake := NewFakeSlack(t)
+	d := NewDispatcher(WithEnforcement(), WithFakeSlack(fake), WithMessageRoutes(pingRoute("*")))
+
+	require.NoError(t, d.DispatchChannelMessage(slackevents.MessageEvent{User: "U_USER", Channel: "D123", ChannelType: "im"}, "ping"))
+	fake.AssertPosted(t, "D123", "pong")
+
+	err := d.DispatchChannelMessage(slackevents.MessageEvent{User: "U_USER", Channel: "C123", ChannelType: "channel"}, "ping")
+	assert.ErrorIs(t, err, ErrNoRoute)
+	fake.AssertNothingPosted(t, "C123")
+}
+
+func newMattermostAdapter(t *testing.T) (*mattermost.Adapter, *FakeMattermost) {
+	t.Helper()
+	fake := NewFakeMattermost(t)
+	a, err := mattermost.New(mattermost.Options{URL: fake.URL(), Token: MattermostToken})
+	require.NoError(t, err)
+	return a, fake
+}
+
+func TestDispatchMessage_Mattermost(t *testing.T) {
+	a, fake := newMattermostAdapter(t)
+	d := NewDispatcher(WithAdapter(a), WithMessageRoutes(pingRoute()))
+
+	require.NoError(t, d.DispatchMessage(adapter.Message{Platform: "mattermost", Channel: "ch1", User: "u1", Text: "ping"}))
+
+	fake.AssertPosted(t, "ch1", "pong")
+}
+
+func TestDispatchMessage_NoMatch(t *testing.T) {
+	d := NewDispatcher()
+
+	err := d.DispatchMessage(adapter.Message{Platform: "mattermost", Channel: "ch1", User: "u1", Text: "ping"})
+
+	assert.ErrorIs(t, err, ErrNoRoute)
+}
+
+func TestEnforcement_MessageRouteUsesPlatformUsers(t *testing.T) {
+	a, fake := newMattermostAdapter(t)
+	d := NewDispatcher(WithEnforcement(), WithAdapter(a), WithGroup("pingers", "mattermost:u1"), WithMessageRoutes(pingRoute("pingers")))
+
+	require.NoError(t, d.DispatchMessage(adapter.Message{Platform: "mattermost", Channel: "ch1", User: "u1", Text: "ping"}))
+	fake.AssertPosted(t, "ch1", "pong")
+
+	id := fake.AddPost("ch2", "u2", "ping")
+	err := d.DispatchMessage(adapter.Message{Platform: "mattermost", ID: id, Channel: "ch2", User: "u2", Text: "ping"})
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	fake.AssertPosted(t, "ch2", "not allowed")
+	fake.AssertReacted(t, id, "astonished")
+}
+
+func TestEnforcement_MessageFallback(t *testing.T) {
+	a, fake := newMattermostAdapter(t)
+	d := NewDispatcher(WithEnforcement(), WithAdapter(a))
+
+	err := d.DispatchMessage(adapter.Message{Platform: "mattermost", Channel: "ch1", User: "u1", Text: "sing a song"})
+
+	assert.ErrorIs(t, err, ErrNoRoute)
+	fake.AssertPosted(t, "ch1", "not sure what to do")
+}
+
+func TestDispatcher_PluginMetrics(t *testing.T) {
+	d := NewDispatcher(WithMentionRoutes(router.MentionRoute{
+		Route: router.Route{Name: "greet", Pattern: `(?i)^hello`},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+			ctx.Metrics.Counter("greetings_total", "Greetings sent.").WithLabelValues().Inc()
+		},
+	}))
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, d.DispatchMention(slackevents.AppMentionEvent{User: "U_USER", Channel: "C123"}, "hello"))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(d.Metrics().Counter("greetings_total", "Greetings sent.")))
+}
@@ -0,0 +1,180 @@
+package e2e
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/core"
+	"github.com/gadget-bot/gadget/gadgettest"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func greeter() router.MentionRoute {
+	var route router.MentionRoute
+	route.Name = "greet"
+	route.Pattern = `(?i)^hello`
+	route.Plugin = func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+		time.Sleep(20 * time.Millisecond) // finishes after the HTTP response
+		_ = ctx.Reply("Hi <@" + ev.User + ">")
+	}
+	return route
+}
+
+func TestHarness_MentionWaitsForPlugin(t *testing.T) {
+	h := New(t, func(g *core.Gadget) {
+		g.Router.AddMentionRoute(greeter())
+	})
+
+	resp := h.Send(Mention("U1", "C1", "hello there"))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	h.Slack.AssertPosted(t, "C1", "Hi <@U1>")
+}
+
+func TestHarness_MentionInThread(t *testing.T) {
+	h := New(t, func(g *core.Gadget) {
+		g.Router.AddMentionRoute(greeter())
+	})
+
+	h.Send(Mention("U1", "C1", "hello").InThread("1600000000.000001"))
+
+	h.Slack.AssertPostedInThread(t, "C1", "1600000000.000001", "Hi <@U1>")
+}
+
+func TestHarness_UnknownMentionFallsBack(t *testing.T) {
+	h := New(t)
+
+	resp := h.Send(Mention("U1", "C1", "make me a sandwich"))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	h.Slack.AssertPosted(t, "C1", "I'm not sure what to do with that")
+}
+
+func TestHarness_ChannelMessage(t *testing.T) {
+	var route router.ChannelMessageRoute
+	route.Name = "ack"
+	route.Pattern = `(?i)ship it`
+	route.Plugin = func(ctx router.HandlerContext, ev slackevents.MessageEvent, message string) {
+		_ = ctx.React("rocket")
+	}
+	h := New(t, func(g *core.Gadget) {
+		g.Router.AddChannelMessageRoute(route)
+	})
+
+	h.Send(ChannelMessage("U1", "C1", "ship it").At("1600000000.000042"))
+
+	h.Slack.AssertCalled(t, "reactions.add")
+	require.Len(t, h.Slack.Calls("reactions.add"), 1)
+	assert.Equal(t, "1600000000.000042", h.Slack.Calls("reactions.add")[0].Params.Get("timestamp"))
+}
+
+func TestHarness_RejectsUnsignedRequests(t *testing.T) {
+	h := New(t)
+
+	resp, err := http.Post(h.URL()+"/gadget", "application/json", strings.NewReader(`{"type":"url_verification","challenge":"abc"}`))
+
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestHarness_URLVerification(t *testing.T) {
+	h := New(t)
+
+	resp := h.Post("/gadget", "application/json", `{"type":"url_verification","challenge":"abc"}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "abc", resp.Body)
+}
+
+func TestHarness_SlashCommand(t *testing.T) {
+	var route router.SlashCommandRoute
+	route.Name = "deploy"
+	route.Command = "/deploy"
+	route.Pattern = `^(?P<app>\S+)$`
+	route.ImmediateResponse = func() string { return "Deploying..." }
+	got := make(chan slack.SlashCommand, 1)
+	route.Plugin = func(ctx router.HandlerContext, cmd slack.SlashCommand) {
+		got <- cmd
+	}
+	h := New(t, func(g *core.Gadget) {
+		g.Router.AddSlashCommandRoute(route)
+	})
+
+	resp := h.Command(SlashCommand("U1", "C1", "/deploy", "api"))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Body, "Deploying...")
+	require.Len(t, got, 1, "the plugin has returned by the time Command does")
+	cmd := <-got
+	assert.Equal(t, "api", cmd.Text)
+	assert.Equal(t, "U1", cmd.UserID)
+	assert.Equal(t, TeamID, cmd.TeamID)
+}
+
+func TestHarness_ButtonClick(t *testing.T) {
+	var route router.BlockActionRoute
+	route.Name = "approve"
+	route.ActionID = "approve"
+	route.Plugin = func(ctx router.HandlerContext, callback slack.InteractionCallback, action slack.BlockAction) {
+		_ = ctx.Reply("Approved " + action.Value + " for <@" + callback.User.ID + ">")
+	}
+	h := New(t, func(g *core.Gadget) {
+		g.Router.AddBlockActionRoute(route)
+	})
+
+	resp := h.Interact(ButtonClick("U1", "C1", "1600000000.000007", "approve", "release-42"))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	h.Slack.AssertPosted(t, "C1", "Approved release-42 for <@U1>")
+}
+
+func TestHarness_Middleware(t *testing.T) {
+	var calls int
+	h := New(t, func(g *core.Gadget) {
+		g.Router.AddMentionRoute(greeter())
+		g.Use(func(ctx router.HandlerContext, next func(router.HandlerContext)) {
+			calls++
+			next(ctx)
+		})
+	})
+
+	h.Send(Mention("U1", "C1", "hello"))
+	h.Send(Mention("U1", "C1", "hello again"))
+
+	assert.Equal(t, 2, calls)
+	assert.Len(t, h.Slack.Messages("C1"), 2)
+}
+
+func TestHarness_IgnoresBotMessages(t *testing.T) {
+	h := New(t, func(g *core.Gadget) {
+		g.Router.AddMentionRoute(greeter())
+	})
+
+	h.Send(Mention("U_BOT", "C1", "hello"))
+	h.Send(Mention("U_OTHER_BOT", "C1", "hello").FromBot("B_OTHER"))
+
+	h.Slack.AssertNothingPosted(t, "C1")
+}
+
+func TestHarness_LoadsIdentity(t *testing.T) {
+	var identity router.BotIdentity
+	h := New(t, func(g *core.Gadget) {
+		g.Router.AddMentionRoute(router.MentionRoute{
+			Route: router.Route{Name: "whoami", Pattern: `^whoami$`, Permissions: []string{"*"}},
+			Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+				identity = ctx.Identity
+			},
+		})
+	})
+
+	h.Send(Mention("U1", "C1", "whoami"))
+
+	assert.Equal(t, gadgettest.Identity, identity)
+}
@@ -0,0 +1,98 @@
+package e2e
+
+import (
+	"fmt"
+
+	"github.com/gadget-bot/gadget/gadgettest"
+	"github.com/slack-go/slack"
+)
+
+// Event is the inner event of an event callback, as Slack sends it. Build
+// common ones with Mention and ChannelMessage, or write out any other event
+// type's fields directly.
+type Event map[string]interface{}
+
+// Mention is user mentioning the bot in channel with text
+func Mention(user, channel, text string) Event {
+	return Event{
+		"type":    "app_mention",
+		"user":    user,
+		"channel": channel,
+		"text":    fmt.Sprintf("<@%s> %s", gadgettest.BotUserID, text),
+	}
+}
+
+// ChannelMessage is user posting text in channel without mentioning the bot
+func ChannelMessage(user, channel, text string) Event {
+	return Event{
+		"type":         "message",
+		"user":         user,
+		"channel":      channel,
+		"channel_type": "channel",
+		"text":         text,
+	}
+}
+
+// DirectMessage is user sending text to the bot in the DM channel
+func DirectMessage(user, channel, text string) Event {
+	event := ChannelMessage(user, channel, text)
+	event["channel_type"] = "im"
+	return event
+}
+
+// InThread returns a copy of e posted in the thread started at threadTS
+func (e Event) InThread(threadTS string) Event {
+	return e.with("thread_ts", threadTS)
+}
+
+// At returns a copy of e with timestamp ts
+func (e Event) At(ts string) Event {
+	return e.with("ts", ts)
+}
+
+// FromBot returns a copy of e posted by the bot with ID botID, e.g. another
+// app's integration
+func (e Event) FromBot(botID string) Event {
+	return e.with("bot_id", botID)
+}
+
+func (e Event) with(key string, value interface{}) Event {
+	event := make(Event, len(e)+1)
+	for k, v := range e {
+		event[k] = v
+	}
+	event[key] = value
+	return event
+}
+
+// SlashCommand is user running command with text in channel
+func SlashCommand(user, channel, command, text string) slack.SlashCommand {
+	return slack.SlashCommand{
+		Command:   command,
+		Text:      text,
+		UserID:    user,
+		ChannelID: channel,
+		TriggerID: "trigger-" + user,
+	}
+}
+
+// ButtonClick is user clicking the button actionID, with value, on the
+// message at messageTS in channel
+func ButtonClick(user, channel, messageTS, actionID, value string) slack.InteractionCallback {
+	var callback slack.InteractionCallback
+	callback.Type = slack.InteractionTypeBlockActions
+	callback.User.ID = user
+	callback.Channel.ID = channel
+	callback.Container.Type = "message"
+	callback.Container.ChannelID = channel
+	callback.Container.MessageTs = messageTS
+	callback.Message.Timestamp = messageTS
+	callback.TriggerID = "trigger-" + user
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{
+		ActionID: actionID,
+		Type:     slack.ActionType("button"),
+		Value:    value,
+		ActionTs: messageTS,
+	}}
+	return callback
+}
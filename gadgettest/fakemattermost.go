@@ -0,0 +1,205 @@
+package gadgettest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// FakeMattermost is an in-process fake of the parts of the Mattermost REST
+// API (v4) that the mattermost adapter uses: looking up users, creating posts
+// and adding reactions. Requests without the bearer token MattermostToken
+// are rejected.
+type FakeMattermost struct {
+	server *httptest.Server
+
+	mu     sync.Mutex
+	users  map[string]MattermostUser
+	posts  []MattermostPost
+	lastID int
+}
+
+const (
+	// MattermostToken is the bot access token FakeMattermost accepts
+	MattermostToken = "mattermost-fake-token"
+	// MattermostBotUserID is the bot's user ID, as users/me reports it
+	MattermostBotUserID = "mm_bot"
+)
+
+// MattermostUser is a user known to FakeMattermost
+type MattermostUser struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	Nickname  string `json:"nickname,omitempty"`
+	Email     string `json:"email,omitempty"`
+}
+
+// MattermostPost is a post created on FakeMattermost
+type MattermostPost struct {
+	ID        string   `json:"id"`
+	ChannelID string   `json:"channel_id"`
+	RootID    string   `json:"root_id"`
+	UserID    string   `json:"user_id"`
+	Message   string   `json:"message"`
+	Reactions []string `json:"-"` // emoji names
+}
+
+// NewFakeMattermost starts a FakeMattermost that is shut down when the test
+// ends
+func NewFakeMattermost(t testing.TB) *FakeMattermost {
+	t.Helper()
+	f := &FakeMattermost{users: map[string]MattermostUser{
+		MattermostBotUserID: {ID: MattermostBotUserID, Username: "gadget"},
+	}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// URL returns the fake server's base URL
+func (f *FakeMattermost) URL() string {
+	return f.server.URL
+}
+
+// AddUser makes user known to the users API
+func (f *FakeMattermost) AddUser(user MattermostUser) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[user.ID] = user
+}
+
+// AddPost adds a post by someone other than the bot, e.g. for the bot to
+// react to, and returns its ID
+func (f *FakeMattermost) AddPost(channel, user, message string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	post := MattermostPost{ID: f.nextID(), ChannelID: channel, UserID: user, Message: message}
+	f.posts = append(f.posts, post)
+	return post.ID
+}
+
+// Posts returns the posts in channel, or in every channel when channel is
+// empty, oldest first
+func (f *FakeMattermost) Posts(channel string) []MattermostPost {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var posts []MattermostPost
+	for _, post := range f.posts {
+		if channel == "" || post.ChannelID == channel {
+			post.Reactions = append([]string(nil), post.Reactions...)
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
+
+// AssertPosted asserts that the bot posted a message containing text to
+// channel
+func (f *FakeMattermost) AssertPosted(t testing.TB, channel, text string) bool {
+	t.Helper()
+	posts := f.Posts("")
+	for _, post := range posts {
+		if post.ChannelID == channel && post.UserID == MattermostBotUserID && strings.Contains(post.Message, text) {
+			return true
+		}
+	}
+	var lines []string
+	for _, post := range posts {
+		lines = append(lines, fmt.Sprintf("  %s %s by %s: %s", post.ChannelID, post.ID, post.UserID, post.Message))
+	}
+	t.Errorf("expected a post in %s containing %q, got %d posts:\n%s", channel, text, len(posts), strings.Join(lines, "\n"))
+	return false
+}
+
+// AssertReacted asserts that the post with id has the reaction emoji
+func (f *FakeMattermost) AssertReacted(t testing.TB, id, emoji string) bool {
+	t.Helper()
+	for _, post := range f.Posts("") {
+		if post.ID != id {
+			continue
+		}
+		for _, reaction := range post.Reactions {
+			if reaction == emoji {
+				return true
+			}
+		}
+		t.Errorf("expected a :%s: reaction on %s, got %v", emoji, id, post.Reactions)
+		return false
+	}
+	t.Errorf("expected a :%s: reaction on %s, which doesn't exist", emoji, id)
+	return false
+}
+
+// nextID returns a new post ID. f.mu must be held.
+func (f *FakeMattermost) nextID() string {
+	f.lastID++
+	return fmt.Sprintf("post%d", f.lastID)
+}
+
+func (f *FakeMattermost) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+MattermostToken {
+		writeMattermostError(w, http.StatusUnauthorized, "api.context.session_expired.app_error", "Invalid or expired session, please login again.")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/api/v4")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && path == "/users/me":
+		writeMattermostJSON(w, http.StatusOK, f.users[MattermostBotUserID])
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/users/"):
+		user, exists := f.users[strings.TrimPrefix(path, "/users/")]
+		if !exists {
+			writeMattermostError(w, http.StatusNotFound, "app.user.missing_account.const", "Unable to find the user.")
+			return
+		}
+		writeMattermostJSON(w, http.StatusOK, user)
+	case r.Method == http.MethodPost && path == "/posts":
+		var post MattermostPost
+		if err := json.NewDecoder(r.Body).Decode(&post); err != nil || post.ChannelID == "" {
+			writeMattermostError(w, http.StatusBadRequest, "api.context.invalid_body_param.app_error", "Invalid or missing post in request body.")
+			return
+		}
+		post.ID = f.nextID()
+		post.UserID = MattermostBotUserID
+		f.posts = append(f.posts, post)
+		writeMattermostJSON(w, http.StatusCreated, post)
+	case r.Method == http.MethodPost && path == "/reactions":
+		var reaction struct {
+			UserID    string `json:"user_id"`
+			PostID    string `json:"post_id"`
+			EmojiName string `json:"emoji_name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&reaction); err != nil {
+			writeMattermostError(w, http.StatusBadRequest, "api.context.invalid_body_param.app_error", "Invalid or missing reaction in request body.")
+			return
+		}
+		for i := range f.posts {
+			if f.posts[i].ID == reaction.PostID {
+				f.posts[i].Reactions = append(f.posts[i].Reactions, reaction.EmojiName)
+				writeMattermostJSON(w, http.StatusOK, reaction)
+				return
+			}
+		}
+		writeMattermostError(w, http.StatusNotFound, "app.post.get.app_error", "Unable to get the post.")
+	default:
+		writeMattermostError(w, http.StatusNotFound, "api.context.404.app_error", "Sorry, we could not find the page.")
+	}
+}
+
+func writeMattermostJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeMattermostError(w http.ResponseWriter, status int, id, message string) {
+	writeMattermostJSON(w, status, map[string]interface{}{"id": id, "message": message, "status_code": status})
+}
@@ -0,0 +1,517 @@
+package gadgettest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+)
+
+// FakeSlack is an in-process fake of the Slack Web API. It answers the
+// methods plugins commonly use from simple state (users, channels and the
+// messages posted to them), records every call it receives, and can assert on
+// what was posted. Methods it doesn't implement fail with "unknown_method".
+//
+// Implemented methods: auth.test, bots.info, chat.postMessage,
+// chat.postEphemeral, chat.update, chat.delete, reactions.add, users.info,
+// conversations.list, conversations.join, conversations.open, views.open
+// and oauth.v2.access.
+type FakeSlack struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	calls    []Call
+	users    map[string]slack.User
+	channels map[string]slack.Channel
+	messages []*Message
+	views    []Call
+	failures map[string]string // method -> error returned by every call to it
+	grants   map[string]grant  // OAuth code -> the installation it grants
+	lastTS   int
+}
+
+// The bot's identity, as auth.test and bots.info report it
+const (
+	BotUserID = "U_BOT"
+	BotID     = "B_BOT"
+	TeamID    = "T_FAKE"
+	AppID     = "A_FAKE"
+)
+
+// Identity is the bot's identity, as Gadget loads it from the fake
+var Identity = router.BotIdentity{UserID: BotUserID, BotID: BotID, TeamID: TeamID, Team: "fake", AppID: AppID}
+
+// Call is a request the fake received
+type Call struct {
+	Method string     // e.g. "chat.postMessage"
+	Params url.Values // form values, or the top-level fields of a JSON body
+}
+
+// Message is a message posted to the fake
+type Message struct {
+	Channel   string
+	TS        string
+	ThreadTS  string // empty for messages outside threads
+	User      string // the recipient of an ephemeral message; empty otherwise
+	Text      string
+	Blocks    string // JSON array of the message's blocks; empty without blocks
+	Reactions []string
+	Edited    bool
+	Deleted   bool
+}
+
+// Ephemeral returns true if the message was posted with chat.postEphemeral
+func (m Message) Ephemeral() bool {
+	return m.User != ""
+}
+
+// Content returns the message's text and the text of its blocks, one per
+// line, for matching against.
+func (m Message) Content() string {
+	content := []string{m.Text}
+	if m.Blocks != "" {
+		var blocks interface{}
+		if err := json.Unmarshal([]byte(m.Blocks), &blocks); err == nil {
+			content = append(content, blockTexts(blocks)...)
+		}
+	}
+	return strings.Join(content, "\n")
+}
+
+// blockTexts collects every "text" string in decoded block JSON
+func blockTexts(v interface{}) []string {
+	var texts []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if text, ok := v[key].(string); ok && key == "text" {
+				texts = append(texts, text)
+				continue
+			}
+			texts = append(texts, blockTexts(v[key])...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			texts = append(texts, blockTexts(item)...)
+		}
+	}
+	return texts
+}
+
+// NewFakeSlack starts a FakeSlack that is shut down when the test ends
+func NewFakeSlack(t testing.TB) *FakeSlack {
+	t.Helper()
+	f := &FakeSlack{
+		users:    map[string]slack.User{},
+		channels: map[string]slack.Channel{},
+		failures: map[string]string{},
+		grants:   map[string]grant{},
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// WithFakeSlack sets the bot Slack client to one that calls fake
+func WithFakeSlack(fake *FakeSlack) Option {
+	return WithBotClient(fake.Client())
+}
+
+// URL returns the base URL of the fake's API, ending in "/"
+func (f *FakeSlack) URL() string {
+	return f.server.URL + "/"
+}
+
+// Client returns a Slack client that calls the fake
+func (f *FakeSlack) Client() *slack.Client {
+	return slack.New("xoxb-fake", slack.OptionAPIURL(f.URL()))
+}
+
+// AddUser makes user known to users.info
+func (f *FakeSlack) AddUser(user slack.User) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[user.ID] = user
+}
+
+// AddChannel makes channel known to conversations.list and conversations.join
+func (f *FakeSlack) AddChannel(channel slack.Channel) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if channel.NameNormalized == "" {
+		channel.NameNormalized = strings.ToLower(channel.Name)
+	}
+	f.channels[channel.ID] = channel
+}
+
+// Channel returns the channel with id, including any changes calls made to it
+func (f *FakeSlack) Channel(id string) (slack.Channel, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	channel, exists := f.channels[id]
+	return channel, exists
+}
+
+// Fail makes every later call to method fail with the Slack error code err,
+// e.g. Fail("chat.postMessage", "channel_not_found")
+func (f *FakeSlack) Fail(method, err string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[method] = err
+}
+
+// grant is an installation an OAuth code can be exchanged for
+type grant struct {
+	teamID string
+	user   string
+}
+
+// GrantCode makes oauth.v2.access exchange code, once, for a bot token in
+// the workspace teamID installed by user. Other codes are rejected with
+// invalid_code.
+func (f *FakeSlack) GrantCode(code, teamID, user string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.grants[code] = grant{teamID: teamID, user: user}
+}
+
+// Calls returns the calls made to method, or every call when method is empty
+func (f *FakeSlack) Calls(method string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []Call
+	for _, call := range f.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Messages returns the messages posted to channel that haven't been
+// deleted, or to every channel when channel is empty, oldest first
+func (f *FakeSlack) Messages(channel string) []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var messages []Message
+	for _, msg := range f.messages {
+		if !msg.Deleted && (channel == "" || msg.Channel == channel) {
+			messages = append(messages, *msg)
+		}
+	}
+	return messages
+}
+
+// Views returns the views.open calls made, with the view JSON in
+// Params.Get("view")
+func (f *FakeSlack) Views() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.views...)
+}
+
+// AssertPosted asserts that a message whose content contains text was posted
+// to channel
+func (f *FakeSlack) AssertPosted(t testing.TB, channel, text string) bool {
+	t.Helper()
+	return f.assertMessage(t, fmt.Sprintf("a message in %s containing %q", channel, text), func(m Message) bool {
+		return m.Channel == channel && !m.Ephemeral() && strings.Contains(m.Content(), text)
+	})
+}
+
+// AssertPostedInThread asserts that a message whose content contains text was
+// posted to channel in the thread threadTS
+func (f *FakeSlack) AssertPostedInThread(t testing.TB, channel, threadTS, text string) bool {
+	t.Helper()
+	return f.assertMessage(t, fmt.Sprintf("a message in %s thread %s containing %q", channel, threadTS, text), func(m Message) bool {
+		return m.Channel == channel && m.ThreadTS == threadTS && !m.Ephemeral() && strings.Contains(m.Content(), text)
+	})
+}
+
+// AssertPostedEphemeral asserts that an ephemeral message whose content
+// contains text was shown to user in channel
+func (f *FakeSlack) AssertPostedEphemeral(t testing.TB, channel, user, text string) bool {
+	t.Helper()
+	return f.assertMessage(t, fmt.Sprintf("an ephemeral message to %s in %s containing %q", user, channel, text), func(m Message) bool {
+		return m.Channel == channel && m.User == user && strings.Contains(m.Content(), text)
+	})
+}
+
+// AssertReacted asserts that the message at ts in channel has the reaction name
+func (f *FakeSlack) AssertReacted(t testing.TB, channel, ts, name string) bool {
+	t.Helper()
+	return f.assertMessage(t, fmt.Sprintf("a :%s: reaction on %s in %s", name, ts, channel), func(m Message) bool {
+		if m.Channel != channel || m.TS != ts {
+			return false
+		}
+		for _, reaction := range m.Reactions {
+			if reaction == name {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// AssertNothingPosted asserts that no message was posted to channel, or to
+// any channel when channel is empty
+func (f *FakeSlack) AssertNothingPosted(t testing.TB, channel string) bool {
+	t.Helper()
+	if messages := f.Messages(channel); len(messages) > 0 {
+		t.Errorf("expected no messages in %q, got %d:\n%s", channel, len(messages), describe(messages))
+		return false
+	}
+	return true
+}
+
+// AssertCalled asserts that method was called at least once
+func (f *FakeSlack) AssertCalled(t testing.TB, method string) bool {
+	t.Helper()
+	if len(f.Calls(method)) == 0 {
+		t.Errorf("expected a call to %s", method)
+		return false
+	}
+	return true
+}
+
+func (f *FakeSlack) assertMessage(t testing.TB, want string, match func(Message) bool) bool {
+	t.Helper()
+	messages := f.Messages("")
+	for _, msg := range messages {
+		if match(msg) {
+			return true
+		}
+	}
+	t.Errorf("expected %s, got %d messages:\n%s", want, len(messages), describe(messages))
+	return false
+}
+
+func describe(messages []Message) string {
+	var lines []string
+	for _, msg := range messages {
+		line := fmt.Sprintf("  %s %s", msg.Channel, msg.TS)
+		if msg.ThreadTS != "" {
+			line += " thread " + msg.ThreadTS
+		}
+		lines = append(lines, line+": "+strings.ReplaceAll(msg.Content(), "\n", " | "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (f *FakeSlack) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/")
+	params, err := requestParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Method: method, Params: params})
+	var response map[string]interface{}
+	if failure, exists := f.failures[method]; exists {
+		response = errorResponse(failure)
+	} else {
+		response = f.handle(method, params)
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// requestParams reads a request's form values, or the top-level fields of its
+// JSON body with non-string values left as JSON
+func requestParams(r *http.Request) (url.Values, error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		return r.Form, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	for key, raw := range fields {
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil {
+			params.Set(key, text)
+			continue
+		}
+		params.Set(key, string(raw))
+	}
+	return params, nil
+}
+
+func errorResponse(code string) map[string]interface{} {
+	return map[string]interface{}{"ok": false, "error": code}
+}
+
+func okResponse(fields map[string]interface{}) map[string]interface{} {
+	fields["ok"] = true
+	return fields
+}
+
+// handle answers a call to method. f.mu is held.
+func (f *FakeSlack) handle(method string, params url.Values) map[string]interface{} {
+	switch method {
+	case "auth.test":
+		return okResponse(map[string]interface{}{"user_id": BotUserID, "bot_id": BotID, "team_id": TeamID, "team": Identity.Team, "user": "gadget"})
+	case "bots.info":
+		if params.Get("bot") != BotID {
+			return errorResponse("bot_not_found")
+		}
+		return okResponse(map[string]interface{}{"bot": map[string]interface{}{"id": BotID, "app_id": AppID, "user_id": BotUserID, "name": "gadget"}})
+	case "chat.postMessage", "chat.postEphemeral":
+		return f.postMessage(method, params)
+	case "chat.update":
+		msg := f.message(params.Get("channel"), params.Get("ts"))
+		if msg == nil {
+			return errorResponse("message_not_found")
+		}
+		msg.Text = params.Get("text")
+		msg.Blocks = params.Get("blocks")
+		msg.Edited = true
+		return okResponse(map[string]interface{}{"channel": msg.Channel, "ts": msg.TS, "text": msg.Text})
+	case "chat.delete":
+		msg := f.message(params.Get("channel"), params.Get("ts"))
+		if msg == nil {
+			return errorResponse("message_not_found")
+		}
+		msg.Deleted = true
+		return okResponse(map[string]interface{}{"channel": msg.Channel, "ts": msg.TS})
+	case "reactions.add":
+		msg := f.message(params.Get("channel"), params.Get("timestamp"))
+		if msg == nil {
+			return errorResponse("message_not_found")
+		}
+		for _, reaction := range msg.Reactions {
+			if reaction == params.Get("name") {
+				return errorResponse("already_reacted")
+			}
+		}
+		msg.Reactions = append(msg.Reactions, params.Get("name"))
+		return okResponse(map[string]interface{}{})
+	case "users.info":
+		user, exists := f.users[params.Get("user")]
+		if !exists {
+			return errorResponse("user_not_found")
+		}
+		return okResponse(map[string]interface{}{"user": user})
+	case "conversations.list":
+		channels := make([]slack.Channel, 0, len(f.channels))
+		for _, channel := range f.channels {
+			if channel.IsArchived && params.Get("exclude_archived") == "true" {
+				continue
+			}
+			channels = append(channels, channel)
+		}
+		sort.Slice(channels, func(i, j int) bool { return channels[i].ID < channels[j].ID })
+		return okResponse(map[string]interface{}{"channels": channels, "response_metadata": map[string]string{"next_cursor": ""}})
+	case "conversations.join":
+		channel, exists := f.channels[params.Get("channel")]
+		if !exists {
+			return errorResponse("channel_not_found")
+		}
+		channel.IsMember = true
+		f.channels[channel.ID] = channel
+		return okResponse(map[string]interface{}{"channel": channel})
+	case "conversations.open":
+		users := params.Get("users")
+		if users == "" {
+			return errorResponse("users_list_not_supplied")
+		}
+		channel := slack.Channel{}
+		channel.ID = "D_" + strings.ReplaceAll(users, ",", "_")
+		channel.IsIM = !strings.Contains(users, ",")
+		channel.IsMpIM = !channel.IsIM
+		channel.IsMember = true
+		f.channels[channel.ID] = channel
+		return okResponse(map[string]interface{}{"channel": channel})
+	case "oauth.v2.access":
+		g, exists := f.grants[params.Get("code")]
+		if !exists {
+			return errorResponse("invalid_code")
+		}
+		delete(f.grants, params.Get("code"))
+		return okResponse(map[string]interface{}{
+			"access_token": "xoxb-" + g.teamID,
+			"token_type":   "bot",
+			"scope":        "app_mentions:read,chat:write",
+			"bot_user_id":  BotUserID,
+			"app_id":       AppID,
+			"team":         map[string]string{"id": g.teamID, "name": g.teamID},
+			"authed_user":  map[string]string{"id": g.user},
+		})
+	case "views.open":
+		if params.Get("trigger_id") == "" {
+			return errorResponse("invalid_trigger_id")
+		}
+		f.views = append(f.views, Call{Method: method, Params: params})
+		var view map[string]interface{}
+		_ = json.Unmarshal([]byte(params.Get("view")), &view)
+		if view == nil {
+			view = map[string]interface{}{}
+		}
+		view["id"] = fmt.Sprintf("V%06d", len(f.views))
+		return okResponse(map[string]interface{}{"view": view})
+	}
+	return errorResponse("unknown_method")
+}
+
+// postMessage stores a message posted with chat.postMessage or chat.postEphemeral
+func (f *FakeSlack) postMessage(method string, params url.Values) map[string]interface{} {
+	channel := params.Get("channel")
+	if channel == "" {
+		return errorResponse("channel_not_found")
+	}
+	if params.Get("text") == "" && params.Get("blocks") == "" && params.Get("attachments") == "" {
+		return errorResponse("no_text")
+	}
+	f.lastTS++
+	msg := &Message{
+		Channel:  channel,
+		TS:       fmt.Sprintf("1700000000.%06d", f.lastTS),
+		ThreadTS: params.Get("thread_ts"),
+		Text:     params.Get("text"),
+		Blocks:   params.Get("blocks"),
+	}
+	if method == "chat.postEphemeral" {
+		msg.User = params.Get("user")
+		f.messages = append(f.messages, msg)
+		return okResponse(map[string]interface{}{"message_ts": msg.TS})
+	}
+	f.messages = append(f.messages, msg)
+	return okResponse(map[string]interface{}{"channel": channel, "ts": msg.TS, "message": map[string]interface{}{"text": msg.Text, "ts": msg.TS}})
+}
+
+// message returns the message at ts in channel. f.mu is held.
+func (f *FakeSlack) message(channel, ts string) *Message {
+	for _, msg := range f.messages {
+		if msg.Channel == channel && msg.TS == ts && !msg.Deleted {
+			return msg
+		}
+	}
+	return nil
+}
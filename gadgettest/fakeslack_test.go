@@ -0,0 +1,222 @@
+package gadgettest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingT captures failures so assertions that should fail can be tested
+type recordingT struct {
+	testing.TB
+	failed  bool
+	message string
+}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.failed = true
+	r.message = fmt.Sprintf(format, args...)
+}
+func (r *recordingT) Helper() {}
+
+func TestFakeSlack_PostMessage(t *testing.T) {
+	fake := NewFakeSlack(t)
+	api := fake.Client()
+
+	channel, ts, err := api.PostMessage("C123", slack.MsgOptionText("hello there", false), slack.MsgOptionTS("1.1"))
+
+	require.NoError(t, err)
+	assert.Equal(t, "C123", channel)
+	assert.NotEmpty(t, ts)
+	fake.AssertPostedInThread(t, "C123", "1.1", "hello")
+	require.Len(t, fake.Calls("chat.postMessage"), 1)
+	assert.Equal(t, "hello there", fake.Calls("chat.postMessage")[0].Params.Get("text"))
+}
+
+func TestFakeSlack_MatchesBlockText(t *testing.T) {
+	fake := NewFakeSlack(t)
+
+	_, _, err := fake.Client().PostMessage("C123", slack.MsgOptionBlocks(
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "*Deploy* finished", false, false), nil, nil),
+	))
+
+	require.NoError(t, err)
+	fake.AssertPosted(t, "C123", "*Deploy* finished")
+}
+
+func TestFakeSlack_UpdateAndDelete(t *testing.T) {
+	fake := NewFakeSlack(t)
+	api := fake.Client()
+	_, ts, err := api.PostMessage("C123", slack.MsgOptionText("working", false))
+	require.NoError(t, err)
+
+	_, _, _, err = api.UpdateMessage("C123", ts, slack.MsgOptionText("done", false))
+	require.NoError(t, err)
+	messages := fake.Messages("C123")
+	require.Len(t, messages, 1)
+	assert.Equal(t, "done", messages[0].Text)
+	assert.True(t, messages[0].Edited)
+
+	_, _, err = api.DeleteMessage("C123", ts)
+	require.NoError(t, err)
+	fake.AssertNothingPosted(t, "C123")
+
+	_, _, err = api.DeleteMessage("C123", ts)
+	assert.EqualError(t, err, "message_not_found")
+}
+
+func TestFakeSlack_Reactions(t *testing.T) {
+	fake := NewFakeSlack(t)
+	api := fake.Client()
+	_, ts, err := api.PostMessage("C123", slack.MsgOptionText("ship it", false))
+	require.NoError(t, err)
+
+	require.NoError(t, api.AddReaction("rocket", slack.NewRefToMessage("C123", ts)))
+
+	fake.AssertReacted(t, "C123", ts, "rocket")
+	assert.EqualError(t, api.AddReaction("rocket", slack.NewRefToMessage("C123", ts)), "already_reacted")
+}
+
+func TestFakeSlack_Ephemeral(t *testing.T) {
+	fake := NewFakeSlack(t)
+
+	_, err := fake.Client().PostEphemeral("C123", "U1", slack.MsgOptionText("only you", false))
+
+	require.NoError(t, err)
+	fake.AssertPostedEphemeral(t, "C123", "U1", "only you")
+	recorder := &recordingT{TB: t}
+	fake.AssertPosted(recorder, "C123", "only you")
+	assert.True(t, recorder.failed, "ephemeral messages aren't posted to the channel")
+}
+
+func TestFakeSlack_UsersAndChannels(t *testing.T) {
+	fake := NewFakeSlack(t)
+	api := fake.Client()
+	fake.AddUser(slack.User{ID: "U1", Name: "alice", TZ: "Europe/London"})
+	general := slack.Channel{}
+	general.ID, general.Name = "C1", "General"
+	fake.AddChannel(general)
+
+	user, err := api.GetUserInfo("U1")
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/London", user.TZ)
+	_, err = api.GetUserInfo("U2")
+	assert.EqualError(t, err, "user_not_found")
+
+	channels, _, err := api.GetConversations(&slack.GetConversationsParameters{})
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	assert.Equal(t, "general", channels[0].NameNormalized)
+
+	_, _, _, err = api.JoinConversation("C1")
+	require.NoError(t, err)
+	joined, _ := fake.Channel("C1")
+	assert.True(t, joined.IsMember)
+
+	dm, _, _, err := api.OpenConversation(&slack.OpenConversationParameters{Users: []string{"U1"}})
+	require.NoError(t, err)
+	_, _, err = api.PostMessage(dm.ID, slack.MsgOptionText("psst", false))
+	require.NoError(t, err)
+	fake.AssertPosted(t, dm.ID, "psst")
+}
+
+func TestFakeSlack_OpenView(t *testing.T) {
+	fake := NewFakeSlack(t)
+
+	resp, err := fake.Client().OpenView("trigger-1", slack.ModalViewRequest{
+		Type:  slack.VTModal,
+		Title: slack.NewTextBlockObject(slack.PlainTextType, "Feedback", false, false),
+	})
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.ID)
+	require.Len(t, fake.Views(), 1)
+	assert.Equal(t, "trigger-1", fake.Views()[0].Params.Get("trigger_id"))
+	assert.Contains(t, fake.Views()[0].Params.Get("view"), "Feedback")
+}
+
+func TestFakeSlack_Identity(t *testing.T) {
+	api := NewFakeSlack(t).Client()
+
+	auth, err := api.AuthTest()
+	require.NoError(t, err)
+	bot, err := api.GetBotInfo(slack.GetBotInfoParameters{Bot: auth.BotID})
+	require.NoError(t, err)
+
+	assert.Equal(t, Identity, router.BotIdentity{UserID: auth.UserID, BotID: auth.BotID, TeamID: auth.TeamID, Team: auth.Team, AppID: bot.AppID})
+}
+
+func TestFakeSlack_GrantCode(t *testing.T) {
+	fake := NewFakeSlack(t)
+	fake.GrantCode("code-1", "T_OTHER", "U_INSTALLER")
+	exchange := func(code string) slack.OAuthV2Response {
+		resp, err := http.PostForm(fake.URL()+"oauth.v2.access", url.Values{"code": {code}})
+		require.NoError(t, err)
+		defer resp.Body.Close() //nolint:errcheck // test response
+		var access slack.OAuthV2Response
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&access))
+		return access
+	}
+
+	access := exchange("code-1")
+	require.NoError(t, access.Err())
+	assert.Equal(t, "T_OTHER", access.Team.ID)
+	assert.Equal(t, "U_INSTALLER", access.AuthedUser.ID)
+	assert.Equal(t, BotUserID, access.BotUserID)
+
+	assert.EqualError(t, exchange("code-1").Err(), "invalid_code", "codes can only be exchanged once")
+}
+
+func TestFakeSlack_Fail(t *testing.T) {
+	fake := NewFakeSlack(t)
+	fake.Fail("chat.postMessage", "channel_not_found")
+
+	_, _, err := fake.Client().PostMessage("C404", slack.MsgOptionText("hello", false))
+
+	assert.EqualError(t, err, "channel_not_found")
+	fake.AssertCalled(t, "chat.postMessage")
+	fake.AssertNothingPosted(t, "")
+}
+
+func TestFakeSlack_UnknownMethod(t *testing.T) {
+	fake := NewFakeSlack(t)
+
+	_, err := fake.Client().GetTeamInfo()
+
+	assert.EqualError(t, err, "unknown_method")
+}
+
+func TestFakeSlack_FailedAssertionReportsMessages(t *testing.T) {
+	fake := NewFakeSlack(t)
+	_, _, err := fake.Client().PostMessage("C123", slack.MsgOptionText("hello", false))
+	require.NoError(t, err)
+
+	recorder := &recordingT{TB: t}
+	assert.False(t, fake.AssertPosted(recorder, "C123", "goodbye"))
+	assert.True(t, recorder.failed)
+}
+
+func TestWithFakeSlack(t *testing.T) {
+	fake := NewFakeSlack(t)
+	d := NewDispatcher(
+		WithFakeSlack(fake),
+		WithMentionRoutes(router.MentionRoute{
+			Route: router.Route{Name: "greet", Pattern: `(?i)^hello`},
+			Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+				_ = ctx.Reply("Hi <@" + ev.User + ">")
+			},
+		}),
+	)
+
+	require.NoError(t, d.DispatchMention(slackevents.AppMentionEvent{User: "U1", Channel: "C123", TimeStamp: "1.1", ThreadTimeStamp: "1.0"}, "hello"))
+
+	fake.AssertPostedInThread(t, "C123", "1.0", "Hi <@U1>")
+}
@@ -0,0 +1,28 @@
+package gadgettest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/gadget-bot/gadget/tracing"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordSpans(t *testing.T) {
+	rec := RecordSpans(t)
+	d := NewDispatcher(WithMentionRoutes(router.MentionRoute{
+		Route: router.Route{Name: "lookup", Pattern: `(?i)^lookup`},
+		Plugin: func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+			_, span := tracing.Tracer().Start(context.Background(), "lookup.fetch")
+			span.End()
+		},
+	}))
+
+	require.NoError(t, d.DispatchMention(slackevents.AppMentionEvent{User: "U_USER", Channel: "C123"}, "lookup U123"))
+
+	assert.NotNil(t, FindSpan(rec.Ended(), "lookup.fetch"))
+	assert.Nil(t, FindSpan(rec.Ended(), "lookup.store"))
+}
@@ -0,0 +1,317 @@
+package gadgettest
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+var updateTranscripts = flag.Bool("update-transcripts", false, "rewrite gadgettest transcripts with the bot's current replies")
+
+// transcriptMention starts a user line that mentions the bot
+const transcriptMention = "@gadget"
+
+var (
+	transcriptUser = regexp.MustCompile(`^([A-Z][A-Z0-9_]*): ?(.*)$`)
+	transcriptBot  = regexp.MustCompile(`^(bot\b|! )`)
+)
+
+// transcriptLine is a line of a transcript that's kept when it's rewritten
+type transcriptLine struct {
+	text string
+	user string // set for user lines
+	said string // what the user said, for user lines
+}
+
+// RunTranscripts runs RunTranscript as a subtest for each file matching
+// pattern, e.g. "testdata/*.transcript"
+func RunTranscripts(t *testing.T, pattern string, opts ...Option) {
+	t.Helper()
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatalf("gadgettest: %v", err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("gadgettest: no transcripts match %s", pattern)
+	}
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), func(t *testing.T) {
+			RunTranscript(t, path, opts...)
+		})
+	}
+}
+
+// RunTranscript replays the transcript at path against a new enforcing
+// Dispatcher, configured with opts and calling a new FakeSlack, and fails if
+// the bot's replies differ from the ones in the file. A transcript is a
+// scripted conversation with the bot:
+//
+//	# Only admins can add people to groups
+//	global admins: U1
+//	group deployers: U3
+//	user U2: alice
+//	channel: C1
+//
+//	U1: @gadget add <@U2> to admins
+//	bot reacts :tada:
+//	bot: I successfully added <@U2> to admins!
+//
+//	U2: @gadget add <@U2> to admins
+//	bot: You're not allowed to do that.
+//
+// Lines starting with a user ID are what users say: "@gadget ..." mentions
+// the bot, "/command ..." runs a slash command and anything else is posted to
+// the channel. Lines starting with "bot" are what the bot did in reply, and
+// indented lines continue the line before. Comments, blank lines and the
+// lowercase directives (global admins, group, user and channel) are kept as
+// written.
+//
+// Running the tests with -update-transcripts rewrites the file with the
+// bot's current replies instead.
+func RunTranscript(t testing.TB, path string, opts ...Option) {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("gadgettest: %v", err)
+	}
+	lines, err := parseTranscript(string(raw))
+	if err != nil {
+		t.Fatalf("gadgettest: %s:%v", path, err)
+	}
+
+	fake := NewFakeSlack(t)
+	opts = append(opts, WithEnforcement(), WithFakeSlack(fake))
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line.text, "global admins:"):
+			opts = append(opts, WithGlobalAdmins(strings.Fields(strings.TrimPrefix(line.text, "global admins:"))...))
+		case strings.HasPrefix(line.text, "group "):
+			name, members, _ := strings.Cut(strings.TrimPrefix(line.text, "group "), ":")
+			opts = append(opts, WithGroup(strings.TrimSpace(name), strings.Fields(members)...))
+		case strings.HasPrefix(line.text, "user "):
+			id, name, _ := strings.Cut(strings.TrimPrefix(line.text, "user "), ":")
+			fake.AddUser(slack.User{ID: strings.TrimSpace(id), Name: strings.TrimSpace(name)})
+		}
+	}
+	d := NewDispatcher(opts...)
+
+	var out []string
+	channel := "C1"
+	for i, line := range lines {
+		out = append(out, line.text)
+		if strings.HasPrefix(line.text, "channel:") {
+			channel = strings.TrimSpace(strings.TrimPrefix(line.text, "channel:"))
+		}
+		if line.user == "" {
+			continue
+		}
+		seen := len(fake.Calls(""))
+		ts := fmt.Sprintf("1600000000.%06d", i+1)
+		if err := d.say(line.user, channel, ts, line.said); err != nil {
+			out = append(out, "! "+err.Error())
+		}
+		for _, call := range fake.Calls("")[seen:] {
+			out = append(out, renderCall(call)...)
+		}
+	}
+
+	got := strings.Join(out, "\n") + "\n"
+	if *updateTranscripts {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil { //nolint:gosec // test fixtures are world readable
+			t.Fatalf("gadgettest: %v", err)
+		}
+		return
+	}
+	want := string(raw)
+	if trimLines(got) != trimLines(want) {
+		t.Errorf("%s differs from the bot's replies (run with -update-transcripts to accept them):\n%s", path, transcriptDiff(want, got))
+	}
+}
+
+// parseTranscript returns the lines of transcript, without the bot's
+// replies
+func parseTranscript(transcript string) ([]transcriptLine, error) {
+	var lines []transcriptLine
+	raw := strings.Split(strings.TrimSuffix(transcript, "\n"), "\n")
+	inReply := false
+	for i, text := range raw {
+		text = strings.TrimRight(text, " \t\r")
+		switch {
+		case strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t"):
+			if inReply {
+				continue
+			}
+			if len(lines) == 0 || lines[len(lines)-1].user == "" {
+				return nil, fmt.Errorf("%d: indented line doesn't continue a message", i+1)
+			}
+			last := &lines[len(lines)-1]
+			last.text += "\n" + text
+			last.said += "\n" + strings.TrimSpace(text)
+			continue
+		case text == "" && inReply && i+1 < len(raw) && strings.HasPrefix(raw[i+1], " "):
+			// a blank line inside a multi-line reply
+			continue
+		case transcriptBot.MatchString(text):
+			inReply = true
+			continue
+		}
+		inReply = false
+
+		line := transcriptLine{text: text}
+		if m := transcriptUser.FindStringSubmatch(text); m != nil {
+			line.user, line.said = m[1], m[2]
+		} else if text != "" && !strings.HasPrefix(text, "#") && !isTranscriptDirective(text) {
+			return nil, fmt.Errorf("%d: can't parse %q", i+1, text)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func isTranscriptDirective(text string) bool {
+	for _, directive := range []string{"global admins:", "group ", "user ", "channel:"} {
+		if strings.HasPrefix(text, directive) {
+			return true
+		}
+	}
+	return false
+}
+
+// say dispatches what user said in channel. Errors that Gadget would answer
+// with a route, like denials, aren't returned.
+func (d *Dispatcher) say(user, channel, ts, said string) error {
+	var err error
+	switch {
+	case strings.HasPrefix(said, transcriptMention):
+		message := strings.TrimSpace(strings.TrimPrefix(said, transcriptMention))
+		err = d.DispatchMention(slackevents.AppMentionEvent{
+			User:      user,
+			Channel:   channel,
+			TimeStamp: ts,
+			Text:      "<@" + BotUserID + "> " + message,
+		}, message)
+	case strings.HasPrefix(said, "/"):
+		command, text, _ := strings.Cut(said, " ")
+		cmd := slack.SlashCommand{Command: command, Text: text, UserID: user, ChannelID: channel}
+		// Gadget answers slash commands itself when no route can
+		if !d.router.HasSlashCommand(command) {
+			return d.reply(channel, user, router.UnknownSlashCommandResponse)
+		}
+		err = d.DispatchSlashCommand(cmd)
+		switch {
+		case errors.Is(err, ErrNoRoute) && router.IsSlashCommandHelp(text):
+			return d.reply(channel, user, d.router.SlashCommandHelp(command, d.user(user)))
+		case errors.Is(err, ErrNoRoute):
+			return d.reply(channel, user, router.SlashCommandFallbackResponse(command))
+		case errors.Is(err, ErrPermissionDenied):
+			return d.reply(channel, user, router.DeniedSlashCommandResponse)
+		case errors.Is(err, ErrRateLimited):
+			return d.reply(channel, user, router.RateLimitedSlashCommandResponse)
+		}
+	default:
+		err = d.DispatchChannelMessage(slackevents.MessageEvent{
+			User:      user,
+			Channel:   channel,
+			TimeStamp: ts,
+			Text:      said,
+		}, said)
+	}
+	if errors.Is(err, ErrNoRoute) || errors.Is(err, ErrPermissionDenied) || errors.Is(err, ErrRateLimited) {
+		return nil
+	}
+	return err
+}
+
+// reply posts text to user as Gadget answers a slash command itself
+func (d *Dispatcher) reply(channel, user, text string) error {
+	_, err := d.botClient.PostEphemeral(channel, user, slack.MsgOptionText(text, false))
+	return err
+}
+
+// renderCall describes what the bot did with call, in transcript lines
+func renderCall(call Call) []string {
+	p := call.Params
+	switch call.Method {
+	case "chat.postMessage":
+		if p.Get("thread_ts") != "" {
+			return renderReply("bot (in thread): ", messageText(p.Get("text"), p.Get("blocks")))
+		}
+		return renderReply("bot: ", messageText(p.Get("text"), p.Get("blocks")))
+	case "chat.postEphemeral":
+		return renderReply("bot (only "+p.Get("user")+"): ", messageText(p.Get("text"), p.Get("blocks")))
+	case "chat.update":
+		return renderReply("bot edits: ", messageText(p.Get("text"), p.Get("blocks")))
+	case "chat.delete":
+		return []string{"bot deletes a message"}
+	case "reactions.add":
+		return []string{"bot reacts :" + p.Get("name") + ":"}
+	case "views.open":
+		return renderReply("bot opens a view: ", messageText("", p.Get("view")))
+	}
+	return nil
+}
+
+// messageText is a message's blocks' text if it has any, and its text
+// otherwise
+func messageText(text, blocks string) string {
+	if blocks == "" {
+		return text
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(blocks), &decoded); err != nil {
+		return text
+	}
+	if texts := blockTexts(decoded); len(texts) > 0 {
+		return strings.Join(texts, "\n")
+	}
+	return text
+}
+
+// renderReply is prefix followed by text, with its later lines indented
+func renderReply(prefix, text string) []string {
+	lines := strings.Split(text, "\n")
+	out := []string{strings.TrimRight(prefix+lines[0], " ")}
+	for _, line := range lines[1:] {
+		out = append(out, strings.TrimRight("  "+line, " "))
+	}
+	return out
+}
+
+// trimLines removes trailing whitespace from every line of s
+func trimLines(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// transcriptDiff shows the first line where got differs from want, and got
+// in full
+func transcriptDiff(want, got string) string {
+	wantLines := strings.Split(trimLines(want), "\n")
+	gotLines := strings.Split(trimLines(got), "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n  want: %s\n  got:  %s\n\nthe bot's replies:\n%s", i+1, w, g, strings.Join(gotLines, "\n"))
+		}
+	}
+	return ""
+}
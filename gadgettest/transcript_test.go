@@ -0,0 +1,145 @@
+package gadgettest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func transcriptRoutes() []Option {
+	var echo router.MentionRoute
+	echo.Name = "echo"
+	echo.Pattern = `(?i)^echo (.+)$`
+	echo.Plugin = func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+		_ = ctx.Reply(ctx.Route.CompiledPattern.FindStringSubmatch(message)[1])
+	}
+
+	var lines router.MentionRoute
+	lines.Name = "lines"
+	lines.Pattern = `(?i)^two lines$`
+	lines.Plugin = func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+		_ = ctx.Reply("first\n\nsecond")
+	}
+
+	var ack router.ChannelMessageRoute
+	ack.Name = "ack"
+	ack.Pattern = `(?i)ship it`
+	ack.Plugin = func(ctx router.HandlerContext, ev slackevents.MessageEvent, message string) {
+		_ = ctx.React("rocket")
+	}
+
+	var deploy router.SlashCommandRoute
+	deploy.Name = "deploy"
+	deploy.Command = "/deploy"
+	deploy.Pattern = `^(api|web)$`
+	deploy.Description = "Deploys an app"
+	deploy.Permissions = []string{"deployers"}
+	deploy.Plugin = func(ctx router.HandlerContext, cmd slack.SlashCommand) {
+		_ = ctx.ReplyEphemeral("Deploying " + cmd.Text)
+	}
+
+	return []Option{
+		WithMentionRoutes(echo, lines),
+		WithChannelMessageRoutes(ack),
+		WithSlashCommandRoutes(deploy),
+	}
+}
+
+func writeTranscript(t *testing.T, transcript string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.transcript")
+	require.NoError(t, os.WriteFile(path, []byte(transcript), 0o600))
+	return path
+}
+
+const passingTranscript = `# Everything a transcript can do
+group deployers: U2
+channel: C9
+
+U1: @gadget echo hello
+bot: hello
+
+U1: @gadget two lines
+bot: first
+
+  second
+
+U1: ship it
+bot reacts :rocket:
+
+U1: nothing to see here
+
+U2: /deploy api
+bot (only U2): Deploying api
+
+U1: /deploy api
+bot (only U1): Permission denied.
+
+U2: /deploy help
+bot (only U2): Here's what you can do with ` + "`/deploy`" + `:
+  • ` + "`/deploy deploy`" + ` - Deploys an app
+
+U1: /nope
+bot (only U1): Unknown command.
+
+U1: @gadget make me a sandwich
+bot: Hi there! I see you sent me a message, <@U1>, but I'm not sure what to do with that.
+`
+
+func TestRunTranscript_Passes(t *testing.T) {
+	path := writeTranscript(t, passingTranscript)
+
+	recorder := &recordingT{TB: t}
+	RunTranscript(recorder, path, transcriptRoutes()...)
+
+	assert.False(t, recorder.failed, recorder.message)
+}
+
+func TestRunTranscript_ReportsDifferences(t *testing.T) {
+	path := writeTranscript(t, "U1: @gadget echo hello\nbot: goodbye\n")
+
+	recorder := &recordingT{TB: t}
+	RunTranscript(recorder, path, transcriptRoutes()...)
+
+	assert.True(t, recorder.failed)
+	assert.Contains(t, recorder.message, "want: bot: goodbye")
+	assert.Contains(t, recorder.message, "got:  bot: hello")
+	assert.Contains(t, recorder.message, "-update-transcripts")
+}
+
+func TestRunTranscript_Update(t *testing.T) {
+	path := writeTranscript(t, "# greeting\nU1: @gadget echo hello\nbot: goodbye\n\nU1: @gadget echo again\n")
+	*updateTranscripts = true
+	defer func() { *updateTranscripts = false }()
+
+	RunTranscript(t, path, transcriptRoutes()...)
+
+	updated, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "# greeting\nU1: @gadget echo hello\nbot: hello\n\nU1: @gadget echo again\nbot: again\n", string(updated))
+}
+
+func TestParseTranscript(t *testing.T) {
+	lines, err := parseTranscript("U1: @gadget echo one\n  two\nbot: one\n  two\n\nU2: hi\n")
+
+	require.NoError(t, err)
+	require.Len(t, lines, 3)
+	assert.Equal(t, "U1", lines[0].user)
+	assert.Equal(t, "@gadget echo one\ntwo", lines[0].said)
+	assert.Equal(t, "", lines[1].text)
+	assert.Equal(t, "hi", lines[2].said)
+}
+
+func TestParseTranscript_Errors(t *testing.T) {
+	_, err := parseTranscript("# fine\nnot a line\n")
+	assert.EqualError(t, err, `2: can't parse "not a line"`)
+
+	_, err = parseTranscript("# fine\n  dangling\n")
+	assert.EqualError(t, err, "2: indented line doesn't continue a message")
+}
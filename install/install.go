@@ -0,0 +1,252 @@
+// Package install lets workspaces install Gadget with Slack's OAuth v2 flow
+// and keeps the tokens each installation grants, so that one Gadget can
+// serve many workspaces.
+//
+// Send people to InstallPath to add Gadget to their workspace. It redirects
+// them to Slack, which asks them to approve the scopes Gadget needs and then
+// sends them back to CallbackPath, where the tokens Slack grants are saved
+// to a Store.
+package install
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/rs/zerolog/log"
+	"github.com/slack-go/slack"
+)
+
+// Paths the Handler is served on
+const (
+	InstallPath  = "/gadget/install"        // starts an installation
+	CallbackPath = "/gadget/oauth/callback" // where Slack sends the installer back to
+)
+
+// Slack's endpoints, used unless Options override them
+const (
+	DefaultAuthorizeURL = "https://slack.com/oauth/v2/authorize"
+	DefaultAPIURL       = "https://slack.com/api/"
+)
+
+// stateCookie carries the state of an installation between InstallPath and
+// CallbackPath, so a callback can't be replayed in someone else's browser
+const stateCookie = "gadget_oauth_state"
+
+// stateTTL is how long an installer has to approve the installation
+const stateTTL = 10 * time.Minute
+
+// Options configure a Handler
+type Options struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // CallbackPath on Gadget's public URL, as registered with the Slack app
+	Scopes       []string // bot scopes to request
+	UserScopes   []string // user scopes to request; optional
+	AuthorizeURL string   // "" uses DefaultAuthorizeURL
+	APIURL       string   // base URL of Slack's Web API; "" uses DefaultAPIURL
+	HTTPClient   *http.Client
+	// OnInstall, if set, is called with each installation once it's saved
+	OnInstall func(ctx context.Context, installation models.Installation)
+}
+
+func (o Options) authorizeURL() string {
+	if o.AuthorizeURL == "" {
+		return DefaultAuthorizeURL
+	}
+	return o.AuthorizeURL
+}
+
+func (o Options) apiURL() string {
+	if o.APIURL == "" {
+		return DefaultAPIURL
+	}
+	return o.APIURL
+}
+
+func (o Options) httpClient() *http.Client {
+	if o.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return o.HTTPClient
+}
+
+// Handler serves the OAuth install flow, saving installations to a Store
+type Handler struct {
+	store Store
+	opts  Options
+	now   func() time.Time
+}
+
+// NewHandler returns a Handler that saves installations to store
+func NewHandler(store Store, opts Options) *Handler {
+	return &Handler{store: store, opts: opts, now: time.Now}
+}
+
+// ServeInstall redirects the installer to Slack to approve the installation
+func (h *Handler) ServeInstall(w http.ResponseWriter, r *http.Request) {
+	state, err := h.newState()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create OAuth state")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     CallbackPath,
+		MaxAge:   int(stateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.opts.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := url.Values{
+		"client_id":    {h.opts.ClientID},
+		"scope":        {strings.Join(h.opts.Scopes, ",")},
+		"redirect_uri": {h.opts.RedirectURL},
+		"state":        {state},
+	}
+	if len(h.opts.UserScopes) > 0 {
+		query.Set("user_scope", strings.Join(h.opts.UserScopes, ","))
+	}
+	http.Redirect(w, r, h.opts.authorizeURL()+"?"+query.Encode(), http.StatusFound)
+}
+
+// ServeCallback completes an installation Slack approved: it exchanges the
+// code Slack sent for tokens and saves them
+func (h *Handler) ServeCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		log.Info().Str("error", reason).Msg("Installation cancelled")
+		http.Error(w, "Installation cancelled: "+reason, http.StatusForbidden)
+		return
+	}
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil || !hmac.Equal([]byte(cookie.Value), []byte(query.Get("state"))) || !h.validState(cookie.Value) {
+		log.Warn().Str("remote_addr", r.RemoteAddr).Msg("Installation callback with invalid state")
+		http.Error(w, "This installation link has expired. Please start again.", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: CallbackPath, MaxAge: -1})
+
+	installation, err := h.exchange(r.Context(), query.Get("code"))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to exchange OAuth code")
+		http.Error(w, "Slack didn't complete the installation. Please try again.", http.StatusBadGateway)
+		return
+	}
+	if err := h.store.Save(r.Context(), installation); err != nil {
+		log.Error().Err(err).Msg("Failed to save installation")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Info().
+		Str("team_id", installation.TeamID).
+		Str("enterprise_id", installation.EnterpriseID).
+		Str("installer", installation.InstallerUserID).
+		Msg("Installed")
+	if h.opts.OnInstall != nil {
+		h.opts.OnInstall(r.Context(), installation)
+	}
+
+	name := installation.TeamName
+	if installation.IsEnterpriseInstall {
+		name = installation.EnterpriseName
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = fmt.Fprintf(w, "Gadget is installed in %s.\n", name) //nolint:errcheck // nothing to do if the installer hung up
+}
+
+// exchange trades code for the installation's tokens with oauth.v2.access,
+// and asks auth.test for the bot's ID, which the exchange doesn't return
+func (h *Handler) exchange(ctx context.Context, code string) (models.Installation, error) {
+	form := url.Values{
+		"client_id":     {h.opts.ClientID},
+		"client_secret": {h.opts.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {h.opts.RedirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.opts.apiURL()+"oauth.v2.access", strings.NewReader(form.Encode()))
+	if err != nil {
+		return models.Installation{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := h.opts.httpClient().Do(req)
+	if err != nil {
+		return models.Installation{}, fmt.Errorf("oauth.v2.access: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // read-only body
+
+	var access slack.OAuthV2Response
+	if err := json.NewDecoder(resp.Body).Decode(&access); err != nil {
+		return models.Installation{}, fmt.Errorf("decode oauth.v2.access response: %w", err)
+	}
+	if err := access.Err(); err != nil {
+		return models.Installation{}, fmt.Errorf("oauth.v2.access: %w", err)
+	}
+
+	installation := models.Installation{
+		EnterpriseID:        access.Enterprise.ID,
+		EnterpriseName:      access.Enterprise.Name,
+		TeamID:              access.Team.ID,
+		TeamName:            access.Team.Name,
+		IsEnterpriseInstall: access.IsEnterpriseInstall,
+		AppID:               access.AppID,
+		BotToken:            access.AccessToken,
+		BotUserID:           access.BotUserID,
+		BotScopes:           access.Scope,
+		InstallerUserID:     access.AuthedUser.ID,
+		UserToken:           access.AuthedUser.AccessToken,
+		UserScopes:          access.AuthedUser.Scope,
+	}
+	bot := slack.New(access.AccessToken, slack.OptionAPIURL(h.opts.apiURL()), slack.OptionHTTPClient(h.opts.httpClient()))
+	auth, err := bot.AuthTestContext(ctx)
+	if err != nil {
+		return models.Installation{}, fmt.Errorf("auth.test: %w", err)
+	}
+	installation.BotID = auth.BotID
+	return installation, nil
+}
+
+// newState returns a random state that expires after stateTTL, signed with
+// the client secret
+func (h *Handler) newState() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload := hex.EncodeToString(nonce) + "." + strconv.FormatInt(h.now().Add(stateTTL).Unix(), 10)
+	return payload + "." + h.sign(payload), nil
+}
+
+// validState returns true if state was made by newState and hasn't expired
+func (h *Handler) validState(state string) bool {
+	i := strings.LastIndex(state, ".")
+	if i < 0 {
+		return false
+	}
+	payload, signature := state[:i], state[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(h.sign(payload))) {
+		return false
+	}
+	_, expiry, _ := strings.Cut(payload, ".")
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	return err == nil && h.now().Unix() < expires
+}
+
+func (h *Handler) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(h.opts.ClientSecret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
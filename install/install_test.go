@@ -0,0 +1,155 @@
+package install
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/gadgettest"
+	"github.com/gadget-bot/gadget/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURL = "https://gadget.example.com" + CallbackPath
+
+func newTestHandler(t *testing.T, fake *gadgettest.FakeSlack, onInstall func(context.Context, models.Installation)) (*Handler, *DBStore) {
+	t.Helper()
+	store := newTestStore(t)
+	return NewHandler(store, Options{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"app_mentions:read", "chat:write"},
+		UserScopes:   []string{"users:read"},
+		APIURL:       fake.URL(),
+		OnInstall:    onInstall,
+	}), store
+}
+
+// startInstall follows InstallPath and returns the state cookie it set and
+// the Slack URL it redirected to
+func startInstall(t *testing.T, h *Handler) (*http.Cookie, *url.URL) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeInstall(w, httptest.NewRequest(http.MethodGet, InstallPath, nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	return cookies[0], location
+}
+
+func callback(h *Handler, cookie *http.Cookie, query url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, CallbackPath+"?"+query.Encode(), nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	h.ServeCallback(w, r)
+	return w
+}
+
+func TestHandler_ServeInstall(t *testing.T) {
+	h, _ := newTestHandler(t, gadgettest.NewFakeSlack(t), nil)
+
+	cookie, location := startInstall(t, h)
+
+	assert.Equal(t, "slack.com", location.Host)
+	assert.Equal(t, "client-id", location.Query().Get("client_id"))
+	assert.Equal(t, "app_mentions:read,chat:write", location.Query().Get("scope"))
+	assert.Equal(t, "users:read", location.Query().Get("user_scope"))
+	assert.Equal(t, redirectURL, location.Query().Get("redirect_uri"))
+	assert.Equal(t, cookie.Value, location.Query().Get("state"))
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+}
+
+func TestHandler_ServeCallback(t *testing.T) {
+	fake := gadgettest.NewFakeSlack(t)
+	fake.GrantCode("code-1", "T_OTHER", "U_INSTALLER")
+	var installed models.Installation
+	h, store := newTestHandler(t, fake, func(ctx context.Context, installation models.Installation) {
+		installed = installation
+	})
+	cookie, location := startInstall(t, h)
+
+	w := callback(h, cookie, url.Values{"code": {"code-1"}, "state": {location.Query().Get("state")}})
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "installed in T_OTHER")
+	installation, err := store.Find(context.Background(), "", "T_OTHER")
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-T_OTHER", installation.BotToken)
+	assert.Equal(t, gadgettest.BotUserID, installation.BotUserID)
+	assert.Equal(t, gadgettest.BotID, installation.BotID)
+	assert.Equal(t, gadgettest.AppID, installation.AppID)
+	assert.Equal(t, "U_INSTALLER", installation.InstallerUserID)
+	assert.Equal(t, "T_OTHER", installed.TeamID)
+	exchange := fake.Calls("oauth.v2.access")
+	require.Len(t, exchange, 1)
+	assert.Equal(t, "client-secret", exchange[0].Params.Get("client_secret"))
+	assert.Equal(t, redirectURL, exchange[0].Params.Get("redirect_uri"))
+}
+
+func TestHandler_ServeCallbackRejectsBadState(t *testing.T) {
+	fake := gadgettest.NewFakeSlack(t)
+	fake.GrantCode("code-1", "T_OTHER", "U_INSTALLER")
+	h, _ := newTestHandler(t, fake, nil)
+	_, location := startInstall(t, h)
+	state := location.Query().Get("state")
+	other, _ := startInstall(t, h)
+
+	tests := map[string]struct {
+		cookie *http.Cookie
+		state  string
+	}{
+		"no cookie":       {nil, state},
+		"another browser": {other, state},
+		"forged":          {&http.Cookie{Name: stateCookie, Value: "abc.99999999999.def"}, "abc.99999999999.def"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := callback(h, tt.cookie, url.Values{"code": {"code-1"}, "state": {tt.state}})
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+	assert.Empty(t, fake.Calls("oauth.v2.access"))
+}
+
+func TestHandler_ServeCallbackRejectsExpiredState(t *testing.T) {
+	fake := gadgettest.NewFakeSlack(t)
+	h, _ := newTestHandler(t, fake, nil)
+	cookie, location := startInstall(t, h)
+	h.now = func() time.Time { return time.Now().Add(stateTTL + time.Second) }
+
+	w := callback(h, cookie, url.Values{"code": {"code-1"}, "state": {location.Query().Get("state")}})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_ServeCallbackCancelled(t *testing.T) {
+	h, _ := newTestHandler(t, gadgettest.NewFakeSlack(t), nil)
+
+	w := callback(h, nil, url.Values{"error": {"access_denied"}})
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "access_denied")
+}
+
+func TestHandler_ServeCallbackExchangeFails(t *testing.T) {
+	fake := gadgettest.NewFakeSlack(t)
+	h, store := newTestHandler(t, fake, nil)
+	cookie, location := startInstall(t, h)
+
+	w := callback(h, cookie, url.Values{"code": {"unknown"}, "state": {location.Query().Get("state")}})
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	_, err := store.Find(context.Background(), "", "T_OTHER")
+	assert.ErrorIs(t, err, ErrNotInstalled)
+}
@@ -0,0 +1,192 @@
+package install
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gadget-bot/gadget/models"
+	"gorm.io/gorm"
+)
+
+// ErrNotInstalled is returned by Store.Find when Gadget isn't installed in
+// a workspace
+var ErrNotInstalled = errors.New("not installed in this workspace")
+
+// Store saves the installations the OAuth flow completes and finds the one
+// serving a workspace
+type Store interface {
+	// Save adds installation, replacing any earlier installation in the
+	// same workspace
+	Save(ctx context.Context, installation models.Installation) error
+	// Find returns the installation for teamID, or the organization-wide
+	// installation for enterpriseID, or ErrNotInstalled
+	Find(ctx context.Context, enterpriseID, teamID string) (models.Installation, error)
+	// FindWorkspace returns the installation whose Workspace is workspace,
+	// or ErrNotInstalled
+	FindWorkspace(ctx context.Context, workspace string) (models.Installation, error)
+	// Delete removes the installation for teamID, or the organization-wide
+	// installation for enterpriseID if teamID is empty
+	Delete(ctx context.Context, enterpriseID, teamID string) error
+}
+
+// encryptedPrefix marks tokens NewEncryptedDBStore's stores encrypted
+const encryptedPrefix = "enc:v1:"
+
+// DBStore keeps installations in the installations table. Their tokens are
+// stored as Slack issued them, readable by anyone who can read the table,
+// unless the store was made with NewEncryptedDBStore.
+type DBStore struct {
+	db   *gorm.DB
+	aead cipher.AEAD // nil stores tokens in plaintext
+}
+
+// NewDBStore returns a Store that keeps installations in db, which must have
+// been migrated with router.SetupDb
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// NewEncryptedDBStore returns a Store like NewDBStore's that encrypts
+// installations' tokens with key, 32 random bytes, using AES-256-GCM.
+// Tokens saved in plaintext before are still read, and encrypted the next
+// time their workspace is installed.
+func NewEncryptedDBStore(db *gorm.DB, key []byte) (*DBStore, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("installation key must be 32 bytes, not %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create installation cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create installation cipher: %w", err)
+	}
+	return &DBStore{db: db, aead: aead}, nil
+}
+
+// tokenAAD binds an encrypted token to its installation's workspace, so it
+// can't be copied to another workspace's row
+func tokenAAD(installation models.Installation) []byte {
+	return []byte(installation.EnterpriseID + "/" + installation.TeamID)
+}
+
+// seal returns installation with its tokens encrypted, if s has a key
+func (s *DBStore) seal(installation models.Installation) (models.Installation, error) {
+	if s.aead == nil {
+		return installation, nil
+	}
+	for _, token := range []*string{&installation.BotToken, &installation.UserToken} {
+		if *token == "" {
+			continue
+		}
+		nonce := make([]byte, s.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return installation, fmt.Errorf("encrypt token: %w", err)
+		}
+		sealed := s.aead.Seal(nonce, nonce, []byte(*token), tokenAAD(installation))
+		*token = encryptedPrefix + base64.StdEncoding.EncodeToString(sealed)
+	}
+	return installation, nil
+}
+
+// open returns installation with its encrypted tokens decrypted
+func (s *DBStore) open(installation models.Installation) (models.Installation, error) {
+	for _, token := range []*string{&installation.BotToken, &installation.UserToken} {
+		encoded, encrypted := strings.CutPrefix(*token, encryptedPrefix)
+		if !encrypted {
+			continue
+		}
+		if s.aead == nil {
+			return models.Installation{}, errors.New("decrypt token: the installation's tokens are encrypted, but the store has no key")
+		}
+		sealed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(sealed) < s.aead.NonceSize() {
+			return models.Installation{}, errors.New("decrypt token: malformed token")
+		}
+		nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+		plaintext, err := s.aead.Open(nil, nonce, ciphertext, tokenAAD(installation))
+		if err != nil {
+			return models.Installation{}, fmt.Errorf("decrypt token: %w", err)
+		}
+		*token = string(plaintext)
+	}
+	return installation, nil
+}
+
+// Save adds installation, replacing any earlier installation in the same
+// workspace
+func (s *DBStore) Save(ctx context.Context, installation models.Installation) error {
+	var existing models.Installation
+	err := s.db.WithContext(ctx).
+		Where("enterprise_id = ? AND team_id = ?", installation.EnterpriseID, installation.TeamID).
+		Limit(1).Find(&existing).Error
+	if err != nil {
+		return fmt.Errorf("load installation: %w", err)
+	}
+	installation.ID = existing.ID
+	installation.CreatedAt = existing.CreatedAt
+	installation, err = s.seal(installation)
+	if err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Save(&installation).Error; err != nil {
+		return fmt.Errorf("save installation: %w", err)
+	}
+	return nil
+}
+
+// Find returns the installation for teamID, or the organization-wide
+// installation for enterpriseID, or ErrNotInstalled
+func (s *DBStore) Find(ctx context.Context, enterpriseID, teamID string) (models.Installation, error) {
+	var installations []models.Installation
+	query := s.db.WithContext(ctx).Where("enterprise_id = ? AND team_id = ?", enterpriseID, teamID)
+	if enterpriseID != "" {
+		query = query.Or("enterprise_id = ? AND team_id = '' AND is_enterprise_install = ?", enterpriseID, true)
+	}
+	// The team's own installation comes before its organization's
+	if err := query.Order("team_id DESC").Limit(1).Find(&installations).Error; err != nil {
+		return models.Installation{}, fmt.Errorf("find installation: %w", err)
+	}
+	if len(installations) == 0 {
+		return models.Installation{}, ErrNotInstalled
+	}
+	return s.open(installations[0])
+}
+
+// FindWorkspace returns the installation whose Workspace is workspace, i.e.
+// the team's own installation or an organization-wide one, or
+// ErrNotInstalled
+func (s *DBStore) FindWorkspace(ctx context.Context, workspace string) (models.Installation, error) {
+	var installations []models.Installation
+	err := s.db.WithContext(ctx).
+		Where("team_id = ?", workspace).
+		Or("team_id = '' AND enterprise_id = ?", workspace).
+		Limit(1).Find(&installations).Error
+	if err != nil {
+		return models.Installation{}, fmt.Errorf("find installation: %w", err)
+	}
+	if len(installations) == 0 {
+		return models.Installation{}, ErrNotInstalled
+	}
+	return s.open(installations[0])
+}
+
+// Delete removes the installation for teamID, or the organization-wide
+// installation for enterpriseID if teamID is empty. Its tokens are deleted
+// with it.
+func (s *DBStore) Delete(ctx context.Context, enterpriseID, teamID string) error {
+	err := s.db.WithContext(ctx).Unscoped().
+		Where("enterprise_id = ? AND team_id = ?", enterpriseID, teamID).
+		Delete(&models.Installation{}).Error
+	if err != nil {
+		return fmt.Errorf("delete installation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package install
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/gadget-bot/gadget/gadgettest"
+	"github.com/gadget-bot/gadget/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) *DBStore {
+	t.Helper()
+	db, err := gadgettest.OpenMemoryDB()
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Installation{}))
+	return NewDBStore(db)
+}
+
+func TestDBStore_SaveAndFind(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Save(ctx, models.Installation{TeamID: "T1", BotToken: "xoxb-1"}))
+	require.NoError(t, store.Save(ctx, models.Installation{TeamID: "T1", BotToken: "xoxb-2"}))
+
+	installation, err := store.Find(ctx, "", "T1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-2", installation.BotToken, "reinstalling replaces the installation")
+	var count int64
+	store.db.Model(&models.Installation{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestDBStore_FindNotInstalled(t *testing.T) {
+	store := newTestStore(t)
+
+	_, err := store.Find(context.Background(), "", "T404")
+
+	assert.ErrorIs(t, err, ErrNotInstalled)
+}
+
+func TestDBStore_FindOrganizationInstall(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Save(ctx, models.Installation{EnterpriseID: "E1", IsEnterpriseInstall: true, BotToken: "xoxb-org"}))
+	require.NoError(t, store.Save(ctx, models.Installation{EnterpriseID: "E1", TeamID: "T1", BotToken: "xoxb-team"}))
+
+	own, err := store.Find(ctx, "E1", "T1")
+	require.NoError(t, err)
+	org, err := store.Find(ctx, "E1", "T2")
+	require.NoError(t, err)
+
+	assert.Equal(t, "xoxb-team", own.BotToken, "a team's own installation comes first")
+	assert.Equal(t, "xoxb-org", org.BotToken)
+}
+
+func TestDBStore_FindWorkspace(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Save(ctx, models.Installation{EnterpriseID: "E1", IsEnterpriseInstall: true, BotToken: "xoxb-org"}))
+	require.NoError(t, store.Save(ctx, models.Installation{EnterpriseID: "E2", TeamID: "T1", BotToken: "xoxb-team"}))
+
+	team, err := store.FindWorkspace(ctx, "T1")
+	require.NoError(t, err)
+	org, err := store.FindWorkspace(ctx, "E1")
+	require.NoError(t, err)
+	_, err = store.FindWorkspace(ctx, "E2")
+
+	assert.Equal(t, "xoxb-team", team.BotToken)
+	assert.Equal(t, "xoxb-org", org.BotToken)
+	assert.ErrorIs(t, err, ErrNotInstalled, "a team's enterprise isn't a workspace of its own")
+}
+
+func TestDBStore_Delete(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Save(ctx, models.Installation{TeamID: "T1", BotToken: "xoxb-1"}))
+
+	require.NoError(t, store.Delete(ctx, "", "T1"))
+
+	_, err := store.Find(ctx, "", "T1")
+	assert.ErrorIs(t, err, ErrNotInstalled)
+	require.NoError(t, store.Save(ctx, models.Installation{TeamID: "T1", BotToken: "xoxb-3"}), "the workspace can install again")
+}
+
+func newEncryptedTestStore(t *testing.T, key []byte) *DBStore {
+	t.Helper()
+	store, err := NewEncryptedDBStore(newTestStore(t).db, key)
+	require.NoError(t, err)
+	return store
+}
+
+func TestEncryptedDBStore_EncryptsTokens(t *testing.T) {
+	store := newEncryptedTestStore(t, bytes.Repeat([]byte{1}, 32))
+	ctx := context.Background()
+	require.NoError(t, store.Save(ctx, models.Installation{TeamID: "T1", BotToken: "xoxb-1", UserToken: "xoxp-1"}))
+
+	var stored models.Installation
+	require.NoError(t, store.db.First(&stored).Error)
+	assert.NotContains(t, stored.BotToken, "xoxb-1")
+	assert.NotContains(t, stored.UserToken, "xoxp-1")
+
+	installation, err := store.Find(ctx, "", "T1")
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-1", installation.BotToken)
+	assert.Equal(t, "xoxp-1", installation.UserToken)
+	installation, err = store.FindWorkspace(ctx, "T1")
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-1", installation.BotToken)
+}
+
+func TestEncryptedDBStore_ReadsPlaintextTokens(t *testing.T) {
+	plain := newTestStore(t)
+	require.NoError(t, plain.Save(context.Background(), models.Installation{TeamID: "T1", BotToken: "xoxb-1"}))
+	store, err := NewEncryptedDBStore(plain.db, bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+
+	installation, err := store.Find(context.Background(), "", "T1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-1", installation.BotToken)
+}
+
+func TestEncryptedDBStore_WrongKey(t *testing.T) {
+	store := newEncryptedTestStore(t, bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, store.Save(context.Background(), models.Installation{TeamID: "T1", BotToken: "xoxb-1"}))
+	other, err := NewEncryptedDBStore(store.db, bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+
+	_, err = other.Find(context.Background(), "", "T1")
+	assert.ErrorContains(t, err, "decrypt token")
+	_, err = NewDBStore(store.db).Find(context.Background(), "", "T1")
+	assert.ErrorContains(t, err, "no key")
+	_, err = NewEncryptedDBStore(store.db, []byte("short"))
+	assert.Error(t, err)
+}
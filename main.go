@@ -1,13 +1,31 @@
 package main
 
 import (
+	"os"
+
+	"github.com/gadget-bot/gadget/console"
 	gadget "github.com/gadget-bot/gadget/core"
 
 	"github.com/rs/zerolog/log"
 )
 
 func main() {
-	myBot, err := gadget.Setup()
+	// "gadget console" talks to the bot from the terminal instead of Slack
+	consoleMode := len(os.Args) > 1 && os.Args[1] == "console"
+
+	var myBot *gadget.Gadget
+	var err error
+	if consoleMode {
+		// The console needs neither Slack nor a database, so its config
+		// isn't validated
+		cfg, cfgErr := gadget.ReadConfig(os.Getenv(gadget.ConfigFileEnv))
+		if cfgErr != nil {
+			log.Fatal().Err(cfgErr).Msg("Reading config failed")
+		}
+		myBot, err = console.Setup(cfg)
+	} else {
+		myBot, err = gadget.Setup()
+	}
 	if err != nil {
 		log.Fatal().Err(err).Msg("Setup failed")
 	}
@@ -16,6 +34,18 @@ func main() {
 
 	// This launches your bot
 
+	if consoleMode {
+		c, err := console.New(myBot, os.Stdout)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Console failed")
+		}
+		defer func() { _ = c.Close() }()
+		if err := c.Run(os.Stdin); err != nil {
+			log.Error().Err(err).Msg("Console stopped")
+		}
+		return
+	}
+
 	if err := myBot.Run(); err != nil {
 		log.Fatal().Err(err).Msg("Bot stopped")
 	}
@@ -40,6 +40,7 @@ type BotUser struct {
 type SlashInfo struct {
 	Command     string `json:"command"`
 	Description string `json:"description"`
+	UsageHint   string `json:"usage_hint,omitempty"`
 }
 
 // Settings represents the settings section of the manifest.
@@ -78,9 +79,13 @@ func Generate(r router.Router, name, description, requestURL string, extraScopes
 	scopes := map[string]bool{}
 	var slashCommands []SlashInfo
 
-	hasMentions := len(r.MentionRoutes) > 0
+	// MessageRoutes answer mentions and direct messages
+	hasMessages := len(r.MessageRoutes) > 0
+	hasMentions := len(r.MentionRoutes) > 0 || hasMessages
 	hasChannelMessages := len(r.ChannelMessageRoutes) > 0
-	hasSlashCommands := len(r.SlashCommandRoutes) > 0
+	commands := r.SlashCommands()
+	hasSlashCommands := len(commands) > 0
+	hasBlockActions := len(r.BlockActionRoutes) > 0
 
 	if hasMentions {
 		botEvents = append(botEvents, "app_mention")
@@ -90,28 +95,32 @@ func Generate(r router.Router, name, description, requestURL string, extraScopes
 		botEvents = append(botEvents, "message.channels")
 		scopes["channels:history"] = true
 	}
+	if hasMessages {
+		botEvents = append(botEvents, "message.im")
+		scopes["im:history"] = true
+	}
 
 	// chat:write is needed for nearly every bot
 	if hasMentions || hasChannelMessages || hasSlashCommands {
 		scopes["chat:write"] = true
 	}
 
-	for cmd, route := range r.SlashCommandRoutes {
-		desc := route.Description
-		if desc == "" {
-			desc = route.Name
+	for _, cmd := range commands {
+		info := SlashInfo{Command: cmd}
+		if route, exists := r.FindSlashCommandRouteByCommand(cmd); exists {
+			info.Description = route.Description
+			if info.Description == "" {
+				info.Description = route.Name
+			}
+		} else {
+			// Commands made up only of subcommands point users at the generated help
+			info.Description = subcommandsDescription(r.SlashSubcommands(cmd))
+			info.UsageHint = "help"
 		}
-		slashCommands = append(slashCommands, SlashInfo{
-			Command:     cmd,
-			Description: desc,
-		})
+		slashCommands = append(slashCommands, info)
 		scopes["commands"] = true
 	}
 
-	sort.Slice(slashCommands, func(i, j int) bool {
-		return slashCommands[i].Command < slashCommands[j].Command
-	})
-
 	scopeList := make([]string, 0, len(scopes))
 	for s := range scopes {
 		scopeList = append(scopeList, s)
@@ -153,7 +162,9 @@ func Generate(r router.Router, name, description, requestURL string, extraScopes
 		},
 	}
 
-	if hasSlashCommands && requestURL != "" {
+	// Slack posts block actions to the interactivity URL, which Gadget
+	// serves alongside slash commands
+	if (hasSlashCommands || hasBlockActions) && requestURL != "" {
 		m.Settings.Interactivity = &Interactivity{
 			Enabled:    true,
 			RequestURL: requestURL + "/gadget/command",
@@ -163,6 +174,17 @@ func Generate(r router.Router, name, description, requestURL string, extraScopes
 	return m
 }
 
+// subcommandsDescription describes a command by its highest priority subcommand
+func subcommandsDescription(routes []router.SlashCommandRoute) string {
+	if len(routes) == 0 {
+		return ""
+	}
+	if routes[0].Description != "" {
+		return routes[0].Description
+	}
+	return routes[0].Name
+}
+
 // JSON returns the manifest as a pretty-printed JSON string.
 func (m Manifest) JSON() (string, error) {
 	b, err := json.MarshalIndent(m, "", "  ")
@@ -39,6 +39,21 @@ func TestGenerate_ChannelMessageRoutes(t *testing.T) {
 	assert.Contains(t, m.OAuthConfig.Scopes.Bot, "channels:history")
 }
 
+func TestGenerate_MessageRoutes(t *testing.T) {
+	r := *router.NewRouter()
+	r.AddMessageRoute(router.MessageRoute{
+		Route: router.Route{Name: "ping", Pattern: `(?i)^ping`},
+	})
+
+	m := Generate(r, "PingBot", "", "https://example.com")
+
+	assert.Contains(t, m.Settings.EventSubscriptions.BotEvents, "app_mention")
+	assert.Contains(t, m.Settings.EventSubscriptions.BotEvents, "message.im")
+	assert.Contains(t, m.OAuthConfig.Scopes.Bot, "app_mentions:read")
+	assert.Contains(t, m.OAuthConfig.Scopes.Bot, "im:history")
+	assert.Contains(t, m.OAuthConfig.Scopes.Bot, "chat:write")
+}
+
 func TestGenerate_SlashCommandRoutes(t *testing.T) {
 	r := *router.NewRouter()
 	r.AddSlashCommandRoute(router.SlashCommandRoute{
@@ -135,3 +150,32 @@ func TestGenerate_BotUser(t *testing.T) {
 	assert.Equal(t, "MyBot", m.Features.BotUser.DisplayName)
 	assert.True(t, m.Features.BotUser.AlwaysOnline)
 }
+
+func TestGenerate_SubcommandOnlyCommand(t *testing.T) {
+	r := *router.NewRouter()
+	r.AddSlashCommandRoutes([]router.SlashCommandRoute{
+		{Route: router.Route{Name: "deploy.status", Pattern: `^status$`, Description: "Show deploy status", Priority: 1}, Command: "/deploy"},
+		{Route: router.Route{Name: "deploy.rollback", Pattern: `^rollback`}, Command: "/deploy"},
+	})
+
+	m := Generate(r, "DeployBot", "", "https://example.com")
+
+	require.Len(t, m.Features.Slash, 1)
+	assert.Equal(t, "/deploy", m.Features.Slash[0].Command)
+	assert.Equal(t, "Show deploy status", m.Features.Slash[0].Description)
+	assert.Equal(t, "help", m.Features.Slash[0].UsageHint)
+	assert.Contains(t, m.OAuthConfig.Scopes.Bot, "commands")
+}
+
+func TestGenerate_BlockActionRoutesEnableInteractivity(t *testing.T) {
+	r := *router.NewRouter()
+	r.AddBlockActionRoute(router.BlockActionRoute{
+		Route:    router.Route{Name: "approve"},
+		ActionID: "approve",
+	})
+
+	m := Generate(r, "Bot", "", "https://example.com")
+
+	require.NotNil(t, m.Settings.Interactivity)
+	assert.Equal(t, "https://example.com/gadget/command", m.Settings.Interactivity.RequestURL)
+}
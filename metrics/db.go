@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// dbStartKey is where the before callback leaves a statement's start time
+const dbStartKey = "gadget:metrics_start"
+
+// InstrumentDB times every statement db runs, as
+// gadget_db_query_duration_seconds. Instrumenting db again replaces the
+// earlier callbacks.
+func (m *Metrics) InstrumentDB(db *gorm.DB) error {
+	if m == nil || db == nil {
+		return nil
+	}
+	cb := db.Callback()
+	for _, op := range []struct {
+		name      string
+		processor processor
+		before    registerFunc
+		after     registerFunc
+	}{
+		{"create", cb.Create(), cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query(), cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update(), cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete(), cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row(), cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw(), cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	} {
+		if err := register(op.processor, op.before, "gadget:metrics_before_"+op.name, startTimer); err != nil {
+			return err
+		}
+		if err := register(op.processor, op.after, "gadget:metrics_after_"+op.name, m.stopTimer(op.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processor is the part of GORM's callback processors InstrumentDB uses
+type processor interface {
+	Get(name string) func(*gorm.DB)
+	Replace(name string, fn func(*gorm.DB)) error
+}
+
+type registerFunc func(name string, fn func(*gorm.DB)) error
+
+// register registers fn as name with add, or replaces the fn already
+// registered as name, which keeps its place in the chain
+func register(p processor, add registerFunc, name string, fn func(*gorm.DB)) error {
+	if p.Get(name) != nil {
+		return p.Replace(name, fn)
+	}
+	return add(name, fn)
+}
+
+func startTimer(db *gorm.DB) {
+	db.InstanceSet(dbStartKey, time.Now())
+}
+
+func (m *Metrics) stopTimer(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(dbStartKey)
+		if !ok {
+			return
+		}
+		if start, ok := v.(time.Time); ok {
+			m.dbDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type widget struct {
+	ID   uint
+	Name string
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&widget{}))
+	return db
+}
+
+func TestInstrumentDB(t *testing.T) {
+	m := New()
+	db := openDB(t)
+	require.NoError(t, m.InstrumentDB(db))
+
+	require.NoError(t, db.Create(&widget{Name: "sprocket"}).Error)
+	var w widget
+	require.NoError(t, db.First(&w).Error)
+	require.NoError(t, db.Model(&w).Update("name", "cog").Error)
+
+	assert.Equal(t, 3, testutil.CollectAndCount(m.dbDuration))
+}
+
+func TestInstrumentDB_Again(t *testing.T) {
+	first, second := New(), New()
+	db := openDB(t)
+	require.NoError(t, first.InstrumentDB(db))
+	require.NoError(t, second.InstrumentDB(db))
+
+	require.NoError(t, db.Create(&widget{Name: "sprocket"}).Error)
+
+	assert.Zero(t, testutil.CollectAndCount(first.dbDuration))
+	assert.Equal(t, 1, testutil.CollectAndCount(second.dbDuration))
+}
@@ -0,0 +1,256 @@
+// Package metrics collects Gadget's Prometheus metrics and serves them on
+// /metrics: events received, how routes resolved, plugin durations and
+// panics, Slack API latency and errors, database query time and the number
+// of handlers waiting to finish. Plugins add their own through
+// HandlerContext.Metrics.
+//
+// Every method is safe to call on a nil *Metrics, which records nothing.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+// Path is where Gadget serves its metrics
+const Path = "/metrics"
+
+// Metrics holds Gadget's metrics and the registry they, and any plugin
+// metrics, are exposed from
+type Metrics struct {
+	registry *prometheus.Registry
+
+	eventsReceived    *prometheus.CounterVec
+	routeResolutions  *prometheus.CounterVec
+	permissionDenials *prometheus.CounterVec
+	pluginDuration    *prometheus.HistogramVec
+	pluginPanics      *prometheus.CounterVec
+	slackDuration     *prometheus.HistogramVec
+	slackErrors       *prometheus.CounterVec
+	dbDuration        *prometheus.HistogramVec
+	queueDepth        prometheus.Gauge
+	requestsRejected  *prometheus.CounterVec
+
+	mu      sync.Mutex
+	plugins map[string]prometheus.Collector // plugin metrics by name, so handlers can ask for them on every run
+}
+
+// New returns Metrics registered on a new registry, along with the Go
+// runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		eventsReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gadget_events_received_total",
+			Help: "Events received from chat platforms, by type, e.g. app_mention or slash_command.",
+		}, []string{"type"}),
+		routeResolutions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gadget_route_matches_total",
+			Help: "Routes chosen to handle events, by route type, route name and outcome (matched, fallback, denied, rate_limited or help).",
+		}, []string{"route_type", "route", "outcome"}),
+		permissionDenials: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gadget_permission_denials_total",
+			Help: "Events from users who lacked permission to use the matching route, by route type.",
+		}, []string{"route_type"}),
+		pluginDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gadget_plugin_duration_seconds",
+			Help:    "How long plugins took to run, including middleware, by route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route"}),
+		pluginPanics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gadget_plugin_panics_total",
+			Help: "Plugins that panicked, by route.",
+		}, []string{"route"}),
+		slackDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gadget_slack_api_call_duration_seconds",
+			Help:    "How long Slack Web API calls took, including rate limit waits and retries, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+		slackErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gadget_slack_api_errors_total",
+			Help: "Slack Web API calls that failed, by method and error, e.g. channel_not_found or http_503.",
+		}, []string{"method", "error"}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gadget_db_query_duration_seconds",
+			Help:    "How long database statements took, by operation (create, query, update, delete, row or raw).",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"operation"}),
+		queueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "gadget_dispatch_queue_depth",
+			Help: "Handlers that have been dispatched and haven't finished.",
+		}),
+		requestsRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gadget_requests_rejected_total",
+			Help: "Requests rejected for their Slack signature, by endpoint (events or commands) and reason, e.g. bad_signature or replayed.",
+		}, []string{"endpoint", "reason"}),
+		plugins: map[string]prometheus.Collector{},
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.eventsReceived,
+		m.routeResolutions,
+		m.permissionDenials,
+		m.pluginDuration,
+		m.pluginPanics,
+		m.slackDuration,
+		m.slackErrors,
+		m.dbDuration,
+		m.queueDepth,
+		m.requestsRejected,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Gatherer returns the registry the metrics are exposed from, e.g. for
+// testutil.GatherAndCompare
+func (m *Metrics) Gatherer() prometheus.Gatherer {
+	if m == nil {
+		return prometheus.NewRegistry()
+	}
+	return m.registry
+}
+
+// EventReceived counts an event of eventType
+func (m *Metrics) EventReceived(eventType string) {
+	if m == nil {
+		return
+	}
+	m.eventsReceived.WithLabelValues(eventType).Inc()
+}
+
+// RouteResolved counts the route chosen to handle an event and why. Denied
+// outcomes are also counted as permission denials.
+func (m *Metrics) RouteResolved(routeType, route, outcome string) {
+	if m == nil {
+		return
+	}
+	m.routeResolutions.WithLabelValues(routeType, route, outcome).Inc()
+	if outcome == "denied" {
+		m.permissionDenials.WithLabelValues(routeType).Inc()
+	}
+}
+
+// PluginDispatched counts a handler as waiting to finish. Call
+// PluginFinished when it does.
+func (m *Metrics) PluginDispatched() {
+	if m == nil {
+		return
+	}
+	m.queueDepth.Inc()
+}
+
+// PluginFinished records how long route's handler ran and whether it
+// panicked
+func (m *Metrics) PluginFinished(route string, d time.Duration, panicked bool) {
+	if m == nil {
+		return
+	}
+	m.queueDepth.Dec()
+	m.pluginDuration.WithLabelValues(route).Observe(d.Seconds())
+	if panicked {
+		m.pluginPanics.WithLabelValues(route).Inc()
+	}
+}
+
+// SlackCall records a Slack Web API call to method that took d and failed
+// with errCode, or succeeded if errCode is empty. It matches
+// slackapi.Options.Observer.
+func (m *Metrics) SlackCall(method string, d time.Duration, errCode string) {
+	if m == nil {
+		return
+	}
+	m.slackDuration.WithLabelValues(method).Observe(d.Seconds())
+	if errCode != "" {
+		m.slackErrors.WithLabelValues(method, errCode).Inc()
+	}
+}
+
+// RequestRejected counts a request to endpoint rejected for reason, e.g.
+// "bad_signature"
+func (m *Metrics) RequestRejected(endpoint, reason string) {
+	if m == nil {
+		return
+	}
+	m.requestsRejected.WithLabelValues(endpoint, reason).Inc()
+}
+
+// Register adds a plugin's collector to the registry. Registering a
+// collector equal to one already registered is not an error, so handlers can
+// register their metrics every time they run.
+func (m *Metrics) Register(c prometheus.Collector) error {
+	if m == nil {
+		return nil
+	}
+	err := m.registry.Register(c)
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) {
+		return nil
+	}
+	return err
+}
+
+// Counter returns the plugin counter name, with labels, registering it the
+// first time it's asked for
+func (m *Metrics) Counter(name, help string, labels ...string) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	if existing, ok := m.plugin(name, counter).(*prometheus.CounterVec); ok {
+		return existing
+	}
+	return counter
+}
+
+// Gauge returns the plugin gauge name, with labels, registering it the first
+// time it's asked for
+func (m *Metrics) Gauge(name, help string, labels ...string) *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+	if existing, ok := m.plugin(name, gauge).(*prometheus.GaugeVec); ok {
+		return existing
+	}
+	return gauge
+}
+
+// Histogram returns the plugin histogram name, with labels, registering it
+// the first time it's asked for. Nil buckets use prometheus.DefBuckets.
+func (m *Metrics) Histogram(name, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	if existing, ok := m.plugin(name, histogram).(*prometheus.HistogramVec); ok {
+		return existing
+	}
+	return histogram
+}
+
+// plugin returns the plugin collector registered as name, registering c as
+// it if there's none yet. A collector that can't be registered is logged
+// and returned unregistered, so the plugin still works.
+func (m *Metrics) plugin(name string, c prometheus.Collector) prometheus.Collector {
+	if m == nil {
+		return c
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, exists := m.plugins[name]; exists {
+		return existing
+	}
+	if err := m.registry.Register(c); err != nil {
+		log.Error().Err(err).Str("metric", name).Msg("Failed to register plugin metric")
+		return c
+	}
+	m.plugins[name] = c
+	return c
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics_Handler(t *testing.T) {
+	m := New()
+	m.EventReceived("app_mention")
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `gadget_events_received_total{type="app_mention"} 1`)
+	assert.Contains(t, string(body), "go_goroutines")
+}
+
+func TestMetrics_RouteResolvedCountsDenials(t *testing.T) {
+	m := New()
+	m.RouteResolved("mention", "greet", "matched")
+	m.RouteResolved("mention", "greet", "denied")
+	m.RouteResolved("slash_command", "deploy", "denied")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.routeResolutions.WithLabelValues("mention", "greet", "denied")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.permissionDenials.WithLabelValues("mention")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.permissionDenials.WithLabelValues("slash_command")))
+}
+
+func TestMetrics_Plugins(t *testing.T) {
+	m := New()
+	m.PluginDispatched()
+	m.PluginDispatched()
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.queueDepth))
+
+	m.PluginFinished("greet", 10*time.Millisecond, false)
+	m.PluginFinished("greet", 20*time.Millisecond, true)
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.queueDepth))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.pluginDuration))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.pluginPanics.WithLabelValues("greet")))
+}
+
+func TestMetrics_SlackCall(t *testing.T) {
+	m := New()
+	m.SlackCall("chat.postMessage", time.Millisecond, "")
+	m.SlackCall("chat.postMessage", time.Millisecond, "channel_not_found")
+
+	assert.Equal(t, 1, testutil.CollectAndCount(m.slackDuration))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.slackErrors.WithLabelValues("chat.postMessage", "channel_not_found")))
+}
+
+func TestMetrics_RequestRejected(t *testing.T) {
+	m := New()
+	m.RequestRejected("events", "bad_signature")
+	m.RequestRejected("events", "bad_signature")
+	m.RequestRejected("commands", "replayed")
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requestsRejected.WithLabelValues("events", "bad_signature")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requestsRejected.WithLabelValues("commands", "replayed")))
+}
+
+func TestMetrics_PluginMetricsAreSharedByName(t *testing.T) {
+	m := New()
+	m.Counter("karma_total", "Karma given.", "user").WithLabelValues("U1").Inc()
+	m.Counter("karma_total", "Karma given.", "user").WithLabelValues("U1").Inc()
+	m.Gauge("karma_leaders", "Users with karma.").WithLabelValues().Set(3)
+	m.Histogram("karma_lookup_seconds", "Karma lookups.", nil).WithLabelValues().Observe(0.1)
+
+	expected := `
+# HELP karma_total Karma given.
+# TYPE karma_total counter
+karma_total{user="U1"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(m.Gatherer(), strings.NewReader(expected), "karma_total"))
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.Gauge("karma_leaders", "Users with karma.")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.Histogram("karma_lookup_seconds", "Karma lookups.", nil)))
+}
+
+func TestMetrics_RegisterIsIdempotent(t *testing.T) {
+	m := New()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "jokes_total", Help: "Jokes told."})
+
+	assert.NoError(t, m.Register(counter))
+	assert.NoError(t, m.Register(counter))
+	assert.Error(t, m.Register(prometheus.NewCounter(prometheus.CounterOpts{Name: "gadget_plugin_panics_total", Help: "Clashes with Gadget's."})))
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *Metrics
+
+	assert.NotPanics(t, func() {
+		m.EventReceived("app_mention")
+		m.RouteResolved("mention", "greet", "denied")
+		m.PluginDispatched()
+		m.PluginFinished("greet", time.Second, true)
+		m.SlackCall("chat.postMessage", time.Second, "")
+		m.RequestRejected("events", "replayed")
+		m.Counter("karma_total", "Karma given.").WithLabelValues().Inc()
+		assert.NoError(t, m.Register(prometheus.NewCounter(prometheus.CounterOpts{Name: "jokes_total", Help: "Jokes told."})))
+		assert.NoError(t, m.InstrumentDB(nil))
+	})
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
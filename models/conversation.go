@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Conversation persists the state of a multi-turn dialog between Gadget and a
+// user. A conversation is scoped to a user, channel, and thread so that the
+// next matching message can be routed back to the waiting step.
+type Conversation struct {
+	gorm.Model
+	UserUuid  string `gorm:"index:idx_conversation_scope,unique;size:64"`
+	Channel   string `gorm:"index:idx_conversation_scope,unique;size:64"`
+	ThreadTs  string `gorm:"index:idx_conversation_scope,unique;size:64"`
+	Step      string
+	State     string    `gorm:"type:text"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// Expired returns true if the conversation has timed out as of now.
+func (c Conversation) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt)
+}
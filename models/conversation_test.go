@@ -0,0 +1,19 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConversation_Expired(t *testing.T) {
+	now := time.Now()
+
+	assert.True(t, Conversation{ExpiresAt: now.Add(-time.Second)}.Expired(now))
+	assert.False(t, Conversation{ExpiresAt: now.Add(time.Minute)}.Expired(now))
+}
+
+func TestConversation_ZeroExpiresAtNeverExpires(t *testing.T) {
+	assert.False(t, Conversation{}.Expired(time.Now()))
+}
@@ -6,7 +6,8 @@ import (
 
 type Group struct {
 	gorm.Model
-	Name    string `gorm:"index:,unique"`
+	Name    string `gorm:"size:191;index:idx_groups_team_name,unique,priority:2"`
+	TeamID  string `gorm:"size:32;index:idx_groups_team_name,unique,priority:1"` // empty outside installed workspaces
 	Members []User `gorm:"many2many:user_groups;"`
 }
 
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Installation is Gadget installed in a Slack workspace, or across an
+// Enterprise Grid organization, by the OAuth install flow. It holds the
+// tokens Gadget uses to talk to that workspace.
+type Installation struct {
+	gorm.Model
+	EnterpriseID        string `gorm:"size:32;index:idx_installations_workspace,unique"`
+	TeamID              string `gorm:"size:32;index:idx_installations_workspace,unique"` // empty for organization-wide installs
+	TeamName            string `gorm:"size:255"`
+	EnterpriseName      string `gorm:"size:255"`
+	IsEnterpriseInstall bool
+	AppID               string `gorm:"size:32"`
+	BotToken            string `gorm:"size:255"`
+	BotUserID           string `gorm:"size:32"`
+	BotID               string `gorm:"size:32"`
+	BotScopes           string `gorm:"size:1024"` // comma separated, as Slack grants them
+	InstallerUserID     string `gorm:"size:32"`
+	UserToken           string `gorm:"size:255"` // empty unless user scopes were requested
+	UserScopes          string `gorm:"size:1024"`
+}
+
+// Workspace returns the ID of the team the installation is for, or of its
+// organization for organization-wide installs
+func (i Installation) Workspace() string {
+	if i.TeamID == "" {
+		return i.EnterpriseID
+	}
+	return i.TeamID
+}
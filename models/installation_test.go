@@ -0,0 +1,12 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstallation_Workspace(t *testing.T) {
+	assert.Equal(t, "T123", Installation{EnterpriseID: "E123", TeamID: "T123"}.Workspace())
+	assert.Equal(t, "E123", Installation{EnterpriseID: "E123", IsEnterpriseInstall: true}.Workspace())
+}
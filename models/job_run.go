@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JobRun records when a scheduled job last ran and which Gadget replica holds
+// the lease to run it. Runs is incremented on every claim so that only one
+// replica can claim a given occurrence.
+type JobRun struct {
+	gorm.Model
+	Name       string `gorm:"index:,unique;size:191"`
+	LastRunAt  time.Time
+	Runs       int64
+	LeaseOwner string `gorm:"size:191"`
+	LeaseUntil time.Time
+}
+
+// Leased returns true if a replica is still running the job as of now.
+func (r JobRun) Leased(now time.Time) bool {
+	return r.LeaseOwner != "" && now.Before(r.LeaseUntil)
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobRun_Leased(t *testing.T) {
+	now := time.Now()
+
+	assert.True(t, JobRun{LeaseOwner: "a", LeaseUntil: now.Add(time.Minute)}.Leased(now))
+	assert.False(t, JobRun{LeaseOwner: "a", LeaseUntil: now.Add(-time.Second)}.Leased(now))
+}
+
+func TestJobRun_NoOwnerIsNotLeased(t *testing.T) {
+	assert.False(t, JobRun{LeaseUntil: time.Now().Add(time.Minute)}.Leased(time.Now()))
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PagedList is a long list Gadget shows a page at a time, with buttons to
+// move between pages. Items is the JSON encoded list of mrkdwn items. Lists
+// are kept until ExpiresAt so that old messages' buttons stop working
+// eventually rather than the table growing forever. TeamID is the workspace
+// the list was posted in; only its buttons can page through it.
+type PagedList struct {
+	gorm.Model
+	TeamID    string `gorm:"index;size:32"` // empty outside installed workspaces
+	Title     string `gorm:"type:text"`
+	Items     string `gorm:"type:mediumtext"`
+	PageSize  int
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// Expired returns true if the list can no longer be paged through at now
+func (l PagedList) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// DecodeItems returns the list's items
+func (l PagedList) DecodeItems() ([]string, error) {
+	var items []string
+	if l.Items == "" {
+		return items, nil
+	}
+	err := json.Unmarshal([]byte(l.Items), &items)
+	return items, err
+}
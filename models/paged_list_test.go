@@ -0,0 +1,30 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPagedList_Expired(t *testing.T) {
+	now := time.Now()
+	list := PagedList{ExpiresAt: now.Add(time.Minute)}
+
+	assert.False(t, list.Expired(now))
+	assert.True(t, list.Expired(now.Add(time.Minute)))
+}
+
+func TestPagedList_DecodeItems(t *testing.T) {
+	items, err := PagedList{Items: `["one","two"]`}.DecodeItems()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "two"}, items)
+
+	items, err = PagedList{}.DecodeItems()
+	require.NoError(t, err)
+	assert.Empty(t, items)
+
+	_, err = PagedList{Items: `not json`}.DecodeItems()
+	assert.Error(t, err)
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RateLimitBucket stores a token bucket so rate limits are shared between
+// Gadget replicas.
+type RateLimitBucket struct {
+	gorm.Model
+	BucketKey  string `gorm:"index:,unique;size:191"`
+	Tokens     float64
+	RefilledAt time.Time
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reminder is a message Gadget will post to Channel (a channel ID, or a user
+// ID for a direct message) once DueAt has passed. Recurring reminders keep
+// the phrase they were created with, e.g. "every monday at 9am", which is
+// evaluated in TimeZone to find the next DueAt after each delivery. Sends is
+// incremented every time a replica claims it for delivery, so only one can.
+// TeamID is the workspace the reminder was set in, and is delivered in.
+type Reminder struct {
+	gorm.Model
+	TeamID     string    `gorm:"index;size:32"` // empty outside installed workspaces
+	UserUuid   string    `gorm:"index;size:64"`
+	Channel    string    `gorm:"size:64"`
+	Text       string    `gorm:"type:text"`
+	DueAt      time.Time `gorm:"index"`
+	Recurrence string
+	TimeZone   string
+	Sends      int64
+}
+
+// Recurring returns true if the reminder repeats after it is delivered
+func (r Reminder) Recurring() bool {
+	return r.Recurrence != ""
+}
+
+// Location returns the time zone the reminder was scheduled in, falling back
+// to UTC if it is missing or unknown.
+func (r Reminder) Location() *time.Location {
+	if r.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(r.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
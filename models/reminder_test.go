@@ -0,0 +1,19 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReminder_Recurring(t *testing.T) {
+	assert.True(t, Reminder{Recurrence: "every monday at 9am"}.Recurring())
+	assert.False(t, Reminder{}.Recurring())
+}
+
+func TestReminder_Location(t *testing.T) {
+	assert.Equal(t, "America/New_York", Reminder{TimeZone: "America/New_York"}.Location().String())
+	assert.Equal(t, time.UTC, Reminder{}.Location())
+	assert.Equal(t, time.UTC, Reminder{TimeZone: "Not/AZone"}.Location())
+}
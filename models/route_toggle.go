@@ -0,0 +1,17 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// RouteToggle records an administrator's decision to disable or re-enable a
+// route. Target is either a route Name or a plugin namespace written as
+// "namespace.*". An empty Channel applies the toggle everywhere, and an empty
+// TeamID applies it in every workspace.
+type RouteToggle struct {
+	gorm.Model
+	TeamID   string `gorm:"size:32;index:idx_route_toggles_team_scope,unique,priority:1"` // empty outside installed workspaces
+	Target   string `gorm:"size:191;index:idx_route_toggles_team_scope,unique,priority:2"`
+	Channel  string `gorm:"size:64;index:idx_route_toggles_team_scope,unique,priority:3"`
+	Disabled bool
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/rs/zerolog/log"
 	"github.com/slack-go/slack"
 	"gorm.io/gorm"
@@ -8,8 +10,18 @@ import (
 
 type User struct {
 	gorm.Model
-	Uuid   string  `gorm:"index:,unique"`
+	Uuid   string  `gorm:"size:191;index:idx_users_team_uuid,unique,priority:2"`
+	TeamID string  `gorm:"size:32;index:idx_users_team_uuid,unique,priority:1"` // empty outside installed workspaces
 	Groups []Group `gorm:"many2many:user_groups;"`
+
+	// Profile snapshot, saved by a directory that persists profiles. Empty
+	// for users it hasn't seen.
+	Name             string `gorm:"size:255"`
+	RealName         string `gorm:"size:255"`
+	DisplayName      string `gorm:"size:255"`
+	Email            string `gorm:"size:255;index"`
+	TimeZone         string `gorm:"size:64"`
+	ProfileUpdatedAt *time.Time
 }
 
 func (u User) Info(api slack.Client) *slack.User {
@@ -21,3 +33,17 @@ func (u User) Info(api slack.Client) *slack.User {
 
 	return info
 }
+
+// ProfileColumns returns the profile snapshot columns for info, taken at at,
+// for use with Assign or Updates. A map is used so cleared fields are saved
+// too.
+func ProfileColumns(info slack.User, at time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"name":               info.Name,
+		"real_name":          info.RealName,
+		"display_name":       info.Profile.DisplayName,
+		"email":              info.Profile.Email,
+		"time_zone":          info.TZ,
+		"profile_updated_at": at,
+	}
+}
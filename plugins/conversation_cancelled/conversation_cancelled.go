@@ -0,0 +1,20 @@
+package conversation_cancelled
+
+import (
+	"github.com/gadget-bot/gadget/plugins/helpers"
+	"github.com/gadget-bot/gadget/router"
+
+	"github.com/slack-go/slack"
+)
+
+func GetConversationStep() *router.ConversationStep {
+	var step router.ConversationStep
+	step.Name = "conversation_cancelled"
+	step.Plugin = func(ctx router.HandlerContext, conv router.Conversation, msg router.ConversationMessage) {
+		helpers.PostMessage(*ctx.BotClient, msg.Channel, "conversation_cancelled",
+			slack.MsgOptionText("Okay <@"+msg.User+">, never mind.", false),
+			helpers.ThreadReplyOption(msg.ThreadTimeStamp),
+		)
+	}
+	return &step
+}
@@ -0,0 +1,48 @@
+package conversation_cancelled
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetConversationStep_Metadata(t *testing.T) {
+	step := GetConversationStep()
+
+	assert.NotNil(t, step)
+	assert.Equal(t, "conversation_cancelled", step.Name)
+	assert.NotNil(t, step.Plugin)
+}
+
+func TestConversationStep_PostsInThread(t *testing.T) {
+	var postedMessage, postedThread string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/chat.postMessage" {
+			if err := r.ParseForm(); err != nil {
+				t.Fatalf("ParseForm failed: %v", err)
+			}
+			postedMessage = r.FormValue("text")
+			postedThread = r.FormValue("thread_ts")
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1234567890.123456"}`)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	defer server.Close()
+
+	api := slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+
+	step := GetConversationStep()
+	msg := router.ConversationMessage{
+		ConversationKey: router.ConversationKey{User: "U_USER", Channel: "C123", ThreadTimeStamp: "111.222"},
+		Text:            "cancel",
+	}
+	step.Plugin(router.HandlerContext{BotClient: api}, router.Conversation{}, msg)
+
+	assert.Contains(t, postedMessage, "never mind")
+	assert.Contains(t, postedMessage, "U_USER")
+	assert.Equal(t, "111.222", postedThread)
+}
@@ -0,0 +1,29 @@
+// Package defaults holds the built-in routes Gadget runs when no route
+// matches, when a user lacks permission or is rate limited, and when a
+// conversation is cancelled. core and gadgettest both use it, so tests see
+// the same replies as production.
+package defaults
+
+import (
+	"github.com/gadget-bot/gadget/plugins/conversation_cancelled"
+	"github.com/gadget-bot/gadget/plugins/fallback"
+	"github.com/gadget-bot/gadget/plugins/permission_denied"
+	"github.com/gadget-bot/gadget/plugins/rate_limited"
+	"github.com/gadget-bot/gadget/router"
+)
+
+// SetRoutes sets r's fallback, denied, rate limited and cancelled
+// conversation routes to the built-in ones
+func SetRoutes(r *router.Router) {
+	r.DefaultMentionRoute = *fallback.GetMentionRoute()
+	r.DeniedMentionRoute = *permission_denied.GetMentionRoute()
+	r.DeniedChannelMessageRoute = *permission_denied.GetChannelMessageRoute()
+	r.DeniedSlashCommandRoute = *permission_denied.GetSlashCommandRoute()
+	r.CancelledConversationStep = *conversation_cancelled.GetConversationStep()
+	r.RateLimitedMentionRoute = *rate_limited.GetMentionRoute()
+	r.RateLimitedChannelMessageRoute = *rate_limited.GetChannelMessageRoute()
+	r.RateLimitedSlashCommandRoute = *rate_limited.GetSlashCommandRoute()
+	r.DefaultMessageRoute = *fallback.GetMessageRoute()
+	r.DeniedMessageRoute = *permission_denied.GetMessageRoute()
+	r.RateLimitedMessageRoute = *rate_limited.GetMessageRoute()
+}
@@ -0,0 +1,26 @@
+package defaults
+
+import (
+	"testing"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetRoutes(t *testing.T) {
+	r := router.NewRouter()
+
+	SetRoutes(r)
+
+	assert.Equal(t, "fallback", r.DefaultMentionRoute.Name)
+	assert.NotNil(t, r.DeniedMentionRoute.Plugin)
+	assert.NotNil(t, r.DeniedChannelMessageRoute.Plugin)
+	assert.NotNil(t, r.DeniedSlashCommandRoute.Plugin)
+	assert.NotNil(t, r.RateLimitedMentionRoute.Plugin)
+	assert.NotNil(t, r.RateLimitedChannelMessageRoute.Plugin)
+	assert.NotNil(t, r.RateLimitedSlashCommandRoute.Plugin)
+	assert.Equal(t, "fallback", r.DefaultMessageRoute.Name)
+	assert.NotNil(t, r.DeniedMessageRoute.Plugin)
+	assert.NotNil(t, r.RateLimitedMessageRoute.Plugin)
+	assert.Equal(t, "conversation_cancelled", r.CancelledConversationStep.Name)
+}
@@ -0,0 +1,91 @@
+package deploys
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gadget-bot/gadget/plugins/helpers"
+	"github.com/gadget-bot/gadget/router"
+
+	"github.com/slack-go/slack"
+)
+
+// deployNotice is the JSON body sent to the deploy webhook, e.g.
+//
+//	{"service": "api", "environment": "production", "version": "v1.2.3",
+//	 "status": "succeeded", "author": "alice", "url": "https://ci.example.com/runs/42"}
+type deployNotice struct {
+	Service     string `json:"service"`
+	Environment string `json:"environment"`
+	Version     string `json:"version"`
+	Status      string `json:"status"`
+	Author      string `json:"author"`
+	URL         string `json:"url"`
+}
+
+var statusEmoji = map[string]string{
+	"started":   ":rocket:",
+	"succeeded": ":white_check_mark:",
+	"success":   ":white_check_mark:",
+	"failed":    ":x:",
+	"failure":   ":x:",
+}
+
+// format renders the notice as a Slack message
+func (notice deployNotice) format() string {
+	status := strings.ToLower(notice.Status)
+	if status == "" {
+		status = "succeeded"
+	}
+	emoji, known := statusEmoji[status]
+	if !known {
+		emoji = ":information_source:"
+	}
+
+	// Every field comes from CI, so none of it may become a mention or link
+	text := fmt.Sprintf("%s Deploy of *%s*", emoji, helpers.EscapeText(notice.Service))
+	if notice.Version != "" {
+		text += fmt.Sprintf(" `%s`", helpers.EscapeText(notice.Version))
+	}
+	if notice.Environment != "" {
+		text += fmt.Sprintf(" to *%s*", helpers.EscapeText(notice.Environment))
+	}
+	text += " " + helpers.EscapeText(status)
+	if notice.Author != "" {
+		text += " (by " + helpers.EscapeText(notice.Author) + ")"
+	}
+	if notice.URL != "" {
+		// a | would end the URL and start the link's label
+		url := strings.ReplaceAll(notice.URL, "|", "%7C")
+		text += fmt.Sprintf(" <%s|details>", helpers.EscapeText(url))
+	}
+	return text
+}
+
+// GetWebhookRoute returns a webhook, mounted at /gadget/hooks/deploy, that
+// posts deploy notices from CI to channel. Requests authenticate with an
+// "Authorization: Bearer <secret>" header.
+func GetWebhookRoute(channel, secret string) *router.WebhookRoute {
+	var pluginRoute router.WebhookRoute
+	pluginRoute.Name = "deploys.deployNotice"
+	pluginRoute.Description = "Posts deploy notices sent by CI"
+	pluginRoute.Path = "deploy"
+	pluginRoute.Auth = router.WebhookAuthBearer
+	pluginRoute.Secret = secret
+	pluginRoute.Plugin = func(ctx router.HandlerContext, req router.WebhookRequest) {
+		var notice deployNotice
+		if err := req.Decode(&notice); err != nil {
+			ctx.Logger.Warn().Err(err).Msg("Failed to decode deploy notice")
+			return
+		}
+		if notice.Service == "" {
+			ctx.Logger.Warn().Msg("Deploy notice is missing a service")
+			return
+		}
+
+		helpers.PostMessage(*ctx.BotClient, channel, "deploys.deployNotice",
+			slack.MsgOptionText(notice.format(), false),
+		)
+	}
+	return &pluginRoute
+}
@@ -0,0 +1,90 @@
+package deploys
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gadget-bot/gadget/router"
+	"github.com/rs/zerolog"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMessageRecorder(t *testing.T, channels, messages *[]string) *slack.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/chat.postMessage" {
+			if err := r.ParseForm(); err != nil {
+				t.Fatalf("ParseForm failed: %v", err)
+			}
+			*channels = append(*channels, r.FormValue("channel"))
+			*messages = append(*messages, r.FormValue("text"))
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1234567890.123456"}`)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	t.Cleanup(server.Close)
+	return slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+}
+
+func TestGetWebhookRoute(t *testing.T) {
+	route := GetWebhookRoute("C0DEPLOY", "s3cret")
+
+	assert.Equal(t, "deploys.deployNotice", route.Name)
+	assert.Equal(t, "deploy", route.Path)
+	assert.Equal(t, router.WebhookAuthBearer, route.Auth)
+	assert.Equal(t, "s3cret", route.Secret)
+}
+
+func TestDeployNotice_Format(t *testing.T) {
+	notice := deployNotice{Service: "api", Environment: "production", Version: "v1.2.3", Status: "succeeded", Author: "alice", URL: "https://ci.example.com/runs/42"}
+	assert.Equal(t, ":white_check_mark: Deploy of *api* `v1.2.3` to *production* succeeded (by alice) <https://ci.example.com/runs/42|details>", notice.format())
+
+	assert.Equal(t, ":x: Deploy of *web* failed", deployNotice{Service: "web", Status: "Failed"}.format())
+	assert.Equal(t, ":information_source: Deploy of *web* rolled back", deployNotice{Service: "web", Status: "rolled back"}.format())
+}
+
+func TestDeployNotice_FormatEscapesFields(t *testing.T) {
+	notice := deployNotice{
+		Service: "<!channel>",
+		Version: "<https://evil.example.com|v2>",
+		Status:  "<!here>",
+		Author:  "<@U123> & co",
+		URL:     "https://ci.example.com/runs/42|<!everyone>",
+	}
+
+	text := notice.format()
+
+	assert.NotContains(t, text, "<!")
+	assert.NotContains(t, text, "<@")
+	assert.NotContains(t, text, "<https://evil")
+	assert.Contains(t, text, "*&lt;!channel&gt;*")
+	assert.Contains(t, text, "(by &lt;@U123&gt; &amp; co)")
+	assert.Contains(t, text, "<https://ci.example.com/runs/42%7C&lt;!everyone&gt;|details>")
+}
+
+func TestDeployNotice_PostsToChannel(t *testing.T) {
+	var channels, messages []string
+	api := newMessageRecorder(t, &channels, &messages)
+	route := GetWebhookRoute("C0DEPLOY", "s3cret")
+
+	route.Execute(router.HandlerContext{BotClient: api, Logger: zerolog.Nop()}, router.WebhookRequest{Body: []byte(`{"service":"api","status":"started"}`)})
+
+	require.Len(t, messages, 1)
+	assert.Equal(t, []string{"C0DEPLOY"}, channels)
+	assert.Equal(t, ":rocket: Deploy of *api* started", messages[0])
+}
+
+func TestDeployNotice_IgnoresInvalidNotices(t *testing.T) {
+	var channels, messages []string
+	api := newMessageRecorder(t, &channels, &messages)
+	route := GetWebhookRoute("C0DEPLOY", "s3cret")
+	ctx := router.HandlerContext{BotClient: api, Logger: zerolog.Nop()}
+
+	route.Execute(ctx, router.WebhookRequest{Body: []byte(`{"status":"started"}`)})
+	route.Execute(ctx, router.WebhookRequest{Body: []byte(`[]`)})
+
+	assert.Empty(t, messages)
+}
@@ -1,6 +1,7 @@
 package fallback
 
 import (
+	"github.com/gadget-bot/gadget/adapter"
 	"github.com/gadget-bot/gadget/plugins/helpers"
 	"github.com/gadget-bot/gadget/router"
 
@@ -20,3 +21,17 @@ func GetMentionRoute() *router.MentionRoute {
 	}
 	return &pluginRoute
 }
+
+// GetMessageRoute answers messages from other chat platforms that no route
+// matches
+func GetMessageRoute() *router.MessageRoute {
+	var pluginRoute router.MessageRoute
+	pluginRoute.Permissions = append(pluginRoute.Permissions, "*")
+	pluginRoute.Name = "fallback"
+	pluginRoute.Plugin = func(ctx router.HandlerContext, msg adapter.Message) {
+		if err := adapter.Reply(ctx.Adapter, msg, "Hi there! I see you sent me a message, but I'm not sure what to do with that."); err != nil {
+			ctx.Logger.Error().Err(err).Str("platform", msg.Platform).Str("channel", msg.Channel).Msg("Failed to post fallback reply")
+		}
+	}
+	return &pluginRoute
+}
@@ -5,6 +5,8 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/gadget-bot/gadget/adapter/slackadapter"
 	"github.com/gadget-bot/gadget/router"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
@@ -59,3 +61,27 @@ func TestFallbackPlugin_PostsMessage(t *testing.T) {
 	assert.Contains(t, postedMessage, "U_USER")
 	assert.Contains(t, postedMessage, "not sure what to do")
 }
+
+func TestMessagePlugin_Replies(t *testing.T) {
+	var postedMessage string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm failed: %v", err)
+		}
+		if r.URL.Path == "/chat.postMessage" {
+			postedMessage = r.FormValue("text")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1234567890.123456"}`)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	defer server.Close()
+
+	api := slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+
+	route := GetMessageRoute()
+	ctx := router.HandlerContext{Route: route.Route, Adapter: slackadapter.New(api, "U_BOT")}
+	route.Plugin(ctx, adapter.Message{Platform: "slack", User: "U_USER", Channel: "C123", Text: "something unrecognized"})
+
+	assert.Equal(t, "fallback", route.Name)
+	assert.Contains(t, postedMessage, "not sure what to do")
+}
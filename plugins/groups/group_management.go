@@ -3,6 +3,7 @@ package groups
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/gadget-bot/gadget/models"
 	"github.com/gadget-bot/gadget/plugins/helpers"
@@ -13,6 +14,15 @@ import (
 	"gorm.io/gorm"
 )
 
+// groupItems renders groups as bulleted list items
+func groupItems(groups []models.Group) []string {
+	items := make([]string, 0, len(groups))
+	for _, group := range groups {
+		items = append(items, "• "+group.Name)
+	}
+	return items
+}
+
 func getMyGroups() *router.MentionRoute {
 	var pluginRoute router.MentionRoute
 	pluginRoute.Permissions = append(pluginRoute.Permissions, "*")
@@ -26,23 +36,19 @@ func getMyGroups() *router.MentionRoute {
 			threadOpt,
 		)
 
-		var currentUser models.User
-		ctx.Router.DbConnection.Preload("Groups").FirstOrCreate(&currentUser, models.User{Uuid: ev.User})
-
-		var response string
-		groupList := currentUser.Groups
+		currentUser := ctx.Router.FindOrCreateUser(ev.User)
+		if err := ctx.Router.DbConnection.Model(&currentUser).Association("Groups").Find(&currentUser.Groups); err != nil {
+			ctx.Logger.Error().Err(err).Msg("Failed to load the user's groups")
+		}
 
-		if len(groupList) > 0 {
-			for _, group := range groupList {
-				response += fmt.Sprintf("*-* %s\n", group.Name)
-			}
-		} else {
-			response = "You don't seem to be a member of _any_ groups. Bummer."
+		text := "You don't seem to be a member of _any_ groups. Bummer."
+		if len(currentUser.Groups) > 0 {
+			text = strings.Join(groupItems(currentUser.Groups), "\n")
 		}
 
-		helpers.PostMessage(*ctx.BotClient, ev.Channel, "groups.getMyGroups",
-			slack.MsgOptionText(response, false),
-			threadOpt,
+		helpers.PostSplitMessage(*ctx.BotClient, ev.Channel, ev.ThreadTimeStamp, "groups.getMyGroups",
+			helpers.NewMessage().Section(text).Build(),
+			helpers.SplitInline,
 		)
 	}
 	return &pluginRoute
@@ -62,18 +68,13 @@ func getAllGroups() *router.MentionRoute {
 			threadOpt,
 		)
 
-		ctx.Router.DbConnection.Find(&groups)
+		ctx.Router.DbConnection.Where("team_id = ?", ctx.Router.TeamID).Find(&groups)
 
-		var response string
-
-		for _, group := range groups {
-			response += fmt.Sprintf("*-* %s\n", group.Name)
-		}
-
-		helpers.PostMessage(*ctx.BotClient, ev.Channel, "groups.getAllGroups",
-			slack.MsgOptionText(response, false),
-			threadOpt,
-		)
+		// Large workspaces can have more groups than fit in a message
+		_ = helpers.Paginate(ctx, ev.Channel, helpers.List{
+			Items: groupItems(groups),
+			Empty: "I don't know about any groups yet.",
+		}, threadOpt)
 	}
 	return &pluginRoute
 }
@@ -89,11 +90,8 @@ func addUserToGroup() *router.MentionRoute {
 		results := ctx.Route.CompiledPattern.FindStringSubmatch(message)
 		userName := results[1]
 		groupName := results[3]
-		var foundGroup models.Group
-		var foundUser models.User
-
-		ctx.Router.DbConnection.Where(models.Group{Name: groupName}).FirstOrCreate(&foundGroup)
-		ctx.Router.DbConnection.Where(models.User{Uuid: userName}).FirstOrCreate(&foundUser)
+		foundGroup := ctx.Router.FindOrCreateGroup(groupName)
+		foundUser := ctx.Router.FindOrCreateUser(userName)
 		if err := ctx.Router.DbConnection.Model(&foundGroup).Association("Members").Append(&foundUser); err != nil {
 			helpers.PostMessage(*ctx.BotClient, ev.Channel, "groups.addUserToGroup",
 				slack.MsgOptionText(fmt.Sprintf("Failed to add <@%s> to %s: %s", userName, groupName, err), false),
@@ -122,12 +120,11 @@ func removeUserFromGroup() *router.MentionRoute {
 		userName := results[1]
 		groupName := results[3]
 		var foundGroup models.Group
-		var foundUser models.User
 		var response string
 		var wasMember bool
 
-		ctx.Router.DbConnection.Where(models.User{Uuid: userName}).FirstOrCreate(&foundUser)
-		groupQueryResult := ctx.Router.DbConnection.Preload("Members").Where(models.Group{Name: groupName}).First(&foundGroup)
+		foundUser := ctx.Router.FindOrCreateUser(userName)
+		groupQueryResult := ctx.Router.DbConnection.Preload("Members").Where("team_id = ? AND name = ?", ctx.Router.TeamID, groupName).First(&foundGroup)
 
 		if errors.Is(groupQueryResult.Error, gorm.ErrRecordNotFound) {
 			response = fmt.Sprintf("I couldn't find a group named '%s'.", groupName)
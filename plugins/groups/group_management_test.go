@@ -1,12 +1,15 @@
 package groups
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
 	"testing"
 
+	"github.com/gadget-bot/gadget/gadgettest"
 	"github.com/gadget-bot/gadget/models"
+	"github.com/gadget-bot/gadget/plugins/helpers"
 	"github.com/gadget-bot/gadget/router"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
@@ -25,7 +28,7 @@ func setupGroupTestDB(t *testing.T) *gorm.DB {
 	if err != nil {
 		t.Fatalf("Failed to open in-memory SQLite: %v", err)
 	}
-	if err := db.AutoMigrate(&models.Group{}, &models.User{}); err != nil {
+	if err := db.AutoMigrate(&models.Group{}, &models.User{}, &models.PagedList{}); err != nil {
 		t.Fatalf("Failed to auto-migrate: %v", err)
 	}
 	return db
@@ -349,6 +352,87 @@ func TestGetAllGroups_PostsAllGroups(t *testing.T) {
 	assert.Contains(t, messages[1], "viewers")
 }
 
+func TestGetAllGroups_OnlyListsTheWorkspacesGroups(t *testing.T) {
+	db := setupGroupTestDB(t)
+	db.Create(&models.Group{TeamID: "T1", Name: "deployers"})
+	db.Create(&models.Group{TeamID: "T2", Name: "secretteam"})
+
+	var messages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/chat.postMessage" {
+			if err := r.ParseForm(); err != nil {
+				t.Fatalf("ParseForm failed: %v", err)
+			}
+			messages = append(messages, r.FormValue("text"))
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1234567890.123456"}`)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	defer server.Close()
+
+	api := slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+
+	route := getAllGroups()
+	ctx := router.HandlerContext{
+		Router:    router.Router{DbConnection: db, TeamID: "T1"},
+		Route:     route.Route,
+		BotClient: api,
+	}
+	ev := slackevents.AppMentionEvent{
+		User:    "U_ADMIN",
+		Channel: "C123",
+	}
+
+	route.Plugin(ctx, ev, "list all groups")
+
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[1], "deployers")
+	assert.NotContains(t, messages[1], "secretteam")
+}
+
+func TestGetAllGroups_PaginatesLongLists(t *testing.T) {
+	db := setupGroupTestDB(t)
+	for i := 0; i < 45; i++ {
+		db.Create(&models.Group{Name: fmt.Sprintf("group%02d", i)})
+	}
+
+	var messages []string
+	var blocks []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/chat.postMessage" {
+			if err := r.ParseForm(); err != nil {
+				t.Fatalf("ParseForm failed: %v", err)
+			}
+			messages = append(messages, r.FormValue("text"))
+			blocks = append(blocks, r.FormValue("blocks"))
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1234567890.123456"}`)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	defer server.Close()
+
+	api := slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+
+	route := getAllGroups()
+	ctx := router.HandlerContext{
+		Router:    router.Router{DbConnection: db},
+		Route:     route.Route,
+		BotClient: api,
+	}
+	ev := slackevents.AppMentionEvent{
+		User:    "U_ADMIN",
+		Channel: "C123",
+	}
+
+	route.Plugin(ctx, ev, "list all groups")
+
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[1], "group00")
+	assert.NotContains(t, messages[1], "group44")
+	assert.Contains(t, messages[1], "Page 1 of 3")
+	assert.Contains(t, blocks[1], helpers.PageNextActionID)
+}
+
 func TestAddUserToGroup_UserAlreadyInGroup(t *testing.T) {
 	db := setupGroupTestDB(t)
 
@@ -437,3 +521,7 @@ func TestRemoveUserFromGroup_UserNotAMember(t *testing.T) {
 
 	assert.Contains(t, postedMessage, "doesn't look like")
 }
+
+func TestTranscripts(t *testing.T) {
+	gadgettest.RunTranscripts(t, "testdata/*.transcript", gadgettest.WithMentionRoutes(GetMentionRoutes()...))
+}
@@ -0,0 +1,202 @@
+package helpers
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// Message is a Block Kit message along with the plain-text fallback Slack
+// shows in notifications and clients that can't render blocks.
+type Message struct {
+	Blocks []slack.Block
+	Text   string
+}
+
+// MsgOption returns the option that sends the message's blocks and fallback text
+func (m Message) MsgOption() slack.MsgOption {
+	return slack.MsgOptionCompose(
+		slack.MsgOptionText(m.Text, false),
+		slack.MsgOptionBlocks(m.Blocks...),
+	)
+}
+
+// Button is an interactive button in an actions block. Set URL to open a
+// link instead of, or as well as, sending ActionID and Value to the app.
+type Button struct {
+	Text     string
+	ActionID string
+	Value    string
+	URL      string
+	Style    slack.Style // "", slack.StylePrimary or slack.StyleDanger
+}
+
+// MenuOption is an item in an overflow menu
+type MenuOption struct {
+	Text  string
+	Value string
+}
+
+// MessageBuilder builds Block Kit messages fluently. Text arguments are
+// mrkdwn unless noted otherwise, e.g.
+//
+//	msg := helpers.NewMessage().
+//		Header("Deploy finished").
+//		Fields("*Service:* api", "*Version:* v1.2.3").
+//		Divider().
+//		Context("Triggered by <@U123>").
+//		Build()
+type MessageBuilder struct {
+	blocks []slack.Block
+}
+
+// NewMessage returns an empty MessageBuilder
+func NewMessage() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+func mrkdwn(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.MarkdownType, text, false, false)
+}
+
+func plainText(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.PlainTextType, text, true, false)
+}
+
+// Header adds a header block. text is plain text.
+func (b *MessageBuilder) Header(text string) *MessageBuilder {
+	b.blocks = append(b.blocks, slack.NewHeaderBlock(plainText(text)))
+	return b
+}
+
+// Section adds a section block
+func (b *MessageBuilder) Section(text string) *MessageBuilder {
+	b.blocks = append(b.blocks, slack.NewSectionBlock(mrkdwn(text), nil, nil))
+	return b
+}
+
+// Fields adds a section block that lays fields out in two columns. Slack
+// allows at most 10 fields per section, so longer lists are split across
+// several sections.
+func (b *MessageBuilder) Fields(fields ...string) *MessageBuilder {
+	for len(fields) > 0 {
+		n := min(len(fields), 10)
+		objects := make([]*slack.TextBlockObject, 0, n)
+		for _, field := range fields[:n] {
+			objects = append(objects, mrkdwn(field))
+		}
+		b.blocks = append(b.blocks, slack.NewSectionBlock(nil, objects, nil))
+		fields = fields[n:]
+	}
+	return b
+}
+
+// Context adds a context block of small, grey text elements
+func (b *MessageBuilder) Context(elements ...string) *MessageBuilder {
+	mixed := make([]slack.MixedElement, 0, len(elements))
+	for _, element := range elements {
+		mixed = append(mixed, mrkdwn(element))
+	}
+	b.blocks = append(b.blocks, slack.NewContextBlock("", mixed...))
+	return b
+}
+
+// Divider adds a divider block
+func (b *MessageBuilder) Divider() *MessageBuilder {
+	b.blocks = append(b.blocks, slack.NewDividerBlock())
+	return b
+}
+
+// Buttons adds an actions block containing buttons
+func (b *MessageBuilder) Buttons(buttons ...Button) *MessageBuilder {
+	elements := make([]slack.BlockElement, 0, len(buttons))
+	for _, button := range buttons {
+		element := slack.NewButtonBlockElement(button.ActionID, button.Value, plainText(button.Text))
+		element.URL = button.URL
+		if button.Style != "" {
+			element = element.WithStyle(button.Style)
+		}
+		elements = append(elements, element)
+	}
+	b.blocks = append(b.blocks, slack.NewActionBlock("", elements...))
+	return b
+}
+
+// Overflow adds a section block with an overflow menu beside its text
+func (b *MessageBuilder) Overflow(text, actionID string, options ...MenuOption) *MessageBuilder {
+	objects := make([]*slack.OptionBlockObject, 0, len(options))
+	for _, option := range options {
+		objects = append(objects, slack.NewOptionBlockObject(option.Value, plainText(option.Text), nil))
+	}
+	menu := slack.NewOverflowBlockElement(actionID, objects...)
+	b.blocks = append(b.blocks, slack.NewSectionBlock(mrkdwn(text), nil, slack.NewAccessory(menu)))
+	return b
+}
+
+// Build returns the message with a fallback generated from its blocks
+func (b *MessageBuilder) Build() Message {
+	return Message{Blocks: b.blocks, Text: FallbackText(b.blocks)}
+}
+
+// FallbackText generates plain text for notifications from the text of
+// header, section and context blocks, with mrkdwn formatting removed.
+func FallbackText(blocks []slack.Block) string {
+	var lines []string
+	add := func(text *slack.TextBlockObject) {
+		if text != nil && text.Text != "" {
+			lines = append(lines, StripMarkdown(text.Text))
+		}
+	}
+
+	for _, block := range blocks {
+		switch block := block.(type) {
+		case *slack.HeaderBlock:
+			add(block.Text)
+		case *slack.SectionBlock:
+			add(block.Text)
+			// Fields are usually a bold label over a value, which reads
+			// better on one line
+			for _, field := range block.Fields {
+				if field != nil && field.Text != "" {
+					lines = append(lines, strings.ReplaceAll(StripMarkdown(field.Text), "\n", " "))
+				}
+			}
+		case *slack.ContextBlock:
+			var parts []string
+			for _, element := range block.ContextElements.Elements {
+				if text, ok := element.(*slack.TextBlockObject); ok && text.Text != "" {
+					parts = append(parts, StripMarkdown(text.Text))
+				}
+			}
+			if len(parts) > 0 {
+				lines = append(lines, strings.Join(parts, " "))
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
+	markdownLink   = regexp.MustCompile(`<((?:https?|mailto):[^|>]+)(?:\|([^>]+))?>`)
+	markdownBold   = regexp.MustCompile(`\*([^*\n]+)\*`)
+	markdownItalic = regexp.MustCompile(`(^|[^\w])_([^_\n]+)_([^\w]|$)`)
+	markdownStrike = regexp.MustCompile(`~([^~\n]+)~`)
+)
+
+// StripMarkdown removes mrkdwn emphasis and replaces links with their labels.
+// User, channel and date references are left alone since Slack renders them
+// in notifications.
+func StripMarkdown(text string) string {
+	text = markdownLink.ReplaceAllStringFunc(text, func(link string) string {
+		parts := markdownLink.FindStringSubmatch(link)
+		if parts[2] != "" {
+			return parts[2]
+		}
+		return parts[1]
+	})
+	text = markdownBold.ReplaceAllString(text, "$1")
+	text = markdownItalic.ReplaceAllString(text, "$1$2$3")
+	text = markdownStrike.ReplaceAllString(text, "$1")
+	return strings.ReplaceAll(text, "`", "")
+}
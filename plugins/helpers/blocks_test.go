@@ -0,0 +1,124 @@
+package helpers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageBuilder_Blocks(t *testing.T) {
+	msg := NewMessage().
+		Header("Deploy finished").
+		Section("*api* is live").
+		Fields("*Service:*\napi", "*Version:*\nv1.2.3").
+		Divider().
+		Context("Triggered by <@U123>").
+		Build()
+
+	require.Len(t, msg.Blocks, 5)
+	assert.Equal(t, slack.MBTHeader, msg.Blocks[0].BlockType())
+	assert.Equal(t, slack.MBTSection, msg.Blocks[1].BlockType())
+	assert.Equal(t, slack.MBTSection, msg.Blocks[2].BlockType())
+	assert.Equal(t, slack.MBTDivider, msg.Blocks[3].BlockType())
+	assert.Equal(t, slack.MBTContext, msg.Blocks[4].BlockType())
+
+	header := msg.Blocks[0].(*slack.HeaderBlock)
+	assert.Equal(t, slack.PlainTextType, header.Text.Type)
+	section := msg.Blocks[1].(*slack.SectionBlock)
+	assert.Equal(t, slack.MarkdownType, section.Text.Type)
+	assert.Len(t, msg.Blocks[2].(*slack.SectionBlock).Fields, 2)
+}
+
+func TestMessageBuilder_FallbackText(t *testing.T) {
+	msg := NewMessage().
+		Header("Deploy finished").
+		Section("*api* is _live_ at <https://example.com|the site>").
+		Fields("*Service:*\napi", "*Version:*\nv1.2.3").
+		Divider().
+		Context("Triggered by <@U123>", "`abc123`").
+		Build()
+
+	assert.Equal(t, "Deploy finished\napi is live at the site\nService: api\nVersion: v1.2.3\nTriggered by <@U123> abc123", msg.Text)
+}
+
+func TestMessageBuilder_FieldsSplitIntoSections(t *testing.T) {
+	var fields []string
+	for i := 0; i < 23; i++ {
+		fields = append(fields, fmt.Sprintf("field %d", i))
+	}
+
+	msg := NewMessage().Fields(fields...).Build()
+
+	require.Len(t, msg.Blocks, 3)
+	assert.Len(t, msg.Blocks[0].(*slack.SectionBlock).Fields, 10)
+	assert.Len(t, msg.Blocks[1].(*slack.SectionBlock).Fields, 10)
+	assert.Len(t, msg.Blocks[2].(*slack.SectionBlock).Fields, 3)
+}
+
+func TestMessageBuilder_Buttons(t *testing.T) {
+	msg := NewMessage().Buttons(
+		Button{Text: "Approve", ActionID: "approve", Value: "42", Style: slack.StylePrimary},
+		Button{Text: "Docs", ActionID: "docs", URL: "https://example.com"},
+	).Build()
+
+	require.Len(t, msg.Blocks, 1)
+	actions := msg.Blocks[0].(*slack.ActionBlock)
+	require.Len(t, actions.Elements.ElementSet, 2)
+
+	approve := actions.Elements.ElementSet[0].(*slack.ButtonBlockElement)
+	assert.Equal(t, "approve", approve.ActionID)
+	assert.Equal(t, "42", approve.Value)
+	assert.Equal(t, slack.StylePrimary, approve.Style)
+
+	docs := actions.Elements.ElementSet[1].(*slack.ButtonBlockElement)
+	assert.Equal(t, "https://example.com", docs.URL)
+	assert.Empty(t, string(docs.Style))
+
+	// Buttons have no text worth notifying about
+	assert.Empty(t, msg.Text)
+}
+
+func TestMessageBuilder_Overflow(t *testing.T) {
+	msg := NewMessage().Overflow("Pick one", "choose",
+		MenuOption{Text: "First", Value: "1"},
+		MenuOption{Text: "Second", Value: "2"},
+	).Build()
+
+	require.Len(t, msg.Blocks, 1)
+	section := msg.Blocks[0].(*slack.SectionBlock)
+	require.NotNil(t, section.Accessory)
+	menu := section.Accessory.OverflowElement
+	require.NotNil(t, menu)
+	assert.Equal(t, "choose", menu.ActionID)
+	require.Len(t, menu.Options, 2)
+	assert.Equal(t, "2", menu.Options[1].Value)
+	assert.Equal(t, "Pick one", msg.Text)
+}
+
+func TestMessage_MsgOption(t *testing.T) {
+	msg := NewMessage().Section("hello").Build()
+
+	_, values, err := slack.UnsafeApplyMsgOptions("xoxb-fake", "C123", "https://slack.com/api/", msg.MsgOption())
+	require.NoError(t, err)
+	assert.Equal(t, "hello", values.Get("text"))
+	assert.Contains(t, values.Get("blocks"), `"type":"section"`)
+}
+
+func TestStripMarkdown(t *testing.T) {
+	cases := map[string]string{
+		"*bold* and _italic_":                  "bold and italic",
+		"~gone~ `code`":                        "gone code",
+		"<https://example.com>":                "https://example.com",
+		"<https://example.com|label>":          "label",
+		"<mailto:a@example.com|a@example.com>": "a@example.com",
+		"<@U123> in <#C123|general>":           "<@U123> in <#C123|general>",
+		"snake_case_name stays":                "snake_case_name stays",
+		"unbalanced * asterisk":                "unbalanced * asterisk",
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, StripMarkdown(in), in)
+	}
+}
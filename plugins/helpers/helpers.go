@@ -62,6 +62,7 @@ var channelTypes = []string{"public_channel", "private_channel"}
 // FindChannelByName searches all conversations for a channel whose
 // NameNormalized matches name, handling pagination internally.
 // Returns the matching channel or an error if not found or if any API call fails.
+// Handlers should prefer ctx.Directory.ChannelByName, which caches channels.
 func FindChannelByName(api slack.Client, name string) (slack.Channel, error) {
 	params := &slack.GetConversationsParameters{Types: channelTypes, ExcludeArchived: true}
 	for {
@@ -0,0 +1,190 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+)
+
+// The action IDs of the paginator's buttons, handled by GetBlockActionRoutes
+const (
+	PagePrevActionID = "helpers.pagePrev"
+	PageNextActionID = "helpers.pageNext"
+)
+
+// DefaultPageSize is the number of items on a page when List.PageSize is 0
+const DefaultPageSize = 20
+
+// PagedListTTL is how long the buttons on a paginated list keep working
+const PagedListTTL = 24 * time.Hour
+
+// List is a list of mrkdwn items, one per line, that Paginate shows a page
+// at a time.
+type List struct {
+	Title    string // optional; shown above every page
+	Items    []string
+	PageSize int    // 0 uses DefaultPageSize
+	Empty    string // shown instead of a page when there are no items
+}
+
+func (l List) pageSize() int {
+	if l.PageSize <= 0 {
+		return DefaultPageSize
+	}
+	return l.PageSize
+}
+
+// Paginate posts list to channel. A list that fits on one page is posted as
+// is; longer lists are saved and posted with Previous and Next buttons that
+// edit the message in place. options are added to the first page, e.g. to
+// post it in a thread.
+func Paginate(ctx router.HandlerContext, channel string, list List, options ...slack.MsgOption) error {
+	pageSize := list.pageSize()
+	if len(list.Items) <= pageSize {
+		return postPage(ctx, channel, renderPage(0, list.Title, list.Items, 0, pageSize, list.Empty), options)
+	}
+
+	items, err := json.Marshal(list.Items)
+	if err != nil {
+		return fmt.Errorf("encode list items: %w", err)
+	}
+	now := time.Now()
+	stored := models.PagedList{TeamID: ctx.Router.TeamID, Title: list.Title, Items: string(items), PageSize: pageSize, ExpiresAt: now.Add(PagedListTTL)}
+	db := ctx.Router.DbConnection
+	if err := db.Unscoped().Where("expires_at <= ?", now).Delete(&models.PagedList{}).Error; err != nil {
+		ctx.Logger.Warn().Err(err).Str("plugin", ctx.Route.Name).Msg("Failed to delete expired paged lists")
+	}
+	if err := db.Create(&stored).Error; err != nil {
+		ctx.Logger.Error().Err(err).Str("plugin", ctx.Route.Name).Msg("Failed to save paged list")
+		return err
+	}
+
+	return postPage(ctx, channel, renderPage(stored.ID, list.Title, list.Items, 0, pageSize, list.Empty), options)
+}
+
+// requestContext returns the context Slack API calls made for ctx run with
+func requestContext(ctx router.HandlerContext) context.Context {
+	if ctx.Context == nil {
+		return context.Background()
+	}
+	return ctx.Context
+}
+
+func postPage(ctx router.HandlerContext, channel string, msg Message, options []slack.MsgOption) error {
+	opts := append([]slack.MsgOption{msg.MsgOption()}, options...)
+	if _, _, err := ctx.BotClient.PostMessageContext(requestContext(ctx), channel, opts...); err != nil {
+		ctx.Logger.Error().Err(err).Str("channel", channel).Str("plugin", ctx.Route.Name).Msg("Failed to post message")
+		return err
+	}
+	return nil
+}
+
+// renderPage renders page (counting from 0) of items. Lists that haven't
+// been saved, with an id of 0, get no buttons.
+func renderPage(id uint, title string, items []string, page, pageSize int, empty string) Message {
+	builder := NewMessage()
+	if title != "" {
+		builder.Section(title)
+	}
+	if len(items) == 0 {
+		if empty != "" {
+			builder.Section(empty)
+		}
+		return builder.Build()
+	}
+
+	pages := (len(items) + pageSize - 1) / pageSize
+	page = max(0, min(page, pages-1))
+	start := page * pageSize
+	end := min(start+pageSize, len(items))
+	for _, text := range SplitText(strings.Join(items[start:end], "\n"), MaxSectionTextLength) {
+		builder.Section(text)
+	}
+	if id == 0 || pages == 1 {
+		return builder.Build()
+	}
+
+	builder.Context(fmt.Sprintf("Page %d of %d · %d items", page+1, pages, len(items)))
+	var buttons []Button
+	if page > 0 {
+		buttons = append(buttons, Button{Text: "Previous", ActionID: PagePrevActionID, Value: pageValue(id, page-1)})
+	}
+	if page < pages-1 {
+		buttons = append(buttons, Button{Text: "Next", ActionID: PageNextActionID, Value: pageValue(id, page+1)})
+	}
+	return builder.Buttons(buttons...).Build()
+}
+
+// pageValue is a paginator button's value: the list's ID and the page it
+// shows, e.g. "12:3"
+func pageValue(id uint, page int) string {
+	return fmt.Sprintf("%d:%d", id, page)
+}
+
+func parsePageValue(value string) (uint, int, error) {
+	idText, pageText, found := strings.Cut(value, ":")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid page value: %q", value)
+	}
+	id, err := strconv.ParseUint(idText, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid page value: %q", value)
+	}
+	page, err := strconv.Atoi(pageText)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid page value: %q", value)
+	}
+	return uint(id), page, nil
+}
+
+func turnPage() func(ctx router.HandlerContext, callback slack.InteractionCallback, action slack.BlockAction) {
+	return func(ctx router.HandlerContext, callback slack.InteractionCallback, action slack.BlockAction) {
+		id, page, err := parsePageValue(action.Value)
+		if err != nil {
+			ctx.Logger.Warn().Err(err).Str("plugin", ctx.Route.Name).Msg("Ignoring page button")
+			return
+		}
+
+		// Lists are only found in the workspace they were posted in, so a
+		// button value from one workspace can't show another's list
+		var list models.PagedList
+		err = ctx.Router.DbConnection.Where("id = ? AND team_id = ?", id, ctx.Router.TeamID).First(&list).Error
+		if err != nil || list.Expired(time.Now()) {
+			_ = ctx.ReplyEphemeral("That list has expired. Ask me for it again to see the latest.")
+			return
+		}
+		items, err := list.DecodeItems()
+		if err != nil {
+			ctx.Logger.Error().Err(err).Str("plugin", ctx.Route.Name).Uint("list", id).Msg("Failed to decode paged list")
+			return
+		}
+
+		msg := renderPage(list.ID, list.Title, items, page, list.PageSize, "")
+		if _, _, _, err := ctx.BotClient.UpdateMessageContext(requestContext(ctx), ctx.Origin.Channel, ctx.Origin.TimeStamp, msg.MsgOption()); err != nil {
+			ctx.Logger.Error().Err(err).Str("channel", ctx.Origin.Channel).Str("plugin", ctx.Route.Name).Msg("Failed to update page")
+		}
+	}
+}
+
+// GetBlockActionRoutes returns the routes for the paginator's buttons
+func GetBlockActionRoutes() []router.BlockActionRoute {
+	var prev, next router.BlockActionRoute
+	prev.Name = "helpers.pagePrev"
+	prev.ActionID = PagePrevActionID
+	prev.Description = "Shows the previous page of a list"
+	prev.Plugin = turnPage()
+
+	next.Name = "helpers.pageNext"
+	next.ActionID = PageNextActionID
+	next.Description = "Shows the next page of a list"
+	next.Plugin = turnPage()
+
+	return []router.BlockActionRoute{prev, next}
+}
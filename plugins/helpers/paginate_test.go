@@ -0,0 +1,206 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/rs/zerolog"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type postedPage struct {
+	path   string
+	text   string
+	ts     string
+	blocks []map[string]interface{}
+}
+
+// newPaginateTestContext returns a HandlerContext backed by an in-memory
+// database whose Slack API calls are appended to posted
+func newPaginateTestContext(t *testing.T, posted *[]postedPage) router.HandlerContext {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.PagedList{}))
+
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		page := postedPage{path: r.URL.Path, text: r.FormValue("text"), ts: r.FormValue("ts")}
+		_ = json.Unmarshal([]byte(r.FormValue("blocks")), &page.blocks)
+		mu.Lock()
+		*posted = append(*posted, page)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1000.0001"}`)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	t.Cleanup(server.Close)
+
+	return router.HandlerContext{
+		Router:    router.Router{DbConnection: db},
+		Route:     router.Route{Name: "test.list"},
+		BotClient: slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/")),
+		Logger:    zerolog.Nop(),
+	}
+}
+
+func items(n int) []string {
+	var list []string
+	for i := 1; i <= n; i++ {
+		list = append(list, fmt.Sprintf("item %d", i))
+	}
+	return list
+}
+
+// actionValues returns the value of each button in blocks, keyed by action ID
+func actionValues(blocks []map[string]interface{}) map[string]string {
+	values := map[string]string{}
+	for _, block := range blocks {
+		if block["type"] != "actions" {
+			continue
+		}
+		for _, element := range block["elements"].([]interface{}) {
+			button := element.(map[string]interface{})
+			values[button["action_id"].(string)] = button["value"].(string)
+		}
+	}
+	return values
+}
+
+func TestPaginate_SinglePage(t *testing.T) {
+	var posted []postedPage
+	ctx := newPaginateTestContext(t, &posted)
+
+	require.NoError(t, Paginate(ctx, "C123", List{Title: "Groups", Items: items(3)}))
+
+	require.Len(t, posted, 1)
+	assert.Equal(t, "Groups\nitem 1\nitem 2\nitem 3", posted[0].text)
+	assert.Empty(t, actionValues(posted[0].blocks))
+
+	var count int64
+	ctx.Router.DbConnection.Model(&models.PagedList{}).Count(&count)
+	assert.Zero(t, count, "lists that fit on one page aren't saved")
+}
+
+func TestPaginate_Empty(t *testing.T) {
+	var posted []postedPage
+	ctx := newPaginateTestContext(t, &posted)
+
+	require.NoError(t, Paginate(ctx, "C123", List{Empty: "Nothing here."}))
+
+	require.Len(t, posted, 1)
+	assert.Equal(t, "Nothing here.", posted[0].text)
+}
+
+func TestPaginate_MultiplePages(t *testing.T) {
+	var posted []postedPage
+	ctx := newPaginateTestContext(t, &posted)
+
+	require.NoError(t, Paginate(ctx, "C123", List{Items: items(45)}))
+
+	require.Len(t, posted, 1)
+	assert.Contains(t, posted[0].text, "item 20")
+	assert.NotContains(t, posted[0].text, "item 21")
+	assert.Contains(t, posted[0].text, "Page 1 of 3 · 45 items")
+
+	var stored models.PagedList
+	require.NoError(t, ctx.Router.DbConnection.First(&stored).Error)
+	assert.Equal(t, DefaultPageSize, stored.PageSize)
+	assert.Equal(t, map[string]string{PageNextActionID: fmt.Sprintf("%d:1", stored.ID)}, actionValues(posted[0].blocks))
+}
+
+func TestPaginate_TurnPage(t *testing.T) {
+	var posted []postedPage
+	ctx := newPaginateTestContext(t, &posted)
+	require.NoError(t, Paginate(ctx, "C123", List{Items: items(25), PageSize: 10}))
+	next := actionValues(posted[0].blocks)[PageNextActionID]
+
+	routes := GetBlockActionRoutes()
+	require.Len(t, routes, 2)
+	ctx = ctx.WithOrigin(router.Origin{Channel: "C123", TimeStamp: "1000.0001", User: "U1"})
+	routes[1].Execute(ctx, slack.InteractionCallback{}, slack.BlockAction{ActionID: PageNextActionID, Value: next})
+
+	require.Len(t, posted, 2)
+	assert.Equal(t, "/chat.update", posted[1].path)
+	assert.Equal(t, "1000.0001", posted[1].ts)
+	assert.Contains(t, posted[1].text, "item 11")
+	assert.NotContains(t, posted[1].text, "item 21")
+	assert.Contains(t, posted[1].text, "Page 2 of 3")
+	buttons := actionValues(posted[1].blocks)
+	assert.Len(t, buttons, 2)
+	assert.Contains(t, buttons, PagePrevActionID)
+	assert.Contains(t, buttons, PageNextActionID)
+}
+
+func TestPaginate_TurnPageExpired(t *testing.T) {
+	var posted []postedPage
+	ctx := newPaginateTestContext(t, &posted)
+	list := models.PagedList{Items: `["a","b"]`, PageSize: 1, ExpiresAt: time.Now().Add(-time.Minute)}
+	require.NoError(t, ctx.Router.DbConnection.Create(&list).Error)
+
+	ctx = ctx.WithOrigin(router.Origin{Channel: "C123", TimeStamp: "1000.0001", User: "U1"})
+	GetBlockActionRoutes()[1].Execute(ctx, slack.InteractionCallback{}, slack.BlockAction{Value: pageValue(list.ID, 1)})
+
+	require.Len(t, posted, 1)
+	assert.Equal(t, "/chat.postEphemeral", posted[0].path)
+	assert.Contains(t, posted[0].text, "expired")
+}
+
+func TestPaginate_TurnPageOnlyInItsWorkspace(t *testing.T) {
+	var posted []postedPage
+	ctx := newPaginateTestContext(t, &posted)
+	ctx.Router.TeamID = "T_TENANT"
+	require.NoError(t, Paginate(ctx, "C123", List{Items: items(25), PageSize: 10}))
+	next := actionValues(posted[0].blocks)[PageNextActionID]
+
+	ctx.Router.TeamID = "T_OTHER"
+	ctx = ctx.WithOrigin(router.Origin{Channel: "C123", TimeStamp: "1000.0001", User: "U1"})
+	GetBlockActionRoutes()[1].Execute(ctx, slack.InteractionCallback{}, slack.BlockAction{Value: next})
+
+	require.Len(t, posted, 2)
+	assert.Equal(t, "/chat.postEphemeral", posted[1].path, "another workspace can't page through the list")
+}
+
+func TestPaginate_DeletesExpiredLists(t *testing.T) {
+	var posted []postedPage
+	ctx := newPaginateTestContext(t, &posted)
+	require.NoError(t, ctx.Router.DbConnection.Create(&models.PagedList{ExpiresAt: time.Now().Add(-time.Minute)}).Error)
+
+	require.NoError(t, Paginate(ctx, "C123", List{Items: items(3), PageSize: 1}))
+
+	var count int64
+	ctx.Router.DbConnection.Unscoped().Model(&models.PagedList{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestRenderPage_ClampsPage(t *testing.T) {
+	msg := renderPage(1, "", items(5), 9, 2, "")
+	assert.Contains(t, msg.Text, "item 5")
+	assert.Contains(t, msg.Text, "Page 3 of 3")
+}
+
+func TestParsePageValue(t *testing.T) {
+	id, page, err := parsePageValue("12:3")
+	require.NoError(t, err)
+	assert.Equal(t, uint(12), id)
+	assert.Equal(t, 3, page)
+
+	for _, value := range []string{"", "12", "x:1", "1:x"} {
+		_, _, err := parsePageValue(value)
+		assert.Error(t, err, value)
+	}
+}
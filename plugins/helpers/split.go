@@ -0,0 +1,163 @@
+package helpers
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/slack-go/slack"
+)
+
+// Slack's limits on message size. Longer content is rejected or truncated.
+const (
+	MaxMessageTextLength = 4000 // recommended maximum for a message's text
+	MaxSectionTextLength = 3000 // maximum text of a section block
+	MaxMessageBlocks     = 50   // maximum blocks in a message
+)
+
+// SplitMode controls where the parts of a split message are posted
+type SplitMode int
+
+const (
+	// SplitInline posts every part to the channel, one after another
+	SplitInline SplitMode = iota
+	// SplitThread posts the first part to the channel and the rest as
+	// replies to it
+	SplitThread
+)
+
+const codeFence = "```"
+
+// SplitText splits text into parts of at most limit bytes, which is never
+// fewer than the characters Slack counts. Parts end at paragraph breaks,
+// line breaks or spaces where possible. A code block that spans parts is
+// closed at the end of one part and reopened at the start of the next. A
+// limit of 0 uses MaxMessageTextLength.
+func SplitText(text string, limit int) []string {
+	if limit <= 0 {
+		limit = MaxMessageTextLength
+	}
+	// leave room to close and reopen a code block in every part
+	fenceOverhead := 2 * len(codeFence+"\n")
+	fenced := strings.Contains(text, codeFence) && limit > 2*fenceOverhead
+	if fenced {
+		limit -= fenceOverhead
+	}
+
+	var parts []string
+	inCode := false
+	for text != "" {
+		end, next := splitPoint(text, limit)
+		part := text[:end]
+		text = text[next:]
+
+		reopen := inCode
+		if fenced && strings.Count(part, codeFence)%2 == 1 {
+			inCode = !inCode
+		}
+		if reopen {
+			part = codeFence + "\n" + part
+		}
+		if inCode && text != "" {
+			part += "\n" + codeFence
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// splitPoint returns where the first part of text ends, and where the rest
+// begins after any whitespace at the break.
+func splitPoint(text string, limit int) (end, next int) {
+	if len(text) <= limit {
+		return len(text), len(text)
+	}
+	window := text[:limit+1]
+	for _, sep := range []string{"\n\n", "\n", " "} {
+		if i := strings.LastIndex(window, sep); i > 0 {
+			return i, i + len(sep)
+		}
+	}
+	// no whitespace to break at, so cut between characters
+	end = limit
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return end, end
+}
+
+// SplitMessage splits msg into messages that fit Slack's limits. Long
+// section text is split across several sections, which are then grouped
+// MaxMessageBlocks to a message. Messages without blocks have their text
+// split instead.
+func SplitMessage(msg Message) []Message {
+	if len(msg.Blocks) == 0 {
+		var messages []Message
+		for _, text := range SplitText(msg.Text, MaxMessageTextLength) {
+			messages = append(messages, Message{Text: text})
+		}
+		return messages
+	}
+
+	var blocks []slack.Block
+	for _, block := range msg.Blocks {
+		section, ok := block.(*slack.SectionBlock)
+		if !ok || section.Text == nil || len(section.Text.Text) <= MaxSectionTextLength {
+			blocks = append(blocks, block)
+			continue
+		}
+		for i, text := range SplitText(section.Text.Text, MaxSectionTextLength) {
+			if i == 0 {
+				// the first part keeps the section's fields and accessory
+				first := *section
+				textObject := *section.Text
+				textObject.Text = text
+				first.Text = &textObject
+				blocks = append(blocks, &first)
+				continue
+			}
+			blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(section.Text.Type, text, false, false), nil, nil))
+		}
+	}
+
+	var messages []Message
+	for len(blocks) > 0 {
+		n := min(len(blocks), MaxMessageBlocks)
+		messages = append(messages, Message{Blocks: blocks[:n], Text: truncate(FallbackText(blocks[:n]), MaxMessageTextLength)})
+		blocks = blocks[n:]
+	}
+	return messages
+}
+
+// truncate shortens text to at most limit bytes, marking the cut with an ellipsis
+func truncate(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	const ellipsis = "…"
+	end, _ := splitPoint(text, limit-len(ellipsis))
+	return text[:end] + ellipsis
+}
+
+// PostSplitMessage posts msg to channel, split into as many messages as it
+// needs, and returns the timestamps of the messages posted. When threadTS is
+// set every part is posted to that thread; otherwise mode decides whether the
+// parts after the first are threaded under it. Errors are logged like
+// PostMessage and stop any remaining parts from being posted.
+func PostSplitMessage(api slack.Client, channel, threadTS, plugin string, msg Message, mode SplitMode, options ...slack.MsgOption) []string {
+	var timestamps []string
+	for _, part := range SplitMessage(msg) {
+		opts := append([]slack.MsgOption{part.MsgOption()}, options...)
+		switch {
+		case threadTS != "":
+			opts = append(opts, slack.MsgOptionTS(threadTS))
+		case mode == SplitThread && len(timestamps) > 0:
+			opts = append(opts, slack.MsgOptionTS(timestamps[0]))
+		}
+		_, ts := PostMessage(api, channel, plugin, opts...)
+		if ts == "" {
+			break
+		}
+		timestamps = append(timestamps, ts)
+	}
+	return timestamps
+}
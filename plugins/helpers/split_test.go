@@ -0,0 +1,123 @@
+package helpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitText_Short(t *testing.T) {
+	assert.Equal(t, []string{"hello"}, SplitText("hello", 10))
+	assert.Empty(t, SplitText("", 10))
+}
+
+func TestSplitText_PrefersParagraphsThenLines(t *testing.T) {
+	assert.Equal(t, []string{"first paragraph", "second\nthird"}, SplitText("first paragraph\n\nsecond\nthird", 20))
+	assert.Equal(t, []string{"aaa\nbbb", "ccc"}, SplitText("aaa\nbbb\nccc", 8))
+}
+
+func TestSplitText_BreaksOnSpaces(t *testing.T) {
+	assert.Equal(t, []string{"one two", "three"}, SplitText("one two three", 9))
+}
+
+func TestSplitText_CutsLongWordsOnRuneBoundaries(t *testing.T) {
+	parts := SplitText(strings.Repeat("é", 5), 3)
+
+	assert.Equal(t, []string{"é", "é", "é", "é", "é"}, parts)
+}
+
+func TestSplitText_RespectsLimit(t *testing.T) {
+	text := strings.Repeat("lorem ipsum dolor sit amet\n", 500)
+	parts := SplitText(text, 1000)
+
+	require.Greater(t, len(parts), 1)
+	for _, part := range parts {
+		assert.LessOrEqual(t, len(part), 1000)
+	}
+	assert.True(t, text == strings.Join(parts, "\n"), "only the line breaks between parts should be dropped")
+}
+
+func TestSplitText_ReopensCodeBlocks(t *testing.T) {
+	text := "```\n" + strings.Repeat("line\n", 20) + "```\nafter"
+	parts := SplitText(text, 50)
+
+	require.Greater(t, len(parts), 1)
+	for _, part := range parts {
+		assert.LessOrEqual(t, len(part), 50)
+		assert.Equal(t, 0, strings.Count(part, "```")%2, "code fences should be balanced in %q", part)
+	}
+	assert.True(t, strings.HasSuffix(parts[len(parts)-1], "after"))
+}
+
+func TestSplitMessage_TextOnly(t *testing.T) {
+	messages := SplitMessage(Message{Text: strings.Repeat("word ", 2000)})
+
+	require.Len(t, messages, 3)
+	for _, msg := range messages {
+		assert.Empty(t, msg.Blocks)
+		assert.LessOrEqual(t, len(msg.Text), MaxMessageTextLength)
+	}
+}
+
+func TestSplitMessage_LongSection(t *testing.T) {
+	msg := NewMessage().Header("Groups").Section(strings.Repeat("• group\n", 1000)).Build()
+	messages := SplitMessage(msg)
+
+	require.Len(t, messages, 1)
+	blocks := messages[0].Blocks
+	require.Len(t, blocks, 5)
+	assert.Equal(t, slack.MBTHeader, blocks[0].BlockType())
+	for _, block := range blocks[1:] {
+		assert.LessOrEqual(t, len(block.(*slack.SectionBlock).Text.Text), MaxSectionTextLength)
+	}
+	assert.LessOrEqual(t, len(messages[0].Text), MaxMessageTextLength)
+	// the original message isn't modified
+	assert.Greater(t, len(msg.Blocks[1].(*slack.SectionBlock).Text.Text), MaxSectionTextLength)
+}
+
+func TestSplitMessage_ManyBlocks(t *testing.T) {
+	builder := NewMessage()
+	for i := 0; i < 120; i++ {
+		builder.Divider()
+	}
+	messages := SplitMessage(builder.Build())
+
+	require.Len(t, messages, 3)
+	assert.Len(t, messages[0].Blocks, MaxMessageBlocks)
+	assert.Len(t, messages[2].Blocks, 20)
+}
+
+func TestPostSplitMessage(t *testing.T) {
+	var mu sync.Mutex
+	var threads []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		mu.Lock()
+		threads = append(threads, r.FormValue("thread_ts"))
+		ts := []string{"1.1", "1.2", "1.3", "1.4", "1.5", "1.6"}[len(threads)-1]
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"` + ts + `"}`)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	defer server.Close()
+	api := slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+	msg := Message{Text: strings.Repeat("word ", 1000)}
+
+	timestamps := PostSplitMessage(*api, "C123", "", "test", msg, SplitThread)
+	assert.Equal(t, []string{"1.1", "1.2"}, timestamps)
+	assert.Equal(t, []string{"", "1.1"}, threads)
+
+	threads = nil
+	PostSplitMessage(*api, "C123", "", "test", msg, SplitInline)
+	assert.Equal(t, []string{"", ""}, threads)
+
+	threads = nil
+	PostSplitMessage(*api, "C123", "9.9", "test", msg, SplitThread)
+	assert.Equal(t, []string{"9.9", "9.9"}, threads)
+}
@@ -0,0 +1,93 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/slack-go/slack"
+)
+
+var (
+	templatesMu sync.RWMutex
+	templates   = map[string]*template.Template{}
+)
+
+// templateFuncs are available to message templates in addition to the
+// text/template builtins
+var templateFuncs = template.FuncMap{
+	// json encodes a value, including the surrounding quotes for strings, so
+	// data can't break out of the template's JSON
+	"json": func(v interface{}) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+	// escape escapes the characters mrkdwn treats as control sequences
+	"escape": EscapeText,
+}
+
+// EscapeText escapes &, < and > so that user supplied text is shown as-is
+// rather than being interpreted as mrkdwn links or mentions.
+func EscapeText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// RegisterTemplate parses text as a message template stored under name.
+// Templates use text/template syntax and must render a JSON array of Block Kit
+// blocks, or an object with a "blocks" array. Use the json function to embed
+// data, e.g.
+//
+//	[{"type": "section", "text": {"type": "mrkdwn", "text": {{json (printf "*%s* deployed" .Service)}}}}]
+//
+// Registering a name again replaces the previous template.
+func RegisterTemplate(name, text string) error {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return fmt.Errorf("parse template %s: %w", name, err)
+	}
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	templates[name] = tmpl
+	return nil
+}
+
+// MustRegisterTemplate is like RegisterTemplate but panics if text can't be parsed
+func MustRegisterTemplate(name, text string) {
+	if err := RegisterTemplate(name, text); err != nil {
+		panic(err)
+	}
+}
+
+// RenderTemplate renders the named template with data into a Message with a
+// generated plain-text fallback.
+func RenderTemplate(name string, data interface{}) (Message, error) {
+	templatesMu.RLock()
+	tmpl, exists := templates[name]
+	templatesMu.RUnlock()
+	if !exists {
+		return Message{}, fmt.Errorf("unknown template: %s", name)
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return Message{}, fmt.Errorf("render template %s: %w", name, err)
+	}
+
+	var blocks slack.Blocks
+	raw := bytes.TrimSpace(rendered.Bytes())
+	if bytes.HasPrefix(raw, []byte("[")) {
+		raw = append(append([]byte(`{"blocks":`), raw...), '}')
+	}
+	var wrapper struct {
+		Blocks *slack.Blocks `json:"blocks"`
+	}
+	wrapper.Blocks = &blocks
+	if err := json.Unmarshal(raw, &wrapper); err != nil {
+		return Message{}, fmt.Errorf("decode blocks from template %s: %w", name, err)
+	}
+
+	return Message{Blocks: blocks.BlockSet, Text: FallbackText(blocks.BlockSet)}, nil
+}
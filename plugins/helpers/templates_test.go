@@ -0,0 +1,76 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplate_Array(t *testing.T) {
+	MustRegisterTemplate("test.array", `[
+		{"type": "header", "text": {"type": "plain_text", "text": {{json .Title}}}},
+		{"type": "section", "text": {"type": "mrkdwn", "text": {{json (printf "*%s* deployed" .Service)}}}}
+	]`)
+
+	msg, err := RenderTemplate("test.array", map[string]string{"Title": "Deploys", "Service": "api"})
+	require.NoError(t, err)
+
+	require.Len(t, msg.Blocks, 2)
+	assert.Equal(t, slack.MBTHeader, msg.Blocks[0].BlockType())
+	assert.Equal(t, slack.MBTSection, msg.Blocks[1].BlockType())
+	assert.Equal(t, "Deploys\napi deployed", msg.Text)
+}
+
+func TestRenderTemplate_Object(t *testing.T) {
+	MustRegisterTemplate("test.object", `{"blocks": [
+		{"type": "section", "text": {"type": "mrkdwn", "text": {{json .}}}},
+		{"type": "divider"}
+	]}`)
+
+	msg, err := RenderTemplate("test.object", "hello")
+	require.NoError(t, err)
+
+	require.Len(t, msg.Blocks, 2)
+	assert.Equal(t, slack.MBTDivider, msg.Blocks[1].BlockType())
+	assert.Equal(t, "hello", msg.Text)
+}
+
+func TestRenderTemplate_JSONEscapesData(t *testing.T) {
+	MustRegisterTemplate("test.quotes", `[{"type": "section", "text": {"type": "mrkdwn", "text": {{json (escape .)}}}}]`)
+
+	msg, err := RenderTemplate("test.quotes", `say "hi" <!channel>`)
+	require.NoError(t, err)
+
+	section := msg.Blocks[0].(*slack.SectionBlock)
+	assert.Equal(t, `say "hi" &lt;!channel&gt;`, section.Text.Text)
+}
+
+func TestRenderTemplate_Unknown(t *testing.T) {
+	_, err := RenderTemplate("test.missing", nil)
+	assert.ErrorContains(t, err, "unknown template")
+}
+
+func TestRenderTemplate_MissingKey(t *testing.T) {
+	MustRegisterTemplate("test.missingKey", `[{"type": "section", "text": {"type": "mrkdwn", "text": {{json .Nope}}}}]`)
+
+	_, err := RenderTemplate("test.missingKey", map[string]string{})
+	assert.ErrorContains(t, err, "render template")
+}
+
+func TestRenderTemplate_InvalidJSON(t *testing.T) {
+	MustRegisterTemplate("test.invalid", `[{"type": "section",`)
+
+	_, err := RenderTemplate("test.invalid", nil)
+	assert.ErrorContains(t, err, "decode blocks")
+}
+
+func TestRegisterTemplate_ParseError(t *testing.T) {
+	assert.Error(t, RegisterTemplate("test.broken", `{{json .`))
+	assert.Panics(t, func() { MustRegisterTemplate("test.broken", `{{json .`) })
+}
+
+func TestEscapeText(t *testing.T) {
+	assert.Equal(t, "a &amp; b &lt;@U1&gt;", EscapeText("a & b <@U1>"))
+}
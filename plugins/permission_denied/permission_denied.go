@@ -1,6 +1,7 @@
 package permission_denied
 
 import (
+	"github.com/gadget-bot/gadget/adapter"
 	"github.com/gadget-bot/gadget/plugins/helpers"
 	"github.com/gadget-bot/gadget/router"
 	"github.com/rs/zerolog/log"
@@ -48,3 +49,19 @@ func GetSlashCommandRoute() *router.SlashCommandRoute {
 	}
 	return &pluginRoute
 }
+
+func GetMessageRoute() *router.MessageRoute {
+	var pluginRoute router.MessageRoute
+	pluginRoute.Permissions = append(pluginRoute.Permissions, "*")
+	pluginRoute.Name = "permission_denied"
+	pluginRoute.Plugin = func(ctx router.HandlerContext, msg adapter.Message) {
+		log.Warn().Str("platform", msg.Platform).Str("user", msg.User).Str("channel", msg.Channel).Msg("Message permission denied")
+		if err := ctx.Adapter.React(msg.Channel, msg.ID, "astonished"); err != nil {
+			ctx.Logger.Error().Err(err).Str("channel", msg.Channel).Msg("Failed to add permission_denied reaction")
+		}
+		if err := adapter.Reply(ctx.Adapter, msg, "I'm sorry, but you're not allowed to do that."); err != nil {
+			ctx.Logger.Error().Err(err).Str("channel", msg.Channel).Msg("Failed to post permission_denied reply")
+		}
+	}
+	return &pluginRoute
+}
@@ -5,6 +5,8 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/gadget-bot/gadget/adapter/slackadapter"
 	"github.com/gadget-bot/gadget/router"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
@@ -136,3 +138,40 @@ func TestChannelMessagePlugin_AddsReactionAndPostsMessage(t *testing.T) {
 	assert.Contains(t, postedMessage, "U_USER")
 	assert.Contains(t, postedMessage, "not allowed")
 }
+
+func TestMessagePlugin_AddsReactionAndReplies(t *testing.T) {
+	var postedMessage, postedThread, addedReaction string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm failed: %v", err)
+		}
+		switch r.URL.Path {
+		case "/reactions.add":
+			addedReaction = r.FormValue("name")
+		case "/chat.postMessage":
+			postedMessage = r.FormValue("text")
+			postedThread = r.FormValue("thread_ts")
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1234567890.123457"}`)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	defer server.Close()
+
+	api := slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+
+	route := GetMessageRoute()
+	ctx := router.HandlerContext{Route: route.Route, Adapter: slackadapter.New(api, "U_BOT")}
+	route.Plugin(ctx, adapter.Message{
+		Platform: "slack",
+		ID:       "1234567890.123456",
+		ThreadID: "1234567890.000001",
+		User:     "U_USER",
+		Channel:  "C123",
+		Text:     "restricted command",
+	})
+
+	assert.Equal(t, "permission_denied", route.Name)
+	assert.Equal(t, "astonished", addedReaction)
+	assert.Contains(t, postedMessage, "not allowed")
+	assert.Equal(t, "1234567890.000001", postedThread)
+}
@@ -0,0 +1,61 @@
+package rate_limited
+
+import (
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/gadget-bot/gadget/plugins/helpers"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/rs/zerolog/log"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+func GetMentionRoute() *router.MentionRoute {
+	var pluginRoute router.MentionRoute
+	pluginRoute.Permissions = append(pluginRoute.Permissions, "*")
+	pluginRoute.Name = "rate_limited"
+	pluginRoute.Plugin = func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+		// Only react, so someone spamming Gadget doesn't get a message back
+		// for every message they send.
+		log.Warn().Str("user", ev.User).Str("channel", ev.Channel).Msg("Mention rate limited")
+		helpers.AddReaction(*ctx.BotClient, ev.Channel, "rate_limited", "hourglass_flowing_sand", ev.TimeStamp)
+	}
+	return &pluginRoute
+}
+
+func GetChannelMessageRoute() *router.ChannelMessageRoute {
+	var pluginRoute router.ChannelMessageRoute
+	pluginRoute.Permissions = append(pluginRoute.Permissions, "*")
+	pluginRoute.Name = "rate_limited"
+	pluginRoute.Plugin = func(ctx router.HandlerContext, ev slackevents.MessageEvent, message string) {
+		// Channel messages aren't addressed to Gadget, so a reaction is enough
+		// of a hint without adding noise to the channel.
+		log.Warn().Str("user", ev.User).Str("channel", ev.Channel).Msg("Channel message rate limited")
+		helpers.AddReaction(*ctx.BotClient, ev.Channel, "rate_limited", "hourglass_flowing_sand", ev.TimeStamp)
+	}
+	return &pluginRoute
+}
+
+func GetSlashCommandRoute() *router.SlashCommandRoute {
+	var pluginRoute router.SlashCommandRoute
+	pluginRoute.Permissions = append(pluginRoute.Permissions, "*")
+	pluginRoute.Name = "rate_limited"
+	pluginRoute.Plugin = func(ctx router.HandlerContext, cmd slack.SlashCommand) {
+		log.Warn().Str("user", cmd.UserID).Str("command", cmd.Command).Msg("Slash command rate limited")
+	}
+	return &pluginRoute
+}
+
+func GetMessageRoute() *router.MessageRoute {
+	var pluginRoute router.MessageRoute
+	pluginRoute.Permissions = append(pluginRoute.Permissions, "*")
+	pluginRoute.Name = "rate_limited"
+	pluginRoute.Plugin = func(ctx router.HandlerContext, msg adapter.Message) {
+		log.Warn().Str("platform", msg.Platform).Str("user", msg.User).Str("channel", msg.Channel).Msg("Message rate limited")
+		// Like mentions, only react rather than answering every message
+		if err := ctx.Adapter.React(msg.Channel, msg.ID, "hourglass_flowing_sand"); err != nil {
+			ctx.Logger.Error().Err(err).Str("channel", msg.Channel).Msg("Failed to add rate_limited reaction")
+		}
+	}
+	return &pluginRoute
+}
@@ -0,0 +1,93 @@
+package rate_limited
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/gadget-bot/gadget/adapter/slackadapter"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMentionRoute_Metadata(t *testing.T) {
+	route := GetMentionRoute()
+
+	assert.Equal(t, "rate_limited", route.Name)
+	assert.Empty(t, route.Pattern)
+	assert.Equal(t, []string{"*"}, route.Permissions)
+	assert.NotNil(t, route.Plugin)
+}
+
+func TestGetChannelMessageRoute_Metadata(t *testing.T) {
+	route := GetChannelMessageRoute()
+
+	assert.Equal(t, "rate_limited", route.Name)
+	assert.Empty(t, route.Pattern)
+	assert.NotNil(t, route.Plugin)
+}
+
+func TestGetSlashCommandRoute_Metadata(t *testing.T) {
+	route := GetSlashCommandRoute()
+
+	assert.Equal(t, "rate_limited", route.Name)
+	assert.Empty(t, route.Pattern)
+	assert.NotNil(t, route.Plugin)
+}
+
+func newRecordingAPI(t *testing.T, reaction, message *string) *slack.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm failed: %v", err)
+		}
+		switch r.URL.Path {
+		case "/reactions.add":
+			*reaction = r.FormValue("name")
+		case "/chat.postMessage":
+			*message = r.FormValue("text")
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1234567890.123456"}`)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	t.Cleanup(server.Close)
+	return slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+}
+
+func TestMentionPlugin_OnlyReacts(t *testing.T) {
+	var reaction, message string
+	api := newRecordingAPI(t, &reaction, &message)
+
+	route := GetMentionRoute()
+	route.Plugin(router.HandlerContext{BotClient: api}, slackevents.AppMentionEvent{User: "U_USER", Channel: "C123", TimeStamp: "1.2"}, "deploy")
+
+	assert.Equal(t, "hourglass_flowing_sand", reaction)
+	assert.Empty(t, message, "a reply to every limited mention would reward spam")
+}
+
+func TestChannelMessagePlugin_OnlyReacts(t *testing.T) {
+	var reaction, message string
+	api := newRecordingAPI(t, &reaction, &message)
+
+	route := GetChannelMessageRoute()
+	route.Plugin(router.HandlerContext{BotClient: api}, slackevents.MessageEvent{User: "U_USER", Channel: "C123", TimeStamp: "1.2"}, "deploy")
+
+	assert.Equal(t, "hourglass_flowing_sand", reaction)
+	assert.Empty(t, message)
+}
+
+func TestMessagePlugin_OnlyReacts(t *testing.T) {
+	var reaction, message string
+	api := newRecordingAPI(t, &reaction, &message)
+
+	route := GetMessageRoute()
+	ctx := router.HandlerContext{Adapter: slackadapter.New(api, "U_BOT")}
+	route.Plugin(ctx, adapter.Message{Platform: "slack", ID: "1.2", User: "U_USER", Channel: "C123", Text: "deploy"})
+
+	assert.Equal(t, "rate_limited", route.Name)
+	assert.Equal(t, "hourglass_flowing_sand", reaction)
+	assert.Empty(t, message)
+}
@@ -0,0 +1,322 @@
+package reminders
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gadget-bot/gadget/directory"
+	"github.com/gadget-bot/gadget/install"
+	"github.com/gadget-bot/gadget/models"
+	"github.com/gadget-bot/gadget/plugins/helpers"
+	"github.com/gadget-bot/gadget/router"
+	"gorm.io/gorm"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// deliveryInterval is how often due reminders are looked for
+const deliveryInterval = 30 * time.Second
+
+// deliveryBatchSize caps how many reminders a single delivery run posts
+const deliveryBatchSize = 100
+
+// userLocation returns the user's Slack time zone, falling back to UTC,
+// also without a Directory
+func userLocation(dir *directory.Directory, uuid string) *time.Location {
+	if dir == nil {
+		return time.UTC
+	}
+	info, err := dir.User(uuid)
+	if err != nil || info.TZ == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(info.TZ)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// formatDue renders t with Slack's date formatting so each reader sees it in
+// their own time zone, falling back to loc for clients that can't.
+func formatDue(t time.Time, loc *time.Location) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|%s>", t.Unix(), t.In(loc).Format("Mon Jan 2 at 3:04 PM MST"))
+}
+
+// isChannelMember reports whether user is a member of channel, paging
+// through its members
+func isChannelMember(api *slack.Client, channel, user string) (bool, error) {
+	params := slack.GetUsersInConversationParameters{ChannelID: channel, Limit: 1000}
+	for {
+		members, cursor, err := api.GetUsersInConversation(&params)
+		if err != nil {
+			return false, fmt.Errorf("list members of %s: %w", channel, err)
+		}
+		for _, member := range members {
+			if member == user {
+				return true, nil
+			}
+		}
+		if cursor == "" {
+			return false, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+func addReminder() *router.MentionRoute {
+	var pluginRoute router.MentionRoute
+	pluginRoute.Name = "reminders.addReminder"
+	pluginRoute.Description = "Reminds you or a channel about something later, once or on a schedule"
+	pluginRoute.Help = "remind me|#CHANNEL in 2h|at 5pm|tomorrow at 9am|every monday at 9am to MESSAGE"
+	pluginRoute.Pattern = `(?i)^remind (me|<#([a-z0-9]+)(\|[^>]*)?>) (.+?) to (.+)$`
+	pluginRoute.Plugin = func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+		results := ctx.Route.CompiledPattern.FindStringSubmatch(message)
+		target, who := ev.User, "you"
+		if results[2] != "" {
+			target, who = results[2], fmt.Sprintf("<#%s>", results[2])
+		}
+		threadOpt := helpers.ThreadReplyOption(ev.ThreadTimeStamp)
+
+		// Only a channel's members can have Gadget post in it
+		if target != ev.User {
+			member, err := isChannelMember(ctx.BotClient, target, ev.User)
+			if err != nil {
+				ctx.Logger.Error().Err(err).Str("channel", target).Msg("Failed to check channel membership")
+			}
+			if !member {
+				helpers.PostMessage(*ctx.BotClient, ev.Channel, "reminders.addReminder",
+					slack.MsgOptionText(fmt.Sprintf("Sorry <@%s>, you can only set reminders for channels you're in.", ev.User), false),
+					threadOpt,
+				)
+				return
+			}
+		}
+
+		loc := userLocation(ctx.Directory, ev.User)
+		due, recurring, err := parseWhen(results[4], time.Now().In(loc))
+		if err != nil {
+			helpers.PostMessage(*ctx.BotClient, ev.Channel, "reminders.addReminder",
+				slack.MsgOptionText(fmt.Sprintf("Sorry <@%s>, %s.", ev.User, err), false),
+				threadOpt,
+			)
+			return
+		}
+
+		reminder := models.Reminder{
+			TeamID:   ctx.Router.TeamID,
+			UserUuid: ev.User,
+			Channel:  target,
+			Text:     results[5],
+			DueAt:    due,
+			TimeZone: loc.String(),
+		}
+		if recurring {
+			reminder.Recurrence = results[4]
+		}
+
+		var response string
+		if err := ctx.Router.DbConnection.Create(&reminder).Error; err != nil {
+			ctx.Logger.Error().Err(err).Str("user", ev.User).Msg("Failed to save reminder")
+			response = "Sorry, I couldn't save that reminder."
+		} else if recurring {
+			response = fmt.Sprintf("Okay, I'll remind %s %s to %s, starting %s.", who, results[4], reminder.Text, formatDue(due, loc))
+		} else {
+			response = fmt.Sprintf("Okay, I'll remind %s to %s %s.", who, reminder.Text, formatDue(due, loc))
+		}
+
+		helpers.PostMessage(*ctx.BotClient, ev.Channel, "reminders.addReminder",
+			slack.MsgOptionText(response, false),
+			threadOpt,
+		)
+	}
+	return &pluginRoute
+}
+
+func listReminders() *router.MentionRoute {
+	var pluginRoute router.MentionRoute
+	pluginRoute.Name = "reminders.listReminders"
+	pluginRoute.Description = "Lists the reminders you have set"
+	pluginRoute.Help = "list reminders"
+	pluginRoute.Pattern = `(?i)^((list )?(my )?reminders)[.?]?$`
+	pluginRoute.Plugin = func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+		var reminders []models.Reminder
+		ctx.Router.DbConnection.Where("team_id = ? AND user_uuid = ?", ctx.Router.TeamID, ev.User).Order("due_at").Find(&reminders)
+
+		var response string
+		for _, reminder := range reminders {
+			where := ""
+			if reminder.Channel != reminder.UserUuid {
+				where = fmt.Sprintf(" in <#%s>", reminder.Channel)
+			}
+			when := formatDue(reminder.DueAt, reminder.Location())
+			if reminder.Recurring() {
+				when = fmt.Sprintf("%s, next %s", reminder.Recurrence, when)
+			}
+			response += fmt.Sprintf("*%d.* %s%s (%s)\n", reminder.ID, reminder.Text, where, when)
+		}
+		if response == "" {
+			response = "You don't have any reminders set."
+		}
+
+		helpers.PostMessage(*ctx.BotClient, ev.Channel, "reminders.listReminders",
+			slack.MsgOptionText(response, false),
+			helpers.ThreadReplyOption(ev.ThreadTimeStamp),
+		)
+	}
+	return &pluginRoute
+}
+
+func cancelReminder() *router.MentionRoute {
+	var pluginRoute router.MentionRoute
+	pluginRoute.Name = "reminders.cancelReminder"
+	pluginRoute.Description = "Cancels one of your reminders"
+	pluginRoute.Help = "cancel reminder NUMBER"
+	pluginRoute.Pattern = `(?i)^(cancel|delete|remove) reminder #?([0-9]+)\.?$`
+	pluginRoute.Plugin = func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+		results := ctx.Route.CompiledPattern.FindStringSubmatch(message)
+		id, _ := strconv.ParseUint(results[2], 10, 64)
+
+		var response string
+		result := ctx.Router.DbConnection.Where("id = ? AND team_id = ? AND user_uuid = ?", id, ctx.Router.TeamID, ev.User).Delete(&models.Reminder{})
+		switch {
+		case result.Error != nil:
+			ctx.Logger.Error().Err(result.Error).Str("user", ev.User).Msg("Failed to cancel reminder")
+			response = "Sorry, I couldn't cancel that reminder."
+		case result.RowsAffected == 0:
+			response = fmt.Sprintf("You don't have a reminder numbered %d.", id)
+		default:
+			response = fmt.Sprintf("Okay, reminder %d is cancelled.", id)
+		}
+
+		helpers.PostMessage(*ctx.BotClient, ev.Channel, "reminders.cancelReminder",
+			slack.MsgOptionText(response, false),
+			helpers.ThreadReplyOption(ev.ThreadTimeStamp),
+		)
+	}
+	return &pluginRoute
+}
+
+// reminderLease is how long a claimed reminder is held for delivery. A
+// replica that dies mid delivery leaves it to be delivered once it runs out.
+const reminderLease = 5 * time.Minute
+
+// undeliverable are the errors Slack answers with when a reminder's channel
+// can never be posted in again, so retrying it would be pointless
+var undeliverable = map[string]bool{
+	"channel_not_found": true,
+	"is_archived":       true,
+	"not_in_channel":    true,
+	"account_inactive":  true,
+}
+
+// claimReminder leases reminder for delivery by moving its DueAt
+// reminderLease past now, and reports whether this caller won the claim.
+// The update is conditional on Sends so a reminder is never delivered
+// twice, even when several replicas look at it at once.
+func claimReminder(db *gorm.DB, reminder models.Reminder, now time.Time) bool {
+	result := db.Model(&models.Reminder{}).
+		Where("id = ? AND sends = ?", reminder.ID, reminder.Sends).
+		Updates(map[string]interface{}{"due_at": now.Add(reminderLease), "sends": reminder.Sends + 1})
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// completeReminder deletes a claimed reminder once it has been delivered,
+// or moves it to its next occurrence
+func completeReminder(db *gorm.DB, reminder models.Reminder, now time.Time) error {
+	claimed := db.Where("id = ? AND sends = ?", reminder.ID, reminder.Sends+1)
+	if reminder.Recurring() {
+		next, _, err := parseWhen(reminder.Recurrence, now.In(reminder.Location()))
+		if err == nil {
+			return claimed.Model(&models.Reminder{}).Update("due_at", next).Error
+		}
+	}
+	return claimed.Delete(&models.Reminder{}).Error
+}
+
+// releaseReminder gives back a claimed reminder that couldn't be delivered,
+// due when it was before, so the next run tries again
+func releaseReminder(db *gorm.DB, reminder models.Reminder) error {
+	return db.Model(&models.Reminder{}).
+		Where("id = ? AND sends = ?", reminder.ID, reminder.Sends+1).
+		Update("due_at", reminder.DueAt).Error
+}
+
+// deliverDue posts every reminder that is due as of now, each in the
+// workspace it was set in. Reminders Slack fails to post, or whose
+// workspace Gadget isn't installed in, stay due.
+func deliverDue(ctx router.HandlerContext, now time.Time) {
+	var due []models.Reminder
+	err := ctx.Router.DbConnection.Where("due_at <= ?", now).Order("due_at").Limit(deliveryBatchSize).Find(&due).Error
+	if err != nil {
+		ctx.Logger.Error().Err(err).Msg("Failed to load due reminders")
+		return
+	}
+
+	for _, reminder := range due {
+		wctx, err := ctx.InWorkspace(reminder.TeamID)
+		if errors.Is(err, install.ErrNotInstalled) {
+			// Gadget isn't installed in the workspace (anymore), so it stays
+			// due for when it's reinstalled
+			ctx.Logger.Warn().Uint("reminder", reminder.ID).Str("team", reminder.TeamID).Msg("Skipping reminder for a workspace Gadget isn't installed in")
+			continue
+		}
+		if err != nil {
+			ctx.Logger.Error().Err(err).Str("team", reminder.TeamID).Msg("Failed to load reminder's workspace")
+			continue
+		}
+		if !claimReminder(ctx.Router.DbConnection, reminder, now) {
+			continue
+		}
+
+		text := "Reminder: " + helpers.EscapeText(reminder.Text)
+		if reminder.Channel != reminder.UserUuid {
+			text = fmt.Sprintf("Reminder from <@%s>: %s", reminder.UserUuid, helpers.EscapeText(reminder.Text))
+		}
+		_, _, err = wctx.BotClient.PostMessage(reminder.Channel, slack.MsgOptionText(text, false))
+		var slackErr slack.SlackErrorResponse
+		switch {
+		case err == nil:
+			err = completeReminder(ctx.Router.DbConnection, reminder, now)
+		case errors.As(err, &slackErr) && undeliverable[slackErr.Err]:
+			ctx.Logger.Warn().Err(err).Uint("reminder", reminder.ID).Str("channel", reminder.Channel).Msg("Skipping reminder for a channel it can't be posted in")
+			err = completeReminder(ctx.Router.DbConnection, reminder, now)
+		default:
+			ctx.Logger.Error().Err(err).Uint("reminder", reminder.ID).Str("channel", reminder.Channel).Msg("Failed to post reminder; will retry")
+			err = releaseReminder(ctx.Router.DbConnection, reminder)
+		}
+		if err != nil {
+			ctx.Logger.Error().Err(err).Uint("reminder", reminder.ID).Msg("Failed to update reminder after delivery")
+		}
+	}
+}
+
+func deliverReminders() *router.ScheduledJob {
+	var job router.ScheduledJob
+	job.Name = "reminders.deliverReminders"
+	job.Description = "Posts reminders that are due"
+	job.Interval = deliveryInterval
+	job.Plugin = func(ctx router.HandlerContext) {
+		deliverDue(ctx, time.Now())
+	}
+	return &job
+}
+
+// GetMentionRoutes Slice of all MentionRoutes
+func GetMentionRoutes() []router.MentionRoute {
+	return []router.MentionRoute{
+		*addReminder(),
+		*listReminders(),
+		*cancelReminder(),
+	}
+}
+
+// GetScheduledJobs Slice of all ScheduledJobs
+func GetScheduledJobs() []router.ScheduledJob {
+	return []router.ScheduledJob{
+		*deliverReminders(),
+	}
+}
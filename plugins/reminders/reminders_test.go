@@ -0,0 +1,354 @@
+package reminders
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/directory"
+	"github.com/gadget-bot/gadget/install"
+	"github.com/gadget-bot/gadget/models"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/rs/zerolog"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type postedMessage struct {
+	channel string
+	text    string
+}
+
+func setupRemindersTestRouter(t *testing.T) router.Router {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open in-memory SQLite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Group{}, &models.User{}, &models.Reminder{}); err != nil {
+		t.Fatalf("Failed to auto-migrate: %v", err)
+	}
+	r := router.NewRouter()
+	r.DbConnection = db
+	r.AddMentionRoutes(GetMentionRoutes())
+	return *r
+}
+
+// newSlackRecorder returns a Slack client for a user in New York, who is a
+// member of C0PS, whose posted messages are appended to messages
+func newSlackRecorder(t *testing.T, messages *[]postedMessage) *slack.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/users.info":
+			_, _ = w.Write([]byte(`{"ok":true,"user":{"id":"U123","tz":"America/New_York"}}`)) //nolint:errcheck // test HTTP response on loopback
+		case "/conversations.members":
+			if err := r.ParseForm(); err != nil {
+				t.Fatalf("ParseForm failed: %v", err)
+			}
+			if r.FormValue("channel") == "C0PS" {
+				_, _ = w.Write([]byte(`{"ok":true,"members":["U999","U123"],"response_metadata":{"next_cursor":""}}`)) //nolint:errcheck // test HTTP response on loopback
+				return
+			}
+			_, _ = w.Write([]byte(`{"ok":true,"members":["U999"],"response_metadata":{"next_cursor":""}}`)) //nolint:errcheck // test HTTP response on loopback
+		case "/chat.postMessage":
+			if err := r.ParseForm(); err != nil {
+				t.Fatalf("ParseForm failed: %v", err)
+			}
+			*messages = append(*messages, postedMessage{channel: r.FormValue("channel"), text: r.FormValue("text")})
+			_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1234567890.123456"}`)) //nolint:errcheck // test HTTP response on loopback
+		default:
+			_, _ = w.Write([]byte(`{"ok":true}`)) //nolint:errcheck // test HTTP response on loopback
+		}
+	}))
+	t.Cleanup(server.Close)
+	return slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+}
+
+func runMention(t *testing.T, r router.Router, api *slack.Client, user, message string) {
+	t.Helper()
+	route, found := r.FindMentionRouteByMessage(message)
+	require.True(t, found, message)
+	route.Execute(router.HandlerContext{Router: r, BotClient: api, Directory: directory.New(api, directory.Options{}), Logger: zerolog.Nop()}, slackevents.AppMentionEvent{User: user, Channel: "C123"}, message)
+}
+
+func TestGetMentionRoutes_ReturnsAllRoutes(t *testing.T) {
+	var names []string
+	for _, route := range GetMentionRoutes() {
+		names = append(names, route.Name)
+	}
+	assert.ElementsMatch(t, []string{"reminders.addReminder", "reminders.listReminders", "reminders.cancelReminder"}, names)
+}
+
+func TestGetScheduledJobs_ReturnsDeliveryJob(t *testing.T) {
+	jobs := GetScheduledJobs()
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "reminders.deliverReminders", jobs[0].Name)
+	assert.Equal(t, deliveryInterval, jobs[0].Interval)
+}
+
+func TestAddReminder_Me(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	var messages []postedMessage
+	api := newSlackRecorder(t, &messages)
+
+	before := time.Now()
+	runMention(t, r, api, "U123", "remind me in 2h to check the deploy")
+
+	var reminder models.Reminder
+	require.NoError(t, r.DbConnection.First(&reminder).Error)
+	assert.Equal(t, "U123", reminder.UserUuid)
+	assert.Equal(t, "U123", reminder.Channel)
+	assert.Equal(t, "check the deploy", reminder.Text)
+	assert.Equal(t, "America/New_York", reminder.TimeZone)
+	assert.False(t, reminder.Recurring())
+	assert.WithinDuration(t, before.Add(2*time.Hour), reminder.DueAt, time.Minute)
+
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].text, "Okay, I'll remind you to check the deploy")
+}
+
+func TestAddReminder_RecurringInChannel(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	var messages []postedMessage
+	api := newSlackRecorder(t, &messages)
+
+	runMention(t, r, api, "U123", "remind <#C0PS|ops> every monday at 9am to post the standup notes")
+
+	var reminder models.Reminder
+	require.NoError(t, r.DbConnection.First(&reminder).Error)
+	assert.Equal(t, "C0PS", reminder.Channel)
+	assert.Equal(t, "every monday at 9am", reminder.Recurrence)
+	assert.Equal(t, "post the standup notes", reminder.Text)
+
+	due := reminder.DueAt.In(reminder.Location())
+	assert.Equal(t, time.Monday, due.Weekday())
+	assert.Equal(t, 9, due.Hour())
+
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].text, "Okay, I'll remind <#C0PS> every monday at 9am to post the standup notes")
+}
+
+func TestAddReminder_OnlyInChannelsTheUserIsIn(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	var messages []postedMessage
+	api := newSlackRecorder(t, &messages)
+
+	runMention(t, r, api, "U123", "remind <#CEXEC|exec> in 1h to approve my raise")
+
+	var count int64
+	r.DbConnection.Model(&models.Reminder{}).Count(&count)
+	assert.Zero(t, count)
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].text, "you can only set reminders for channels you're in")
+}
+
+func TestAddReminder_UnknownTime(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	var messages []postedMessage
+	api := newSlackRecorder(t, &messages)
+
+	runMention(t, r, api, "U123", "remind me whenever to relax")
+
+	var count int64
+	r.DbConnection.Model(&models.Reminder{}).Count(&count)
+	assert.Zero(t, count)
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].text, "I don't understand when that is")
+}
+
+func TestListReminders_OnlyOwn(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	var messages []postedMessage
+	api := newSlackRecorder(t, &messages)
+	r.DbConnection.Create(&models.Reminder{UserUuid: "U123", Channel: "U123", Text: "check the deploy", DueAt: time.Now().Add(time.Hour)})
+	r.DbConnection.Create(&models.Reminder{UserUuid: "U999", Channel: "U999", Text: "someone else's", DueAt: time.Now().Add(time.Hour)})
+
+	runMention(t, r, api, "U123", "list reminders")
+
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].text, "*1.* check the deploy")
+	assert.NotContains(t, messages[0].text, "someone else's")
+}
+
+func TestListReminders_OnlyTheWorkspaces(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	var messages []postedMessage
+	api := newSlackRecorder(t, &messages)
+	r.DbConnection.Create(&models.Reminder{TeamID: "T1", UserUuid: "U123", Channel: "U123", Text: "here", DueAt: time.Now().Add(time.Hour)})
+	r.DbConnection.Create(&models.Reminder{TeamID: "T2", UserUuid: "U123", Channel: "U123", Text: "elsewhere", DueAt: time.Now().Add(time.Hour)})
+	r.TeamID = "T1"
+
+	runMention(t, r, api, "U123", "list reminders")
+	runMention(t, r, api, "U123", "cancel reminder 2")
+
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[0].text, "here")
+	assert.NotContains(t, messages[0].text, "elsewhere")
+	assert.Equal(t, "You don't have a reminder numbered 2.", messages[1].text)
+}
+
+func TestCancelReminder(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	var messages []postedMessage
+	api := newSlackRecorder(t, &messages)
+	r.DbConnection.Create(&models.Reminder{UserUuid: "U123", Channel: "U123", Text: "mine", DueAt: time.Now().Add(time.Hour)})
+	r.DbConnection.Create(&models.Reminder{UserUuid: "U999", Channel: "U999", Text: "theirs", DueAt: time.Now().Add(time.Hour)})
+
+	runMention(t, r, api, "U123", "cancel reminder 2")
+	runMention(t, r, api, "U123", "cancel reminder #1")
+
+	require.Len(t, messages, 2)
+	assert.Equal(t, "You don't have a reminder numbered 2.", messages[0].text)
+	assert.Equal(t, "Okay, reminder 1 is cancelled.", messages[1].text)
+
+	var remaining []models.Reminder
+	r.DbConnection.Find(&remaining)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, "theirs", remaining[0].Text)
+}
+
+func TestDeliverDue(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	var messages []postedMessage
+	api := newSlackRecorder(t, &messages)
+	now := time.Now()
+	r.DbConnection.Create(&models.Reminder{UserUuid: "U123", Channel: "U123", Text: "check the deploy", DueAt: now.Add(-time.Minute)})
+	r.DbConnection.Create(&models.Reminder{UserUuid: "U123", Channel: "C0PS", Text: "standup", DueAt: now.Add(-time.Minute), Recurrence: "every monday at 9am", TimeZone: "America/New_York"})
+	r.DbConnection.Create(&models.Reminder{UserUuid: "U123", Channel: "U123", Text: "later", DueAt: now.Add(time.Hour)})
+
+	ctx := router.HandlerContext{Router: r, BotClient: api, Logger: zerolog.Nop()}
+	deliverDue(ctx, now)
+	deliverDue(ctx, now)
+
+	require.Len(t, messages, 2)
+	assert.Equal(t, postedMessage{channel: "U123", text: "Reminder: check the deploy"}, messages[0])
+	assert.Equal(t, postedMessage{channel: "C0PS", text: "Reminder from <@U123>: standup"}, messages[1])
+
+	var remaining []models.Reminder
+	r.DbConnection.Order("id").Find(&remaining)
+	require.Len(t, remaining, 2)
+	assert.Equal(t, "standup", remaining[0].Text)
+	assert.True(t, remaining[0].DueAt.After(now))
+	assert.Equal(t, time.Monday, remaining[0].DueAt.In(remaining[0].Location()).Weekday())
+	assert.Equal(t, int64(1), remaining[0].Sends)
+}
+
+func TestDeliverDue_InTheRemindersWorkspace(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	var defaultMessages, tenantMessages []postedMessage
+	now := time.Now()
+	r.DbConnection.Create(&models.Reminder{UserUuid: "U1", Channel: "U1", Text: "ours", DueAt: now.Add(-time.Minute)})
+	r.DbConnection.Create(&models.Reminder{TeamID: "T_TENANT", UserUuid: "U2", Channel: "U2", Text: "theirs", DueAt: now.Add(-time.Minute)})
+	r.DbConnection.Create(&models.Reminder{TeamID: "T_GONE", UserUuid: "U3", Channel: "U3", Text: "uninstalled", DueAt: now.Add(-time.Minute)})
+
+	tenantClient := newSlackRecorder(t, &tenantMessages)
+	ctx := router.HandlerContext{Router: r, BotClient: newSlackRecorder(t, &defaultMessages), Logger: zerolog.Nop()}
+	ctx.Workspace = func(teamID string) (router.HandlerContext, error) {
+		if teamID != "T_TENANT" {
+			return router.HandlerContext{}, install.ErrNotInstalled
+		}
+		return router.HandlerContext{Router: r, BotClient: tenantClient}, nil
+	}
+	deliverDue(ctx, now)
+
+	assert.Equal(t, []postedMessage{{channel: "U1", text: "Reminder: ours"}}, defaultMessages)
+	assert.Equal(t, []postedMessage{{channel: "U2", text: "Reminder: theirs"}}, tenantMessages)
+	var pending []models.Reminder
+	r.DbConnection.Find(&pending)
+	require.Len(t, pending, 1, "reminders for uninstalled workspaces stay due")
+	assert.Equal(t, "T_GONE", pending[0].TeamID)
+	assert.Zero(t, pending[0].Sends)
+}
+
+func TestDeliverDue_EscapesText(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	var messages []postedMessage
+	api := newSlackRecorder(t, &messages)
+	now := time.Now()
+	r.DbConnection.Create(&models.Reminder{UserUuid: "U123", Channel: "C0PS", Text: "<!channel> free pizza & beer", DueAt: now.Add(-time.Minute)})
+
+	deliverDue(router.HandlerContext{Router: r, BotClient: api, Logger: zerolog.Nop()}, now)
+
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Reminder from <@U123>: &lt;!channel&gt; free pizza &amp; beer", messages[0].text)
+}
+
+func TestClaimReminder_OnlyOnce(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	reminder := models.Reminder{UserUuid: "U123", Channel: "U123", Text: "once", DueAt: time.Now()}
+	r.DbConnection.Create(&reminder)
+
+	assert.True(t, claimReminder(r.DbConnection, reminder, time.Now()))
+	assert.False(t, claimReminder(r.DbConnection, reminder, time.Now()))
+}
+
+// newFailingSlack returns a Slack client whose chat.postMessage fails with
+// the Slack error code, or with a server error if code is empty
+func newFailingSlack(t *testing.T, code string) *slack.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":false,"error":"` + code + `"}`)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	t.Cleanup(server.Close)
+	return slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+}
+
+func TestDeliverDue_KeepsRemindersSlackFailedToPost(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	now := time.Now()
+	due := now.Add(-time.Minute)
+	r.DbConnection.Create(&models.Reminder{UserUuid: "U123", Channel: "U123", Text: "check the deploy", DueAt: due})
+
+	deliverDue(router.HandlerContext{Router: r, BotClient: newFailingSlack(t, ""), Logger: zerolog.Nop()}, now)
+
+	var reminder models.Reminder
+	require.NoError(t, r.DbConnection.First(&reminder).Error)
+	assert.WithinDuration(t, due, reminder.DueAt, time.Second, "the reminder should be due again")
+
+	var messages []postedMessage
+	deliverDue(router.HandlerContext{Router: r, BotClient: newSlackRecorder(t, &messages), Logger: zerolog.Nop()}, now)
+	assert.Equal(t, []postedMessage{{channel: "U123", text: "Reminder: check the deploy"}}, messages)
+}
+
+func TestDeliverDue_DropsRemindersForChannelsItCantPostIn(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	now := time.Now()
+	r.DbConnection.Create(&models.Reminder{UserUuid: "U123", Channel: "C_GONE", Text: "standup", DueAt: now.Add(-time.Minute)})
+
+	deliverDue(router.HandlerContext{Router: r, BotClient: newFailingSlack(t, "channel_not_found"), Logger: zerolog.Nop()}, now)
+
+	var count int64
+	r.DbConnection.Model(&models.Reminder{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestDeliverDue_LeasedRemindersAreRetriedAfterTheLease(t *testing.T) {
+	r := setupRemindersTestRouter(t)
+	now := time.Now()
+	reminder := models.Reminder{UserUuid: "U123", Channel: "U123", Text: "check the deploy", DueAt: now.Add(-time.Minute)}
+	r.DbConnection.Create(&reminder)
+	// a replica claims it and dies before posting
+	require.True(t, claimReminder(r.DbConnection, reminder, now))
+
+	var messages []postedMessage
+	ctx := router.HandlerContext{Router: r, BotClient: newSlackRecorder(t, &messages), Logger: zerolog.Nop()}
+	deliverDue(ctx, now)
+	assert.Empty(t, messages, "the lease holds the reminder")
+	deliverDue(ctx, now.Add(reminderLease))
+	assert.Len(t, messages, 1)
+}
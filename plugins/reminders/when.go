@@ -0,0 +1,159 @@
+package reminders
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultHour is used when a day is given without a time, e.g. "tomorrow"
+const defaultHour = 9
+
+var errUnknownTime = errors.New("I don't understand when that is. Try something like `in 2h`, `at 5pm`, `tomorrow at 9am` or `every monday at 9am`")
+
+var (
+	inPattern    = regexp.MustCompile(`^in (an?|\d+) ?(s|secs?|seconds?|m|mins?|minutes?|h|hrs?|hours?|d|days?|w|weeks?)$`)
+	clockPattern = regexp.MustCompile(`^(\d{1,2})(:(\d{2}))? ?(am|pm)?$`)
+	dayPattern   = regexp.MustCompile(`^(every |on )?([a-z]+)( at (.+))?$`)
+)
+
+var units = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// parseWhen works out when a reminder described by phrase is next due after
+// now, in now's location. recurring is true for "every ..." phrases, which
+// can be passed to parseWhen again after each delivery to find the next one.
+func parseWhen(phrase string, now time.Time) (due time.Time, recurring bool, err error) {
+	phrase = strings.Join(strings.Fields(strings.ToLower(phrase)), " ")
+
+	if strings.HasPrefix(phrase, "in ") {
+		d, err := parseIn(phrase)
+		return now.Add(d), false, err
+	}
+
+	if clock, ok := strings.CutPrefix(phrase, "at "); ok {
+		hour, minute, err := parseClock(clock)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		return nextMatching(now, hour, minute, everyDay), false, nil
+	}
+
+	results := dayPattern.FindStringSubmatch(phrase)
+	if results == nil {
+		return time.Time{}, false, errUnknownTime
+	}
+	recurring = results[1] == "every "
+	hour, minute := defaultHour, 0
+	if results[4] != "" {
+		if hour, minute, err = parseClock(results[4]); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+
+	var matches func(time.Weekday) bool
+	switch day := results[2]; {
+	case day == "today" && !recurring:
+		due = time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+		if !due.After(now) {
+			return time.Time{}, false, errors.New("that time has already passed today")
+		}
+		return due, false, nil
+	case day == "tomorrow" && !recurring:
+		return time.Date(now.Year(), now.Month(), now.Day()+1, hour, minute, 0, 0, now.Location()), false, nil
+	case day == "day" && recurring:
+		matches = everyDay
+	case day == "weekday" && recurring:
+		matches = func(w time.Weekday) bool { return w != time.Saturday && w != time.Sunday }
+	default:
+		weekday, ok := weekdays[day]
+		if !ok {
+			return time.Time{}, false, errUnknownTime
+		}
+		matches = func(w time.Weekday) bool { return w == weekday }
+	}
+	return nextMatching(now, hour, minute, matches), recurring, nil
+}
+
+func everyDay(time.Weekday) bool { return true }
+
+// nextMatching returns the first hour:minute after now on a day that matches
+func nextMatching(now time.Time, hour, minute int, matches func(time.Weekday) bool) time.Time {
+	for offset := 0; ; offset++ {
+		candidate := time.Date(now.Year(), now.Month(), now.Day()+offset, hour, minute, 0, 0, now.Location())
+		if candidate.After(now) && matches(candidate.Weekday()) {
+			return candidate
+		}
+	}
+}
+
+// parseIn parses relative times such as "in 2h", "in 10 minutes", "in an
+// hour" or "in 1h30m"
+func parseIn(phrase string) (time.Duration, error) {
+	if results := inPattern.FindStringSubmatch(phrase); results != nil {
+		count := 1
+		if results[1] != "a" && results[1] != "an" {
+			count, _ = strconv.Atoi(results[1])
+		}
+		if count > 0 {
+			return time.Duration(count) * units[results[2][:1]], nil
+		}
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(phrase, "in ")); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, errUnknownTime
+}
+
+// parseClock parses times of day such as "5pm", "5:30 pm", "17:00", "noon"
+// and "midnight"
+func parseClock(clock string) (hour, minute int, err error) {
+	switch clock {
+	case "noon":
+		return 12, 0, nil
+	case "midnight":
+		return 0, 0, nil
+	}
+
+	results := clockPattern.FindStringSubmatch(clock)
+	if results == nil {
+		return 0, 0, fmt.Errorf("I don't understand the time %q", clock)
+	}
+	hour, _ = strconv.Atoi(results[1])
+	if results[3] != "" {
+		minute, _ = strconv.Atoi(results[3])
+	}
+
+	switch results[4] {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, fmt.Errorf("I don't understand the time %q", clock)
+		}
+		hour %= 12
+		if results[4] == "pm" {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, fmt.Errorf("I don't understand the time %q", clock)
+	}
+	return hour, minute, nil
+}
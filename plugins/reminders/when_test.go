@@ -0,0 +1,107 @@
+package reminders
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Wednesday, 10:30am in New York
+func testNow(t *testing.T) time.Time {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	return time.Date(2024, 5, 15, 10, 30, 0, 0, loc)
+}
+
+func TestParseWhen_Relative(t *testing.T) {
+	now := testNow(t)
+	cases := map[string]time.Duration{
+		"in 2h":         2 * time.Hour,
+		"in 10 minutes": 10 * time.Minute,
+		"in an hour":    time.Hour,
+		"in 3 days":     72 * time.Hour,
+		"in 1h30m":      90 * time.Minute,
+		"In 1 Week":     7 * 24 * time.Hour,
+	}
+	for phrase, want := range cases {
+		due, recurring, err := parseWhen(phrase, now)
+		assert.NoError(t, err, phrase)
+		assert.False(t, recurring, phrase)
+		assert.Equal(t, now.Add(want), due, phrase)
+	}
+}
+
+func TestParseWhen_At(t *testing.T) {
+	now := testNow(t)
+
+	due, _, err := parseWhen("at 5pm", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 15, 17, 0, 0, 0, now.Location()), due)
+
+	// Already passed today, so tomorrow
+	due, _, err = parseWhen("at 9:15am", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 16, 9, 15, 0, 0, now.Location()), due)
+
+	due, _, err = parseWhen("at noon", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 15, 12, 0, 0, 0, now.Location()), due)
+}
+
+func TestParseWhen_Days(t *testing.T) {
+	now := testNow(t)
+
+	due, recurring, err := parseWhen("tomorrow at 9am", now)
+	assert.NoError(t, err)
+	assert.False(t, recurring)
+	assert.Equal(t, time.Date(2024, 5, 16, 9, 0, 0, 0, now.Location()), due)
+
+	due, _, err = parseWhen("tomorrow", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 16, defaultHour, 0, 0, 0, now.Location()), due)
+
+	due, _, err = parseWhen("today at 17:30", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 15, 17, 30, 0, 0, now.Location()), due)
+
+	due, _, err = parseWhen("on friday at 3pm", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 17, 15, 0, 0, 0, now.Location()), due)
+
+	_, _, err = parseWhen("today at 8am", now)
+	assert.Error(t, err)
+}
+
+func TestParseWhen_Recurring(t *testing.T) {
+	now := testNow(t)
+
+	due, recurring, err := parseWhen("every monday at 9am", now)
+	assert.NoError(t, err)
+	assert.True(t, recurring)
+	assert.Equal(t, time.Date(2024, 5, 20, 9, 0, 0, 0, now.Location()), due)
+
+	// Today's occurrence is still ahead
+	due, _, err = parseWhen("every wednesday at 11am", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 15, 11, 0, 0, 0, now.Location()), due)
+
+	due, _, err = parseWhen("every day at 8am", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 16, 8, 0, 0, 0, now.Location()), due)
+
+	friday := time.Date(2024, 5, 17, 12, 0, 0, 0, now.Location())
+	due, _, err = parseWhen("every weekday at 9am", friday)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 20, 9, 0, 0, 0, now.Location()), due)
+}
+
+func TestParseWhen_Invalid(t *testing.T) {
+	now := testNow(t)
+	for _, phrase := range []string{"", "someday", "in 0 minutes", "at 25:00", "at 13pm", "every tomorrow", "on blursday"} {
+		_, _, err := parseWhen(phrase, now)
+		assert.Error(t, err, phrase)
+	}
+}
@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gadget-bot/gadget/plugins/helpers"
+	"github.com/gadget-bot/gadget/router"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// namespace is this plugin's route namespace. Its routes can't be toggled,
+// since they are how routes get turned back on.
+const namespace = "routes"
+
+// togglePattern captures the kind of target, its name, and an optional channel
+const togglePattern = `(route|plugin) ([a-z0-9_.*-]+)( in <#([a-z0-9]+)(\|[^>]*)?>)?\.?$`
+
+// targetFor returns the toggle target for a route or plugin name and whether
+// any registered route is matched by it
+func targetFor(r router.Router, kind, name string) (string, bool) {
+	target := name
+	if strings.EqualFold(kind, "plugin") {
+		target = router.NamespaceTarget(strings.TrimSuffix(name, ".*"))
+	}
+	for _, route := range r.RegisteredRoutes() {
+		if route.Name == target || router.NamespaceTarget(router.RouteNamespace(route.Name)) == target {
+			return target, true
+		}
+	}
+	return target, false
+}
+
+func toggleRoute(name, verb string, disable bool) *router.MentionRoute {
+	var pluginRoute router.MentionRoute
+	pluginRoute.Permissions = append(pluginRoute.Permissions, "admins")
+	pluginRoute.Name = name
+	pluginRoute.Description = strings.ToUpper(verb[:1]) + verb[1:] + "s a route or every route in a plugin"
+	pluginRoute.Help = verb + " route NAME|plugin NAME [in #CHANNEL]"
+	pluginRoute.Pattern = `(?i)^` + verb + ` ` + togglePattern
+	pluginRoute.Plugin = func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+		results := ctx.Route.CompiledPattern.FindStringSubmatch(message)
+		kind := results[1]
+		channel := results[4]
+		var response string
+
+		target, known := targetFor(ctx.Router, kind, results[2])
+		if !known {
+			response = fmt.Sprintf("I don't know of any %s named '%s'.", strings.ToLower(kind), results[2])
+		} else if router.RouteNamespace(target) == namespace {
+			response = fmt.Sprintf("I can't %s %s: the routes plugin is how routes get turned back on, so it's always enabled.", verb, target)
+		} else {
+			var err error
+			if disable {
+				err = ctx.Router.DisableRoute(target, channel)
+			} else {
+				err = ctx.Router.EnableRoute(target, channel)
+			}
+
+			where := "everywhere"
+			if channel != "" {
+				where = fmt.Sprintf("in <#%s>", channel)
+			}
+			if err != nil {
+				response = fmt.Sprintf("Failed to %s %s: %s", verb, target, err)
+			} else {
+				response = fmt.Sprintf("Okay, %s is now %sd %s.", target, verb, where)
+			}
+		}
+
+		helpers.PostMessage(*ctx.BotClient, ev.Channel, name,
+			slack.MsgOptionText(response, false),
+			helpers.ThreadReplyOption(ev.ThreadTimeStamp),
+		)
+	}
+	return &pluginRoute
+}
+
+func disableRoute() *router.MentionRoute {
+	return toggleRoute("routes.disableRoute", "disable", true)
+}
+
+func enableRoute() *router.MentionRoute {
+	return toggleRoute("routes.enableRoute", "enable", false)
+}
+
+func listRoutes() *router.MentionRoute {
+	var pluginRoute router.MentionRoute
+	pluginRoute.Permissions = append(pluginRoute.Permissions, "admins")
+	pluginRoute.Name = "routes.listRoutes"
+	pluginRoute.Description = "Lists registered routes and which are disabled"
+	pluginRoute.Help = "list routes"
+	pluginRoute.Pattern = `(?i)^(list( all)?|all) routes\.?$`
+	pluginRoute.Plugin = func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
+		var response string
+
+		for _, route := range ctx.Router.RegisteredRoutes() {
+			status := ""
+			if route.Disabled {
+				status = " _(disabled)_"
+			}
+			response += fmt.Sprintf("*-* %s (%s)%s\n", route.Name, route.Type, status)
+		}
+
+		toggles, err := ctx.Router.RouteToggles()
+		if err != nil {
+			ctx.Logger.Error().Err(err).Msg("Failed to load route toggles")
+		}
+		for _, toggle := range toggles {
+			if toggle.Channel == "" {
+				continue
+			}
+			state := "enabled"
+			if toggle.Disabled {
+				state = "disabled"
+			}
+			response += fmt.Sprintf("*-* %s is %s in <#%s>\n", toggle.Target, state, toggle.Channel)
+		}
+
+		if response == "" {
+			response = "I don't have any routes registered."
+		}
+
+		helpers.PostMessage(*ctx.BotClient, ev.Channel, "routes.listRoutes",
+			slack.MsgOptionText(response, false),
+			helpers.ThreadReplyOption(ev.ThreadTimeStamp),
+		)
+	}
+	return &pluginRoute
+}
+
+// GetMentionRoutes Slice of all MentionRoutes
+func GetMentionRoutes() []router.MentionRoute {
+	return []router.MentionRoute{
+		*disableRoute(),
+		*enableRoute(),
+		*listRoutes(),
+	}
+}
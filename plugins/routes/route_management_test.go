@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/gadget-bot/gadget/router"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func setupRoutesTestRouter(t *testing.T) router.Router {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open in-memory SQLite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Group{}, &models.User{}, &models.RouteToggle{}); err != nil {
+		t.Fatalf("Failed to auto-migrate: %v", err)
+	}
+	r := router.NewRouter()
+	r.DbConnection = db
+	r.AddMentionRoutes(GetMentionRoutes())
+	r.AddMentionRoute(router.MentionRoute{Route: router.Route{Name: "deploy.run", Pattern: `^deploy`}})
+	return *r
+}
+
+// newMessageRecorder returns a Slack client whose posted message texts are appended to messages
+func newMessageRecorder(t *testing.T, messages *[]string) *slack.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/chat.postMessage" {
+			if err := r.ParseForm(); err != nil {
+				t.Fatalf("ParseForm failed: %v", err)
+			}
+			*messages = append(*messages, r.FormValue("text"))
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1234567890.123456"}`)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	t.Cleanup(server.Close)
+	return slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+}
+
+func runMention(t *testing.T, r router.Router, api *slack.Client, message string) {
+	t.Helper()
+	route, found := r.FindMentionRouteByMessage(message)
+	require.True(t, found, message)
+	route.Execute(router.HandlerContext{Router: r, BotClient: api}, slackevents.AppMentionEvent{Channel: "C123"}, message)
+}
+
+func TestGetMentionRoutes_ReturnsAllRoutes(t *testing.T) {
+	var names []string
+	for _, route := range GetMentionRoutes() {
+		names = append(names, route.Name)
+		assert.Equal(t, []string{"admins"}, route.Permissions)
+	}
+	assert.ElementsMatch(t, []string{"routes.disableRoute", "routes.enableRoute", "routes.listRoutes"}, names)
+}
+
+func TestDisableRoute_Globally(t *testing.T) {
+	r := setupRoutesTestRouter(t)
+	var messages []string
+	api := newMessageRecorder(t, &messages)
+
+	runMention(t, r, api, "disable route deploy.run")
+
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "deploy.run is now disabled everywhere")
+	assert.False(t, r.IsRouteEnabled("deploy.run", ""))
+}
+
+func TestDisablePlugin_InChannel(t *testing.T) {
+	r := setupRoutesTestRouter(t)
+	var messages []string
+	api := newMessageRecorder(t, &messages)
+
+	runMention(t, r, api, "disable plugin deploy in <#C0OPS|ops>")
+
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "deploy.* is now disabled in <#C0OPS>")
+	assert.False(t, r.IsRouteEnabled("deploy.run", "C0OPS"))
+	assert.True(t, r.IsRouteEnabled("deploy.run", "C0DEV"))
+}
+
+func TestEnableRoute_UnknownRoute(t *testing.T) {
+	r := setupRoutesTestRouter(t)
+	var messages []string
+	api := newMessageRecorder(t, &messages)
+
+	runMention(t, r, api, "enable route nope.nothing")
+
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "don't know of any route named 'nope.nothing'")
+}
+
+func TestDisableRoute_RefusesOwnRoutes(t *testing.T) {
+	r := setupRoutesTestRouter(t)
+	var messages []string
+	api := newMessageRecorder(t, &messages)
+
+	runMention(t, r, api, "disable plugin routes")
+	runMention(t, r, api, "disable route routes.enableRoute in <#C0OPS|ops>")
+
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[0], "I can't disable routes.*")
+	assert.Contains(t, messages[1], "I can't disable routes.enableRoute")
+	toggles, err := r.RouteToggles()
+	require.NoError(t, err)
+	assert.Empty(t, toggles)
+	assert.True(t, r.IsRouteEnabled("routes.enableRoute", "C0OPS"))
+}
+
+func TestListRoutes_ShowsDisabled(t *testing.T) {
+	r := setupRoutesTestRouter(t)
+	require.NoError(t, r.DisableRoute("deploy.run", ""))
+	require.NoError(t, r.DisableRoute("routes.listRoutes", "C0OPS"))
+	var messages []string
+	api := newMessageRecorder(t, &messages)
+
+	runMention(t, r, api, "list routes")
+
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0], "deploy.run (mention) _(disabled)_")
+	assert.Contains(t, messages[0], "routes.enableRoute (mention)\n")
+	assert.Contains(t, messages[0], "routes.listRoutes is disabled in <#C0OPS>")
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"math/rand/v2"
 
-	"github.com/gadget-bot/gadget/models"
 	"github.com/gadget-bot/gadget/plugins/helpers"
 	"github.com/gadget-bot/gadget/router"
 
@@ -12,6 +11,19 @@ import (
 	"github.com/slack-go/slack/slackevents"
 )
 
+// lookupUser returns the Slack user with id, cached by the Directory if
+// there is one
+func lookupUser(ctx router.HandlerContext, id string) (slack.User, error) {
+	if ctx.Directory != nil {
+		return ctx.Directory.User(id)
+	}
+	user, err := ctx.BotClient.GetUserInfo(id)
+	if err != nil {
+		return slack.User{}, err
+	}
+	return *user, nil
+}
+
 func userInfo() *router.MentionRoute {
 	var pluginRoute router.MentionRoute
 	pluginRoute.Permissions = append(pluginRoute.Permissions, "admins")
@@ -22,8 +34,6 @@ func userInfo() *router.MentionRoute {
 	pluginRoute.Plugin = func(ctx router.HandlerContext, ev slackevents.AppMentionEvent, message string) {
 		results := ctx.Route.CompiledPattern.FindStringSubmatch(message)
 		userName := results[2]
-		var foundUser models.User
-		var response string
 
 		animals := []string{
 			"Giant Panda",
@@ -43,26 +53,32 @@ func userInfo() *router.MentionRoute {
 		randomIndex := rand.IntN(len(animals)) //nolint:gosec // G404: random animal selection has no security requirement
 		randomAnimal := animals[randomIndex]
 
-		ctx.Router.DbConnection.Where(models.User{Uuid: userName}).FirstOrCreate(&foundUser)
+		ctx.Router.FindOrCreateUser(userName)
 
 		threadOpt := helpers.ThreadReplyOption(ev.ThreadTimeStamp)
 
-		slackInfo := foundUser.Info(*ctx.BotClient)
-		if slackInfo == nil {
+		slackInfo, err := lookupUser(ctx, userName)
+		if err != nil {
+			ctx.Logger.Warn().Err(err).Str("uuid", userName).Msg("Failed to get user info")
 			helpers.PostMessage(*ctx.BotClient, ev.Channel, "user_info",
 				slack.MsgOptionText(fmt.Sprintf("Sorry, I couldn't look up info for <@%s>.", userName), false),
 				threadOpt,
 			)
 			return
 		}
-		response += fmt.Sprintf("- *Real Name:* %s\n", slackInfo.RealName)
-		response += fmt.Sprintf("- *Time Zone:* %s\n", slackInfo.TZ)
-		response += fmt.Sprintf("- *Email:* %s\n", slackInfo.Profile.Email)
-		response += fmt.Sprintf("- *Locale:* %s\n", slackInfo.Locale)
-		response += fmt.Sprintf("- *Spirit Animal:* %s\n", randomAnimal)
+		msg := helpers.NewMessage().
+			Section(fmt.Sprintf("Here's what I know about <@%s>:", userName)).
+			Fields(
+				"*Real Name:*\n"+helpers.EscapeText(slackInfo.RealName),
+				"*Time Zone:*\n"+helpers.EscapeText(slackInfo.TZ),
+				"*Email:*\n"+helpers.EscapeText(slackInfo.Profile.Email),
+				"*Locale:*\n"+helpers.EscapeText(slackInfo.Locale),
+				"*Spirit Animal:*\n"+randomAnimal,
+			).
+			Build()
 
 		helpers.PostMessage(*ctx.BotClient, ev.Channel, "user_info",
-			slack.MsgOptionText(response, false),
+			msg.MsgOption(),
 			threadOpt,
 		)
 	}
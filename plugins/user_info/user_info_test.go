@@ -1,11 +1,11 @@
 package user_info
 
 import (
-	"net/http"
-	"net/http/httptest"
 	"regexp"
 	"testing"
 
+	"github.com/gadget-bot/gadget/directory"
+	"github.com/gadget-bot/gadget/gadgettest"
 	"github.com/gadget-bot/gadget/models"
 	"github.com/gadget-bot/gadget/router"
 	"github.com/slack-go/slack"
@@ -56,35 +56,47 @@ func TestUserInfoPlugin_PostsUserDetails(t *testing.T) {
 	user := models.User{Uuid: "u456"}
 	db.Create(&user)
 
-	var postedMessage string
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		switch r.URL.Path {
-		case "/users.info":
-			_, _ = w.Write([]byte(`{
-				"ok": true,
-				"user": {
-					"id": "u456",
-					"name": "testuser",
-					"real_name": "Test User",
-					"tz": "America/Chicago",
-					"locale": "en-US",
-					"profile": {"email": "test@example.com"}
-				}
-			}`)) //nolint:errcheck // test HTTP response on loopback
-		case "/chat.postMessage":
-			if err := r.ParseForm(); err != nil {
-				t.Fatalf("ParseForm failed: %v", err)
-			}
-			postedMessage = r.FormValue("text")
-			_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1234567890.123456"}`)) //nolint:errcheck // test HTTP response on loopback
-		default:
-			_, _ = w.Write([]byte(`{"ok":true}`)) //nolint:errcheck // test HTTP response on loopback
-		}
-	}))
-	defer server.Close()
-
-	api := slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+	fake := gadgettest.NewFakeSlack(t)
+	fake.AddUser(slack.User{
+		ID:       "u456",
+		Name:     "testuser",
+		RealName: "Test User",
+		TZ:       "America/Chicago",
+		Locale:   "en-US",
+		Profile:  slack.UserProfile{Email: "test@example.com"},
+	})
+	api := fake.Client()
+
+	route := userInfo()
+	compileMentionRouteForTest(t, route)
+	ctx := router.HandlerContext{
+		Router:    router.Router{DbConnection: db},
+		Route:     route.Route,
+		BotClient: api,
+		Directory: directory.New(api, directory.Options{}),
+	}
+	ev := slackevents.AppMentionEvent{
+		User:    "U_ADMIN",
+		Channel: "C123",
+	}
+
+	route.Plugin(ctx, ev, "who is <@u456>")
+
+	fake.AssertPosted(t, "C123", "Test User")
+	fake.AssertPosted(t, "C123", "America/Chicago")
+	fake.AssertPosted(t, "C123", "test@example.com")
+}
+
+func TestUserInfoPlugin_EscapesProfileFields(t *testing.T) {
+	db := setupUserInfoTestDB(t)
+
+	fake := gadgettest.NewFakeSlack(t)
+	fake.AddUser(slack.User{
+		ID:       "u456",
+		Name:     "testuser",
+		RealName: "<!channel> & co",
+	})
+	api := fake.Client()
 
 	route := userInfo()
 	compileMentionRouteForTest(t, route)
@@ -92,6 +104,7 @@ func TestUserInfoPlugin_PostsUserDetails(t *testing.T) {
 		Router:    router.Router{DbConnection: db},
 		Route:     route.Route,
 		BotClient: api,
+		Directory: directory.New(api, directory.Options{}),
 	}
 	ev := slackevents.AppMentionEvent{
 		User:    "U_ADMIN",
@@ -100,33 +113,17 @@ func TestUserInfoPlugin_PostsUserDetails(t *testing.T) {
 
 	route.Plugin(ctx, ev, "who is <@u456>")
 
-	assert.Contains(t, postedMessage, "Test User")
-	assert.Contains(t, postedMessage, "America/Chicago")
-	assert.Contains(t, postedMessage, "test@example.com")
+	fake.AssertPosted(t, "C123", "&lt;!channel&gt; &amp; co")
+	for _, msg := range fake.Messages("C123") {
+		assert.NotContains(t, msg.Content(), "<!channel>")
+	}
 }
 
 func TestUserInfoPlugin_UserNotFound(t *testing.T) {
 	db := setupUserInfoTestDB(t)
 
-	var postedMessage string
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		switch r.URL.Path {
-		case "/users.info":
-			_, _ = w.Write([]byte(`{"ok":false,"error":"user_not_found"}`)) //nolint:errcheck // test HTTP response on loopback
-		case "/chat.postMessage":
-			if err := r.ParseForm(); err != nil {
-				t.Fatalf("ParseForm failed: %v", err)
-			}
-			postedMessage = r.FormValue("text")
-			_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1234567890.123456"}`)) //nolint:errcheck // test HTTP response on loopback
-		default:
-			_, _ = w.Write([]byte(`{"ok":true}`)) //nolint:errcheck // test HTTP response on loopback
-		}
-	}))
-	defer server.Close()
-
-	api := slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/"))
+	fake := gadgettest.NewFakeSlack(t)
+	api := fake.Client()
 
 	route := userInfo()
 	compileMentionRouteForTest(t, route)
@@ -134,6 +131,7 @@ func TestUserInfoPlugin_UserNotFound(t *testing.T) {
 		Router:    router.Router{DbConnection: db},
 		Route:     route.Route,
 		BotClient: api,
+		Directory: directory.New(api, directory.Options{}),
 	}
 	ev := slackevents.AppMentionEvent{
 		User:    "U_ADMIN",
@@ -142,5 +140,28 @@ func TestUserInfoPlugin_UserNotFound(t *testing.T) {
 
 	route.Plugin(ctx, ev, "who is <@u999>")
 
-	assert.Contains(t, postedMessage, "couldn't look up")
+	fake.AssertPosted(t, "C123", "couldn't look up")
+}
+
+func TestUserInfoPlugin_WithoutDirectory(t *testing.T) {
+	db := setupUserInfoTestDB(t)
+
+	fake := gadgettest.NewFakeSlack(t)
+	fake.AddUser(slack.User{ID: "u456", RealName: "Test User", TZ: "America/Chicago"})
+
+	route := userInfo()
+	compileMentionRouteForTest(t, route)
+	ctx := router.HandlerContext{
+		Router:    router.Router{DbConnection: db},
+		Route:     route.Route,
+		BotClient: fake.Client(),
+	}
+	ev := slackevents.AppMentionEvent{
+		User:    "U_ADMIN",
+		Channel: "C123",
+	}
+
+	route.Plugin(ctx, ev, "who is <@u456>")
+
+	fake.AssertPosted(t, "C123", "Test User")
 }
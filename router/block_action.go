@@ -0,0 +1,67 @@
+package router
+
+import (
+	"fmt"
+
+	"github.com/slack-go/slack"
+)
+
+// BlockActionRoute handles clicks on interactive Block Kit elements, such as
+// buttons and overflow menus, whose action_id is ActionID. Slack posts these
+// to the app's interactivity URL and Gadget acknowledges them before the
+// Plugin runs. Route.Pattern is ignored.
+type BlockActionRoute struct {
+	Route
+	ActionID string
+	Plugin   func(ctx HandlerContext, callback slack.InteractionCallback, action slack.BlockAction)
+}
+
+// Execute calls Plugin()
+func (route BlockActionRoute) Execute(ctx HandlerContext, callback slack.InteractionCallback, action slack.BlockAction) {
+	ctx.Route = route.Route
+	route.Plugin(ctx, callback, action)
+}
+
+// OriginFromBlockAction returns the origin of a block action: the message
+// holding the clicked element, in the thread it was posted to.
+func OriginFromBlockAction(callback slack.InteractionCallback) Origin {
+	channel := callback.Container.ChannelID
+	if channel == "" {
+		channel = callback.Channel.ID
+	}
+	return Origin{
+		Channel:         channel,
+		ThreadTimeStamp: callback.Container.ThreadTs,
+		TimeStamp:       callback.Container.MessageTs,
+		User:            callback.User.ID,
+	}
+}
+
+// AddBlockActionRoute sets the key for BlockActionRoutes to route.ActionID and
+// its value to route. It panics if the route has no ActionID.
+func (router *Router) AddBlockActionRoute(route BlockActionRoute) {
+	if route.ActionID == "" {
+		panic(fmt.Sprintf("block action route %s: ActionID is required", route.Name))
+	}
+	if router.BlockActionRoutes == nil {
+		router.BlockActionRoutes = make(map[string]BlockActionRoute)
+	}
+	router.BlockActionRoutes[route.ActionID] = route
+}
+
+// AddBlockActionRoutes calls AddBlockActionRoute for each element in routes
+func (router *Router) AddBlockActionRoutes(routes []BlockActionRoute) {
+	for _, route := range routes {
+		router.AddBlockActionRoute(route)
+	}
+}
+
+// FindBlockActionRoute returns the route handling actionID, skipping routes
+// that are disabled in channel.
+func (router Router) FindBlockActionRoute(actionID, channel string) (BlockActionRoute, bool) {
+	route, exists := router.BlockActionRoutes[actionID]
+	if !exists || !router.IsRouteEnabled(route.Name, channel) {
+		return BlockActionRoute{}, false
+	}
+	return route, true
+}
@@ -0,0 +1,78 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddBlockActionRoute(t *testing.T) {
+	var r Router // zero value, as a Router copied before the map existed
+	r.AddBlockActionRoutes([]BlockActionRoute{
+		{Route: Route{Name: "approvals.approve"}, ActionID: "approve"},
+		{Route: Route{Name: "approvals.reject"}, ActionID: "reject"},
+	})
+
+	route, exists := r.FindBlockActionRoute("approve", "")
+	require.True(t, exists)
+	assert.Equal(t, "approvals.approve", route.Name)
+
+	_, exists = r.FindBlockActionRoute("missing", "")
+	assert.False(t, exists)
+}
+
+func TestAddBlockActionRoute_RequiresActionID(t *testing.T) {
+	r := NewRouter()
+	assert.Panics(t, func() {
+		r.AddBlockActionRoute(BlockActionRoute{Route: Route{Name: "approvals.approve"}})
+	})
+}
+
+func TestFindBlockActionRoute_Disabled(t *testing.T) {
+	r := NewRouter()
+	r.DbConnection = setupTestDB(t)
+	r.AddBlockActionRoute(BlockActionRoute{Route: Route{Name: "approvals.approve"}, ActionID: "approve"})
+	require.NoError(t, r.DisableRoute("approvals.approve", "C123"))
+
+	_, exists := r.FindBlockActionRoute("approve", "C123")
+	assert.False(t, exists)
+	_, exists = r.FindBlockActionRoute("approve", "C456")
+	assert.True(t, exists)
+}
+
+func TestBlockActionRoute_Execute(t *testing.T) {
+	var got HandlerContext
+	route := BlockActionRoute{
+		Route:    Route{Name: "approvals.approve"},
+		ActionID: "approve",
+		Plugin: func(ctx HandlerContext, callback slack.InteractionCallback, action slack.BlockAction) {
+			got = ctx
+		},
+	}
+
+	route.Execute(HandlerContext{}, slack.InteractionCallback{}, slack.BlockAction{ActionID: "approve"})
+	assert.Equal(t, "approvals.approve", got.Route.Name)
+}
+
+func TestOriginFromBlockAction(t *testing.T) {
+	callback := slack.InteractionCallback{
+		User:      slack.User{ID: "U1"},
+		Container: slack.Container{ChannelID: "C123", MessageTs: "1000.0002", ThreadTs: "1000.0001"},
+	}
+	assert.Equal(t, Origin{Channel: "C123", ThreadTimeStamp: "1000.0001", TimeStamp: "1000.0002", User: "U1"}, OriginFromBlockAction(callback))
+
+	callback.Container.ChannelID = ""
+	callback.Channel.ID = "C456"
+	assert.Equal(t, "C456", OriginFromBlockAction(callback).Channel)
+}
+
+func TestRegisteredRoutes_IncludesBlockActions(t *testing.T) {
+	r := NewRouter()
+	r.AddBlockActionRoute(BlockActionRoute{Route: Route{Name: "approvals.approve"}, ActionID: "approve"})
+
+	routes := r.RegisteredRoutes()
+	require.Len(t, routes, 1)
+	assert.Equal(t, RouteTypeBlockAction, routes[0].Type)
+}
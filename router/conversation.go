@@ -0,0 +1,254 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/rs/zerolog/log"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// DefaultConversationTimeout is used when neither the step nor the Router
+// specify how long a conversation may wait for its next message.
+const DefaultConversationTimeout = 5 * time.Minute
+
+// DefaultConversationCancelPattern matches the messages that abandon an
+// active conversation.
+const DefaultConversationCancelPattern = `(?i)^(cancel|never ?mind|stop)[.!]?$`
+
+// ConversationKey identifies a conversation by the user taking part in it and
+// the channel and thread it is happening in. ThreadTimeStamp is empty for
+// conversations that take place outside of a thread.
+type ConversationKey struct {
+	User            string
+	Channel         string
+	ThreadTimeStamp string
+}
+
+// ConversationMessage is a message delivered to a waiting ConversationStep.
+// It is built from either an app mention or a channel message so steps can
+// handle replies without caring which event carried them.
+type ConversationMessage struct {
+	ConversationKey
+	TimeStamp string
+	Text      string
+}
+
+// Conversation is the state of an active dialog as loaded from the database.
+type Conversation struct {
+	ConversationKey
+	Step      string
+	State     json.RawMessage
+	ExpiresAt time.Time
+}
+
+// Decode unmarshals the stored conversation state into v.
+func (c Conversation) Decode(v interface{}) error {
+	if len(c.State) == 0 {
+		return nil
+	}
+	return json.Unmarshal(c.State, v)
+}
+
+// ConversationStep handles the next message in a conversation. Steps are
+// registered by Name so that a persisted conversation can be resumed after a
+// restart.
+type ConversationStep struct {
+	Name    string
+	Timeout time.Duration // how long to wait for the reply; 0 uses the Router's timeout
+	Plugin  func(ctx HandlerContext, conv Conversation, msg ConversationMessage)
+}
+
+// Execute calls Plugin()
+func (step ConversationStep) Execute(ctx HandlerContext, conv Conversation, msg ConversationMessage) {
+	ctx.Route = Route{Name: step.Name}
+	step.Plugin(ctx, conv, msg)
+}
+
+// ConversationKeyFromMention returns the key for a conversation with the author
+// of ev in the channel and thread it was sent in.
+func ConversationKeyFromMention(ev slackevents.AppMentionEvent) ConversationKey {
+	return ConversationKey{User: ev.User, Channel: ev.Channel, ThreadTimeStamp: ev.ThreadTimeStamp}
+}
+
+// ConversationKeyFromMessage returns the key for a conversation with the author
+// of ev in the channel and thread it was sent in.
+func ConversationKeyFromMessage(ev slackevents.MessageEvent) ConversationKey {
+	return ConversationKey{User: ev.User, Channel: ev.Channel, ThreadTimeStamp: ev.ThreadTimeStamp}
+}
+
+// AddConversationStep registers a step keyed by its Name
+func (router *Router) AddConversationStep(step ConversationStep) {
+	if router.ConversationSteps == nil {
+		router.ConversationSteps = make(map[string]ConversationStep)
+	}
+	router.ConversationSteps[step.Name] = step
+}
+
+// AddConversationSteps calls AddConversationStep for each element in steps
+func (router *Router) AddConversationSteps(steps []ConversationStep) {
+	for _, step := range steps {
+		router.AddConversationStep(step)
+	}
+}
+
+// IsConversationCancel returns true if message should abandon the active conversation
+func (router Router) IsConversationCancel(message string) bool {
+	pattern := router.ConversationCancelPattern
+	if pattern == nil {
+		pattern = defaultConversationCancelPattern
+	}
+	return pattern.MatchString(message)
+}
+
+var defaultConversationCancelPattern = regexp.MustCompile(DefaultConversationCancelPattern)
+
+const conversationScope = "user_uuid = ? AND channel = ? AND thread_ts = ?"
+
+func (router Router) conversationTimeout(step string) time.Duration {
+	if s, exists := router.ConversationSteps[step]; exists && s.Timeout > 0 {
+		return s.Timeout
+	}
+	if router.ConversationTimeout > 0 {
+		return router.ConversationTimeout
+	}
+	return DefaultConversationTimeout
+}
+
+// SaveConversation creates or replaces the conversation for key so that the
+// next message is routed to step. state is stored as JSON and may be nil.
+func (router Router) SaveConversation(key ConversationKey, step string, state interface{}) error {
+	if _, exists := router.ConversationSteps[step]; !exists {
+		return fmt.Errorf("unknown conversation step: %s", step)
+	}
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encode conversation state: %w", err)
+	}
+
+	// Struct conditions skip zero values, so the scope is matched explicitly to
+	// keep an empty ThreadTs from matching every thread.
+	conv := models.Conversation{UserUuid: key.User, Channel: key.Channel, ThreadTs: key.ThreadTimeStamp}
+	err = router.DbConnection.Where(conversationScope, key.User, key.Channel, key.ThreadTimeStamp).
+		Limit(1).Find(&conv).Error
+	if err != nil {
+		return fmt.Errorf("load conversation: %w", err)
+	}
+	conv.Step = step
+	conv.State = string(encoded)
+	conv.ExpiresAt = time.Now().Add(router.conversationTimeout(step))
+	if err := router.DbConnection.Save(&conv).Error; err != nil {
+		return fmt.Errorf("save conversation: %w", err)
+	}
+	return nil
+}
+
+// DeleteConversation removes the conversation for key, if any
+func (router Router) DeleteConversation(key ConversationKey) error {
+	err := router.DbConnection.Unscoped().
+		Where(conversationScope, key.User, key.Channel, key.ThreadTimeStamp).
+		Delete(&models.Conversation{}).Error
+	if err != nil {
+		return fmt.Errorf("delete conversation: %w", err)
+	}
+	return nil
+}
+
+// FindConversation returns the active conversation for key along with the step
+// waiting on it. Expired conversations and those whose step is no longer
+// registered are removed and reported as not found, as are conversations
+// that couldn't be loaded, after logging why.
+func (router Router) FindConversation(key ConversationKey) (Conversation, ConversationStep, bool) {
+	stored, step, found, err := router.loadConversation(key)
+	if err != nil {
+		log.Error().Err(err).Str("user", key.User).Msg("Failed to load conversation")
+		return Conversation{}, ConversationStep{}, false
+	}
+	if !found {
+		return Conversation{}, ConversationStep{}, false
+	}
+	return toConversation(key, stored), step, true
+}
+
+// ClaimConversation ends the active conversation for key and returns it
+// along with the step waiting on it, so the step can run. The conversation
+// is deleted only if it hasn't changed since it was loaded, so when two
+// messages or replicas race for it only one claims it; the other finds
+// nothing. Errors are the database's.
+func (router Router) ClaimConversation(key ConversationKey) (Conversation, ConversationStep, bool, error) {
+	stored, step, found, err := router.loadConversation(key)
+	if err != nil || !found {
+		return Conversation{}, ConversationStep{}, false, err
+	}
+	result := router.DbConnection.Unscoped().
+		Where("id = ? AND updated_at = ?", stored.ID, stored.UpdatedAt).
+		Delete(&models.Conversation{})
+	if result.Error != nil {
+		return Conversation{}, ConversationStep{}, false, fmt.Errorf("claim conversation: %w", result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return Conversation{}, ConversationStep{}, false, nil
+	}
+	return toConversation(key, stored), step, true, nil
+}
+
+// loadConversation returns the stored conversation for key and its step,
+// removing it if it has expired or its step is no longer registered
+func (router Router) loadConversation(key ConversationKey) (models.Conversation, ConversationStep, bool, error) {
+	if router.DbConnection == nil || len(router.ConversationSteps) == 0 {
+		return models.Conversation{}, ConversationStep{}, false, nil
+	}
+
+	var conversations []models.Conversation
+	err := router.DbConnection.Where(conversationScope, key.User, key.Channel, key.ThreadTimeStamp).
+		Limit(1).Find(&conversations).Error
+	if err != nil {
+		return models.Conversation{}, ConversationStep{}, false, fmt.Errorf("load conversation: %w", err)
+	}
+	if len(conversations) == 0 {
+		return models.Conversation{}, ConversationStep{}, false, nil
+	}
+
+	stored := conversations[0]
+	step, exists := router.ConversationSteps[stored.Step]
+	if !exists || stored.Expired(time.Now()) {
+		if err := router.DeleteConversation(key); err != nil {
+			log.Error().Err(err).Str("user", key.User).Str("step", stored.Step).Msg("Failed to remove stale conversation")
+		}
+		return models.Conversation{}, ConversationStep{}, false, nil
+	}
+	return stored, step, true, nil
+}
+
+// toConversation returns the Conversation stored for key
+func toConversation(key ConversationKey, stored models.Conversation) Conversation {
+	return Conversation{
+		ConversationKey: key,
+		Step:            stored.Step,
+		State:           json.RawMessage(stored.State),
+		ExpiresAt:       stored.ExpiresAt,
+	}
+}
+
+// StartConversation begins a dialog with the user identified by key. The next
+// message from that user in the same channel and thread is routed to step
+// before normal route matching. state is persisted and available to the step
+// via Conversation.Decode.
+func (ctx HandlerContext) StartConversation(key ConversationKey, step string, state interface{}) error {
+	return ctx.Router.SaveConversation(key, step, state)
+}
+
+// ContinueConversation waits for another message in conv, routing it to step
+// with the updated state. The conversation timeout is reset.
+func (ctx HandlerContext) ContinueConversation(conv Conversation, step string, state interface{}) error {
+	return ctx.Router.SaveConversation(conv.ConversationKey, step, state)
+}
+
+// EndConversation finishes the conversation for key so that later messages
+// are routed normally.
+func (ctx HandlerContext) EndConversation(key ConversationKey) error {
+	return ctx.Router.DeleteConversation(key)
+}
@@ -0,0 +1,149 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newConversationRouter(t *testing.T) *Router {
+	t.Helper()
+	r := NewRouter()
+	r.DbConnection = setupTestDB(t)
+	r.AddConversationSteps([]ConversationStep{
+		{Name: "deploy.askEnvironment", Plugin: func(ctx HandlerContext, conv Conversation, msg ConversationMessage) {}},
+		{Name: "deploy.confirm", Timeout: time.Hour, Plugin: func(ctx HandlerContext, conv Conversation, msg ConversationMessage) {}},
+	})
+	return r
+}
+
+func TestConversationKeyFromMention(t *testing.T) {
+	key := ConversationKeyFromMention(slackevents.AppMentionEvent{User: "U1", Channel: "C1", ThreadTimeStamp: "111.222"})
+	assert.Equal(t, ConversationKey{User: "U1", Channel: "C1", ThreadTimeStamp: "111.222"}, key)
+}
+
+func TestConversationKeyFromMessage(t *testing.T) {
+	key := ConversationKeyFromMessage(slackevents.MessageEvent{User: "U1", Channel: "C1"})
+	assert.Equal(t, ConversationKey{User: "U1", Channel: "C1"}, key)
+}
+
+func TestSaveConversation_RoundTripsState(t *testing.T) {
+	r := newConversationRouter(t)
+	key := ConversationKey{User: "U1", Channel: "C1", ThreadTimeStamp: "111.222"}
+
+	require.NoError(t, r.SaveConversation(key, "deploy.askEnvironment", map[string]string{"app": "api"}))
+
+	conv, step, found := r.FindConversation(key)
+	require.True(t, found)
+	assert.Equal(t, "deploy.askEnvironment", step.Name)
+	assert.Equal(t, key, conv.ConversationKey)
+
+	var state map[string]string
+	require.NoError(t, conv.Decode(&state))
+	assert.Equal(t, "api", state["app"])
+}
+
+func TestSaveConversation_ReplacesExisting(t *testing.T) {
+	r := newConversationRouter(t)
+	key := ConversationKey{User: "U1", Channel: "C1"}
+
+	require.NoError(t, r.SaveConversation(key, "deploy.askEnvironment", nil))
+	require.NoError(t, r.SaveConversation(key, "deploy.confirm", nil))
+
+	var count int64
+	r.DbConnection.Model(&models.Conversation{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	conv, _, found := r.FindConversation(key)
+	require.True(t, found)
+	assert.Equal(t, "deploy.confirm", conv.Step)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), conv.ExpiresAt, time.Minute)
+}
+
+func TestSaveConversation_UnknownStep(t *testing.T) {
+	r := newConversationRouter(t)
+	err := r.SaveConversation(ConversationKey{User: "U1", Channel: "C1"}, "nope", nil)
+	assert.Error(t, err)
+}
+
+func TestFindConversation_ScopedToThread(t *testing.T) {
+	r := newConversationRouter(t)
+	require.NoError(t, r.SaveConversation(ConversationKey{User: "U1", Channel: "C1", ThreadTimeStamp: "111.222"}, "deploy.askEnvironment", nil))
+
+	_, _, found := r.FindConversation(ConversationKey{User: "U1", Channel: "C1"})
+	assert.False(t, found, "a top-level message should not resume a threaded conversation")
+
+	_, _, found = r.FindConversation(ConversationKey{User: "U2", Channel: "C1", ThreadTimeStamp: "111.222"})
+	assert.False(t, found, "another user should not resume the conversation")
+}
+
+func TestFindConversation_ExpiredIsRemoved(t *testing.T) {
+	r := newConversationRouter(t)
+	r.ConversationTimeout = time.Millisecond
+	key := ConversationKey{User: "U1", Channel: "C1"}
+	require.NoError(t, r.SaveConversation(key, "deploy.askEnvironment", nil))
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, _, found := r.FindConversation(key)
+	assert.False(t, found)
+
+	var count int64
+	r.DbConnection.Model(&models.Conversation{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestFindConversation_NoDatabase(t *testing.T) {
+	r := NewRouter()
+	_, _, found := r.FindConversation(ConversationKey{User: "U1"})
+	assert.False(t, found)
+}
+
+func TestClaimConversation_OnlyOnce(t *testing.T) {
+	r := newConversationRouter(t)
+	key := ConversationKey{User: "U1", Channel: "C1"}
+	require.NoError(t, r.SaveConversation(key, "deploy.askEnvironment", map[string]string{"app": "api"}))
+
+	conv, step, found, err := r.ClaimConversation(key)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "deploy.askEnvironment", step.Name)
+	assert.JSONEq(t, `{"app":"api"}`, string(conv.State))
+
+	_, _, found, err = r.ClaimConversation(key)
+	require.NoError(t, err)
+	assert.False(t, found, "a claimed conversation can't be claimed again")
+}
+
+func TestClaimConversation_DatabaseError(t *testing.T) {
+	r := newConversationRouter(t)
+	require.NoError(t, r.DbConnection.Migrator().DropTable(&models.Conversation{}))
+
+	_, _, found, err := r.ClaimConversation(ConversationKey{User: "U1", Channel: "C1"})
+
+	assert.Error(t, err)
+	assert.False(t, found)
+}
+
+func TestDeleteConversation(t *testing.T) {
+	r := newConversationRouter(t)
+	key := ConversationKey{User: "U1", Channel: "C1"}
+	require.NoError(t, r.SaveConversation(key, "deploy.askEnvironment", nil))
+
+	ctx := HandlerContext{Router: *r}
+	require.NoError(t, ctx.EndConversation(key))
+
+	_, _, found := r.FindConversation(key)
+	assert.False(t, found)
+}
+
+func TestIsConversationCancel(t *testing.T) {
+	r := NewRouter()
+	assert.True(t, r.IsConversationCancel("cancel"))
+	assert.True(t, r.IsConversationCancel("Never mind."))
+	assert.False(t, r.IsConversationCancel("production"))
+}
@@ -0,0 +1,168 @@
+package router
+
+import (
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/gadget-bot/gadget/models"
+	"github.com/gadget-bot/gadget/tracing"
+	"github.com/slack-go/slack"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Outcome is why a Resolve method chose the route it did. Gadget's HTTP
+// handlers and gadgettest's enforcing dispatcher both act on it, so tests see
+// the same routing as production.
+type Outcome int
+
+const (
+	// Matched means a route matched and the user may use it
+	Matched Outcome = iota
+	// Fallback means no enabled route matched, or the user isn't in the
+	// matching route's rollout
+	Fallback
+	// Denied means the user lacks the matching route's Permissions
+	Denied
+	// RateLimited means the user has used the matching route too often
+	RateLimited
+	// Help means a slash command asked for its generated help
+	Help
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Matched:
+		return "matched"
+	case Fallback:
+		return "fallback"
+	case Denied:
+		return "denied"
+	case RateLimited:
+		return "rate_limited"
+	case Help:
+		return "help"
+	}
+	return "unknown"
+}
+
+// check applies route's permissions and then its rate limits for u, in a
+// span of its own
+func (router Router) check(route Route, u models.User, channel string) (outcome Outcome) {
+	ctx, span := tracing.Tracer().Start(router.context(), "gadget.permission_check", trace.WithAttributes(
+		attribute.String("gadget.route", route.Name),
+		attribute.String("gadget.user", u.Uuid),
+	))
+	defer func() {
+		span.SetAttributes(attribute.String("gadget.outcome", outcome.String()))
+		span.End()
+	}()
+	router = router.WithContext(ctx)
+
+	if !router.Can(u, route.Permissions) {
+		return Denied
+	}
+	if !router.AllowRequest(route, u, channel) {
+		return RateLimited
+	}
+	return Matched
+}
+
+// ResolveMention returns the route that handles a mention of the bot by u in
+// channel: the matching route, DefaultMentionRoute on Fallback,
+// DeniedMentionRoute when u lacks permission, or RateLimitedMentionRoute.
+// Rate limits are only counted for routes u is permitted to use.
+func (router Router) ResolveMention(message, channel string, u models.User) (MentionRoute, Outcome) {
+	route, exists := router.FindMentionRouteByMessageInChannel(message, channel)
+	outcome := Matched
+	if !exists || !router.InRollout(route.Route, u) {
+		route, outcome = router.DefaultMentionRoute, Fallback
+	}
+
+	switch router.check(route.Route, u, channel) {
+	case Denied:
+		return router.DeniedMentionRoute, Denied
+	case RateLimited:
+		return router.RateLimitedMentionRoute, RateLimited
+	}
+	return route, outcome
+}
+
+// ResolveChannelMessage returns the route that handles message, posted by u
+// in channel: the matching route, DeniedChannelMessageRoute when u lacks
+// permission, or RateLimitedChannelMessageRoute. On Fallback no route
+// handles the message and the returned route is empty.
+func (router Router) ResolveChannelMessage(message, channel string, u models.User) (ChannelMessageRoute, Outcome) {
+	route, exists := router.FindChannelMessageRouteByMessageInChannel(message, channel)
+	if !exists || !router.InRollout(route.Route, u) {
+		return ChannelMessageRoute{}, Fallback
+	}
+
+	switch outcome := router.check(route.Route, u, channel); outcome {
+	case Denied:
+		return router.DeniedChannelMessageRoute, outcome
+	case RateLimited:
+		return router.RateLimitedChannelMessageRoute, outcome
+	}
+	return route, Matched
+}
+
+// ResolveMessage returns the platform-neutral route that handles msg, sent by
+// u: the matching route, DefaultMessageRoute on Fallback, DeniedMessageRoute
+// when u lacks permission, or RateLimitedMessageRoute. DefaultMessageRoute is
+// optional, so its Plugin may be nil.
+func (router Router) ResolveMessage(msg adapter.Message, u models.User) (MessageRoute, Outcome) {
+	route, exists := router.FindMessageRouteInChannel(msg.Text, msg.Channel)
+	if !exists || !router.InRollout(route.Route, u) {
+		return router.DefaultMessageRoute, Fallback
+	}
+
+	switch outcome := router.check(route.Route, u, msg.Channel); outcome {
+	case Denied:
+		return router.DeniedMessageRoute, outcome
+	case RateLimited:
+		return router.RateLimitedMessageRoute, outcome
+	}
+	return route, Matched
+}
+
+// ResolveSlashCommand returns the route that handles cmd, run by u: the
+// matching subcommand or fallback route, DeniedSlashCommandRoute when u lacks
+// permission, or RateLimitedSlashCommandRoute. On Help the caller answers
+// with SlashCommandHelp, and on Fallback with a pointer to it; the returned
+// route is empty for both. "help" gets the generated help even if a
+// catch-all subcommand matches it, unless a subcommand AnswersHelp.
+func (router Router) ResolveSlashCommand(cmd slack.SlashCommand, u models.User) (SlashCommandRoute, Outcome) {
+	var route SlashCommandRoute
+	var exists bool
+	if IsSlashCommandHelp(cmd.Text) {
+		if route, exists = router.findHelpSubcommandInChannel(cmd.Command, cmd.ChannelID); !exists {
+			return SlashCommandRoute{}, Help
+		}
+	} else {
+		route, exists = router.FindSlashCommandRouteInChannel(cmd.Command, cmd.Text, cmd.ChannelID)
+	}
+	if !exists || !router.InRollout(route.Route, u) {
+		return SlashCommandRoute{}, Fallback
+	}
+
+	switch outcome := router.check(route.Route, u, cmd.ChannelID); outcome {
+	case Denied:
+		return router.DeniedSlashCommandRoute, outcome
+	case RateLimited:
+		return router.RateLimitedSlashCommandRoute, outcome
+	}
+	return route, Matched
+}
+
+// ResolveBlockAction returns the route handling actionID, clicked by u in
+// channel. Block actions have no denied or rate limited routes, so the
+// returned route is empty unless the Outcome is Matched.
+func (router Router) ResolveBlockAction(actionID, channel string, u models.User) (BlockActionRoute, Outcome) {
+	route, exists := router.FindBlockActionRoute(actionID, channel)
+	if !exists {
+		return BlockActionRoute{}, Fallback
+	}
+	if outcome := router.check(route.Route, u, channel); outcome != Matched {
+		return BlockActionRoute{}, outcome
+	}
+	return route, Matched
+}
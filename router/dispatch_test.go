@@ -0,0 +1,212 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/gadget-bot/gadget/models"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newResolveRouter returns a router with a database, named fallback, denied
+// and rate limited routes, and a user in the "admins" group
+func newResolveRouter(t *testing.T) (*Router, models.User, models.User) {
+	t.Helper()
+	r := NewRouter()
+	r.DbConnection = setupTestDB(t)
+	r.DefaultMentionRoute = MentionRoute{Route: Route{Name: "fallback", Permissions: []string{"*"}}}
+	r.DeniedMentionRoute = MentionRoute{Route: Route{Name: "denied"}}
+	r.RateLimitedMentionRoute = MentionRoute{Route: Route{Name: "limited"}}
+	r.DeniedChannelMessageRoute = ChannelMessageRoute{Route: Route{Name: "denied"}}
+	r.RateLimitedChannelMessageRoute = ChannelMessageRoute{Route: Route{Name: "limited"}}
+	r.DeniedSlashCommandRoute = SlashCommandRoute{Route: Route{Name: "denied"}}
+	r.RateLimitedSlashCommandRoute = SlashCommandRoute{Route: Route{Name: "limited"}}
+	r.DefaultMessageRoute = MessageRoute{Route: Route{Name: "fallback", Permissions: []string{"*"}}}
+	r.DeniedMessageRoute = MessageRoute{Route: Route{Name: "denied"}}
+	r.RateLimitedMessageRoute = MessageRoute{Route: Route{Name: "limited"}}
+
+	admin := models.User{Uuid: "U_ADMIN"}
+	other := models.User{Uuid: "U_OTHER"}
+	require.NoError(t, r.DbConnection.Create(&admin).Error)
+	require.NoError(t, r.DbConnection.Create(&other).Error)
+	require.NoError(t, r.DbConnection.Create(&models.Group{Name: "admins", Members: []models.User{admin}}).Error)
+	return r, admin, other
+}
+
+func TestResolveMention(t *testing.T) {
+	r, admin, other := newResolveRouter(t)
+	r.AddMentionRoute(MentionRoute{
+		Route:  Route{Name: "deploy", Pattern: `^deploy`, Permissions: []string{"admins"}, RateLimits: []RateLimit{{Scope: RateLimitPerUser, Burst: 1, Every: time.Hour}}},
+		Plugin: func(HandlerContext, slackevents.AppMentionEvent, string) {},
+	})
+
+	route, outcome := r.ResolveMention("deploy", "C1", admin)
+	assert.Equal(t, "deploy", route.Name)
+	assert.Equal(t, Matched, outcome)
+
+	route, outcome = r.ResolveMention("deploy", "C1", admin)
+	assert.Equal(t, "limited", route.Name)
+	assert.Equal(t, RateLimited, outcome)
+
+	route, outcome = r.ResolveMention("deploy", "C1", other)
+	assert.Equal(t, "denied", route.Name)
+	assert.Equal(t, Denied, outcome)
+
+	route, outcome = r.ResolveMention("hello", "C1", other)
+	assert.Equal(t, "fallback", route.Name)
+	assert.Equal(t, Fallback, outcome)
+}
+
+func TestResolveChannelMessage(t *testing.T) {
+	r, admin, other := newResolveRouter(t)
+	r.AddChannelMessageRoute(ChannelMessageRoute{
+		Route:  Route{Name: "deploy", Pattern: `^deploy`, Permissions: []string{"admins"}},
+		Plugin: func(HandlerContext, slackevents.MessageEvent, string) {},
+	})
+
+	route, outcome := r.ResolveChannelMessage("deploy", "C1", admin)
+	assert.Equal(t, "deploy", route.Name)
+	assert.Equal(t, Matched, outcome)
+
+	route, outcome = r.ResolveChannelMessage("deploy", "C1", other)
+	assert.Equal(t, "denied", route.Name)
+	assert.Equal(t, Denied, outcome)
+
+	route, outcome = r.ResolveChannelMessage("hello", "C1", admin)
+	assert.Empty(t, route.Name)
+	assert.Equal(t, Fallback, outcome)
+}
+
+func TestResolveMessage(t *testing.T) {
+	r, admin, other := newResolveRouter(t)
+	r.AddMessageRoute(MessageRoute{
+		Route:  Route{Name: "deploy", Pattern: `^deploy`, Permissions: []string{"admins"}, RateLimits: []RateLimit{{Scope: RateLimitPerUser, Burst: 1, Every: time.Hour}}},
+		Plugin: func(HandlerContext, adapter.Message) {},
+	})
+	msg := adapter.Message{Platform: "mattermost", Channel: "ch1", Text: "deploy"}
+
+	route, outcome := r.ResolveMessage(msg, admin)
+	assert.Equal(t, "deploy", route.Name)
+	assert.Equal(t, Matched, outcome)
+
+	route, outcome = r.ResolveMessage(msg, admin)
+	assert.Equal(t, "limited", route.Name)
+	assert.Equal(t, RateLimited, outcome)
+
+	route, outcome = r.ResolveMessage(msg, other)
+	assert.Equal(t, "denied", route.Name)
+	assert.Equal(t, Denied, outcome)
+
+	msg.Text = "hello"
+	route, outcome = r.ResolveMessage(msg, other)
+	assert.Equal(t, "fallback", route.Name)
+	assert.Equal(t, Fallback, outcome)
+}
+
+func TestResolveMessage_DisabledInChannel(t *testing.T) {
+	r, admin, _ := newResolveRouter(t)
+	r.AddMessageRoute(MessageRoute{
+		Route:  Route{Name: "deploy", Pattern: `^deploy`, Permissions: []string{"*"}},
+		Plugin: func(HandlerContext, adapter.Message) {},
+	})
+	require.NoError(t, r.DisableRoute("deploy", "ch1"))
+
+	_, outcome := r.ResolveMessage(adapter.Message{Channel: "ch1", Text: "deploy"}, admin)
+	assert.Equal(t, Fallback, outcome)
+
+	_, outcome = r.ResolveMessage(adapter.Message{Channel: "ch2", Text: "deploy"}, admin)
+	assert.Equal(t, Matched, outcome)
+}
+
+func TestResolveSlashCommand(t *testing.T) {
+	r, admin, other := newResolveRouter(t)
+	r.AddSlashCommandRoute(SlashCommandRoute{
+		Route:   Route{Name: "deploy.run", Pattern: `^run`, Permissions: []string{"admins"}},
+		Command: "/deploy",
+		Plugin:  func(HandlerContext, slack.SlashCommand) {},
+	})
+
+	route, outcome := r.ResolveSlashCommand(slack.SlashCommand{Command: "/deploy", Text: "run"}, admin)
+	assert.Equal(t, "deploy.run", route.Name)
+	assert.Equal(t, Matched, outcome)
+
+	route, outcome = r.ResolveSlashCommand(slack.SlashCommand{Command: "/deploy", Text: "run"}, other)
+	assert.Equal(t, "denied", route.Name)
+	assert.Equal(t, Denied, outcome)
+
+	_, outcome = r.ResolveSlashCommand(slack.SlashCommand{Command: "/deploy", Text: "help"}, other)
+	assert.Equal(t, Help, outcome)
+
+	_, outcome = r.ResolveSlashCommand(slack.SlashCommand{Command: "/deploy", Text: "stop"}, admin)
+	assert.Equal(t, Fallback, outcome)
+}
+
+func TestResolveSlashCommand_HelpBeforeCatchAll(t *testing.T) {
+	r, admin, _ := newResolveRouter(t)
+	r.AddSlashCommandRoute(SlashCommandRoute{
+		Route:   Route{Name: "deploy.any", Pattern: `.+`},
+		Command: "/deploy",
+		Plugin:  func(HandlerContext, slack.SlashCommand) {},
+	})
+
+	_, outcome := r.ResolveSlashCommand(slack.SlashCommand{Command: "/deploy", Text: "help"}, admin)
+	assert.Equal(t, Help, outcome, "a catch-all subcommand shouldn't hide the generated help")
+
+	r.AddSlashCommandRoute(SlashCommandRoute{
+		Route:       Route{Name: "deploy.help", Pattern: `(?i)^(help|h|\?)$`, Priority: 10},
+		Command:     "/deploy",
+		AnswersHelp: true,
+		Plugin:      func(HandlerContext, slack.SlashCommand) {},
+	})
+	route, outcome := r.ResolveSlashCommand(slack.SlashCommand{Command: "/deploy", Text: "HELP"}, admin)
+	assert.Equal(t, Matched, outcome, "a subcommand that AnswersHelp replaces the generated help")
+	assert.Equal(t, "deploy.help", route.Name)
+	route, _ = r.ResolveSlashCommand(slack.SlashCommand{Command: "/deploy", Text: "h"}, admin)
+	assert.Equal(t, "deploy.help", route.Name)
+
+	require.NoError(t, r.DisableRoute("deploy.help", ""))
+	_, outcome = r.ResolveSlashCommand(slack.SlashCommand{Command: "/deploy", Text: "help"}, admin)
+	assert.Equal(t, Help, outcome, "a disabled help subcommand gives the generated help back")
+}
+
+func TestResolveBlockAction(t *testing.T) {
+	r, admin, other := newResolveRouter(t)
+	r.AddBlockActionRoute(BlockActionRoute{
+		Route:    Route{Name: "approve", Permissions: []string{"admins"}},
+		ActionID: "approve",
+		Plugin:   func(HandlerContext, slack.InteractionCallback, slack.BlockAction) {},
+	})
+
+	route, outcome := r.ResolveBlockAction("approve", "C1", admin)
+	assert.Equal(t, "approve", route.Name)
+	assert.Equal(t, Matched, outcome)
+
+	route, outcome = r.ResolveBlockAction("approve", "C1", other)
+	assert.Empty(t, route.Name)
+	assert.Equal(t, Denied, outcome)
+
+	_, outcome = r.ResolveBlockAction("reject", "C1", admin)
+	assert.Equal(t, Fallback, outcome)
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(ctx HandlerContext, next func(HandlerContext)) {
+			calls = append(calls, name)
+			next(ctx)
+		}
+	}
+	stop := func(ctx HandlerContext, next func(HandlerContext)) { calls = append(calls, "stop") }
+
+	Chain([]Middleware{record("first"), record("second")}, func(HandlerContext) { calls = append(calls, "handler") })(HandlerContext{})
+	assert.Equal(t, []string{"first", "second", "handler"}, calls)
+
+	calls = nil
+	Chain([]Middleware{stop, record("second")}, func(HandlerContext) { calls = append(calls, "handler") })(HandlerContext{})
+	assert.Equal(t, []string{"stop"}, calls)
+}
@@ -1,6 +1,12 @@
 package router
 
 import (
+	"context"
+	"sync"
+
+	"github.com/gadget-bot/gadget/adapter"
+	"github.com/gadget-bot/gadget/directory"
+	"github.com/gadget-bot/gadget/metrics"
 	"github.com/rs/zerolog"
 	"github.com/slack-go/slack"
 )
@@ -13,4 +19,65 @@ type HandlerContext struct {
 	BotClient  *slack.Client
 	UserClient *slack.Client // nil if no user token configured
 	Logger     zerolog.Logger
+	Origin     Origin               // where the triggering event came from; empty for scheduled jobs and webhooks
+	Directory  *directory.Directory // cached workspace users and channels
+	Adapter    adapter.Adapter      // the chat platform the triggering message came from; Slack's for Slack events
+	Metrics    *metrics.Metrics     // registers the plugin's own Prometheus metrics; nil-safe
+	Context    context.Context      // carries the plugin's trace span for Slack's *Context methods, e.g. PostMessageContext; may be nil
+	Identity   BotIdentity          // who the bot is in Slack
+	Workspace  WorkspaceFunc        // backs InWorkspace; nil outside Gadget
+	replies    *replyState
+}
+
+// WorkspaceFunc returns a HandlerContext acting in the workspace teamID
+type WorkspaceFunc func(teamID string) (HandlerContext, error)
+
+// Origin describes the conversation a handler is responding to, so that it
+// can reply without knowing which kind of event triggered it.
+type Origin struct {
+	Channel         string // channel, group or DM the event happened in
+	ThreadTimeStamp string // thread the event happened in; empty outside of threads
+	TimeStamp       string // the triggering message; empty for slash commands
+	User            string
+	ResponseURL     string // slash commands only
+}
+
+// replyState tracks the bot's most recent reply. It is shared by every copy
+// of a HandlerContext so that middleware and plugins see the same reply.
+type replyState struct {
+	mu          sync.Mutex
+	channel     string
+	timeStamp   string
+	responseURL bool // the reply was sent through the slash command's response_url
+}
+
+// context returns ctx.Context, or the background context if it's nil
+func (ctx HandlerContext) context() context.Context {
+	if ctx.Context == nil {
+		return context.Background()
+	}
+	return ctx.Context
+}
+
+// InWorkspace returns a copy of ctx whose clients, directory, identity and
+// router act in the workspace teamID, a Router.TeamID saved earlier, so
+// scheduled jobs can reach every workspace Gadget was installed in. An
+// empty teamID, or a ctx without Workspace, gets ctx unchanged.
+func (ctx HandlerContext) InWorkspace(teamID string) (HandlerContext, error) {
+	if ctx.Workspace == nil || teamID == "" {
+		return ctx, nil
+	}
+	ws, err := ctx.Workspace(teamID)
+	if err != nil {
+		return ctx, err
+	}
+	ws.Route, ws.Logger, ws.Origin, ws.Context, ws.replies = ctx.Route, ctx.Logger, ctx.Origin, ctx.Context, ctx.replies
+	return ws, nil
+}
+
+// WithOrigin returns a copy of ctx that replies to origin
+func (ctx HandlerContext) WithOrigin(origin Origin) HandlerContext {
+	ctx.Origin = origin
+	ctx.replies = &replyState{}
+	return ctx
 }
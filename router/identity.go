@@ -0,0 +1,54 @@
+package router
+
+import "sync"
+
+// BotIdentity is who the bot is in Slack, as auth.test reports it
+type BotIdentity struct {
+	UserID string // the bot user, e.g. "U0123"; mentions of the bot are "<@UserID>"
+	BotID  string // the bot, e.g. "B0123"; set as bot_id on the messages it posts
+	TeamID string // the workspace the bot's token belongs to
+	Team   string // the workspace's name
+	AppID  string // the Slack app the bot belongs to; empty if it couldn't be looked up
+}
+
+// Known returns true once the bot's user ID has been loaded
+func (id BotIdentity) Known() bool {
+	return id.UserID != ""
+}
+
+// Identity holds the BotIdentity loaded at startup. It's safe for concurrent
+// use, and a nil *Identity holds an unknown identity.
+type Identity struct {
+	mu       sync.RWMutex
+	identity BotIdentity
+}
+
+// NewIdentity returns an Identity holding identity
+func NewIdentity(identity BotIdentity) *Identity {
+	return &Identity{identity: identity}
+}
+
+// Get returns the identity held
+func (i *Identity) Get() BotIdentity {
+	if i == nil {
+		return BotIdentity{}
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.identity
+}
+
+// Set replaces the identity held
+func (i *Identity) Set(identity BotIdentity) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.identity = identity
+}
+
+// Update calls update with the identity held, holding the lock so that
+// changes based on its current value aren't lost to concurrent updates
+func (i *Identity) Update(update func(*BotIdentity)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	update(&i.identity)
+}
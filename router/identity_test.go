@@ -0,0 +1,59 @@
+package router
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentity_GetAndSet(t *testing.T) {
+	identity := NewIdentity(BotIdentity{UserID: "U_BOT"})
+	assert.True(t, identity.Get().Known())
+
+	identity.Set(BotIdentity{UserID: "U_OTHER", BotID: "B_OTHER"})
+
+	assert.Equal(t, BotIdentity{UserID: "U_OTHER", BotID: "B_OTHER"}, identity.Get())
+}
+
+func TestIdentity_NilIsUnknown(t *testing.T) {
+	var identity *Identity
+
+	assert.False(t, identity.Get().Known())
+}
+
+func TestIdentity_ConcurrentUse(t *testing.T) {
+	identity := &Identity{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			identity.Set(BotIdentity{UserID: "U_BOT"})
+		}()
+		go func() {
+			defer wg.Done()
+			_ = identity.Get()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, "U_BOT", identity.Get().UserID)
+}
+
+func TestIdentity_UpdateIsAtomic(t *testing.T) {
+	identity := &Identity{}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			identity.Update(func(id *BotIdentity) {
+				id.Team += "x"
+			})
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, identity.Get().Team, 50, "no update should be lost")
+}
@@ -0,0 +1,79 @@
+package router
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/gadget-bot/gadget/adapter"
+)
+
+// MessageRoute handles a message addressed to the bot on any chat platform
+// Gadget has an adapter for: a mention of the bot or a direct message.
+// Plugins reply with ctx.Adapter rather than ctx.BotClient, so the same route
+// runs on Slack and on, e.g., Mattermost.
+//
+// On Slack, MentionRoutes take precedence: a mention only reaches a
+// MessageRoute when no MentionRoute matches it, and a direct message only
+// when no ChannelMessageRoute does.
+type MessageRoute struct {
+	Route
+	Plugin func(ctx HandlerContext, msg adapter.Message)
+}
+
+// messageRoutesSortedByPriority implements Sort such that those with higher priority are first
+type messageRoutesSortedByPriority []MessageRoute
+
+// Execute calls Plugin()
+func (route MessageRoute) Execute(ctx HandlerContext, msg adapter.Message) {
+	ctx.Route = route.Route
+	route.Plugin(ctx, msg)
+}
+
+func (a messageRoutesSortedByPriority) Len() int { return len(a) }
+
+func (a messageRoutesSortedByPriority) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a messageRoutesSortedByPriority) Less(i, j int) bool {
+	if a[i].Priority != a[j].Priority {
+		return a[i].Priority > a[j].Priority
+	}
+	return a[i].Name < a[j].Name
+}
+
+// AddMessageRoute sets the key for MessageRoutes to route.Name and its value to route
+func (router *Router) AddMessageRoute(route MessageRoute) {
+	if route.Pattern != "" {
+		route.CompiledPattern = regexp.MustCompile(route.Pattern)
+	}
+	if router.MessageRoutes == nil {
+		router.MessageRoutes = make(map[string]MessageRoute)
+	}
+	router.MessageRoutes[route.Name] = route
+}
+
+// AddMessageRoutes calls AddMessageRoute for each element in routes
+func (router *Router) AddMessageRoutes(routes []MessageRoute) {
+	for _, route := range routes {
+		router.AddMessageRoute(route)
+	}
+}
+
+// FindMessageRouteInChannel returns the highest priority MessageRoute whose
+// Pattern matches text, skipping routes that are disabled in channel
+func (router Router) FindMessageRouteInChannel(text, channel string) (MessageRoute, bool) {
+	sortedRoutes := make([]MessageRoute, 0, len(router.MessageRoutes))
+	for _, route := range router.MessageRoutes {
+		sortedRoutes = append(sortedRoutes, route)
+	}
+	sort.Sort(messageRoutesSortedByPriority(sortedRoutes))
+
+	toggles := router.loadRouteToggles()
+	for _, route := range sortedRoutes {
+		if route.CompiledPattern != nil && route.CompiledPattern.MatchString(text) && toggles.enabled(route.Name, channel) {
+			return route, true
+		}
+	}
+	return MessageRoute{}, false
+}
@@ -0,0 +1,19 @@
+package router
+
+// Middleware wraps handler execution. Call next(ctx) to continue the chain,
+// or return without calling next to short-circuit.
+type Middleware func(ctx HandlerContext, next func(HandlerContext))
+
+// Chain builds a middleware chain ending with fn. Middleware runs in the
+// order given.
+func Chain(middleware []Middleware, fn func(HandlerContext)) func(HandlerContext) {
+	handler := fn
+	for i := len(middleware) - 1; i >= 0; i-- {
+		mw := middleware[i]
+		next := handler
+		handler = func(ctx HandlerContext) {
+			mw(ctx, next)
+		}
+	}
+	return handler
+}
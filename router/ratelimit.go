@@ -0,0 +1,226 @@
+package router
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	RateLimitPerUser    = "user"
+	RateLimitPerChannel = "channel"
+	RateLimitGlobal     = "global"
+)
+
+// RateLimit is a token bucket: up to Burst requests may be made at once, and
+// one more is allowed every Every. Scope decides who shares the bucket.
+type RateLimit struct {
+	Scope string // RateLimitPerUser, RateLimitPerChannel, or RateLimitGlobal
+	Burst int
+	Every time.Duration
+}
+
+// RateLimiter decides whether a request identified by key may proceed under limit.
+type RateLimiter interface {
+	Allow(key string, limit RateLimit, now time.Time) (bool, error)
+}
+
+// ParseRateLimit parses a per-user limit written as "COUNT/DURATION", e.g.
+// "10/1m" for a burst of 10 requests refilled over a minute.
+func ParseRateLimit(value string) (RateLimit, error) {
+	count, window, found := strings.Cut(value, "/")
+	if !found {
+		return RateLimit{}, fmt.Errorf("rate limit %q must look like COUNT/DURATION", value)
+	}
+	burst, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || burst < 1 {
+		return RateLimit{}, fmt.Errorf("rate limit %q has an invalid count", value)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q has an invalid duration", value)
+	}
+	return RateLimit{Scope: RateLimitPerUser, Burst: burst, Every: d / time.Duration(burst)}, nil
+}
+
+// UnmarshalText parses text with ParseRateLimit, so config files can write
+// rate limits as "COUNT/DURATION"
+func (limit *RateLimit) UnmarshalText(text []byte) error {
+	parsed, err := ParseRateLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*limit = parsed
+	return nil
+}
+
+// refill returns the tokens in a bucket after the time since refilledAt has passed
+func (limit RateLimit) refill(tokens float64, refilledAt, now time.Time) float64 {
+	if limit.Every <= 0 {
+		return float64(limit.Burst)
+	}
+	elapsed := now.Sub(refilledAt)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(limit.Burst), tokens+float64(elapsed)/float64(limit.Every))
+}
+
+// rateLimitKey returns the bucket key for route under limit in teamID's
+// workspace, or "" if the scope's identifier is unknown. Workspaces never
+// share buckets, since their user and channel IDs may collide.
+func rateLimitKey(teamID, routeName string, limit RateLimit, user, channel string) string {
+	var id string
+	switch limit.Scope {
+	case RateLimitPerUser:
+		id = user
+	case RateLimitPerChannel:
+		id = channel
+	case RateLimitGlobal:
+		id = "*"
+	}
+	if id == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", teamID, routeName, limit.Scope, id)
+}
+
+// memorySweepInterval is how often MemoryRateLimiter forgets full buckets
+const memorySweepInterval = time.Minute
+
+type tokenBucket struct {
+	tokens     float64
+	refilledAt time.Time
+	limit      RateLimit
+}
+
+// MemoryRateLimiter keeps token buckets in process memory. Limits are not
+// shared between replicas; use DBRateLimiter for that.
+type MemoryRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	nextSweep time.Time
+}
+
+// NewMemoryRateLimiter returns an empty MemoryRateLimiter
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow takes a token from the bucket for key if one is available
+func (l *MemoryRateLimiter) Allow(key string, limit RateLimit, now time.Time) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !now.Before(l.nextSweep) {
+		l.sweep(now)
+	}
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), refilledAt: now}
+		l.buckets[key] = bucket
+	}
+	bucket.limit = limit
+	bucket.tokens = limit.refill(bucket.tokens, bucket.refilledAt, now)
+	bucket.refilledAt = now
+	if bucket.tokens < 1 {
+		return false, nil
+	}
+	bucket.tokens--
+	return true, nil
+}
+
+// sweep forgets the buckets that have refilled to their Burst, since a new
+// bucket would start out the same, so keys seen once don't stay forever
+func (l *MemoryRateLimiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		if bucket.limit.refill(bucket.tokens, bucket.refilledAt, now) >= float64(bucket.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.nextSweep = now.Add(memorySweepInterval)
+}
+
+// DBRateLimiter stores token buckets in the database so that limits hold
+// across every replica sharing it.
+type DBRateLimiter struct {
+	db *gorm.DB
+}
+
+// NewDBRateLimiter returns a DBRateLimiter using db
+func NewDBRateLimiter(db *gorm.DB) *DBRateLimiter {
+	return &DBRateLimiter{db: db}
+}
+
+// Allow takes a token from the bucket for key if one is available. The bucket
+// row is locked for the duration of the update. A missing bucket is created
+// full first, ignoring the conflict if another replica creates it at the
+// same time, so the row is always there to lock and concurrent first
+// requests are counted against the same bucket.
+func (l *DBRateLimiter) Allow(key string, limit RateLimit, now time.Time) (bool, error) {
+	allowed := false
+	err := l.db.Transaction(func(tx *gorm.DB) error {
+		full := models.RateLimitBucket{BucketKey: key, Tokens: float64(limit.Burst), RefilledAt: now}
+		if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "bucket_key"}}, DoNothing: true}).Create(&full).Error; err != nil {
+			return err
+		}
+		var bucket models.RateLimitBucket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("bucket_key = ?", key).Take(&bucket).Error; err != nil {
+			return err
+		}
+		bucket.Tokens = limit.refill(bucket.Tokens, bucket.RefilledAt, now)
+		bucket.RefilledAt = now
+		if bucket.Tokens >= 1 {
+			bucket.Tokens--
+			allowed = true
+		}
+		return tx.Save(&bucket).Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("update rate limit bucket: %w", err)
+	}
+	return allowed, nil
+}
+
+// AllowRequest returns true if u may use route in channel under the route's
+// RateLimits, or the Router's DefaultRateLimits if it declares none. Limits
+// are checked in order and a request denied by one still spends tokens from
+// those before it. Global admins are never limited, and requests are allowed
+// if the limiter fails.
+func (router Router) AllowRequest(route Route, u models.User, channel string) bool {
+	limits := route.RateLimits
+	if len(limits) == 0 {
+		limits = router.DefaultRateLimits
+	}
+	if len(limits) == 0 || router.RateLimiter == nil {
+		return true
+	}
+	if router.IsGlobalAdmin(u) {
+		return true
+	}
+
+	now := time.Now()
+	for _, limit := range limits {
+		key := rateLimitKey(router.TeamID, route.Name, limit, u.Uuid, channel)
+		if key == "" {
+			continue
+		}
+		allowed, err := router.RateLimiter.Allow(key, limit, now)
+		if err != nil {
+			log.Error().Err(err).Str("key", key).Msg("Rate limiter failed; allowing request")
+			continue
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
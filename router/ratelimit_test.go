@@ -0,0 +1,185 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	limit, err := ParseRateLimit("10/1m")
+	require.NoError(t, err)
+	assert.Equal(t, RateLimit{Scope: RateLimitPerUser, Burst: 10, Every: 6 * time.Second}, limit)
+
+	for _, invalid := range []string{"10", "x/1m", "0/1m", "10/forever", "10/-1s"} {
+		_, err := ParseRateLimit(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRateLimit_UnmarshalText(t *testing.T) {
+	var limit RateLimit
+	require.NoError(t, limit.UnmarshalText([]byte("5/1m")))
+	assert.Equal(t, RateLimit{Scope: RateLimitPerUser, Burst: 5, Every: 12 * time.Second}, limit)
+
+	assert.Error(t, limit.UnmarshalText([]byte("often")))
+}
+
+func TestMemoryRateLimiter_TokenBucket(t *testing.T) {
+	l := NewMemoryRateLimiter()
+	limit := RateLimit{Scope: RateLimitPerUser, Burst: 2, Every: time.Minute}
+	now := time.Now()
+
+	allowed, _ := l.Allow("k", limit, now)
+	assert.True(t, allowed)
+	allowed, _ = l.Allow("k", limit, now)
+	assert.True(t, allowed)
+	allowed, _ = l.Allow("k", limit, now)
+	assert.False(t, allowed, "burst should be exhausted")
+
+	allowed, _ = l.Allow("other", limit, now)
+	assert.True(t, allowed, "buckets are per key")
+
+	allowed, _ = l.Allow("k", limit, now.Add(time.Minute))
+	assert.True(t, allowed, "one token should refill after Every")
+	allowed, _ = l.Allow("k", limit, now.Add(time.Minute))
+	assert.False(t, allowed)
+}
+
+func TestMemoryRateLimiter_ForgetsFullBuckets(t *testing.T) {
+	l := NewMemoryRateLimiter()
+	limit := RateLimit{Scope: RateLimitPerUser, Burst: 2, Every: time.Minute}
+	now := time.Now()
+
+	_, _ = l.Allow("idle", limit, now)
+	_, _ = l.Allow("busy", limit, now)
+	_, _ = l.Allow("busy", limit, now)
+	require.Len(t, l.buckets, 2)
+
+	// a minute later "idle" is full again, but "busy" has only one token
+	_, _ = l.Allow("new", limit, now.Add(time.Minute))
+
+	assert.Len(t, l.buckets, 2)
+	assert.NotContains(t, l.buckets, "idle")
+	assert.Contains(t, l.buckets, "busy")
+	allowed, _ := l.Allow("busy", limit, now.Add(time.Minute))
+	assert.True(t, allowed)
+	allowed, _ = l.Allow("busy", limit, now.Add(time.Minute))
+	assert.False(t, allowed, "sweeping shouldn't refill buckets")
+}
+
+func TestDBRateLimiter_SharesBuckets(t *testing.T) {
+	db := setupTestDB(t)
+	replicaA := NewDBRateLimiter(db)
+	replicaB := NewDBRateLimiter(db)
+	limit := RateLimit{Scope: RateLimitGlobal, Burst: 1, Every: time.Hour}
+	now := time.Now()
+
+	allowed, err := replicaA.Allow("k", limit, now)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, err = replicaB.Allow("k", limit, now)
+	require.NoError(t, err)
+	assert.False(t, allowed, "the second replica should see the spent token")
+
+	allowed, err = replicaB.Allow("k", limit, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	var count int64
+	db.Model(&models.RateLimitBucket{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestDBRateLimiter_UsesABucketAnotherReplicaCreated(t *testing.T) {
+	db := setupTestDB(t)
+	limit := RateLimit{Scope: RateLimitGlobal, Burst: 2, Every: time.Hour}
+	now := time.Now()
+	// another replica created the bucket and spent a token first
+	require.NoError(t, db.Create(&models.RateLimitBucket{BucketKey: "k", Tokens: 1, RefilledAt: now}).Error)
+
+	allowed, err := NewDBRateLimiter(db).Allow("k", limit, now)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, err = NewDBRateLimiter(db).Allow("k", limit, now)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	var count int64
+	db.Model(&models.RateLimitBucket{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestAllowRequest_PerWorkspace(t *testing.T) {
+	r := NewRouter()
+	r.DbConnection = setupTestDB(t)
+	route := Route{Name: "deploy.run", RateLimits: []RateLimit{{Scope: RateLimitPerUser, Burst: 1, Every: time.Hour}}}
+	u := models.User{Uuid: "U1"}
+	r.DbConnection.Create(&u)
+	tenant := *r
+	tenant.TeamID = "T_TENANT"
+
+	assert.True(t, r.AllowRequest(route, u, "C1"))
+	assert.False(t, r.AllowRequest(route, u, "C1"))
+	assert.True(t, tenant.AllowRequest(route, u, "C1"), "another workspace's U1 has its own bucket")
+}
+
+func TestAllowRequest_PerUserAndChannel(t *testing.T) {
+	r := NewRouter()
+	r.DbConnection = setupTestDB(t)
+	route := Route{Name: "deploy.run", RateLimits: []RateLimit{
+		{Scope: RateLimitPerUser, Burst: 1, Every: time.Hour},
+		{Scope: RateLimitPerChannel, Burst: 2, Every: time.Hour},
+	}}
+	u1 := models.User{Uuid: "U1"}
+	u2 := models.User{Uuid: "U2"}
+	u3 := models.User{Uuid: "U3"}
+	r.DbConnection.Create(&u1)
+	r.DbConnection.Create(&u2)
+	r.DbConnection.Create(&u3)
+
+	assert.True(t, r.AllowRequest(route, u1, "C1"))
+	assert.False(t, r.AllowRequest(route, u1, "C2"), "per-user limit applies across channels")
+	assert.True(t, r.AllowRequest(route, u2, "C1"))
+	assert.False(t, r.AllowRequest(route, u3, "C1"), "per-channel limit should be exhausted")
+	assert.False(t, r.AllowRequest(route, u2, "C2"), "u2 already spent their token")
+}
+
+func TestAllowRequest_DefaultRateLimits(t *testing.T) {
+	r := NewRouter()
+	r.DbConnection = setupTestDB(t)
+	r.DefaultRateLimits = []RateLimit{{Scope: RateLimitGlobal, Burst: 1, Every: time.Hour}}
+	u := models.User{Uuid: "U1"}
+	r.DbConnection.Create(&u)
+
+	assert.True(t, r.AllowRequest(Route{Name: "a"}, u, "C1"))
+	assert.False(t, r.AllowRequest(Route{Name: "a"}, u, "C1"))
+	assert.True(t, r.AllowRequest(Route{Name: "b"}, u, "C1"), "limits are per route")
+}
+
+func TestAllowRequest_GlobalAdminsExempt(t *testing.T) {
+	db := setupTestDB(t)
+	r := NewRouter()
+	r.DbConnection = db
+	admin := models.User{Uuid: "U_ADMIN"}
+	db.Create(&admin)
+	group := models.Group{Name: "globalAdmins"}
+	db.Create(&group)
+	require.NoError(t, db.Model(&group).Association("Members").Append(&admin))
+
+	route := Route{Name: "deploy.run", RateLimits: []RateLimit{{Scope: RateLimitPerUser, Burst: 1, Every: time.Hour}}}
+	for i := 0; i < 5; i++ {
+		assert.True(t, r.AllowRequest(route, admin, "C1"))
+	}
+	assert.True(t, r.IsGlobalAdmin(admin))
+}
+
+func TestAllowRequest_NoLimiter(t *testing.T) {
+	r := Router{}
+	route := Route{Name: "x", RateLimits: []RateLimit{{Scope: RateLimitGlobal, Burst: 0, Every: time.Hour}}}
+	assert.True(t, r.AllowRequest(route, models.User{Uuid: "U1"}, "C1"))
+}
@@ -0,0 +1,175 @@
+package router
+
+import (
+	"errors"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// ErrNoOrigin is returned by the reply methods when the HandlerContext was
+// not created in response to a Slack event, e.g. for scheduled jobs.
+var ErrNoOrigin = errors.New("handler context has no origin to reply to")
+
+// ErrNoReply is returned by UpdateReply and DeleteReply when the handler
+// hasn't replied yet.
+var ErrNoReply = errors.New("no previous reply")
+
+// OriginFromMention returns the origin of an app mention
+func OriginFromMention(ev slackevents.AppMentionEvent) Origin {
+	return Origin{Channel: ev.Channel, ThreadTimeStamp: ev.ThreadTimeStamp, TimeStamp: ev.TimeStamp, User: ev.User}
+}
+
+// OriginFromMessage returns the origin of a channel or direct message
+func OriginFromMessage(ev slackevents.MessageEvent) Origin {
+	return Origin{Channel: ev.Channel, ThreadTimeStamp: ev.ThreadTimeStamp, TimeStamp: ev.TimeStamp, User: ev.User}
+}
+
+// OriginFromSlashCommand returns the origin of a slash command
+func OriginFromSlashCommand(cmd slack.SlashCommand) Origin {
+	return Origin{Channel: cmd.ChannelID, User: cmd.UserID, ResponseURL: cmd.ResponseURL}
+}
+
+// Reply posts text, plus any extra options such as blocks, where the
+// triggering event happened: in the same thread for messages, or through the
+// response_url, visible to the whole channel, for slash commands.
+func (ctx HandlerContext) Reply(text string, options ...slack.MsgOption) error {
+	return ctx.reply(ctx.Origin.ThreadTimeStamp, text, options)
+}
+
+// ReplyInThread is like Reply but starts a thread on the triggering message
+// if it wasn't already in one. Slash commands have no message to thread on,
+// so this is the same as Reply for them.
+func (ctx HandlerContext) ReplyInThread(text string, options ...slack.MsgOption) error {
+	thread := ctx.Origin.ThreadTimeStamp
+	if thread == "" {
+		thread = ctx.Origin.TimeStamp
+	}
+	return ctx.reply(thread, text, options)
+}
+
+func (ctx HandlerContext) reply(thread, text string, options []slack.MsgOption) error {
+	if ctx.Origin.ResponseURL != "" {
+		return ctx.respond(slack.ResponseTypeInChannel, text, options)
+	}
+	if ctx.Origin.Channel == "" {
+		return ErrNoOrigin
+	}
+
+	opts := append([]slack.MsgOption{slack.MsgOptionText(text, false)}, options...)
+	if thread != "" {
+		opts = append(opts, slack.MsgOptionTS(thread))
+	}
+	channel, ts, err := ctx.BotClient.PostMessageContext(ctx.context(), ctx.Origin.Channel, opts...)
+	if err != nil {
+		ctx.Logger.Error().Err(err).Str("channel", ctx.Origin.Channel).Str("plugin", ctx.Route.Name).Msg("Failed to post reply")
+		return err
+	}
+	ctx.remember(channel, ts, false)
+	return nil
+}
+
+// respond sends a message through the slash command's response_url
+func (ctx HandlerContext) respond(responseType, text string, options []slack.MsgOption) error {
+	opts := append([]slack.MsgOption{slack.MsgOptionText(text, false)}, options...)
+	opts = append(opts, slack.MsgOptionResponseURL(ctx.Origin.ResponseURL, responseType))
+	if _, _, err := ctx.BotClient.PostMessageContext(ctx.context(), ctx.Origin.Channel, opts...); err != nil {
+		ctx.Logger.Error().Err(err).Str("channel", ctx.Origin.Channel).Str("plugin", ctx.Route.Name).Msg("Failed to respond to slash command")
+		return err
+	}
+	ctx.remember("", "", true)
+	return nil
+}
+
+// ReplyEphemeral replies with a message only the triggering user can see.
+// Ephemeral replies to messages can't be updated or deleted later.
+func (ctx HandlerContext) ReplyEphemeral(text string, options ...slack.MsgOption) error {
+	if ctx.Origin.ResponseURL != "" {
+		return ctx.respond(slack.ResponseTypeEphemeral, text, options)
+	}
+	if ctx.Origin.Channel == "" || ctx.Origin.User == "" {
+		return ErrNoOrigin
+	}
+
+	opts := append([]slack.MsgOption{slack.MsgOptionText(text, false)}, options...)
+	if ctx.Origin.ThreadTimeStamp != "" {
+		opts = append(opts, slack.MsgOptionTS(ctx.Origin.ThreadTimeStamp))
+	}
+	if _, err := ctx.BotClient.PostEphemeralContext(ctx.context(), ctx.Origin.Channel, ctx.Origin.User, opts...); err != nil {
+		ctx.Logger.Error().Err(err).Str("channel", ctx.Origin.Channel).Str("plugin", ctx.Route.Name).Msg("Failed to post ephemeral reply")
+		return err
+	}
+	return nil
+}
+
+// React adds the named emoji reaction, e.g. "thumbsup", to the triggering
+// message. Slash commands have no message to react to.
+func (ctx HandlerContext) React(name string) error {
+	if ctx.Origin.Channel == "" || ctx.Origin.TimeStamp == "" {
+		return ErrNoOrigin
+	}
+	if err := ctx.BotClient.AddReactionContext(ctx.context(), name, slack.NewRefToMessage(ctx.Origin.Channel, ctx.Origin.TimeStamp)); err != nil {
+		ctx.Logger.Error().Err(err).Str("channel", ctx.Origin.Channel).Str("plugin", ctx.Route.Name).Str("reaction", name).Msg("Failed to add reaction")
+		return err
+	}
+	return nil
+}
+
+// UpdateReply replaces the text of the handler's most recent reply
+func (ctx HandlerContext) UpdateReply(text string, options ...slack.MsgOption) error {
+	channel, ts, responseURL := ctx.lastReply()
+	opts := append([]slack.MsgOption{slack.MsgOptionText(text, false)}, options...)
+
+	var err error
+	switch {
+	case responseURL:
+		_, _, err = ctx.BotClient.PostMessageContext(ctx.context(), ctx.Origin.Channel, append(opts, slack.MsgOptionReplaceOriginal(ctx.Origin.ResponseURL))...)
+	case ts != "":
+		_, _, _, err = ctx.BotClient.UpdateMessageContext(ctx.context(), channel, ts, opts...)
+	default:
+		return ErrNoReply
+	}
+	if err != nil {
+		ctx.Logger.Error().Err(err).Str("channel", ctx.Origin.Channel).Str("plugin", ctx.Route.Name).Msg("Failed to update reply")
+	}
+	return err
+}
+
+// DeleteReply deletes the handler's most recent reply
+func (ctx HandlerContext) DeleteReply() error {
+	channel, ts, responseURL := ctx.lastReply()
+
+	var err error
+	switch {
+	case responseURL:
+		_, _, err = ctx.BotClient.PostMessageContext(ctx.context(), ctx.Origin.Channel, slack.MsgOptionDeleteOriginal(ctx.Origin.ResponseURL))
+	case ts != "":
+		_, _, err = ctx.BotClient.DeleteMessageContext(ctx.context(), channel, ts)
+	default:
+		return ErrNoReply
+	}
+	if err != nil {
+		ctx.Logger.Error().Err(err).Str("channel", ctx.Origin.Channel).Str("plugin", ctx.Route.Name).Msg("Failed to delete reply")
+		return err
+	}
+	ctx.remember("", "", false)
+	return nil
+}
+
+func (ctx HandlerContext) remember(channel, ts string, responseURL bool) {
+	if ctx.replies == nil {
+		return
+	}
+	ctx.replies.mu.Lock()
+	defer ctx.replies.mu.Unlock()
+	ctx.replies.channel, ctx.replies.timeStamp, ctx.replies.responseURL = channel, ts, responseURL
+}
+
+func (ctx HandlerContext) lastReply() (channel, ts string, responseURL bool) {
+	if ctx.replies == nil {
+		return "", "", false
+	}
+	ctx.replies.mu.Lock()
+	defer ctx.replies.mu.Unlock()
+	return ctx.replies.channel, ctx.replies.timeStamp, ctx.replies.responseURL
+}
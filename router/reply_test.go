@@ -0,0 +1,179 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type slackCall struct {
+	path string
+	form url.Values
+	json map[string]interface{}
+}
+
+// newReplyTestContext returns a HandlerContext whose Slack API calls, and
+// requests to the returned response URL, are appended to calls
+func newReplyTestContext(t *testing.T, calls *[]slackCall) (HandlerContext, string) {
+	t.Helper()
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := slackCall{path: r.URL.Path}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			body, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &call.json)
+		} else {
+			_ = r.ParseForm()
+			call.form = r.PostForm
+		}
+		mu.Lock()
+		*calls = append(*calls, call)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1111.2222","message_ts":"3333.4444"}`)) //nolint:errcheck // test HTTP response on loopback
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := HandlerContext{
+		BotClient: slack.New("xoxb-fake", slack.OptionAPIURL(server.URL+"/")),
+		Logger:    zerolog.Nop(),
+	}
+	return ctx, server.URL + "/response"
+}
+
+func TestReply_Mention(t *testing.T) {
+	var calls []slackCall
+	ctx, _ := newReplyTestContext(t, &calls)
+	ctx = ctx.WithOrigin(OriginFromMention(slackevents.AppMentionEvent{Channel: "C123", User: "U1", TimeStamp: "1000.0001"}))
+
+	assert.NoError(t, ctx.Reply("hello"))
+
+	require.Len(t, calls, 1)
+	assert.Equal(t, "/chat.postMessage", calls[0].path)
+	assert.Equal(t, "C123", calls[0].form.Get("channel"))
+	assert.Equal(t, "hello", calls[0].form.Get("text"))
+	assert.Empty(t, calls[0].form.Get("thread_ts"))
+}
+
+func TestReply_StaysInThread(t *testing.T) {
+	var calls []slackCall
+	ctx, _ := newReplyTestContext(t, &calls)
+	ctx = ctx.WithOrigin(OriginFromMessage(slackevents.MessageEvent{Channel: "C123", User: "U1", TimeStamp: "1000.0002", ThreadTimeStamp: "1000.0001"}))
+
+	assert.NoError(t, ctx.Reply("hello"))
+
+	require.Len(t, calls, 1)
+	assert.Equal(t, "1000.0001", calls[0].form.Get("thread_ts"))
+}
+
+func TestReplyInThread_StartsThread(t *testing.T) {
+	var calls []slackCall
+	ctx, _ := newReplyTestContext(t, &calls)
+	ctx = ctx.WithOrigin(OriginFromMention(slackevents.AppMentionEvent{Channel: "C123", User: "U1", TimeStamp: "1000.0001"}))
+
+	assert.NoError(t, ctx.ReplyInThread("hello"))
+
+	require.Len(t, calls, 1)
+	assert.Equal(t, "1000.0001", calls[0].form.Get("thread_ts"))
+}
+
+func TestReplyEphemeral_Message(t *testing.T) {
+	var calls []slackCall
+	ctx, _ := newReplyTestContext(t, &calls)
+	ctx = ctx.WithOrigin(OriginFromMention(slackevents.AppMentionEvent{Channel: "C123", User: "U1", TimeStamp: "1000.0001"}))
+
+	assert.NoError(t, ctx.ReplyEphemeral("psst"))
+
+	require.Len(t, calls, 1)
+	assert.Equal(t, "/chat.postEphemeral", calls[0].path)
+	assert.Equal(t, "U1", calls[0].form.Get("user"))
+	assert.Equal(t, "psst", calls[0].form.Get("text"))
+}
+
+func TestReply_SlashCommandUsesResponseURL(t *testing.T) {
+	var calls []slackCall
+	ctx, responseURL := newReplyTestContext(t, &calls)
+	ctx = ctx.WithOrigin(OriginFromSlashCommand(slack.SlashCommand{ChannelID: "C123", UserID: "U1", ResponseURL: responseURL}))
+
+	assert.NoError(t, ctx.Reply("deployed"))
+	assert.NoError(t, ctx.ReplyEphemeral("only you"))
+	assert.NoError(t, ctx.UpdateReply("deployed!"))
+	assert.NoError(t, ctx.DeleteReply())
+
+	require.Len(t, calls, 4)
+	for _, call := range calls {
+		assert.Equal(t, "/response", call.path)
+	}
+	assert.Equal(t, "deployed", calls[0].json["text"])
+	assert.Equal(t, slack.ResponseTypeInChannel, calls[0].json["response_type"])
+	assert.Equal(t, slack.ResponseTypeEphemeral, calls[1].json["response_type"])
+	assert.Equal(t, true, calls[2].json["replace_original"])
+	assert.Equal(t, "deployed!", calls[2].json["text"])
+	assert.Equal(t, true, calls[3].json["delete_original"])
+}
+
+func TestReact(t *testing.T) {
+	var calls []slackCall
+	ctx, _ := newReplyTestContext(t, &calls)
+	ctx = ctx.WithOrigin(OriginFromMention(slackevents.AppMentionEvent{Channel: "C123", User: "U1", TimeStamp: "1000.0001"}))
+
+	assert.NoError(t, ctx.React("thumbsup"))
+
+	require.Len(t, calls, 1)
+	assert.Equal(t, "/reactions.add", calls[0].path)
+	assert.Equal(t, "thumbsup", calls[0].form.Get("name"))
+	assert.Equal(t, "1000.0001", calls[0].form.Get("timestamp"))
+}
+
+func TestReact_SlashCommandHasNoMessage(t *testing.T) {
+	var calls []slackCall
+	ctx, responseURL := newReplyTestContext(t, &calls)
+	ctx = ctx.WithOrigin(OriginFromSlashCommand(slack.SlashCommand{ChannelID: "C123", ResponseURL: responseURL}))
+
+	assert.ErrorIs(t, ctx.React("thumbsup"), ErrNoOrigin)
+	assert.Empty(t, calls)
+}
+
+func TestUpdateAndDeleteReply(t *testing.T) {
+	var calls []slackCall
+	ctx, _ := newReplyTestContext(t, &calls)
+	ctx = ctx.WithOrigin(OriginFromMention(slackevents.AppMentionEvent{Channel: "C123", User: "U1", TimeStamp: "1000.0001"}))
+
+	assert.ErrorIs(t, ctx.UpdateReply("too soon"), ErrNoReply)
+
+	assert.NoError(t, ctx.Reply("working on it..."))
+	// A copy of the context, as passed through middleware, shares the reply
+	copied := ctx
+	assert.NoError(t, copied.UpdateReply("done"))
+	assert.NoError(t, ctx.DeleteReply())
+	assert.ErrorIs(t, ctx.DeleteReply(), ErrNoReply)
+
+	require.Len(t, calls, 3)
+	assert.Equal(t, "/chat.update", calls[1].path)
+	assert.Equal(t, "1111.2222", calls[1].form.Get("ts"))
+	assert.Equal(t, "done", calls[1].form.Get("text"))
+	assert.Equal(t, "/chat.delete", calls[2].path)
+	assert.Equal(t, "1111.2222", calls[2].form.Get("ts"))
+}
+
+func TestReply_NoOrigin(t *testing.T) {
+	var calls []slackCall
+	ctx, _ := newReplyTestContext(t, &calls)
+
+	assert.ErrorIs(t, ctx.Reply("hello"), ErrNoOrigin)
+	assert.ErrorIs(t, ctx.ReplyEphemeral("hello"), ErrNoOrigin)
+	assert.ErrorIs(t, ctx.UpdateReply("hello"), ErrNoReply)
+	assert.Empty(t, calls)
+}
@@ -1,11 +1,14 @@
 package router
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/gadget-bot/gadget/models"
 	"github.com/rs/zerolog/log"
@@ -22,31 +25,65 @@ type Route struct {
 	Help            string
 	Permissions     []string
 	Priority        int
+	Rollout         *Rollout    // optional; nil routes every permitted user
+	RateLimits      []RateLimit // optional; empty uses the Router's DefaultRateLimits
 }
 
 const (
 	RouteTypeMention        = "mention"
 	RouteTypeChannelMessage = "channel_message"
 	RouteTypeSlashCommand   = "slash_command"
+	RouteTypeScheduledJob   = "scheduled_job"
+	RouteTypeWebhook        = "webhook"
+	RouteTypeBlockAction    = "block_action"
+	RouteTypeMessage        = "message"
 )
 
 // RegisteredRoute wraps a Route with its type for introspection
 type RegisteredRoute struct {
 	Route
-	Type string // RouteTypeMention, RouteTypeChannelMessage, or RouteTypeSlashCommand
+	Type     string // RouteTypeMention, RouteTypeChannelMessage, RouteTypeSlashCommand, RouteTypeScheduledJob, RouteTypeWebhook, RouteTypeBlockAction, or RouteTypeMessage
+	Disabled bool   // true if the route has been disabled globally
 }
 
 // Router the HTTP router which handles Events from Slack
 type Router struct {
-	MentionRoutes             map[string]MentionRoute
-	ChannelMessageRoutes      map[string]ChannelMessageRoute
-	SlashCommandRoutes        map[string]SlashCommandRoute
-	DefaultMentionRoute       MentionRoute
-	DeniedMentionRoute        MentionRoute
-	DeniedChannelMessageRoute ChannelMessageRoute
-	DeniedSlashCommandRoute   SlashCommandRoute
-	DbConnection              *gorm.DB
-	BotUID                    string
+	MentionRoutes                  map[string]MentionRoute
+	ChannelMessageRoutes           map[string]ChannelMessageRoute
+	SlashCommandRoutes             map[string]SlashCommandRoute // fallback route for each command, keyed by Command
+	SlashSubcommandRoutes          map[string]SlashCommandRoute // routes with a Pattern, keyed by Name
+	MessageRoutes                  map[string]MessageRoute      // platform-neutral routes, keyed by Name
+	DefaultMentionRoute            MentionRoute
+	DeniedMentionRoute             MentionRoute
+	DeniedChannelMessageRoute      ChannelMessageRoute
+	DeniedSlashCommandRoute        SlashCommandRoute
+	RateLimitedMentionRoute        MentionRoute
+	RateLimitedChannelMessageRoute ChannelMessageRoute
+	RateLimitedSlashCommandRoute   SlashCommandRoute
+	DefaultMessageRoute            MessageRoute // optional; answers messages from other platforms that no route matches
+	DeniedMessageRoute             MessageRoute
+	RateLimitedMessageRoute        MessageRoute
+	RateLimiter                    RateLimiter // nil disables rate limiting
+	DefaultRateLimits              []RateLimit // applied to routes that declare no RateLimits
+	ScheduledJobs                  map[string]ScheduledJob
+	WebhookRoutes                  map[string]WebhookRoute     // keyed by Path
+	BlockActionRoutes              map[string]BlockActionRoute // keyed by ActionID
+	ConversationSteps              map[string]ConversationStep
+	CancelledConversationStep      ConversationStep // optional; called when a user cancels an active conversation
+	ConversationTimeout            time.Duration    // 0 uses DefaultConversationTimeout
+	ConversationCancelPattern      *regexp.Regexp   // nil uses DefaultConversationCancelPattern
+	DbConnection                   *gorm.DB
+	TeamID                         string          // the installed workspace users and groups belong to; empty outside installed workspaces
+	Identity                       *Identity       // who the bot is; Gadget shares its own Identity here
+	ctx                            context.Context // set by WithContext; nil uses the background context
+	toggles                        *toggleCache    // set by NewRouter; nil loads route toggles every time
+
+	// BotUID is the bot's user ID, or "" until it's known. Gadget keeps it
+	// in sync with Identity in the Routers it hands to handlers.
+	//
+	// Deprecated: use Identity.Get().UserID, or HandlerContext.Identity in
+	// handlers.
+	BotUID string
 }
 
 // this is required because slack-go doesn't seem to provide a way to get the bot's own ID
@@ -71,22 +108,58 @@ func NewRouter() *Router {
 	newRouter.MentionRoutes = make(map[string]MentionRoute)
 	newRouter.ChannelMessageRoutes = make(map[string]ChannelMessageRoute)
 	newRouter.SlashCommandRoutes = make(map[string]SlashCommandRoute)
+	newRouter.SlashSubcommandRoutes = make(map[string]SlashCommandRoute)
+	newRouter.MessageRoutes = make(map[string]MessageRoute)
+	newRouter.ScheduledJobs = make(map[string]ScheduledJob)
+	newRouter.WebhookRoutes = make(map[string]WebhookRoute)
+	newRouter.BlockActionRoutes = make(map[string]BlockActionRoute)
+	newRouter.ConversationSteps = make(map[string]ConversationStep)
+	newRouter.RateLimiter = NewMemoryRateLimiter()
+	newRouter.toggles = newToggleCache()
 	return &newRouter
 }
 
-// UpdateBotUID sets the BotUID field from an event body. Only updates if currently empty.
+// WithContext returns a copy of router whose database calls, and the
+// permission checks made by the Resolve methods, run with ctx, so they're
+// traced under the span ctx carries
+func (router Router) WithContext(ctx context.Context) Router {
+	router.ctx = ctx
+	if router.DbConnection != nil {
+		router.DbConnection = router.DbConnection.WithContext(ctx)
+	}
+	return router
+}
+
+// context returns the context set by WithContext, or the background context
+func (router Router) context() context.Context {
+	if router.ctx == nil {
+		return context.Background()
+	}
+	return router.ctx
+}
+
+// UpdateBotUID sets the bot's user ID in Identity from an event body. Only
+// updates if it isn't known yet.
 //
-// Note: BotUID is effectively set-once; no synchronization is needed
-// because concurrent calls with valid bodies will all set the same value.
+// Deprecated: Gadget loads the bot's identity with auth.test at startup.
 func (r *Router) UpdateBotUID(body []byte) error {
-	if r.BotUID != "" {
+	if r.Identity.Get().Known() {
+		r.BotUID = r.Identity.Get().UserID
 		return nil
 	}
 	uid, err := getBotUidFromBody(body)
 	if err != nil {
 		return err
 	}
-	r.BotUID = uid
+	if r.Identity == nil {
+		r.Identity = &Identity{}
+	}
+	r.Identity.Update(func(identity *BotIdentity) {
+		if !identity.Known() {
+			identity.UserID = uid
+		}
+	})
+	r.BotUID = r.Identity.Get().UserID
 	return nil
 }
 
@@ -102,13 +175,67 @@ func getBotUidFromBody(body []byte) (string, error) {
 	return "", errors.New("no authorized users in event body")
 }
 
+// schemas are the models SetupDb migrates, with the names its errors use
+var schemas = []struct {
+	name  string
+	model interface{}
+}{
+	{"Group", &models.Group{}},
+	{"User", &models.User{}},
+	{"Conversation", &models.Conversation{}},
+	{"RouteToggle", &models.RouteToggle{}},
+	{"RateLimitBucket", &models.RateLimitBucket{}},
+	{"JobRun", &models.JobRun{}},
+	{"Reminder", &models.Reminder{}},
+	{"PagedList", &models.PagedList{}},
+	{"Installation", &models.Installation{}},
+}
+
+// legacyIndexes made users, groups and route toggles unique on their own,
+// before they belonged to teams
+var legacyIndexes = []struct {
+	model interface{}
+	name  string
+}{
+	{&models.User{}, "idx_users_uuid"},
+	{&models.Group{}, "idx_groups_name"},
+	{&models.RouteToggle{}, "idx_route_toggle_scope"},
+}
+
 // SetupDb migrates the schemas
 func (router Router) SetupDb() error {
-	if err := router.DbConnection.AutoMigrate(&models.Group{}); err != nil {
-		return fmt.Errorf("auto-migrate Group: %w", err)
+	for _, schema := range schemas {
+		if err := router.DbConnection.AutoMigrate(schema.model); err != nil {
+			return fmt.Errorf("auto-migrate %s: %w", schema.name, err)
+		}
+	}
+	migrator := router.DbConnection.Migrator()
+	for _, index := range legacyIndexes {
+		if !migrator.HasIndex(index.model, index.name) {
+			continue
+		}
+		if err := migrator.DropIndex(index.model, index.name); err != nil {
+			return fmt.Errorf("drop index %s: %w", index.name, err)
+		}
+	}
+	return nil
+}
+
+// CheckMigrations returns an error naming the models whose tables SetupDb
+// hasn't created
+func (router Router) CheckMigrations() error {
+	if router.DbConnection == nil {
+		return errors.New("no database connection")
+	}
+	migrator := router.DbConnection.Migrator()
+	var missing []string
+	for _, schema := range schemas {
+		if !migrator.HasTable(schema.model) {
+			missing = append(missing, schema.name)
+		}
 	}
-	if err := router.DbConnection.AutoMigrate(&models.User{}); err != nil {
-		return fmt.Errorf("auto-migrate User: %w", err)
+	if len(missing) > 0 {
+		return fmt.Errorf("tables not migrated: %s", strings.Join(missing, ", "))
 	}
 	return nil
 }
@@ -127,6 +254,12 @@ func (router Router) FindMentionRouteByName(name string) (MentionRoute, bool) {
 
 // FindChannelMessageRouteByMessage Returns the ChannelMessageRoute that matches the provided message
 func (router Router) FindChannelMessageRouteByMessage(message string) (ChannelMessageRoute, bool) {
+	return router.FindChannelMessageRouteByMessageInChannel(message, "")
+}
+
+// FindChannelMessageRouteByMessageInChannel Returns the ChannelMessageRoute that matches the provided
+// message, skipping routes that are disabled in channel
+func (router Router) FindChannelMessageRouteByMessageInChannel(message, channel string) (ChannelMessageRoute, bool) {
 	var matchingRoute ChannelMessageRoute
 	foundRoute := false
 	sortedRoutes := make([]ChannelMessageRoute, 0, len(router.ChannelMessageRoutes))
@@ -138,8 +271,9 @@ func (router Router) FindChannelMessageRouteByMessage(message string) (ChannelMe
 
 	sort.Sort(channelMessageRoutesSortedByPriority(sortedRoutes))
 
+	toggles := router.loadRouteToggles()
 	for _, route := range sortedRoutes {
-		if route.CompiledPattern != nil && route.CompiledPattern.MatchString(message) {
+		if route.CompiledPattern != nil && route.CompiledPattern.MatchString(message) && toggles.enabled(route.Name, channel) {
 			matchingRoute = route
 			foundRoute = true
 			break
@@ -151,6 +285,12 @@ func (router Router) FindChannelMessageRouteByMessage(message string) (ChannelMe
 
 // FindMentionRouteByMessage Returns the route to execute based on the first matched Route.Pattern.
 func (router Router) FindMentionRouteByMessage(message string) (MentionRoute, bool) {
+	return router.FindMentionRouteByMessageInChannel(message, "")
+}
+
+// FindMentionRouteByMessageInChannel Returns the route to execute based on the first matched
+// Route.Pattern, skipping routes that are disabled in channel.
+func (router Router) FindMentionRouteByMessageInChannel(message, channel string) (MentionRoute, bool) {
 	var matchingRoute MentionRoute
 	foundRoute := false
 	sortedRoutes := make([]MentionRoute, 0, len(router.MentionRoutes))
@@ -161,8 +301,9 @@ func (router Router) FindMentionRouteByMessage(message string) (MentionRoute, bo
 	}
 	sort.Sort(mentionRoutesSortedByPriority(sortedRoutes))
 
+	toggles := router.loadRouteToggles()
 	for _, route := range sortedRoutes {
-		if route.CompiledPattern != nil && route.CompiledPattern.MatchString(message) {
+		if route.CompiledPattern != nil && route.CompiledPattern.MatchString(message) && toggles.enabled(route.Name, channel) {
 			matchingRoute = route
 			foundRoute = true
 			break
@@ -171,6 +312,40 @@ func (router Router) FindMentionRouteByMessage(message string) (MentionRoute, bo
 	return matchingRoute, foundRoute
 }
 
+// IsGlobalAdmin Returns true if `u` is a member of the globalAdmins group of
+// router's team
+func (router Router) IsGlobalAdmin(u models.User) bool {
+	if router.DbConnection == nil {
+		return false
+	}
+	count := router.DbConnection.Model(&u).Where("name = ? AND team_id = ?", "globalAdmins", router.TeamID).Association("Groups").Count()
+	return count > 0
+}
+
+// FindOrCreateUser returns the stored user with uuid in router's team,
+// creating it if there isn't one
+func (router Router) FindOrCreateUser(uuid string) models.User {
+	var u models.User
+	err := router.DbConnection.Where("team_id = ? AND uuid = ?", router.TeamID, uuid).
+		FirstOrCreate(&u, models.User{Uuid: uuid, TeamID: router.TeamID}).Error
+	if err != nil {
+		log.Error().Err(err).Str("user", uuid).Str("team", router.TeamID).Msg("Failed to load user")
+	}
+	return u
+}
+
+// FindOrCreateGroup returns the stored group named name in router's team,
+// creating it if there isn't one
+func (router Router) FindOrCreateGroup(name string) models.Group {
+	var g models.Group
+	err := router.DbConnection.Where("team_id = ? AND name = ?", router.TeamID, name).
+		FirstOrCreate(&g, models.Group{Name: name, TeamID: router.TeamID}).Error
+	if err != nil {
+		log.Error().Err(err).Str("group", name).Str("team", router.TeamID).Msg("Failed to load group")
+	}
+	return g
+}
+
 // Can Returns true if `u` possesses the provided permissions
 func (router Router) Can(u models.User, permissions []string) bool {
 	var userGroupNames []string
@@ -182,6 +357,10 @@ func (router Router) Can(u models.User, permissions []string) bool {
 	}
 
 	for _, userGroup := range userGroups {
+		// Groups only grant permissions in their own workspace
+		if userGroup.TeamID != router.TeamID {
+			continue
+		}
 		// If the user is a global admin, let them through
 		if userGroup.Name == "globalAdmins" {
 			return true
@@ -239,12 +418,19 @@ func (router *Router) AddChannelMessageRoutes(routes []ChannelMessageRoute) {
 	}
 }
 
-// AddSlashCommandRoute adds a slash command route keyed by its Name
+// AddSlashCommandRoute adds a slash command route. Routes with a Pattern are
+// subcommands keyed by their Name; a route without one becomes the fallback
+// for its Command.
 func (router *Router) AddSlashCommandRoute(route SlashCommandRoute) {
-	if route.Pattern != "" {
-		route.CompiledPattern = regexp.MustCompile(route.Pattern)
+	if route.Pattern == "" {
+		router.SlashCommandRoutes[route.Command] = route
+		return
+	}
+	route.CompiledPattern = regexp.MustCompile(route.Pattern)
+	if router.SlashSubcommandRoutes == nil {
+		router.SlashSubcommandRoutes = make(map[string]SlashCommandRoute)
 	}
-	router.SlashCommandRoutes[route.Command] = route
+	router.SlashSubcommandRoutes[route.Name] = route
 }
 
 // AddSlashCommandRoutes calls AddSlashCommandRoute for each element in routes
@@ -254,7 +440,7 @@ func (router *Router) AddSlashCommandRoutes(routes []SlashCommandRoute) {
 	}
 }
 
-// FindSlashCommandRouteByCommand looks up a SlashCommandRoute by command name
+// FindSlashCommandRouteByCommand looks up the fallback SlashCommandRoute for a command name
 func (router Router) FindSlashCommandRouteByCommand(command string) (SlashCommandRoute, bool) {
 	route, exists := router.SlashCommandRoutes[command]
 	return route, exists
@@ -263,17 +449,38 @@ func (router Router) FindSlashCommandRouteByCommand(command string) (SlashComman
 // RegisteredRoutes returns all registered routes sorted by priority (descending),
 // then by name (alphabetical). DefaultMentionRoute and DeniedMentionRoute are excluded
 // because they are stored as separate struct fields, not entries in the route maps.
+// Routes that have been disabled globally are included and marked Disabled.
 func (router Router) RegisteredRoutes() []RegisteredRoute {
-	routes := make([]RegisteredRoute, 0, len(router.MentionRoutes)+len(router.ChannelMessageRoutes)+len(router.SlashCommandRoutes))
+	routes := make([]RegisteredRoute, 0, len(router.MentionRoutes)+len(router.ChannelMessageRoutes)+len(router.SlashCommandRoutes)+len(router.SlashSubcommandRoutes)+len(router.ScheduledJobs)+len(router.WebhookRoutes)+len(router.BlockActionRoutes)+len(router.MessageRoutes))
+
+	toggles := router.loadRouteToggles()
+	register := func(r Route, routeType string) {
+		routes = append(routes, RegisteredRoute{Route: r, Type: routeType, Disabled: !toggles.enabled(r.Name, "")})
+	}
 
 	for _, r := range router.MentionRoutes {
-		routes = append(routes, RegisteredRoute{Route: r.Route, Type: RouteTypeMention})
+		register(r.Route, RouteTypeMention)
 	}
 	for _, r := range router.ChannelMessageRoutes {
-		routes = append(routes, RegisteredRoute{Route: r.Route, Type: RouteTypeChannelMessage})
+		register(r.Route, RouteTypeChannelMessage)
 	}
 	for _, r := range router.SlashCommandRoutes {
-		routes = append(routes, RegisteredRoute{Route: r.Route, Type: RouteTypeSlashCommand})
+		register(r.Route, RouteTypeSlashCommand)
+	}
+	for _, r := range router.SlashSubcommandRoutes {
+		register(r.Route, RouteTypeSlashCommand)
+	}
+	for _, j := range router.ScheduledJobs {
+		register(j.Route, RouteTypeScheduledJob)
+	}
+	for _, w := range router.WebhookRoutes {
+		register(w.Route, RouteTypeWebhook)
+	}
+	for _, a := range router.BlockActionRoutes {
+		register(a.Route, RouteTypeBlockAction)
+	}
+	for _, m := range router.MessageRoutes {
+		register(m.Route, RouteTypeMessage)
 	}
 
 	sort.Slice(routes, func(i, j int) bool {
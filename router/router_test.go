@@ -20,7 +20,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	if err != nil {
 		t.Fatalf("Failed to open in-memory SQLite: %v", err)
 	}
-	if err := db.AutoMigrate(&models.Group{}, &models.User{}); err != nil {
+	if err := db.AutoMigrate(&models.Group{}, &models.User{}, &models.Conversation{}, &models.RouteToggle{}, &models.RateLimitBucket{}, &models.JobRun{}); err != nil {
 		t.Fatalf("Failed to auto-migrate: %v", err)
 	}
 	return db
@@ -32,6 +32,7 @@ func TestUpdateBotUID_ValidBody(t *testing.T) {
 	err := r.UpdateBotUID(body)
 	assert.NoError(t, err)
 	assert.Equal(t, "U_BOT", r.BotUID)
+	assert.Equal(t, "U_BOT", r.Identity.Get().UserID)
 }
 
 func TestUpdateBotUID_InvalidJSON(t *testing.T) {
@@ -50,11 +51,12 @@ func TestUpdateBotUID_MissingAuthorizations(t *testing.T) {
 
 func TestUpdateBotUID_AlreadySet(t *testing.T) {
 	r := NewRouter()
-	r.BotUID = "U_EXISTING"
+	r.Identity = NewIdentity(BotIdentity{UserID: "U_EXISTING", BotID: "B_EXISTING"})
 	body := []byte(`{"authorizations":[{"user_id":"U_NEW","team_id":"T123"}]}`)
 	err := r.UpdateBotUID(body)
 	assert.NoError(t, err)
 	assert.Equal(t, "U_EXISTING", r.BotUID)
+	assert.Equal(t, "B_EXISTING", r.Identity.Get().BotID)
 }
 
 func TestRegisteredRoutes_Empty(t *testing.T) {
@@ -132,6 +134,42 @@ func TestRegisteredRoutes_ExcludesDefaultAndDenied(t *testing.T) {
 	assert.Equal(t, "real_route", routes[0].Name)
 }
 
+func TestRegisteredRoutes_IncludesMessageRoutes(t *testing.T) {
+	r := NewRouter()
+	r.AddMessageRoute(MessageRoute{Route: Route{Name: "ping", Pattern: `^ping`}})
+
+	routes := r.RegisteredRoutes()
+	require.Len(t, routes, 1)
+	assert.Equal(t, RouteTypeMessage, routes[0].Type)
+}
+
+func TestFindMessageRouteInChannel_Priority(t *testing.T) {
+	r := NewRouter()
+	r.AddMessageRoutes([]MessageRoute{
+		{Route: Route{Name: "low", Pattern: `^deploy`, Priority: 1}},
+		{Route: Route{Name: "high", Pattern: `^deploy prod`, Priority: 10}},
+	})
+
+	route, found := r.FindMessageRouteInChannel("deploy prod", "C1")
+	require.True(t, found)
+	assert.Equal(t, "high", route.Name)
+
+	route, found = r.FindMessageRouteInChannel("deploy staging", "C1")
+	require.True(t, found)
+	assert.Equal(t, "low", route.Name)
+
+	_, found = r.FindMessageRouteInChannel("hello", "C1")
+	assert.False(t, found)
+}
+
+func TestAddMessageRoute_ZeroValueRouter(t *testing.T) {
+	var r Router
+	r.AddMessageRoute(MessageRoute{Route: Route{Name: "ping", Pattern: `^ping`}})
+
+	_, found := r.FindMessageRouteInChannel("ping", "")
+	assert.True(t, found)
+}
+
 func TestAddSlashCommandRoute(t *testing.T) {
 	r := NewRouter()
 	route := SlashCommandRoute{
@@ -280,8 +318,9 @@ func TestAddSlashCommandRoute_CompilesPattern(t *testing.T) {
 		Route:   Route{Name: "deploy", Pattern: `(?i)^production`},
 		Command: "/deploy",
 	})
-	route := r.SlashCommandRoutes["/deploy"]
+	route := r.SlashSubcommandRoutes["deploy"]
 	assert.NotNil(t, route.CompiledPattern)
+	assert.NotContains(t, r.SlashCommandRoutes, "/deploy", "routes with a Pattern are subcommands, not the fallback")
 }
 
 func TestFindMentionRouteByMessage_UsesCompiledPattern(t *testing.T) {
@@ -336,6 +375,25 @@ func TestCan_GlobalAdminAllowed(t *testing.T) {
 	assert.True(t, r.Can(user, []string{"some_permission"}))
 }
 
+func TestCan_GroupsOnlyCountInTheirTeam(t *testing.T) {
+	db := setupTestDB(t)
+	r := NewRouter()
+	r.DbConnection = db
+	tenant := *r
+	tenant.TeamID = "T_TENANT"
+
+	user := models.User{Uuid: "U_ADMIN"}
+	db.Create(&user)
+	group := models.Group{TeamID: "T_TENANT", Name: "globalAdmins"}
+	db.Create(&group)
+	require.NoError(t, db.Model(&group).Association("Members").Append(&user))
+
+	assert.True(t, tenant.Can(user, []string{"some_permission"}))
+	assert.True(t, tenant.IsGlobalAdmin(user))
+	assert.False(t, r.Can(user, []string{"some_permission"}), "a workspace's globalAdmins aren't global")
+	assert.False(t, r.IsGlobalAdmin(user))
+}
+
 func TestCan_EmptyPermissionsAllowAll(t *testing.T) {
 	db := setupTestDB(t)
 	r := NewRouter()
@@ -424,3 +482,82 @@ func TestCan_NilPermissionsAllowAll(t *testing.T) {
 
 	assert.True(t, r.Can(user, nil))
 }
+
+func TestCheckMigrations(t *testing.T) {
+	r := NewRouter()
+	r.DbConnection = setupTestDB(t)
+
+	assert.EqualError(t, r.CheckMigrations(), "tables not migrated: Reminder, PagedList, Installation")
+
+	require.NoError(t, r.SetupDb())
+	assert.NoError(t, r.CheckMigrations())
+}
+
+func TestCheckMigrations_NoDatabase(t *testing.T) {
+	assert.Error(t, NewRouter().CheckMigrations())
+}
+
+// legacyUser is the users table before users belonged to teams
+type legacyUser struct {
+	gorm.Model
+	Uuid string `gorm:"index:,unique"`
+}
+
+func (legacyUser) TableName() string { return "users" }
+
+// legacyRouteToggle is the route_toggles table before toggles belonged to teams
+type legacyRouteToggle struct {
+	gorm.Model
+	Target  string `gorm:"index:idx_route_toggle_scope,unique;size:191"`
+	Channel string `gorm:"index:idx_route_toggle_scope,unique;size:64"`
+}
+
+func (legacyRouteToggle) TableName() string { return "route_toggles" }
+
+func TestSetupDb_DropsLegacyIndexes(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&legacyUser{}, &legacyRouteToggle{}))
+	require.True(t, db.Migrator().HasIndex(&models.User{}, "idx_users_uuid"))
+	r := NewRouter()
+	r.DbConnection = db
+
+	require.NoError(t, r.SetupDb())
+
+	assert.False(t, db.Migrator().HasIndex(&models.User{}, "idx_users_uuid"))
+	assert.True(t, db.Migrator().HasIndex(&models.User{}, "idx_users_team_uuid"))
+	assert.False(t, db.Migrator().HasIndex(&models.RouteToggle{}, "idx_route_toggle_scope"))
+	assert.True(t, db.Migrator().HasIndex(&models.RouteToggle{}, "idx_route_toggles_team_scope"))
+}
+
+func TestFindOrCreateUser_ScopedToTeam(t *testing.T) {
+	r := NewRouter()
+	r.DbConnection = setupTestDB(t)
+	require.NoError(t, r.SetupDb())
+	teamA, teamB := *r, *r
+	teamA.TeamID = "T_A"
+	teamB.TeamID = "T_B"
+
+	a := teamA.FindOrCreateUser("U1")
+	b := teamB.FindOrCreateUser("U1")
+
+	assert.NotEqual(t, a.ID, b.ID)
+	assert.Equal(t, "T_A", a.TeamID)
+	assert.Equal(t, a.ID, teamA.FindOrCreateUser("U1").ID, "the same user is found again")
+	assert.Equal(t, "", r.FindOrCreateUser("U1").TeamID)
+}
+
+func TestFindOrCreateGroup_ScopedToTeam(t *testing.T) {
+	r := NewRouter()
+	r.DbConnection = setupTestDB(t)
+	require.NoError(t, r.SetupDb())
+	teamA := *r
+	teamA.TeamID = "T_A"
+	admin := teamA.FindOrCreateUser("U1")
+	admins := teamA.FindOrCreateGroup("globalAdmins")
+	require.NoError(t, r.DbConnection.Model(&admins).Association("Members").Append(&admin))
+
+	assert.NotEqual(t, admins.ID, r.FindOrCreateGroup("globalAdmins").ID)
+	assert.True(t, teamA.IsGlobalAdmin(admin))
+	assert.False(t, r.IsGlobalAdmin(r.FindOrCreateUser("U1")), "U1 administers team T_A only")
+}
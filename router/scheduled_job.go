@@ -0,0 +1,236 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultJobLease is how long other replicas wait for a run to finish before
+// assuming it died, used when a job doesn't set MaxRuntime.
+const DefaultJobLease = 10 * time.Minute
+
+// Schedule reports when a job should next run after the given time
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// ScheduledJob runs Plugin on a cron Schedule or at a fixed Interval rather
+// than in response to a Slack event. Exactly one of Schedule and Interval must
+// be set. Route.Pattern is ignored; Permissions and Rollout do not apply since
+// there is no user, but jobs can be disabled like any other route. Plugin
+// runs in Gadget's own workspace; jobs that act in the workspaces Gadget was
+// installed in switch to them with HandlerContext.InWorkspace.
+type ScheduledJob struct {
+	Route
+	Schedule         string         // cron expression, e.g. "0 9 * * MON-FRI", "@daily" or "CRON_TZ=Europe/Paris 0 9 * * *"
+	Interval         time.Duration  // run every Interval instead of on a cron Schedule
+	Location         *time.Location // time zone for Schedule; nil uses UTC unless Schedule sets CRON_TZ
+	MaxRuntime       time.Duration  // how long a run holds its lease; 0 uses DefaultJobLease
+	CompiledSchedule Schedule
+	Plugin           func(ctx HandlerContext)
+}
+
+// RegisteredJob describes a scheduled job and its persisted run history for introspection
+type RegisteredJob struct {
+	Route
+	Schedule  string    // the cron expression or "every <Interval>"
+	LastRunAt time.Time // zero if the job has never been seen by a scheduler
+	NextRunAt time.Time // zero if the job has never been seen by a scheduler
+	Disabled  bool
+}
+
+// Execute calls Plugin()
+func (job ScheduledJob) Execute(ctx HandlerContext) {
+	ctx.Route = job.Route
+	job.Plugin(ctx)
+}
+
+// Lease returns how long a run of the job holds its lease
+func (job ScheduledJob) Lease() time.Duration {
+	if job.MaxRuntime > 0 {
+		return job.MaxRuntime
+	}
+	return DefaultJobLease
+}
+
+// Describe returns the job's schedule in human readable form
+func (job ScheduledJob) Describe() string {
+	if job.Schedule != "" {
+		return job.Schedule
+	}
+	return "every " + job.Interval.String()
+}
+
+type intervalSchedule time.Duration
+
+func (every intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(every))
+}
+
+// latestRun returns the last time schedule was due at or before now, given
+// that it was due at due, so runs missed while no scheduler was up are
+// skipped rather than run one after another
+func latestRun(schedule Schedule, due, now time.Time) time.Time {
+	if every, ok := schedule.(intervalSchedule); ok {
+		return due.Add(now.Sub(due) / time.Duration(every) * time.Duration(every))
+	}
+	for next := schedule.Next(due); !next.After(now); next = schedule.Next(next) {
+		due = next
+	}
+	return due
+}
+
+// CompileSchedule parses the job's Schedule or Interval
+func CompileSchedule(job ScheduledJob) (Schedule, error) {
+	switch {
+	case job.Schedule != "" && job.Interval != 0:
+		return nil, errors.New("scheduled job must set only one of Schedule and Interval")
+	case job.Interval < 0:
+		return nil, fmt.Errorf("invalid interval: %s", job.Interval)
+	case job.Interval > 0:
+		return intervalSchedule(job.Interval), nil
+	case job.Schedule == "":
+		return nil, errors.New("scheduled job must set Schedule or Interval")
+	}
+
+	schedule, err := cron.ParseStandard(job.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("parse schedule %q: %w", job.Schedule, err)
+	}
+	if spec, ok := schedule.(*cron.SpecSchedule); ok && !hasCronTimeZone(job.Schedule) {
+		spec.Location = time.UTC
+		if job.Location != nil {
+			spec.Location = job.Location
+		}
+	}
+	return schedule, nil
+}
+
+func hasCronTimeZone(spec string) bool {
+	return strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=")
+}
+
+// AddScheduledJob sets the key for ScheduledJobs to job.Name and its value to
+// job. It panics if the schedule is invalid, as AddMentionRoute does for
+// patterns.
+func (router *Router) AddScheduledJob(job ScheduledJob) {
+	schedule, err := CompileSchedule(job)
+	if err != nil {
+		panic(fmt.Sprintf("scheduled job %s: %v", job.Name, err))
+	}
+	job.CompiledSchedule = schedule
+	if router.ScheduledJobs == nil {
+		router.ScheduledJobs = make(map[string]ScheduledJob)
+	}
+	router.ScheduledJobs[job.Name] = job
+}
+
+// AddScheduledJobs calls AddScheduledJob for each element in jobs
+func (router *Router) AddScheduledJobs(jobs []ScheduledJob) {
+	for _, job := range jobs {
+		router.AddScheduledJob(job)
+	}
+}
+
+// FindScheduledJobByName Returns the named scheduled job
+func (router Router) FindScheduledJobByName(name string) (ScheduledJob, bool) {
+	job, exists := router.ScheduledJobs[name]
+	return job, exists
+}
+
+// ClaimScheduledJob reports whether job is due as of now and, if so, records
+// the run and takes its lease on behalf of owner. Only one replica can claim a
+// given run: the claim is a conditional update that fails if another replica
+// claimed the job first. The first time a job is seen, now is recorded as its
+// baseline and it runs at its next scheduled time. A run is recorded at the
+// time it was scheduled for, not when it was claimed, so interval jobs don't
+// drift by the scheduler's tick.
+func (router Router) ClaimScheduledJob(job ScheduledJob, owner string, now time.Time) (bool, error) {
+	if router.DbConnection == nil || job.CompiledSchedule == nil {
+		return false, nil
+	}
+
+	var run models.JobRun
+	if err := router.DbConnection.Where("name = ?", job.Name).Limit(1).Find(&run).Error; err != nil {
+		return false, fmt.Errorf("load job run: %w", err)
+	}
+	if run.ID == 0 {
+		run = models.JobRun{Name: job.Name, LastRunAt: now, LeaseUntil: now}
+		err := router.DbConnection.Clauses(clause.OnConflict{DoNothing: true}).Create(&run).Error
+		if err != nil {
+			return false, fmt.Errorf("create job run: %w", err)
+		}
+		return false, nil
+	}
+
+	due := job.CompiledSchedule.Next(run.LastRunAt)
+	if now.Before(due) || run.Leased(now) {
+		return false, nil
+	}
+
+	result := router.DbConnection.Model(&models.JobRun{}).
+		Where("id = ? AND runs = ?", run.ID, run.Runs).
+		Updates(map[string]interface{}{
+			"last_run_at": latestRun(job.CompiledSchedule, due, now),
+			"runs":        run.Runs + 1,
+			"lease_owner": owner,
+			"lease_until": now.Add(job.Lease()),
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("claim job run: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseScheduledJob gives up the lease owner holds on the named job so that
+// it may run again at its next scheduled time.
+func (router Router) ReleaseScheduledJob(name, owner string) error {
+	err := router.DbConnection.Model(&models.JobRun{}).
+		Where("name = ? AND lease_owner = ?", name, owner).
+		Updates(map[string]interface{}{"lease_owner": "", "lease_until": time.Now()}).Error
+	if err != nil {
+		return fmt.Errorf("release job run: %w", err)
+	}
+	return nil
+}
+
+// RegisteredJobs returns all scheduled jobs sorted by name along with when
+// they last ran and will next run.
+func (router Router) RegisteredJobs() []RegisteredJob {
+	runs := make(map[string]models.JobRun)
+	if router.DbConnection != nil && len(router.ScheduledJobs) > 0 {
+		var stored []models.JobRun
+		if err := router.DbConnection.Find(&stored).Error; err == nil {
+			for _, run := range stored {
+				runs[run.Name] = run
+			}
+		}
+	}
+
+	toggles := router.loadRouteToggles()
+	jobs := make([]RegisteredJob, 0, len(router.ScheduledJobs))
+	for _, job := range router.ScheduledJobs {
+		registered := RegisteredJob{
+			Route:    job.Route,
+			Schedule: job.Describe(),
+			Disabled: !toggles.enabled(job.Name, ""),
+		}
+		if run, exists := runs[job.Name]; exists {
+			registered.LastRunAt = run.LastRunAt
+			if job.CompiledSchedule != nil {
+				registered.NextRunAt = job.CompiledSchedule.Next(run.LastRunAt)
+			}
+		}
+		jobs = append(jobs, registered)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
@@ -0,0 +1,198 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileSchedule_Interval(t *testing.T) {
+	schedule, err := CompileSchedule(ScheduledJob{Interval: time.Hour})
+	assert.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, start.Add(time.Hour), schedule.Next(start))
+}
+
+func TestCompileSchedule_CronDefaultsToUTC(t *testing.T) {
+	schedule, err := CompileSchedule(ScheduledJob{Schedule: "0 9 * * *"})
+	assert.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC), schedule.Next(start).UTC())
+}
+
+func TestCompileSchedule_CronUsesLocation(t *testing.T) {
+	tokyo := time.FixedZone("Tokyo", 9*60*60)
+	schedule, err := CompileSchedule(ScheduledJob{Schedule: "0 9 * * *", Location: tokyo})
+	assert.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), schedule.Next(start).UTC())
+}
+
+func TestCompileSchedule_CronTimeZonePrefixWins(t *testing.T) {
+	schedule, err := CompileSchedule(ScheduledJob{Schedule: "CRON_TZ=UTC 0 9 * * *", Location: time.FixedZone("Tokyo", 9*60*60)})
+	assert.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC), schedule.Next(start).UTC())
+}
+
+func TestCompileSchedule_Invalid(t *testing.T) {
+	_, err := CompileSchedule(ScheduledJob{})
+	assert.Error(t, err)
+
+	_, err = CompileSchedule(ScheduledJob{Schedule: "@daily", Interval: time.Hour})
+	assert.Error(t, err)
+
+	_, err = CompileSchedule(ScheduledJob{Schedule: "not a schedule"})
+	assert.Error(t, err)
+}
+
+func TestAddScheduledJob_InvalidSchedulePanics(t *testing.T) {
+	r := NewRouter()
+	assert.Panics(t, func() {
+		r.AddScheduledJob(ScheduledJob{Route: Route{Name: "bad"}, Schedule: "nope"})
+	})
+}
+
+func TestAddScheduledJob_ZeroValueRouter(t *testing.T) {
+	var r Router
+	r.AddScheduledJob(ScheduledJob{Route: Route{Name: "cleanup"}, Interval: time.Hour})
+
+	job, exists := r.FindScheduledJobByName("cleanup")
+	assert.True(t, exists)
+	assert.NotNil(t, job.CompiledSchedule)
+}
+
+func TestClaimScheduledJob_FirstSightingRecordsBaseline(t *testing.T) {
+	r := Router{DbConnection: setupTestDB(t)}
+	r.AddScheduledJob(ScheduledJob{Route: Route{Name: "cleanup"}, Interval: time.Hour})
+	job := r.ScheduledJobs["cleanup"]
+	now := time.Now()
+
+	claimed, err := r.ClaimScheduledJob(job, "a", now)
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+
+	claimed, err = r.ClaimScheduledJob(job, "a", now.Add(30*time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+
+	claimed, err = r.ClaimScheduledJob(job, "a", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+}
+
+func TestClaimScheduledJob_OnlyOneReplicaClaims(t *testing.T) {
+	r := Router{DbConnection: setupTestDB(t)}
+	r.AddScheduledJob(ScheduledJob{Route: Route{Name: "cleanup"}, Interval: time.Hour})
+	job := r.ScheduledJobs["cleanup"]
+	now := time.Now()
+	_, _ = r.ClaimScheduledJob(job, "a", now)
+
+	due := now.Add(time.Hour)
+	claimedA, err := r.ClaimScheduledJob(job, "a", due)
+	assert.NoError(t, err)
+	claimedB, err := r.ClaimScheduledJob(job, "b", due)
+	assert.NoError(t, err)
+
+	assert.True(t, claimedA)
+	assert.False(t, claimedB)
+}
+
+func TestClaimScheduledJob_RecordsTheScheduledTime(t *testing.T) {
+	r := Router{DbConnection: setupTestDB(t)}
+	r.AddScheduledJob(ScheduledJob{Route: Route{Name: "cleanup"}, Interval: time.Hour})
+	job := r.ScheduledJobs["cleanup"]
+	now := time.Now().Truncate(time.Second)
+	_, _ = r.ClaimScheduledJob(job, "a", now)
+
+	// claimed a tick late, the next run is still an hour after the scheduled one
+	claimed, err := r.ClaimScheduledJob(job, "a", now.Add(time.Hour+15*time.Second))
+	require.NoError(t, err)
+	require.True(t, claimed)
+	require.NoError(t, r.ReleaseScheduledJob("cleanup", "a"))
+	jobs := r.RegisteredJobs()
+	assert.True(t, jobs[0].LastRunAt.Equal(now.Add(time.Hour)), jobs[0].LastRunAt)
+	assert.True(t, jobs[0].NextRunAt.Equal(now.Add(2*time.Hour)), jobs[0].NextRunAt)
+
+	// after a long outage the missed runs are skipped, not caught up on
+	claimed, _ = r.ClaimScheduledJob(job, "a", now.Add(5*time.Hour+time.Minute))
+	require.True(t, claimed)
+	require.NoError(t, r.ReleaseScheduledJob("cleanup", "a"))
+	claimed, _ = r.ClaimScheduledJob(job, "a", now.Add(5*time.Hour+2*time.Minute))
+	assert.False(t, claimed)
+	assert.True(t, r.RegisteredJobs()[0].LastRunAt.Equal(now.Add(5*time.Hour)))
+}
+
+func TestLatestRun_Cron(t *testing.T) {
+	schedule, err := CompileSchedule(ScheduledJob{Schedule: "0 9 * * *"})
+	require.NoError(t, err)
+	due := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, due, latestRun(schedule, due, due.Add(time.Hour)))
+	assert.Equal(t, due.AddDate(0, 0, 3), latestRun(schedule, due, due.AddDate(0, 0, 3).Add(time.Hour)))
+}
+
+func TestClaimScheduledJob_LeaseBlocksOverlappingRuns(t *testing.T) {
+	r := Router{DbConnection: setupTestDB(t)}
+	r.AddScheduledJob(ScheduledJob{Route: Route{Name: "cleanup"}, Interval: time.Minute, MaxRuntime: time.Hour})
+	job := r.ScheduledJobs["cleanup"]
+	now := time.Now()
+	_, _ = r.ClaimScheduledJob(job, "a", now)
+
+	claimed, _ := r.ClaimScheduledJob(job, "a", now.Add(time.Minute))
+	assert.True(t, claimed)
+
+	// Still running, so the next occurrence is skipped
+	claimed, _ = r.ClaimScheduledJob(job, "b", now.Add(2*time.Minute))
+	assert.False(t, claimed)
+
+	assert.NoError(t, r.ReleaseScheduledJob("cleanup", "a"))
+	claimed, _ = r.ClaimScheduledJob(job, "b", now.Add(2*time.Minute))
+	assert.True(t, claimed)
+}
+
+func TestClaimScheduledJob_NoDatabase(t *testing.T) {
+	var r Router
+	r.AddScheduledJob(ScheduledJob{Route: Route{Name: "cleanup"}, Interval: time.Hour})
+
+	claimed, err := r.ClaimScheduledJob(r.ScheduledJobs["cleanup"], "a", time.Now())
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+}
+
+func TestRegisteredJobs_IncludesRunHistory(t *testing.T) {
+	db := setupTestDB(t)
+	r := Router{DbConnection: db}
+	r.AddScheduledJob(ScheduledJob{Route: Route{Name: "standup"}, Schedule: "0 9 * * MON-FRI"})
+	r.AddScheduledJob(ScheduledJob{Route: Route{Name: "cleanup"}, Interval: time.Hour})
+
+	last := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	db.Create(&models.JobRun{Name: "cleanup", LastRunAt: last, LeaseUntil: last})
+
+	jobs := r.RegisteredJobs()
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "cleanup", jobs[0].Name)
+	assert.Equal(t, "every 1h0m0s", jobs[0].Schedule)
+	assert.True(t, last.Equal(jobs[0].LastRunAt))
+	assert.True(t, last.Add(time.Hour).Equal(jobs[0].NextRunAt))
+	assert.Equal(t, "standup", jobs[1].Name)
+	assert.Equal(t, "0 9 * * MON-FRI", jobs[1].Schedule)
+	assert.True(t, jobs[1].NextRunAt.IsZero())
+}
+
+func TestRegisteredRoutes_IncludesScheduledJobs(t *testing.T) {
+	r := NewRouter()
+	r.AddScheduledJob(ScheduledJob{Route: Route{Name: "cleanup"}, Interval: time.Hour})
+
+	routes := r.RegisteredRoutes()
+	assert.Len(t, routes, 1)
+	assert.Equal(t, "cleanup", routes[0].Name)
+	assert.Equal(t, RouteTypeScheduledJob, routes[0].Type)
+}
@@ -1,6 +1,14 @@
 package router
 
-import "github.com/slack-go/slack"
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/slack-go/slack"
+)
 
 // SlashCommandRoute handles Slack slash command invocations.
 // Plugin execution is dispatched asynchronously in a goroutine, so the HTTP
@@ -8,15 +16,178 @@ import "github.com/slack-go/slack"
 // deadline. For commands that need to send a visible response, the Plugin
 // should post a follow-up message using the Slack API (e.g. chat.postMessage
 // or the slash command's ResponseURL).
+//
+// A route with a Pattern is a subcommand: it is selected when the command's
+// text (e.g. "rollback prod" for "/deploy rollback prod") matches the Pattern.
+// Several subcommands can share a Command; the one with the highest Priority
+// wins. A route without a Pattern is the command's fallback and handles any
+// text that no subcommand matches.
 type SlashCommandRoute struct {
 	Route
 	Command           string        // Slack command name, e.g. "/deploy"
 	ImmediateResponse func() string // Optional ephemeral response evaluated per-request; nil means no response
+	AnswersHelp       bool          // the subcommand answers "help" instead of the generated help, whatever its Pattern
 	Plugin            func(ctx HandlerContext, cmd slack.SlashCommand)
 }
 
+// slashCommandRoutesSortedByPriority implements Sort such that those with higher priority are first
+type slashCommandRoutesSortedByPriority []SlashCommandRoute
+
 // Execute calls Plugin()
 func (route SlashCommandRoute) Execute(ctx HandlerContext, cmd slack.SlashCommand) {
 	ctx.Route = route.Route
 	route.Plugin(ctx, cmd)
 }
+
+func (a slashCommandRoutesSortedByPriority) Len() int { return len(a) }
+
+func (a slashCommandRoutesSortedByPriority) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a slashCommandRoutesSortedByPriority) Less(i, j int) bool {
+	if a[i].Priority != a[j].Priority {
+		return a[i].Priority > a[j].Priority
+	}
+	return a[i].Name < a[j].Name
+}
+
+// Ephemeral responses Gadget gives to slash commands it answers itself
+const (
+	UnknownSlashCommandResponse     = "Unknown command."
+	DeniedSlashCommandResponse      = "Permission denied."
+	RateLimitedSlashCommandResponse = "Slow down! Try that again in a little while."
+)
+
+// SlashCommandFallbackResponse is the response to a slash command whose text
+// no subcommand matches, when it has no fallback route
+func SlashCommandFallbackResponse(command string) string {
+	return fmt.Sprintf("I don't know how to do that. Try `%s help`.", command)
+}
+
+// helpSubcommandPattern matches the text that requests a command's generated help
+var helpSubcommandPattern = regexp.MustCompile(`(?i)^help$`)
+
+// IsSlashCommandHelp returns true if text asks for a command's generated help
+func IsSlashCommandHelp(text string) bool {
+	return helpSubcommandPattern.MatchString(strings.TrimSpace(text))
+}
+
+// SlashSubcommands returns the subcommand routes registered for command,
+// sorted by priority (descending) then name.
+func (router Router) SlashSubcommands(command string) []SlashCommandRoute {
+	var routes []SlashCommandRoute
+	for _, route := range router.SlashSubcommandRoutes {
+		if route.Command == command {
+			routes = append(routes, route)
+		}
+	}
+	sort.Sort(slashCommandRoutesSortedByPriority(routes))
+	return routes
+}
+
+// SlashCommands returns the names of all commands with at least one route, sorted
+func (router Router) SlashCommands() []string {
+	seen := map[string]bool{}
+	for command := range router.SlashCommandRoutes {
+		seen[command] = true
+	}
+	for _, route := range router.SlashSubcommandRoutes {
+		seen[route.Command] = true
+	}
+
+	commands := make([]string, 0, len(seen))
+	for command := range seen {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// HasSlashCommand returns true if command has a fallback route or any subcommands
+func (router Router) HasSlashCommand(command string) bool {
+	if _, exists := router.SlashCommandRoutes[command]; exists {
+		return true
+	}
+	return len(router.SlashSubcommands(command)) > 0
+}
+
+// FindSlashSubcommandRoute returns the highest priority subcommand of command
+// whose Pattern matches text. The command's fallback route is not considered.
+func (router Router) FindSlashSubcommandRoute(command, text string) (SlashCommandRoute, bool) {
+	return router.FindSlashSubcommandRouteInChannel(command, text, "")
+}
+
+// FindSlashSubcommandRouteInChannel is FindSlashSubcommandRoute, skipping
+// subcommands that are disabled in channel.
+func (router Router) FindSlashSubcommandRouteInChannel(command, text, channel string) (SlashCommandRoute, bool) {
+	trimmed := strings.TrimSpace(text)
+	toggles := router.loadRouteToggles()
+	for _, route := range router.SlashSubcommands(command) {
+		if route.CompiledPattern != nil && route.CompiledPattern.MatchString(trimmed) && toggles.enabled(route.Name, channel) {
+			return route, true
+		}
+	}
+	return SlashCommandRoute{}, false
+}
+
+// FindSlashCommandRoute returns the subcommand of command matching text, or
+// the command's fallback route if no subcommand matches.
+func (router Router) FindSlashCommandRoute(command, text string) (SlashCommandRoute, bool) {
+	return router.FindSlashCommandRouteInChannel(command, text, "")
+}
+
+// FindSlashCommandRouteInChannel is FindSlashCommandRoute, skipping routes
+// that are disabled in channel.
+func (router Router) FindSlashCommandRouteInChannel(command, text, channel string) (SlashCommandRoute, bool) {
+	if route, exists := router.FindSlashSubcommandRouteInChannel(command, text, channel); exists {
+		return route, true
+	}
+	route, exists := router.FindSlashCommandRouteByCommand(command)
+	if !exists || !router.IsRouteEnabled(route.Name, channel) {
+		return SlashCommandRoute{}, false
+	}
+	return route, true
+}
+
+// findHelpSubcommandInChannel returns the highest priority subcommand of
+// command that AnswersHelp and is enabled in channel
+func (router Router) findHelpSubcommandInChannel(command, channel string) (SlashCommandRoute, bool) {
+	toggles := router.loadRouteToggles()
+	for _, route := range router.SlashSubcommands(command) {
+		if route.AnswersHelp && toggles.enabled(route.Name, channel) {
+			return route, true
+		}
+	}
+	return SlashCommandRoute{}, false
+}
+
+// SlashCommandHelp generates the `/command help` response listing the
+// subcommands of command that u is permitted to use.
+func (router Router) SlashCommandHelp(command string, u models.User) string {
+	var lines []string
+	routes := router.SlashSubcommands(command)
+	if fallback, exists := router.FindSlashCommandRouteByCommand(command); exists {
+		routes = append(routes, fallback)
+	}
+
+	for _, route := range routes {
+		if !router.Can(u, route.Permissions) {
+			continue
+		}
+		usage := route.Help
+		if usage == "" {
+			usage = route.Name
+		}
+		line := fmt.Sprintf("• `%s %s`", command, usage)
+		if route.Description != "" {
+			line += " - " + route.Description
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return fmt.Sprintf("There's nothing you can do with `%s`.", command)
+	}
+	return fmt.Sprintf("Here's what you can do with `%s`:\n%s", command, strings.Join(lines, "\n"))
+}
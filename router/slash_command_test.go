@@ -3,6 +3,7 @@ package router
 import (
 	"testing"
 
+	"github.com/gadget-bot/gadget/models"
 	"github.com/slack-go/slack"
 	"github.com/stretchr/testify/assert"
 )
@@ -40,3 +41,102 @@ func TestSlashCommandRoute_ImmediateResponse(t *testing.T) {
 
 	assert.Equal(t, "Deploying...", route.ImmediateResponse())
 }
+
+func newSubcommandRouter() *Router {
+	r := NewRouter()
+	r.AddSlashCommandRoutes([]SlashCommandRoute{
+		{Route: Route{Name: "deploy.status", Pattern: `(?i)^status$`, Help: "status", Description: "Show deploy status"}, Command: "/deploy"},
+		{Route: Route{Name: "deploy.rollback", Pattern: `(?i)^rollback (\w+)$`, Help: "rollback ENV", Permissions: []string{"deployers"}}, Command: "/deploy"},
+		{Route: Route{Name: "deploy.anything", Pattern: `.*`, Priority: -1}, Command: "/deploy"},
+		{Route: Route{Name: "deploy", Help: "APP", Description: "Deploy an app"}, Command: "/deploy"},
+		{Route: Route{Name: "other.status", Pattern: `(?i)^status$`}, Command: "/other"},
+	})
+	return r
+}
+
+func TestFindSlashCommandRoute_MatchesSubcommand(t *testing.T) {
+	r := newSubcommandRouter()
+
+	route, found := r.FindSlashCommandRoute("/deploy", "  rollback prod ")
+	assert.True(t, found)
+	assert.Equal(t, "deploy.rollback", route.Name)
+
+	route, found = r.FindSlashCommandRoute("/other", "status")
+	assert.True(t, found)
+	assert.Equal(t, "other.status", route.Name)
+}
+
+func TestFindSlashCommandRoute_PriorityWins(t *testing.T) {
+	r := newSubcommandRouter()
+
+	route, found := r.FindSlashCommandRoute("/deploy", "status")
+	assert.True(t, found)
+	assert.Equal(t, "deploy.status", route.Name, "higher priority subcommand should win over the catch-all")
+
+	route, found = r.FindSlashCommandRoute("/deploy", "something else")
+	assert.True(t, found)
+	assert.Equal(t, "deploy.anything", route.Name)
+}
+
+func TestFindSlashCommandRoute_FallsBackToCommandRoute(t *testing.T) {
+	r := NewRouter()
+	r.AddSlashCommandRoutes([]SlashCommandRoute{
+		{Route: Route{Name: "deploy.status", Pattern: `(?i)^status$`}, Command: "/deploy"},
+		{Route: Route{Name: "deploy"}, Command: "/deploy"},
+	})
+
+	route, found := r.FindSlashCommandRoute("/deploy", "api")
+	assert.True(t, found)
+	assert.Equal(t, "deploy", route.Name)
+
+	_, found = r.FindSlashSubcommandRoute("/deploy", "api")
+	assert.False(t, found)
+}
+
+func TestFindSlashCommandRoute_UnknownCommand(t *testing.T) {
+	r := newSubcommandRouter()
+	_, found := r.FindSlashCommandRoute("/unknown", "status")
+	assert.False(t, found)
+	assert.False(t, r.HasSlashCommand("/unknown"))
+	assert.True(t, r.HasSlashCommand("/other"))
+}
+
+func TestSlashCommands_ListsAllCommands(t *testing.T) {
+	r := newSubcommandRouter()
+	assert.Equal(t, []string{"/deploy", "/other"}, r.SlashCommands())
+}
+
+func TestIsSlashCommandHelp(t *testing.T) {
+	assert.True(t, IsSlashCommandHelp("help"))
+	assert.True(t, IsSlashCommandHelp(" HELP "))
+	assert.False(t, IsSlashCommandHelp("help me"))
+}
+
+func TestSlashCommandHelp_ListsPermittedSubcommands(t *testing.T) {
+	r := newSubcommandRouter()
+	r.DbConnection = setupTestDB(t)
+	user := models.User{Uuid: "U_VIEWER"}
+	r.DbConnection.Create(&user)
+
+	help := r.SlashCommandHelp("/deploy", user)
+
+	assert.Contains(t, help, "`/deploy status` - Show deploy status")
+	assert.Contains(t, help, "`/deploy APP` - Deploy an app")
+	assert.Contains(t, help, "`/deploy deploy.anything`")
+	assert.NotContains(t, help, "rollback", "subcommands the user cannot use should be hidden")
+}
+
+func TestSlashCommandHelp_IncludesRestrictedForMembers(t *testing.T) {
+	r := newSubcommandRouter()
+	db := setupTestDB(t)
+	r.DbConnection = db
+	user := models.User{Uuid: "U_DEPLOYER"}
+	db.Create(&user)
+	group := models.Group{Name: "deployers"}
+	db.Create(&group)
+	assert.NoError(t, db.Model(&group).Association("Members").Append(&user))
+
+	help := r.SlashCommandHelp("/deploy", user)
+
+	assert.Contains(t, help, "`/deploy rollback ENV`")
+}
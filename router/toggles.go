@@ -0,0 +1,227 @@
+package router
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Rollout limits a route to a subset of users. A user is included if they are
+// a member of any of the Groups, or if they fall within Percentage of users
+// (bucketed by a stable hash of the route name and user ID).
+type Rollout struct {
+	Percentage int
+	Groups     []string
+}
+
+// routeToggles resolves route toggles loaded from the database
+type routeToggles []models.RouteToggle
+
+// RouteNamespace returns the plugin namespace of a route name, i.e. everything
+// before the first ".". Names without a namespace return "".
+func RouteNamespace(name string) string {
+	if i := strings.Index(name, "."); i > 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// NamespaceTarget returns the toggle target that matches every route in namespace
+func NamespaceTarget(namespace string) string {
+	return namespace + ".*"
+}
+
+// enabled resolves whether the named route is enabled in channel. Global
+// toggles and the workspace's own are resolved separately, and the route
+// must be enabled by both, so a workspace can't override what's turned off
+// for every workspace. Within each, the most specific toggle wins: a
+// channel toggle beats an unscoped one, and a toggle for the route itself
+// beats one for its namespace.
+func (toggles routeToggles) enabled(name, channel string) bool {
+	return toggles.resolve(false, name, channel) && toggles.resolve(true, name, channel)
+}
+
+// resolve resolves the named route in channel using either the workspace's
+// toggles or the global ones
+func (toggles routeToggles) resolve(workspace bool, name, channel string) bool {
+	targets := []string{name}
+	if namespace := RouteNamespace(name); namespace != "" {
+		targets = append(targets, NamespaceTarget(namespace))
+	}
+
+	scopes := []string{""}
+	if channel != "" {
+		scopes = []string{channel, ""}
+	}
+
+	for _, scope := range scopes {
+		for _, target := range targets {
+			for _, toggle := range toggles {
+				if (toggle.TeamID != "") == workspace && toggle.Channel == scope && toggle.Target == target {
+					return !toggle.Disabled
+				}
+			}
+		}
+	}
+	return true
+}
+
+// routeToggleTTL is how long loaded route toggles are reused. Toggles set
+// through the Router take effect at once; those set by another replica
+// within routeToggleTTL.
+const routeToggleTTL = 10 * time.Second
+
+// toggleCache holds each team's route toggles, so routing a message doesn't
+// load them once per route
+type toggleCache struct {
+	mu     sync.Mutex
+	byTeam map[string]cachedToggles
+	now    func() time.Time // replaced in tests
+}
+
+type cachedToggles struct {
+	toggles  routeToggles
+	loadedAt time.Time
+}
+
+func newToggleCache() *toggleCache {
+	return &toggleCache{byTeam: map[string]cachedToggles{}, now: time.Now}
+}
+
+// get returns teamID's toggles, calling load if they aren't cached or are
+// older than routeToggleTTL. Toggles load failed to get aren't cached.
+func (c *toggleCache) get(teamID string, load func() (routeToggles, error)) routeToggles {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if cached, ok := c.byTeam[teamID]; ok && now.Sub(cached.loadedAt) < routeToggleTTL {
+		return cached.toggles
+	}
+	toggles, err := load()
+	if err != nil {
+		log.Error().Err(err).Str("team", teamID).Msg("Failed to load route toggles")
+		return nil
+	}
+	c.byTeam[teamID] = cachedToggles{toggles: toggles, loadedAt: now}
+	return toggles
+}
+
+// invalidate forgets every team's toggles. Global toggles apply to every
+// team, so changing one team's alone isn't enough.
+func (c *toggleCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byTeam = map[string]cachedToggles{}
+}
+
+// loadRouteToggles returns the global toggles and those of router's team,
+// cached for routeToggleTTL. Without a database all routes are enabled.
+func (router Router) loadRouteToggles() routeToggles {
+	if router.DbConnection == nil {
+		return nil
+	}
+	load := func() (routeToggles, error) {
+		var toggles []models.RouteToggle
+		err := router.DbConnection.Where("team_id IN ?", router.toggleTeams()).Find(&toggles).Error
+		return toggles, err
+	}
+	if router.toggles == nil {
+		toggles, err := load()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load route toggles")
+			return nil
+		}
+		return toggles
+	}
+	return router.toggles.get(router.TeamID, load)
+}
+
+// toggleTeams returns the teams whose toggles apply to router's: its own,
+// and "" for the global ones
+func (router Router) toggleTeams() []string {
+	if router.TeamID == "" {
+		return []string{""}
+	}
+	return []string{"", router.TeamID}
+}
+
+// RouteToggles returns the stored route toggles that apply to router's team
+func (router Router) RouteToggles() ([]models.RouteToggle, error) {
+	var toggles []models.RouteToggle
+	if err := router.DbConnection.Where("team_id IN ?", router.toggleTeams()).Order("target, channel").Find(&toggles).Error; err != nil {
+		return nil, fmt.Errorf("load route toggles: %w", err)
+	}
+	return toggles, nil
+}
+
+// IsRouteEnabled returns true unless the named route, or its namespace, has
+// been disabled globally or in channel.
+func (router Router) IsRouteEnabled(name, channel string) bool {
+	return router.loadRouteToggles().enabled(name, channel)
+}
+
+// DisableRoute turns off target, a route Name or "namespace.*", in channel.
+// An empty channel disables it everywhere. Toggles are saved for router's
+// team, so only a router outside installed workspaces, whose admins come
+// from Config.GlobalAdmins, sets toggles for every workspace.
+func (router Router) DisableRoute(target, channel string) error {
+	return router.setRouteToggle(target, channel, true)
+}
+
+// EnableRoute turns target back on in channel. Enabling in a channel overrides
+// a global DisableRoute for that channel only.
+func (router Router) EnableRoute(target, channel string) error {
+	return router.setRouteToggle(target, channel, false)
+}
+
+func (router Router) setRouteToggle(target, channel string, disabled bool) error {
+	toggle := models.RouteToggle{TeamID: router.TeamID, Target: target, Channel: channel}
+	err := router.DbConnection.Where("team_id = ? AND target = ? AND channel = ?", router.TeamID, target, channel).Limit(1).Find(&toggle).Error
+	if err != nil {
+		return fmt.Errorf("load route toggle: %w", err)
+	}
+	toggle.Disabled = disabled
+	if err := router.DbConnection.Save(&toggle).Error; err != nil {
+		return fmt.Errorf("save route toggle: %w", err)
+	}
+	if router.toggles != nil {
+		router.toggles.invalidate()
+	}
+	return nil
+}
+
+// InRollout returns true if u should be routed to route according to its Rollout
+func (router Router) InRollout(route Route, u models.User) bool {
+	if route.Rollout == nil || route.Rollout.Percentage >= 100 {
+		return true
+	}
+
+	if len(route.Rollout.Groups) > 0 && router.DbConnection != nil {
+		var userGroups []models.Group
+		if err := router.DbConnection.Model(&u).Association("Groups").Find(&userGroups); err != nil {
+			log.Error().Err(err).Str("user", u.Uuid).Msg("Failed to load user groups for rollout check")
+		}
+		for _, userGroup := range userGroups {
+			for _, groupName := range route.Rollout.Groups {
+				if userGroup.Name == groupName {
+					return true
+				}
+			}
+		}
+	}
+
+	return rolloutBucket(route.Name, u.Uuid) < route.Rollout.Percentage
+}
+
+// rolloutBucket places a user in one of 100 buckets for a route. The bucket is
+// stable so users don't flip in and out of a rollout between messages.
+func rolloutBucket(routeName, userID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(routeName + "/" + userID)) // hash.Hash.Write never returns an error
+	return int(h.Sum32() % 100)
+}
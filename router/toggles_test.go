@@ -0,0 +1,231 @@
+package router
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/models"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newToggleRouter(t *testing.T) *Router {
+	t.Helper()
+	r := NewRouter()
+	r.DbConnection = setupTestDB(t)
+	r.AddMentionRoutes([]MentionRoute{
+		{
+			Route:  Route{Name: "deploy.run", Pattern: `(?i)^deploy`, Priority: 10},
+			Plugin: func(ctx HandlerContext, ev slackevents.AppMentionEvent, message string) {},
+		},
+		{
+			Route:  Route{Name: "chatter.any", Pattern: `.*`},
+			Plugin: func(ctx HandlerContext, ev slackevents.AppMentionEvent, message string) {},
+		},
+	})
+	return r
+}
+
+func TestRouteNamespace(t *testing.T) {
+	assert.Equal(t, "groups", RouteNamespace("groups.getMyGroups"))
+	assert.Equal(t, "", RouteNamespace("fallback"))
+	assert.Equal(t, "groups.*", NamespaceTarget("groups"))
+}
+
+func TestDisableRoute_SkippedByFind(t *testing.T) {
+	r := newToggleRouter(t)
+	require.NoError(t, r.DisableRoute("deploy.run", ""))
+
+	route, found := r.FindMentionRouteByMessage("deploy api")
+	assert.True(t, found)
+	assert.Equal(t, "chatter.any", route.Name, "disabled route should fall through to the next match")
+	assert.False(t, r.IsRouteEnabled("deploy.run", "C1"))
+}
+
+func TestDisableRoute_Namespace(t *testing.T) {
+	r := newToggleRouter(t)
+	require.NoError(t, r.DisableRoute(NamespaceTarget("deploy"), ""))
+
+	assert.False(t, r.IsRouteEnabled("deploy.run", ""))
+	assert.True(t, r.IsRouteEnabled("chatter.any", ""))
+}
+
+func TestDisableRoute_PerChannel(t *testing.T) {
+	r := newToggleRouter(t)
+	require.NoError(t, r.DisableRoute("deploy.run", "C_OPS"))
+
+	route, _ := r.FindMentionRouteByMessageInChannel("deploy api", "C_OPS")
+	assert.Equal(t, "chatter.any", route.Name)
+
+	route, _ = r.FindMentionRouteByMessageInChannel("deploy api", "C_OTHER")
+	assert.Equal(t, "deploy.run", route.Name)
+}
+
+func TestEnableRoute_ChannelOverridesGlobal(t *testing.T) {
+	r := newToggleRouter(t)
+	require.NoError(t, r.DisableRoute(NamespaceTarget("deploy"), ""))
+	require.NoError(t, r.EnableRoute("deploy.run", "C_OPS"))
+
+	assert.True(t, r.IsRouteEnabled("deploy.run", "C_OPS"))
+	assert.False(t, r.IsRouteEnabled("deploy.run", "C_OTHER"))
+}
+
+func TestEnableRoute_UpdatesExistingToggle(t *testing.T) {
+	r := newToggleRouter(t)
+	require.NoError(t, r.DisableRoute("deploy.run", ""))
+	require.NoError(t, r.EnableRoute("deploy.run", ""))
+
+	toggles, err := r.RouteToggles()
+	require.NoError(t, err)
+	assert.Len(t, toggles, 1)
+	assert.True(t, r.IsRouteEnabled("deploy.run", ""))
+}
+
+func TestDisableRoute_ScopedToTeam(t *testing.T) {
+	r := newToggleRouter(t)
+	tenant := *r
+	tenant.TeamID = "T_TENANT"
+	other := *r
+	other.TeamID = "T_OTHER"
+	require.NoError(t, tenant.DisableRoute("deploy.run", ""))
+
+	assert.False(t, tenant.IsRouteEnabled("deploy.run", ""))
+	assert.True(t, other.IsRouteEnabled("deploy.run", ""), "a workspace's toggle shouldn't reach other workspaces")
+	assert.True(t, r.IsRouteEnabled("deploy.run", ""), "a workspace's toggle shouldn't become global")
+
+	toggles, err := other.RouteToggles()
+	require.NoError(t, err)
+	assert.Empty(t, toggles)
+}
+
+func TestDisableRoute_GlobalAppliesToEveryTeam(t *testing.T) {
+	r := newToggleRouter(t)
+	tenant := *r
+	tenant.TeamID = "T_TENANT"
+	require.NoError(t, r.DisableRoute(NamespaceTarget("deploy"), ""))
+	require.NoError(t, tenant.EnableRoute("deploy.run", ""))
+
+	assert.False(t, tenant.IsRouteEnabled("deploy.run", ""), "a workspace can't re-enable a globally disabled route")
+	toggles, err := tenant.RouteToggles()
+	require.NoError(t, err)
+	assert.Len(t, toggles, 2)
+}
+
+func TestRouteToggles_CacheSeesUpdates(t *testing.T) {
+	r := newToggleRouter(t)
+	tenant := *r
+	tenant.TeamID = "T_TENANT"
+	assert.True(t, tenant.IsRouteEnabled("deploy.run", ""), "loads the tenant's toggles into the cache")
+
+	require.NoError(t, r.DisableRoute("deploy.run", ""))
+	assert.False(t, tenant.IsRouteEnabled("deploy.run", ""), "a global toggle reaches cached workspaces at once")
+
+	require.NoError(t, r.EnableRoute("deploy.run", ""))
+	assert.True(t, tenant.IsRouteEnabled("deploy.run", ""))
+}
+
+func TestRouteToggles_CachedUntilTTL(t *testing.T) {
+	r := newToggleRouter(t)
+	now := time.Now()
+	r.toggles.now = func() time.Time { return now }
+	assert.True(t, r.IsRouteEnabled("deploy.run", ""))
+
+	// another replica disables the route
+	require.NoError(t, r.DbConnection.Create(&models.RouteToggle{Target: "deploy.run", Disabled: true}).Error)
+	assert.True(t, r.IsRouteEnabled("deploy.run", ""), "toggles are reused within the TTL")
+
+	now = now.Add(routeToggleTTL)
+	assert.False(t, r.IsRouteEnabled("deploy.run", ""))
+}
+
+func TestRegisteredRoutes_MarksDisabled(t *testing.T) {
+	r := newToggleRouter(t)
+	require.NoError(t, r.DisableRoute("deploy.run", ""))
+
+	for _, route := range r.RegisteredRoutes() {
+		assert.Equal(t, route.Name == "deploy.run", route.Disabled, route.Name)
+	}
+}
+
+func TestFindChannelMessageRouteByMessageInChannel_SkipsDisabled(t *testing.T) {
+	r := NewRouter()
+	r.DbConnection = setupTestDB(t)
+	r.AddChannelMessageRoute(ChannelMessageRoute{
+		Route:  Route{Name: "deploy.watch", Pattern: `(?i)^deploy`},
+		Plugin: func(ctx HandlerContext, ev slackevents.MessageEvent, message string) {},
+	})
+	require.NoError(t, r.DisableRoute("deploy.watch", "C_OPS"))
+
+	_, found := r.FindChannelMessageRouteByMessageInChannel("deploy", "C_OPS")
+	assert.False(t, found)
+	_, found = r.FindChannelMessageRouteByMessageInChannel("deploy", "C_DEV")
+	assert.True(t, found)
+}
+
+func TestFindSlashCommandRouteInChannel_SkipsDisabled(t *testing.T) {
+	r := NewRouter()
+	r.DbConnection = setupTestDB(t)
+	r.AddSlashCommandRoutes([]SlashCommandRoute{
+		{Route: Route{Name: "deploy.status", Pattern: `^status$`}, Command: "/deploy"},
+		{Route: Route{Name: "deploy"}, Command: "/deploy"},
+	})
+	require.NoError(t, r.DisableRoute("deploy.status", ""))
+
+	route, found := r.FindSlashCommandRouteInChannel("/deploy", "status", "C1")
+	assert.True(t, found)
+	assert.Equal(t, "deploy", route.Name)
+
+	require.NoError(t, r.DisableRoute("deploy", ""))
+	_, found = r.FindSlashCommandRouteInChannel("/deploy", "status", "C1")
+	assert.False(t, found)
+}
+
+func TestFind_NoDatabaseTreatsAllEnabled(t *testing.T) {
+	r := NewRouter()
+	r.AddMentionRoute(MentionRoute{Route: Route{Name: "deploy.run", Pattern: `^deploy`}})
+	_, found := r.FindMentionRouteByMessageInChannel("deploy", "C1")
+	assert.True(t, found)
+}
+
+func TestInRollout_NilRolloutIncludesEveryone(t *testing.T) {
+	r := NewRouter()
+	assert.True(t, r.InRollout(Route{Name: "x"}, models.User{Uuid: "U1"}))
+}
+
+func TestInRollout_Percentage(t *testing.T) {
+	r := NewRouter()
+	route := Route{Name: "beta.feature", Rollout: &Rollout{Percentage: 30}}
+
+	included := 0
+	for i := 0; i < 1000; i++ {
+		u := models.User{Uuid: fmt.Sprintf("U%04d", i)}
+		in := r.InRollout(route, u)
+		assert.Equal(t, in, r.InRollout(route, u), "rollout should be stable for a user")
+		if in {
+			included++
+		}
+	}
+	assert.InDelta(t, 300, included, 60)
+
+	assert.False(t, r.InRollout(Route{Name: "off", Rollout: &Rollout{}}, models.User{Uuid: "U1"}))
+}
+
+func TestInRollout_Groups(t *testing.T) {
+	db := setupTestDB(t)
+	r := NewRouter()
+	r.DbConnection = db
+
+	user := models.User{Uuid: "U_BETA"}
+	db.Create(&user)
+	group := models.Group{Name: "beta"}
+	db.Create(&group)
+	require.NoError(t, db.Model(&group).Association("Members").Append(&user))
+	other := models.User{Uuid: "U_OTHER"}
+	db.Create(&other)
+
+	route := Route{Name: "beta.feature", Rollout: &Rollout{Groups: []string{"beta"}}}
+	assert.True(t, r.InRollout(route, user))
+	assert.False(t, r.InRollout(route, other))
+}
@@ -0,0 +1,208 @@
+package router
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookPathPrefix is where webhook routes are mounted by Gadget's handler
+const WebhookPathPrefix = "/gadget/hooks/"
+
+const (
+	// WebhookAuthBearer requires an "Authorization: Bearer <Secret>" header
+	WebhookAuthBearer = "bearer"
+	// WebhookAuthHMAC requires the Unix time the request was sent in the
+	// route's TimestampHeader, and a hex encoded HMAC-SHA256 of
+	// "<timestamp>:<body>", keyed with Secret, in its SignatureHeader. A
+	// "sha256=" prefix is accepted. Requests whose timestamp is more than
+	// MaxSkew from now are rejected, so captured requests can't be replayed
+	// later.
+	WebhookAuthHMAC = "hmac"
+)
+
+// DefaultWebhookSignatureHeader carries the body signature for WebhookAuthHMAC
+// routes that don't set SignatureHeader
+const DefaultWebhookSignatureHeader = "X-Gadget-Signature"
+
+// DefaultWebhookTimestampHeader carries the signed timestamp for
+// WebhookAuthHMAC routes that don't set TimestampHeader
+const DefaultWebhookTimestampHeader = "X-Gadget-Timestamp"
+
+// DefaultWebhookMaxSkew is how far a WebhookAuthHMAC request's timestamp may
+// be from now for routes that don't set MaxSkew
+const DefaultWebhookMaxSkew = 5 * time.Minute
+
+// WebhookRoute handles HTTP requests from systems outside of Slack, such as CI
+// or alerting tools. Requests are POSTed to WebhookPathPrefix + Path with a
+// JSON body and must authenticate using Secret. Route.Pattern, Permissions and
+// Rollout are ignored, but webhooks can be disabled like any other route.
+type WebhookRoute struct {
+	Route
+	Path            string // e.g. "deploy" for /gadget/hooks/deploy
+	Auth            string // WebhookAuthBearer or WebhookAuthHMAC; empty uses WebhookAuthBearer
+	Secret          string
+	SignatureHeader string        // for WebhookAuthHMAC; empty uses DefaultWebhookSignatureHeader
+	TimestampHeader string        // for WebhookAuthHMAC; empty uses DefaultWebhookTimestampHeader
+	MaxSkew         time.Duration // for WebhookAuthHMAC; 0 uses DefaultWebhookMaxSkew
+	Plugin          func(ctx HandlerContext, req WebhookRequest)
+}
+
+// WebhookRequest is the request a WebhookRoute's Plugin receives. It is
+// copied from the HTTP request so it can be used after the response is sent.
+type WebhookRequest struct {
+	Path   string
+	Header http.Header
+	Query  url.Values
+	Body   json.RawMessage
+}
+
+// Decode unmarshals the request body into v
+func (req WebhookRequest) Decode(v interface{}) error {
+	if len(req.Body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(req.Body, v)
+}
+
+// WebhookURL describes where a webhook route can be reached
+type WebhookURL struct {
+	Name string
+	URL  string
+	Auth string
+}
+
+// Execute calls Plugin()
+func (route WebhookRoute) Execute(ctx HandlerContext, req WebhookRequest) {
+	ctx.Route = route.Route
+	route.Plugin(ctx, req)
+}
+
+// AuthMethod returns how requests to the route authenticate
+func (route WebhookRoute) AuthMethod() string {
+	if route.Auth == "" {
+		return WebhookAuthBearer
+	}
+	return route.Auth
+}
+
+// Authenticate returns true if header and body carry valid credentials for
+// the route. Routes without a Secret reject every request.
+func (route WebhookRoute) Authenticate(header http.Header, body []byte) bool {
+	return route.authenticate(header, body, time.Now())
+}
+
+func (route WebhookRoute) authenticate(header http.Header, body []byte, now time.Time) bool {
+	if route.Secret == "" {
+		return false
+	}
+
+	switch route.AuthMethod() {
+	case WebhookAuthBearer:
+		token, ok := strings.CutPrefix(header.Get("Authorization"), "Bearer ")
+		return ok && subtle.ConstantTimeCompare([]byte(token), []byte(route.Secret)) == 1
+	case WebhookAuthHMAC:
+		name := route.SignatureHeader
+		if name == "" {
+			name = DefaultWebhookSignatureHeader
+		}
+		signature, err := hex.DecodeString(strings.TrimPrefix(header.Get(name), "sha256="))
+		if err != nil {
+			return false
+		}
+		timestamp := header.Get(route.timestampHeader())
+		if !route.fresh(timestamp, now) {
+			return false
+		}
+		return hmac.Equal(signature, SignWebhook(route.Secret, timestamp, body))
+	}
+	return false
+}
+
+// SignWebhook returns the HMAC-SHA256 a WebhookAuthHMAC route keyed with
+// secret expects for body sent at timestamp, a Unix time. Senders hex encode
+// it.
+func SignWebhook(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + ":"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func (route WebhookRoute) timestampHeader() string {
+	if route.TimestampHeader == "" {
+		return DefaultWebhookTimestampHeader
+	}
+	return route.TimestampHeader
+}
+
+// fresh returns true if timestamp, a Unix time, is within the route's
+// MaxSkew of now
+func (route WebhookRoute) fresh(timestamp string, now time.Time) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	maxSkew := route.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = DefaultWebhookMaxSkew
+	}
+	skew := now.Sub(time.Unix(seconds, 0))
+	return skew <= maxSkew && skew >= -maxSkew
+}
+
+// AddWebhookRoute sets the key for WebhookRoutes to route.Path and its value
+// to route. It panics if the route has no Path or Secret, or an unknown Auth.
+func (router *Router) AddWebhookRoute(route WebhookRoute) {
+	route.Path = strings.Trim(route.Path, "/")
+	switch {
+	case route.Path == "":
+		panic(fmt.Sprintf("webhook route %s: Path is required", route.Name))
+	case route.Secret == "":
+		panic(fmt.Sprintf("webhook route %s: Secret is required", route.Name))
+	case route.AuthMethod() != WebhookAuthBearer && route.AuthMethod() != WebhookAuthHMAC:
+		panic(fmt.Sprintf("webhook route %s: unknown Auth %q", route.Name, route.Auth))
+	}
+	if router.WebhookRoutes == nil {
+		router.WebhookRoutes = make(map[string]WebhookRoute)
+	}
+	router.WebhookRoutes[route.Path] = route
+}
+
+// AddWebhookRoutes calls AddWebhookRoute for each element in routes
+func (router *Router) AddWebhookRoutes(routes []WebhookRoute) {
+	for _, route := range routes {
+		router.AddWebhookRoute(route)
+	}
+}
+
+// FindWebhookRouteByPath Returns the webhook route mounted at path, relative
+// to WebhookPathPrefix
+func (router Router) FindWebhookRouteByPath(path string) (WebhookRoute, bool) {
+	route, exists := router.WebhookRoutes[strings.Trim(path, "/")]
+	return route, exists
+}
+
+// WebhookURLs lists the URL of every webhook route, sorted by URL. baseURL is
+// where Gadget is hosted, e.g. "https://example.com".
+func (router Router) WebhookURLs(baseURL string) []WebhookURL {
+	urls := make([]WebhookURL, 0, len(router.WebhookRoutes))
+	for path, route := range router.WebhookRoutes {
+		urls = append(urls, WebhookURL{
+			Name: route.Name,
+			URL:  strings.TrimSuffix(baseURL, "/") + WebhookPathPrefix + path,
+			Auth: route.AuthMethod(),
+		})
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i].URL < urls[j].URL })
+	return urls
+}
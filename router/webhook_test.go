@@ -0,0 +1,134 @@
+package router
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(secret, timestamp string, body []byte) string {
+	return hex.EncodeToString(SignWebhook(secret, timestamp, body))
+}
+
+func TestWebhookRoute_AuthenticateBearer(t *testing.T) {
+	route := WebhookRoute{Secret: "s3cret"}
+
+	header := http.Header{}
+	assert.False(t, route.Authenticate(header, nil))
+
+	header.Set("Authorization", "Bearer wrong")
+	assert.False(t, route.Authenticate(header, nil))
+
+	header.Set("Authorization", "Bearer s3cret")
+	assert.True(t, route.Authenticate(header, nil))
+}
+
+func TestWebhookRoute_AuthenticateHMAC(t *testing.T) {
+	route := WebhookRoute{Secret: "s3cret", Auth: WebhookAuthHMAC}
+	body := []byte(`{"service":"api"}`)
+	now := time.Unix(1700000000, 0)
+
+	header := http.Header{}
+	header.Set(DefaultWebhookTimestampHeader, "1700000000")
+	header.Set(DefaultWebhookSignatureHeader, sign("s3cret", "1700000000", body))
+	assert.True(t, route.authenticate(header, body, now))
+	assert.False(t, route.authenticate(header, []byte(`{"service":"web"}`), now))
+
+	header.Set(DefaultWebhookSignatureHeader, "sha256="+sign("s3cret", "1700000000", body))
+	assert.True(t, route.authenticate(header, body, now))
+
+	header.Set(DefaultWebhookSignatureHeader, sign("other", "1700000000", body))
+	assert.False(t, route.authenticate(header, body, now))
+
+	header.Set(DefaultWebhookSignatureHeader, "not-hex")
+	assert.False(t, route.authenticate(header, body, now))
+}
+
+func TestWebhookRoute_AuthenticateHMACRejectsStaleTimestamps(t *testing.T) {
+	route := WebhookRoute{Secret: "s3cret", Auth: WebhookAuthHMAC}
+	body := []byte(`{}`)
+	now := time.Unix(1700000000, 0)
+
+	header := http.Header{}
+	header.Set(DefaultWebhookTimestampHeader, "1700000000")
+	header.Set(DefaultWebhookSignatureHeader, sign("s3cret", "1700000000", body))
+	assert.True(t, route.authenticate(header, body, now.Add(DefaultWebhookMaxSkew)))
+	assert.False(t, route.authenticate(header, body, now.Add(DefaultWebhookMaxSkew+time.Second)), "a captured request can't be replayed later")
+	assert.False(t, route.authenticate(header, body, now.Add(-DefaultWebhookMaxSkew-time.Second)))
+
+	route.MaxSkew = time.Hour
+	assert.True(t, route.authenticate(header, body, now.Add(30*time.Minute)))
+
+	// the timestamp is signed, so it can't be moved forward
+	header.Set(DefaultWebhookTimestampHeader, "1700003600")
+	assert.False(t, route.authenticate(header, body, now.Add(time.Hour)))
+
+	header.Del(DefaultWebhookTimestampHeader)
+	assert.False(t, route.authenticate(header, body, now))
+}
+
+func TestWebhookRoute_AuthenticateCustomSignatureHeader(t *testing.T) {
+	route := WebhookRoute{Secret: "s3cret", Auth: WebhookAuthHMAC, SignatureHeader: "X-Hub-Signature-256", TimestampHeader: "X-Sent-At"}
+	body := []byte(`{}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	header := http.Header{}
+	header.Set("X-Sent-At", timestamp)
+	header.Set("X-Hub-Signature-256", "sha256="+sign("s3cret", timestamp, body))
+	assert.True(t, route.Authenticate(header, body))
+}
+
+func TestWebhookRoute_NoSecretRejectsEverything(t *testing.T) {
+	route := WebhookRoute{}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer ")
+	assert.False(t, route.Authenticate(header, nil))
+}
+
+func TestWebhookRequest_Decode(t *testing.T) {
+	var v struct{ Service string }
+	assert.NoError(t, WebhookRequest{Body: []byte(`{"service":"api"}`)}.Decode(&v))
+	assert.Equal(t, "api", v.Service)
+	assert.NoError(t, WebhookRequest{}.Decode(&v))
+}
+
+func TestAddWebhookRoute(t *testing.T) {
+	var r Router
+	r.AddWebhookRoute(WebhookRoute{Route: Route{Name: "deploys.deployNotice"}, Path: "/deploy/", Secret: "s3cret"})
+
+	route, exists := r.FindWebhookRouteByPath("deploy")
+	assert.True(t, exists)
+	assert.Equal(t, "deploy", route.Path)
+	assert.Equal(t, WebhookAuthBearer, route.AuthMethod())
+}
+
+func TestAddWebhookRoute_InvalidPanics(t *testing.T) {
+	r := NewRouter()
+	assert.Panics(t, func() { r.AddWebhookRoute(WebhookRoute{Secret: "s3cret"}) })
+	assert.Panics(t, func() { r.AddWebhookRoute(WebhookRoute{Path: "deploy"}) })
+	assert.Panics(t, func() { r.AddWebhookRoute(WebhookRoute{Path: "deploy", Secret: "s3cret", Auth: "basic"}) })
+}
+
+func TestWebhookURLs(t *testing.T) {
+	r := NewRouter()
+	r.AddWebhookRoute(WebhookRoute{Route: Route{Name: "deploys.deployNotice"}, Path: "deploy", Secret: "a"})
+	r.AddWebhookRoute(WebhookRoute{Route: Route{Name: "alerts.page"}, Path: "alerts", Secret: "b", Auth: WebhookAuthHMAC})
+
+	assert.Equal(t, []WebhookURL{
+		{Name: "alerts.page", URL: "https://bot.example.com/gadget/hooks/alerts", Auth: WebhookAuthHMAC},
+		{Name: "deploys.deployNotice", URL: "https://bot.example.com/gadget/hooks/deploy", Auth: WebhookAuthBearer},
+	}, r.WebhookURLs("https://bot.example.com/"))
+}
+
+func TestRegisteredRoutes_IncludesWebhooks(t *testing.T) {
+	r := NewRouter()
+	r.AddWebhookRoute(WebhookRoute{Route: Route{Name: "deploys.deployNotice"}, Path: "deploy", Secret: "a"})
+
+	routes := r.RegisteredRoutes()
+	assert.Len(t, routes, 1)
+	assert.Equal(t, RouteTypeWebhook, routes[0].Type)
+}
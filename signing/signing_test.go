@@ -0,0 +1,114 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Unix(1700000000, 0)
+
+func signed(secret, body string, ts time.Time) http.Header {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	header := http.Header{}
+	header.Set(TimestampHeader, timestamp)
+	header.Set(SignatureHeader, "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func newTestVerifier(opts Options) *Verifier {
+	v := NewVerifier(opts)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestVerifier_AcceptsAnySecret(t *testing.T) {
+	v := newTestVerifier(Options{Secrets: []string{"new-secret", "", "old-secret"}})
+
+	assert.NoError(t, v.Verify(signed("new-secret", "body", now), []byte("body")))
+	assert.NoError(t, v.Verify(signed("old-secret", "body", now), []byte("body")))
+	assert.ErrorIs(t, v.Verify(signed("other-secret", "body", now), []byte("body")), ErrBadSignature)
+	assert.ErrorIs(t, v.Verify(signed("new-secret", "body", now), []byte("tampered")), ErrBadSignature)
+}
+
+func TestVerifier_WithoutSecrets(t *testing.T) {
+	v := newTestVerifier(Options{})
+	var nilVerifier *Verifier
+
+	assert.ErrorIs(t, v.Verify(signed("", "body", now), []byte("body")), ErrBadSignature)
+	assert.ErrorIs(t, nilVerifier.Verify(signed("", "body", now), []byte("body")), ErrBadSignature)
+}
+
+func TestVerifier_MalformedHeaders(t *testing.T) {
+	v := newTestVerifier(Options{Secrets: []string{"secret"}})
+
+	assert.ErrorIs(t, v.Verify(http.Header{}, []byte("body")), ErrMissingHeaders)
+
+	header := signed("secret", "body", now)
+	header.Set(TimestampHeader, "yesterday")
+	assert.ErrorIs(t, v.Verify(header, []byte("body")), ErrMissingHeaders)
+
+	for _, signature := range []string{"v1=abcd", "v0=not-hex", "abcd"} {
+		header := signed("secret", "body", now)
+		header.Set(SignatureHeader, signature)
+		assert.ErrorIs(t, v.Verify(header, []byte("body")), ErrBadSignature, signature)
+	}
+}
+
+func TestVerifier_Skew(t *testing.T) {
+	v := newTestVerifier(Options{Secrets: []string{"secret"}, MaxSkew: time.Minute})
+
+	assert.NoError(t, v.Verify(signed("secret", "body", now.Add(-time.Minute)), []byte("body")))
+	assert.NoError(t, v.Verify(signed("secret", "body", now.Add(time.Minute)), []byte("body")))
+	assert.ErrorIs(t, v.Verify(signed("secret", "body", now.Add(-2*time.Minute)), []byte("body")), ErrStaleTimestamp)
+	assert.ErrorIs(t, v.Verify(signed("secret", "body", now.Add(2*time.Minute)), []byte("body")), ErrStaleTimestamp)
+}
+
+func TestVerifier_DefaultSkew(t *testing.T) {
+	v := newTestVerifier(Options{Secrets: []string{"secret"}})
+
+	assert.NoError(t, v.Verify(signed("secret", "body", now.Add(-4*time.Minute)), []byte("body")))
+	assert.ErrorIs(t, v.Verify(signed("secret", "body", now.Add(-6*time.Minute)), []byte("body")), ErrStaleTimestamp)
+}
+
+func TestVerifier_ReplayProtection(t *testing.T) {
+	v := newTestVerifier(Options{Secrets: []string{"secret"}, MaxSkew: time.Minute, ReplayProtection: true})
+	header := signed("secret", "body", now)
+
+	assert.NoError(t, v.Verify(header, []byte("body")))
+	assert.ErrorIs(t, v.Verify(header, []byte("body")), ErrReplayed)
+	assert.NoError(t, v.Verify(signed("secret", "other body", now), []byte("other body")))
+	upper := header.Clone()
+	upper.Set(SignatureHeader, "v0="+strings.ToUpper(strings.TrimPrefix(header.Get(SignatureHeader), "v0=")))
+	assert.ErrorIs(t, v.Verify(upper, []byte("body")), ErrReplayed, "respelling the signature doesn't get around it")
+
+	v.now = func() time.Time { return now.Add(2 * time.Minute) }
+	assert.ErrorIs(t, v.Verify(header, []byte("body")), ErrStaleTimestamp, "once forgotten, the timestamp is stale")
+	v.Verify(signed("secret", "later", now.Add(2*time.Minute)), []byte("later")) //nolint:errcheck // only prunes
+	assert.Len(t, v.seen, 1, "stale signatures are pruned")
+}
+
+func TestVerifier_ReplaysAllowedWithoutProtection(t *testing.T) {
+	v := newTestVerifier(Options{Secrets: []string{"secret"}})
+	header := signed("secret", "body", now)
+
+	assert.NoError(t, v.Verify(header, []byte("body")))
+	assert.NoError(t, v.Verify(header, []byte("body")))
+}
+
+func TestReason(t *testing.T) {
+	assert.Equal(t, "missing_headers", Reason(ErrMissingHeaders))
+	assert.Equal(t, "stale_timestamp", Reason(ErrStaleTimestamp))
+	assert.Equal(t, "bad_signature", Reason(ErrBadSignature))
+	assert.Equal(t, "replayed", Reason(ErrReplayed))
+	assert.Equal(t, "invalid", Reason(assert.AnError))
+}
@@ -0,0 +1,424 @@
+// Package slackapi makes Slack Web API calls resilient to rate limits and
+// transient failures. It plugs into slack-go's client as its HTTP client, so
+// plugins keep using *slack.Client while every call made through it:
+//
+//   - waits for the method's tier budget before it is sent
+//   - waits, and holds back other calls to the same method, for the
+//     Retry-After period when Slack responds with 429 Too Many Requests
+//   - is retried with jittered exponential backoff on 5xx responses and
+//     network errors
+//   - is spaced at least a second apart from other messages posted to the
+//     same channel, queueing them in the order they were sent
+//
+// Slack has no idempotency keys, so a message retried after a 5xx response
+// may occasionally be posted twice.
+package slackapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gadget-bot/gadget/tracing"
+	"github.com/rs/zerolog/log"
+	"github.com/slack-go/slack"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Defaults used when the corresponding Options field is zero
+const (
+	DefaultMaxRetries      = 3
+	DefaultBaseBackoff     = 500 * time.Millisecond
+	DefaultMaxBackoff      = 30 * time.Second
+	DefaultChannelInterval = time.Second
+	// DefaultRetryAfter is used when a 429 response has no usable Retry-After
+	DefaultRetryAfter = time.Second
+)
+
+// Options configure an HTTPClient. The zero value uses the defaults.
+type Options struct {
+	MaxRetries      int             // retries after the first attempt; negative disables retries
+	BaseBackoff     time.Duration   // delay before the first retry, doubled for each retry after it
+	MaxBackoff      time.Duration   // longest delay between retries
+	ChannelInterval time.Duration   // minimum gap between messages to a channel; negative disables
+	Tiers           map[string]Tier // per-method tiers, overriding MethodTiers
+	HTTPClient      *http.Client    // sends the requests; nil uses http.DefaultClient
+	// Observer, if set, is told about every call once it's done: its
+	// method, e.g. "chat.postMessage" or "response_url", how long it took
+	// including waits and retries, and why it failed, e.g.
+	// "channel_not_found", "http_503" or "request_failed", or "" if it didn't
+	Observer func(method string, d time.Duration, errCode string)
+}
+
+func (o Options) maxRetries() int {
+	switch {
+	case o.MaxRetries < 0:
+		return 0
+	case o.MaxRetries == 0:
+		return DefaultMaxRetries
+	}
+	return o.MaxRetries
+}
+
+func (o Options) baseBackoff() time.Duration {
+	if o.BaseBackoff <= 0 {
+		return DefaultBaseBackoff
+	}
+	return o.BaseBackoff
+}
+
+func (o Options) maxBackoff() time.Duration {
+	if o.MaxBackoff <= 0 {
+		return DefaultMaxBackoff
+	}
+	return o.MaxBackoff
+}
+
+func (o Options) channelInterval() time.Duration {
+	switch {
+	case o.ChannelInterval < 0:
+		return 0
+	case o.ChannelInterval == 0:
+		return DefaultChannelInterval
+	}
+	return o.ChannelInterval
+}
+
+// HTTPClient sends Slack Web API requests within Slack's rate limits. It
+// implements the interface slack.OptionHTTPClient expects and is safe for
+// concurrent use. Use New to create a *slack.Client that uses one.
+type HTTPClient struct {
+	opts     Options
+	client   *http.Client
+	mu       sync.Mutex
+	methods  map[string]*budget
+	channels map[string]time.Time // when the next message may be posted to each channel
+
+	// replaced in tests
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+	jitter func(d time.Duration) time.Duration
+}
+
+// budget is a token bucket holding the calls a method may make right now
+type budget struct {
+	tokens       float64
+	updated      time.Time
+	blockedUntil time.Time // set from Retry-After when Slack rate limits the method
+}
+
+// NewHTTPClient returns an HTTPClient configured by opts
+func NewHTTPClient(opts Options) *HTTPClient {
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPClient{
+		opts:     opts,
+		client:   client,
+		methods:  map[string]*budget{},
+		channels: map[string]time.Time{},
+		now:      time.Now,
+		sleep:    sleepContext,
+		// equal jitter: between half and all of d
+		jitter: func(d time.Duration) time.Duration {
+			return d/2 + rand.N(d/2+1)
+		},
+	}
+}
+
+// New returns a Slack client for token whose API calls are made through an
+// HTTPClient configured by opts. options are passed on to slack.New.
+func New(token string, opts Options, options ...slack.Option) *slack.Client {
+	options = append([]slack.Option{slack.OptionHTTPClient(NewHTTPClient(opts))}, options...)
+	return slack.New(token, options...)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Do sends req once its method's budget and channel allow, retrying it
+// when Slack rate limits it or fails transiently. The response of the last
+// attempt is returned, so callers still see a slack.RateLimitedError once
+// retries run out.
+func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
+	method := methodName(req.URL)
+	name := method
+	if name == "" {
+		name = "response_url"
+	}
+	ctx, span := tracing.Tracer().Start(req.Context(), "slack "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("slack.method", name)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	resp, err := c.do(req.WithContext(ctx), method)
+	if c.opts.Observer == nil && !span.IsRecording() {
+		return resp, err
+	}
+
+	errCode := errorCode(resp, err)
+	if c.opts.Observer != nil {
+		c.opts.Observer(name, time.Since(start), errCode)
+	}
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	}
+	if errCode != "" {
+		span.SetAttributes(attribute.String("slack.error", errCode))
+		span.SetStatus(codes.Error, errCode)
+	}
+	return resp, err
+}
+
+func (c *HTTPClient) do(req *http.Request, method string) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var channel string
+	if method == "chat.postMessage" {
+		channel = channelOf(req.Header.Get("Content-Type"), body)
+	}
+
+	ctx := req.Context()
+	span := trace.SpanFromContext(ctx)
+	for attempt := 0; ; attempt++ {
+		delay := c.reserve(method, channel)
+		if delay > 0 {
+			span.AddEvent("waiting for rate limit", trace.WithAttributes(attribute.String("wait", delay.String())))
+		}
+		if err := c.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+
+		attemptReq := req.Clone(ctx)
+		if body != nil {
+			attemptReq.Body = io.NopCloser(bytes.NewReader(body))
+			attemptReq.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+		}
+		resp, err := c.client.Do(attemptReq)
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			wait = c.backoff(attempt)
+		case resp.StatusCode == http.StatusTooManyRequests:
+			// reserve waits out the block, along with every other call to the method
+			c.block(method, retryAfter(resp.Header))
+		case resp.StatusCode >= http.StatusInternalServerError:
+			wait = c.backoff(attempt)
+		default:
+			return resp, nil
+		}
+
+		if attempt >= c.opts.maxRetries() {
+			return resp, err
+		}
+		event := log.Warn().Str("method", method).Int("attempt", attempt+1).Dur("backoff", wait)
+		if err != nil {
+			event = event.Err(err)
+		} else {
+			event = event.Int("status", resp.StatusCode)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		event.Msg("Retrying Slack API call")
+		span.AddEvent("retrying", trace.WithAttributes(attribute.Int("attempt", attempt+1), attribute.String("backoff", wait.String())))
+
+		if err := c.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// reserve takes a call from method's budget and a slot in channel's queue,
+// and returns how long to wait before making the call.
+func (c *HTTPClient) reserve(method, channel string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	start := now
+	if method != "" {
+		b := c.budget(method, now)
+		if b.blockedUntil.After(start) {
+			start = b.blockedUntil
+		}
+		if tier := c.tier(method); tier != TierSpecial {
+			perCall := time.Minute / time.Duration(tier)
+			b.tokens = min(float64(tier), b.tokens+float64(now.Sub(b.updated))/float64(perCall))
+			b.updated = now
+			// the budget can go negative; later callers queue behind the debt
+			b.tokens--
+			if b.tokens < 0 {
+				if ready := now.Add(time.Duration(-b.tokens * float64(perCall))); ready.After(start) {
+					start = ready
+				}
+			}
+		}
+	}
+
+	if interval := c.opts.channelInterval(); channel != "" && interval > 0 {
+		if next := c.channels[channel]; next.After(start) {
+			start = next
+		}
+		c.channels[channel] = start.Add(interval)
+	}
+	return start.Sub(now)
+}
+
+func (c *HTTPClient) budget(method string, now time.Time) *budget {
+	b, exists := c.methods[method]
+	if !exists {
+		b = &budget{tokens: float64(c.tier(method)), updated: now}
+		c.methods[method] = b
+	}
+	return b
+}
+
+func (c *HTTPClient) tier(method string) Tier {
+	if tier, exists := c.opts.Tiers[method]; exists {
+		return tier
+	}
+	if tier, exists := MethodTiers[method]; exists {
+		return tier
+	}
+	return DefaultTier
+}
+
+// block holds back calls to method for d
+func (c *HTTPClient) block(method string, d time.Duration) {
+	if method == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	b := c.budget(method, now)
+	if until := now.Add(d); until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+}
+
+// backoff returns the jittered delay before retry number attempt+1
+func (c *HTTPClient) backoff(attempt int) time.Duration {
+	d := c.opts.baseBackoff()
+	for i := 0; i < attempt && d < c.opts.maxBackoff(); i++ {
+		d *= 2
+	}
+	return c.jitter(min(d, c.opts.maxBackoff()))
+}
+
+// retryAfter parses the Retry-After header, which Slack sends in seconds
+func retryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return DefaultRetryAfter
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// methodName returns the Web API method a request calls, e.g.
+// "chat.postMessage", or "" for requests to other URLs such as a slash
+// command's response_url.
+func methodName(u *url.URL) string {
+	name := path.Base(u.Path)
+	if !strings.Contains(name, ".") {
+		return ""
+	}
+	return name
+}
+
+// errorCode returns why a call failed, for Options.Observer: the error in
+// Slack's JSON response, "http_<status>" or "request_failed". It reads
+// resp's body to find the error and puts it back for the caller.
+func errorCode(resp *http.Response, err error) string {
+	switch {
+	case err != nil || resp == nil:
+		return "request_failed"
+	case resp.StatusCode != http.StatusOK:
+		return "http_" + strconv.Itoa(resp.StatusCode)
+	case !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json"):
+		return ""
+	}
+
+	body, readErr := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if readErr != nil {
+		return "request_failed"
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &result) != nil || result.OK {
+		return ""
+	}
+	if result.Error == "" {
+		return "unknown_error"
+	}
+	return result.Error
+}
+
+// channelOf returns the channel a chat.postMessage request posts to
+func channelOf(contentType string, body []byte) string {
+	if strings.HasPrefix(contentType, "application/json") {
+		var msg struct {
+			Channel string `json:"channel"`
+		}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return ""
+		}
+		return msg.Channel
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	return values.Get("channel")
+}
+
+// IsRateLimited returns true if err is Slack refusing a call because of its
+// rate limits, after any retries.
+func IsRateLimited(err error) bool {
+	var rateLimited *slack.RateLimitedError
+	return errors.As(err, &rateLimited)
+}
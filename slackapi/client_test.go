@@ -0,0 +1,342 @@
+package slackapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gadget-bot/gadget/gadgettest"
+	"github.com/gadget-bot/gadget/tracing"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// fakeClock stands in for time in an HTTPClient: sleeping advances it
+// instead of blocking, and every sleep is recorded.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if d > 0 {
+		f.now = f.now.Add(d)
+		f.sleeps = append(f.sleeps, d)
+	}
+	return ctx.Err()
+}
+
+func (f *fakeClock) Slept() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var total time.Duration
+	for _, d := range f.sleeps {
+		total += d
+	}
+	return total
+}
+
+// newTestClient returns a Slack client, backed by an HTTPClient using a fake
+// clock, whose calls are answered by handler
+func newTestClient(t *testing.T, opts Options, handler http.HandlerFunc) (*slack.Client, *fakeClock) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	httpClient := NewHTTPClient(opts)
+	httpClient.now = clock.Now
+	httpClient.sleep = clock.Sleep
+	httpClient.jitter = func(d time.Duration) time.Duration { return d }
+
+	return slack.New("xoxb-fake", slack.OptionHTTPClient(httpClient), slack.OptionAPIURL(server.URL+"/")), clock
+}
+
+func writeOK(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"ok":true,"channel":"C123","ts":"1111.2222"}`)) //nolint:errcheck // test HTTP response on loopback
+}
+
+func TestHTTPClient_RetriesAfterRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var texts []string
+	client, clock := newTestClient(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		mu.Lock()
+		defer mu.Unlock()
+		texts = append(texts, r.FormValue("text"))
+		if len(texts) == 1 {
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		writeOK(w)
+	})
+
+	_, ts, err := client.PostMessage("C123", slack.MsgOptionText("hello", false))
+
+	require.NoError(t, err)
+	assert.Equal(t, "1111.2222", ts)
+	assert.Equal(t, []string{"hello", "hello"}, texts, "the body is sent again on retry")
+	assert.Equal(t, 3*time.Second, clock.Slept())
+}
+
+func TestHTTPClient_RateLimitBlocksOtherCalls(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	client, clock := newTestClient(t, Options{MaxRetries: -1}, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "10")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		writeOK(w)
+	})
+
+	err := client.AddReaction("thumbsup", slack.NewRefToMessage("C123", "1.1"))
+	assert.True(t, IsRateLimited(err), "without retries the rate limit error is returned")
+
+	require.NoError(t, client.AddReaction("thumbsup", slack.NewRefToMessage("C123", "1.2")))
+	assert.Equal(t, 10*time.Second, clock.Slept(), "the next call to the method waits out Retry-After")
+}
+
+func TestHTTPClient_GivesUpAfterMaxRetries(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	client, _ := newTestClient(t, Options{MaxRetries: 2}, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, _, err := client.PostMessage("C123", slack.MsgOptionText("hello", false))
+
+	assert.True(t, IsRateLimited(err))
+	assert.Equal(t, 3, calls)
+}
+
+func TestHTTPClient_RetriesServerErrorsWithBackoff(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	client, clock := newTestClient(t, Options{BaseBackoff: time.Second, MaxBackoff: 3 * time.Second}, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls <= 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"user":{"id":"U1"}}`)) //nolint:errcheck // test HTTP response on loopback
+	})
+
+	user, err := client.GetUserInfo("U1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "U1", user.ID)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, clock.sleeps)
+}
+
+func TestHTTPClient_DoesNotRetryClientErrors(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	client, _ := newTestClient(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	_, _, err := client.PostMessage("C123", slack.MsgOptionText("hello", false))
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestHTTPClient_SpacesMessagesPerChannel(t *testing.T) {
+	client, clock := newTestClient(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+		writeOK(w)
+	})
+
+	for i := 0; i < 3; i++ {
+		_, _, err := client.PostMessage("C123", slack.MsgOptionText("hello", false))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2*time.Second, clock.Slept())
+
+	_, _, err := client.PostMessage("C456", slack.MsgOptionText("hello", false))
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, clock.Slept(), "other channels don't wait")
+}
+
+func TestHTTPClient_ChannelIntervalDisabled(t *testing.T) {
+	client, clock := newTestClient(t, Options{ChannelInterval: -1}, func(w http.ResponseWriter, r *http.Request) {
+		writeOK(w)
+	})
+
+	for i := 0; i < 3; i++ {
+		_, _, err := client.PostMessage("C123", slack.MsgOptionText("hello", false))
+		require.NoError(t, err)
+	}
+	assert.Zero(t, clock.Slept())
+}
+
+func TestHTTPClient_TierBudget(t *testing.T) {
+	client, clock := newTestClient(t, Options{Tiers: map[string]Tier{"reactions.add": 2}}, func(w http.ResponseWriter, r *http.Request) {
+		writeOK(w)
+	})
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, client.AddReaction("thumbsup", slack.NewRefToMessage("C123", "1.1")))
+	}
+
+	// two calls a minute: the burst is spent, so the third waits 30s for a call to refill
+	assert.Equal(t, 30*time.Second, clock.Slept())
+}
+
+func TestHTTPClient_ResponseURLsAreNotBudgeted(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		writeOK(w)
+	}))
+	defer server.Close()
+	client, clock := newTestClient(t, Options{}, func(w http.ResponseWriter, r *http.Request) { writeOK(w) })
+
+	for i := 0; i < 3; i++ {
+		_, _, err := client.PostMessage("C123", slack.MsgOptionText("hello", false), slack.MsgOptionResponseURL(server.URL+"/commands/T1/1/abc", slack.ResponseTypeInChannel))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, calls)
+	assert.Zero(t, clock.Slept())
+}
+
+func TestHTTPClient_ContextCancelled(t *testing.T) {
+	client, _ := newTestClient(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := client.PostMessageContext(ctx, "C123", slack.MsgOptionText("hello", false))
+
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// observedCall is a call reported to Options.Observer
+type observedCall struct {
+	method  string
+	errCode string
+}
+
+func TestHTTPClient_Observer(t *testing.T) {
+	var mu sync.Mutex
+	var observed []observedCall
+	opts := Options{MaxRetries: -1, Observer: func(method string, d time.Duration, errCode string) {
+		mu.Lock()
+		defer mu.Unlock()
+		observed = append(observed, observedCall{method, errCode})
+	}}
+	client, _ := newTestClient(t, opts, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chat.postMessage":
+			writeOK(w)
+		case "/users.info":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"ok":false,"error":"user_not_found"}`)) //nolint:errcheck // test HTTP response on loopback
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+
+	_, _, err := client.PostMessage("C123", slack.MsgOptionText("hello", false))
+	require.NoError(t, err)
+	_, err = client.GetUserInfo("U404")
+	assert.EqualError(t, err, "user_not_found", "the response body is put back for slack-go to read")
+	_, err = client.GetConversationInfo(&slack.GetConversationInfoInput{ChannelID: "C123"})
+	assert.Error(t, err)
+
+	assert.Equal(t, []observedCall{
+		{"chat.postMessage", ""},
+		{"users.info", "user_not_found"},
+		{"conversations.info", "http_503"},
+	}, observed)
+}
+
+func TestHTTPClient_ObserverNamesResponseURLs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { writeOK(w) }))
+	defer server.Close()
+	var methods []string
+	opts := Options{Observer: func(method string, d time.Duration, errCode string) {
+		methods = append(methods, method)
+	}}
+	client, _ := newTestClient(t, opts, func(w http.ResponseWriter, r *http.Request) { writeOK(w) })
+
+	_, _, err := client.PostMessage("C123", slack.MsgOptionText("hello", false), slack.MsgOptionResponseURL(server.URL+"/commands/T1/1/abc", slack.ResponseTypeInChannel))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"response_url"}, methods)
+}
+
+func TestTier(t *testing.T) {
+	c := NewHTTPClient(Options{Tiers: map[string]Tier{"users.list": Tier4}})
+
+	assert.Equal(t, Tier4, c.tier("users.list"), "Options.Tiers overrides MethodTiers")
+	assert.Equal(t, Tier2, c.tier("conversations.list"))
+	assert.Equal(t, TierSpecial, c.tier("chat.postMessage"))
+	assert.Equal(t, DefaultTier, c.tier("apps.unknown"))
+}
+
+func TestMethodName(t *testing.T) {
+	for raw, want := range map[string]string{
+		"https://slack.com/api/chat.postMessage":           "chat.postMessage",
+		"http://127.0.0.1:1234/users.info":                 "users.info",
+		"https://hooks.slack.com/commands/T123/456/abcdef": "",
+	} {
+		req, err := http.NewRequest(http.MethodPost, raw, nil)
+		require.NoError(t, err)
+		assert.Equal(t, want, methodName(req.URL), raw)
+	}
+}
+
+func TestHTTPClient_Traces(t *testing.T) {
+	spans := gadgettest.RecordSpans(t)
+	client, _ := newTestClient(t, Options{MaxRetries: 1}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`)) //nolint:errcheck // test HTTP response on loopback
+	})
+
+	ctx, parent := tracing.Tracer().Start(context.Background(), "plugin")
+	_, _, err := client.PostMessageContext(ctx, "C404", slack.MsgOptionText("hello", false))
+	parent.End()
+
+	assert.EqualError(t, err, "channel_not_found")
+	span := gadgettest.FindSpan(spans.Ended(), "slack chat.postMessage")
+	require.NotNil(t, span)
+	assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Equal(t, "channel_not_found", span.Status().Description)
+}
@@ -0,0 +1,46 @@
+package slackapi
+
+// Tier is one of Slack's Web API rate limit tiers, as the number of calls
+// to a method allowed per minute. See https://api.slack.com/apis/rate-limits
+type Tier int
+
+const (
+	// TierSpecial methods have their own limits rather than a per-method
+	// budget. chat.postMessage, for instance, is limited per channel.
+	TierSpecial Tier = 0
+	Tier1       Tier = 1
+	Tier2       Tier = 20
+	Tier3       Tier = 50
+	Tier4       Tier = 100
+)
+
+// DefaultTier applies to methods that aren't in MethodTiers
+const DefaultTier = Tier3
+
+// MethodTiers lists the tier of the Web API methods Gadget and its plugins
+// commonly call. Options.Tiers can add to or override it.
+var MethodTiers = map[string]Tier{
+	"auth.test":             TierSpecial,
+	"chat.delete":           Tier3,
+	"chat.getPermalink":     TierSpecial,
+	"chat.postEphemeral":    Tier4,
+	"chat.postMessage":      TierSpecial,
+	"chat.scheduleMessage":  Tier3,
+	"chat.update":           Tier3,
+	"conversations.history": Tier3,
+	"conversations.info":    Tier3,
+	"conversations.join":    Tier3,
+	"conversations.list":    Tier2,
+	"conversations.members": Tier4,
+	"conversations.open":    Tier3,
+	"conversations.replies": Tier3,
+	"reactions.add":         Tier3,
+	"reactions.remove":      Tier2,
+	"users.info":            Tier4,
+	"users.list":            Tier2,
+	"users.lookupByEmail":   Tier3,
+	"users.profile.get":     Tier4,
+	"views.open":            Tier4,
+	"views.publish":         Tier4,
+	"views.update":          Tier4,
+}
@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// Where the before callback leaves a statement's span, and the context it
+// replaced so the after callback can put it back
+const (
+	dbSpanKey   = "gadget:tracing_span"
+	dbParentKey = "gadget:tracing_parent"
+)
+
+// InstrumentDB traces every statement db runs as a child of the span in
+// the statement's context, so queries made with db.WithContext(ctx) show up
+// under the work that made them. Instrumenting db again is harmless.
+func InstrumentDB(db *gorm.DB) error {
+	if db == nil {
+		return nil
+	}
+	cb := db.Callback()
+	for _, op := range []struct {
+		name      string
+		processor processor
+		before    registerFunc
+		after     registerFunc
+	}{
+		{"create", cb.Create(), cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query(), cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update(), cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete(), cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row(), cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw(), cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	} {
+		if err := register(op.processor, op.before, "gadget:tracing_before_"+op.name, startSpan(op.name)); err != nil {
+			return err
+		}
+		if err := register(op.processor, op.after, "gadget:tracing_after_"+op.name, endSpan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processor is the part of GORM's callback processors InstrumentDB uses
+type processor interface {
+	Get(name string) func(*gorm.DB)
+	Replace(name string, fn func(*gorm.DB)) error
+}
+
+type registerFunc func(name string, fn func(*gorm.DB)) error
+
+// register registers fn as name with add, or replaces the fn already
+// registered as name, which keeps its place in the chain
+func register(p processor, add registerFunc, name string, fn func(*gorm.DB)) error {
+	if p.Get(name) != nil {
+		return p.Replace(name, fn)
+	}
+	return add(name, fn)
+}
+
+func startSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement == nil || db.Statement.Context == nil {
+			return
+		}
+		ctx, span := Tracer().Start(db.Statement.Context, "db."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system.name", db.Dialector.Name()),
+				attribute.String("db.operation.name", operation),
+			),
+		)
+		db.InstanceSet(dbParentKey, db.Statement.Context)
+		db.InstanceSet(dbSpanKey, span)
+		db.Statement.Context = ctx
+	}
+}
+
+func endSpan(db *gorm.DB) {
+	v, ok := db.InstanceGet(dbSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+	if parent, ok := db.InstanceGet(dbParentKey); ok {
+		db.Statement.Context = parent.(context.Context)
+	}
+	if db.Statement.Table != "" {
+		span.SetAttributes(attribute.String("db.collection.name", db.Statement.Table))
+	}
+	span.SetAttributes(
+		attribute.String("db.query.text", db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type widget struct {
+	ID   uint
+	Name string
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&widget{}))
+	return db
+}
+
+func TestInstrumentDB(t *testing.T) {
+	db := openDB(t)
+	require.NoError(t, InstrumentDB(db))
+	require.NoError(t, InstrumentDB(db), "instrumenting again replaces the callbacks")
+	rec := recordSpans(t)
+
+	ctx, parent := Tracer().Start(context.Background(), "request")
+	require.NoError(t, db.WithContext(ctx).Create(&widget{Name: "sprocket"}).Error)
+	var w widget
+	require.NoError(t, db.WithContext(ctx).First(&w).Error)
+	assert.Error(t, db.WithContext(ctx).Exec("SELECT * FROM gadgets").Error)
+	parent.End()
+
+	spans := rec.Ended()
+	require.Len(t, spans, 4)
+	for i, name := range []string{"db.create", "db.query", "db.raw"} {
+		assert.Equal(t, name, spans[i].Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[i].Parent().SpanID(), name)
+		assert.Equal(t, "sqlite", attr(spans[i], "db.system.name").AsString())
+	}
+	assert.Equal(t, "widgets", attr(spans[1], "db.collection.name").AsString())
+	assert.Contains(t, attr(spans[1], "db.query.text").AsString(), "SELECT * FROM `widgets`")
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+}
+
+func TestInstrumentDB_StatementsDontNest(t *testing.T) {
+	db := openDB(t)
+	require.NoError(t, InstrumentDB(db))
+	rec := recordSpans(t)
+
+	ctx, parent := Tracer().Start(context.Background(), "request")
+	tx := db.WithContext(ctx).Model(&widget{})
+	var count int64
+	require.NoError(t, tx.Count(&count).Error)
+	require.NoError(t, tx.Count(&count).Error)
+	parent.End()
+
+	spans := rec.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[1].Parent().SpanID(), "a reused statement is traced under the original parent")
+}
@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordSpans sends spans to a recorder for the rest of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return rec
+}
+
+// attr returns the value of the attribute key on span
+func attr(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestSetup_Off(t *testing.T) {
+	stop, err := Setup(context.Background(), "")
+
+	require.NoError(t, err)
+	assert.NoError(t, stop(context.Background()))
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), "zipkin")
+
+	assert.ErrorContains(t, err, `unknown tracing exporter "zipkin"`)
+}
+
+func TestSetup_Stdout(t *testing.T) {
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	stop, err := Setup(context.Background(), ExporterStdout)
+
+	require.NoError(t, err)
+	_, span := Tracer().Start(context.Background(), "test")
+	assert.True(t, span.IsRecording())
+	span.End()
+	assert.NoError(t, stop(context.Background()))
+}
+
+func TestTraceID(t *testing.T) {
+	recordSpans(t)
+	ctx, span := Tracer().Start(context.Background(), "test")
+	defer span.End()
+
+	assert.Equal(t, span.SpanContext().TraceID().String(), TraceID(ctx))
+	assert.Empty(t, TraceID(context.Background()))
+}
+
+func TestHandler(t *testing.T) {
+	rec := recordSpans(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hooks/{name}", func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, trace.SpanFromContext(r.Context()).IsRecording(), "the handler runs in the request's span")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	handler := Handler(mux)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/hooks/deploy", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/broken", nil))
+
+	spans := rec.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "POST /hooks/{name}", spans[0].Name())
+	assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	assert.Equal(t, int64(http.StatusAccepted), attr(spans[0], "http.response.status_code").AsInt64())
+	assert.Equal(t, "/hooks/deploy", attr(spans[0], "url.path").AsString())
+	assert.Equal(t, "GET /broken", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestHandler_ContinuesPropagatedTrace(t *testing.T) {
+	rec := recordSpans(t)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	Handler(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+}